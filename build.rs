@@ -7,4 +7,15 @@ fn main() {
         &["./pitaya-protos"],
     )
     .unwrap();
+
+    // The example protos are also in the protos package, they are generated apart to not collide.
+    let example_out = std::path::Path::new(&std::env::var("OUT_DIR").unwrap()).join("example");
+    std::fs::create_dir_all(&example_out).unwrap();
+    prost_build::Config::new()
+        .out_dir(example_out)
+        .compile_protos(
+            &["./example-pitaya-server/protos/cluster.proto"],
+            &["./example-pitaya-server/protos"],
+        )
+        .unwrap();
 }
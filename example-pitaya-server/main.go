@@ -1,64 +1,617 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
 	"strings"
+	"time"
 
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/rustgen"
 	"github.com/leohahn/pitaya-rs/example-pitaya-server/services"
+	nats "github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/topfreegames/pitaya"
-	"github.com/topfreegames/pitaya/acceptor"
+	"github.com/topfreegames/pitaya/cluster"
 	"github.com/topfreegames/pitaya/component"
+	"github.com/topfreegames/pitaya/constants"
+	"github.com/topfreegames/pitaya/logger"
+	pitayapipeline "github.com/topfreegames/pitaya/pipeline"
 	"github.com/topfreegames/pitaya/serialize/protobuf"
+	"github.com/topfreegames/pitaya/session"
 )
 
-func configureBackend() {
-	room := services.NewRoom()
-	pitaya.Register(room,
-		component.WithName("room"),
+var appLogger = services.NewSlogLogger(slog.Default())
+
+func newRateLimiter() *services.RateLimiter {
+	return services.RateLimit(services.RateLimitOptions{
+		Default: services.RateLimitRule{Rate: 100, Burst: 100},
+		Routes: map[string]services.RateLimitRule{
+			services.RemoteFuncRoute: {Rate: 10, Burst: 10},
+		},
+	})
+}
+
+// newValidator validates the messages of the routes with validate tags, see protos/cluster.proto
+func newValidator() *services.Validator {
+	return services.NewValidator("room.room.message", services.RemoteFuncRoute)
+}
+
+// newConcurrencyLimiter caps the calls of the expensive remotes so they don't starve the others
+func newConcurrencyLimiter() *services.ConcurrencyLimiter {
+	return services.NewConcurrencyLimiter(services.ConcurrencyOptions{
+		Routes: map[string]services.ConcurrencyRule{
+			"room.room.streamrpc": {Limit: 8, Queue: 32},
+		},
+	})
+}
+
+// schemaVersion is the version of the messages of the remotes, it is bumped when they change
+const schemaVersion = 1
+
+// schemaMigrations convert the messages between consecutive schema versions, each bump of
+// schemaVersion registers the upgrade of the requests and the downgrade of the answers
+var schemaMigrations = []struct {
+	from, to int
+	migrate  services.MigrationFunc
+}{}
+
+// newMigrations upgrades the messages of the callers at older schema versions to schemaVersion
+func newMigrations() *services.Migrations {
+	migrations := services.NewMigrations(schemaVersion)
+	for _, m := range schemaMigrations {
+		migrations.RegisterMigration(m.from, m.to, m.migrate)
+	}
+	return migrations
+}
+
+// newMetrics serves the call metrics on port, nil is returned when port is 0
+func newMetrics(svType string, port int) *services.Metrics {
+	if port == 0 {
+		return nil
+	}
+	registry := prometheus.NewRegistry()
+	metrics, err := services.NewMetrics(svType, registry)
+	if err != nil {
+		logger.Log.Fatalf("error registering metrics: %s", err.Error())
+	}
+	server := services.ServeMetrics(fmt.Sprintf(":%d", port), registry)
+	go func() {
+		if err := server.ListenAndServe(); err != nil {
+			logger.Log.Errorf("metrics server: %s", err.Error())
+		}
+	}()
+	pitaya.AfterHandler(metrics.AfterHandler)
+	return metrics
+}
+
+var (
+	natsOnce       sync.Once
+	natsConnection *nats.Conn
+)
+
+// natsConn returns a connection to the nats server of the cluster, pitaya does not expose its own
+// connections. It must be called once pitaya is configured.
+func natsConn() *nats.Conn {
+	natsOnce.Do(func() {
+		conn, err := nats.Connect(pitaya.GetConfig().GetString("pitaya.cluster.rpc.client.nats.connect"), nats.MaxReconnects(-1))
+		if err != nil {
+			logger.Log.Fatalf("error connecting to nats: %s", err.Error())
+		}
+		natsConnection = conn
+	})
+	return natsConnection
+}
+
+// configureDiscovery sets the service discovery of pitaya, reading the servers from the file at path
+// instead of etcd when it is set
+func configureDiscovery(path string) cluster.ServiceDiscovery {
+	var sd cluster.ServiceDiscovery
+	if path != "" {
+		discovery, err := services.NewFileDiscovery(path, services.DefaultDiscoveryReload, appLogger)
+		if err != nil {
+			logger.Log.Fatalf("error reading discovery file: %s", err.Error())
+		}
+		sd = services.NewPitayaServiceDiscovery(discovery, pitaya.GetServer())
+	} else {
+		etcd, err := cluster.NewEtcdServiceDiscovery(pitaya.GetConfig(), pitaya.GetServer(), pitaya.GetDieChan())
+		if err != nil {
+			logger.Log.Fatalf("error creating service discovery: %s", err.Error())
+		}
+		sd = etcd
+	}
+	pitaya.SetServiceDiscoveryClient(sd)
+	return sd
+}
+
+// configureHealth serves on port the health of the server, which needs a server of each of requiredTypes
+// and fails while the connector, if any, is draining. Nothing is served when port is 0.
+func configureHealth(port int, sd cluster.ServiceDiscovery, connector *services.Connector, requiredTypes ...string) {
+	if port == 0 {
+		return
+	}
+	health := services.NewHealth(sd, requiredTypes...)
+	health.AddCheck("discovery", services.DiscoveryCheck(sd, pitaya.GetServerID()))
+	health.AddCheck("rpc", services.NATSCheck(natsConn()))
+	if connector != nil {
+		health.AddCheck("draining", connector.DrainingCheck())
+	}
+
+	server := services.ServeHealth(fmt.Sprintf(":%d", port), health)
+	go func() {
+		if err := server.ListenAndServe(); err != nil {
+			logger.Log.Errorf("health server: %s", err.Error())
+		}
+	}()
+}
+
+// newAuthenticator returns the authenticator verifying tokens signed with secret or by the keys
+// published at jwksURL, nil is returned when neither is set
+func newAuthenticator(secret, jwksURL string) services.Authenticator {
+	switch {
+	case jwksURL != "":
+		return services.NewJWTAuthenticator(services.NewJWKSKeyProvider(jwksURL, time.Minute))
+	case secret != "":
+		return services.NewJWTAuthenticator(services.StaticKey([]byte(secret)))
+	}
+	return nil
+}
+
+// registerRemote registers c under the routes derived from name, conflicting routes stop the server
+func registerRemote(routes *services.Routes, c component.Component, name string) {
+	err := routes.RegisterRemote(c,
+		component.WithName(name),
 		component.WithNameFunc(strings.ToLower),
 	)
+	if err != nil {
+		logger.Log.Fatalf("error registering remote %s: %s", name, err.Error())
+	}
+}
+
+func configureBackend(routes *services.Routes, authenticated bool) {
+	pitaya.BeforeHandler(newRateLimiter().BeforeHandler)
+	if authenticated {
+		pitaya.BeforeHandler(services.RequireAuth(
+			"room.room.join",
+			"room.room.message",
+			"room.room.sendrpc",
+			"room.room.streamrpc",
+		))
+	}
+	pitaya.BeforeHandler(newValidator().BeforeHandler)
 
-	pitaya.RegisterRemote(room,
+	room := services.NewRoom(services.WithRoomLogger(appLogger))
+	pitaya.Register(room,
 		component.WithName("room"),
 		component.WithNameFunc(strings.ToLower),
 	)
+	registerRoomRemotes(routes, room)
+}
+
+func registerRoomRemotes(routes *services.Routes, room *services.Room) {
+	registerRemote(routes, room, "room")
+	registerRemote(routes, room.StreamReceiver(), "streamreceiver")
+}
+
+// newSessionStore returns the store of the session data, publishing its changes on pubsub so
+// other nodes can watch them
+func newSessionStore(redisAddr string, ttl time.Duration, pubsub services.PubSub) services.SessionStore {
+	var store services.SessionStore = services.NewMemorySessionStore(ttl)
+	if redisAddr != "" {
+		store = services.NewRedisSessionStore(redisAddr, ttl)
+	}
+	return services.NewWatchedSessionStore(store, pubsub, services.DefaultWatchDebounce)
+}
+
+// newIdempotencyCache returns the cache of the answers to requests sent with an idempotency key,
+// shared by the connectors when they use redis
+func newIdempotencyCache(redisAddr string) services.IdempotencyCache {
+	if redisAddr != "" {
+		return services.NewRedisIdempotencyCache(redisAddr)
+	}
+	return services.NewMemoryIdempotencyCache()
+}
+
+// newClusterTLS loads the certificates of the rpcs between the servers, reloading them on SIGHUP.
+// nil is returned when ca is empty, the rpcs go over nats without tls then.
+func newClusterTLS(ca, cert, key string, requireClientCert bool) *services.ClusterTLS {
+	if ca == "" {
+		return nil
+	}
+	clusterTLS, err := services.NewClusterTLS(services.ClusterTLSOptions{
+		CAFile:            ca,
+		CertFile:          cert,
+		KeyFile:           key,
+		RequireClientCert: requireClientCert,
+	})
+	if err != nil {
+		logger.Log.Fatalf("error loading cluster certificates: %s", err.Error())
+	}
+	clusterTLS.ReloadOn(appLogger, syscall.SIGHUP)
+	return clusterTLS
 }
 
-func configureFrontend(port int) {
-	ws := acceptor.NewWSAcceptor(fmt.Sprintf(":%d", port))
-	pitaya.Register(&services.Connector{},
+// grpcHost returns host, or the hostname of the machine when it is empty
+func grpcHost(host string) string {
+	if host != "" {
+		return host
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		logger.Log.Fatalf("error reading hostname: %s", err.Error())
+	}
+	return hostname
+}
+
+// newListeners returns the listeners of the connector, a port of 0 disables its listener.
+// They use tls when cert and key are set.
+func newListeners(wsPort, tcpPort int, cert, key string) services.ListenerOptions {
+	var opts services.ListenerOptions
+	if wsPort != 0 {
+		opts.WSAddr = fmt.Sprintf(":%d", wsPort)
+	}
+	if tcpPort != 0 {
+		opts.TCPAddr = fmt.Sprintf(":%d", tcpPort)
+	}
+	if cert != "" || key != "" {
+		crt, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			logger.Log.Fatalf("error loading tls certificate: %s", err.Error())
+		}
+		opts.TLS = &tls.Config{Certificates: []tls.Certificate{crt}}
+	}
+	return opts
+}
+
+func configureFrontend(
+	routes *services.Routes,
+	listeners services.ListenerOptions,
+	store services.SessionStore,
+	drainTimeout time.Duration,
+	idleTimeout, idleGrace time.Duration,
+	orderedPushes bool,
+	sendBuffer int,
+	overflow services.OverflowPolicy,
+	sessionPolicy services.SessionPolicy,
+	sd cluster.ServiceDiscovery,
+	redactor *services.Redactor,
+	metrics *services.Metrics,
+	authenticator services.Authenticator,
+	limit *services.MessageLimit,
+) *services.Connector {
+	acceptors := services.NewAcceptors(listeners)
+	if len(acceptors) == 0 {
+		logger.Log.Fatal("the connector needs a websocket or a tcp port")
+	}
+	opts := []services.ConnectorOption{
+		services.WithAcceptors(acceptors...),
+		services.WithDrainTimeout(drainTimeout),
+		services.WithIdleTimeout(idleTimeout, idleGrace),
+		services.WithLogger(appLogger),
+		services.WithRedactor(redactor),
+		services.OnSessionDisconnect(func(s *session.Session, reason services.DisconnectReason) {
+			appLogger.Info("session disconnected", "uid", s.UID(), "reason", reason.String())
+		}),
+		services.OnUndeliverable(func(uid, route string, payload []byte) {
+			appLogger.Warn("dropped push to a disconnected session", "uid", uid, "route", route, "size", len(payload))
+		}),
+	}
+	if authenticator != nil {
+		opts = append(opts, services.WithAuthenticator(authenticator))
+	}
+	if orderedPushes {
+		opts = append(opts, services.WithOrderedPushes())
+	}
+	if sendBuffer > 0 {
+		opts = append(opts, services.WithSendBuffer(sendBuffer, overflow))
+	}
+	if sessionPolicy != services.SessionAllow {
+		opts = append(opts,
+			services.WithSingleSession(sessionPolicy),
+			services.WithSessionPeers(sd, pitaya.GetServer(), pitaya.RPCTo),
+		)
+	}
+	connector := services.NewConnector(store, opts...)
+	pitaya.Register(connector,
 		component.WithName("connector"),
 		component.WithNameFunc(strings.ToLower),
 	)
-	pitaya.RegisterRemote(&services.ConnectorRemote{},
-		component.WithName("connectorremote"),
-		component.WithNameFunc(strings.ToLower),
-	)
+	// the clients spamming the handlers of the connector are limited here, the handlers forwarded
+	// to the backends are limited there
+	limiter := newRateLimiter()
+	pitaya.BeforeHandler(limiter.BeforeHandler)
+	remoteOpts := []services.RemoteOption{
+		services.WithRateLimiter(limiter),
+		services.WithValidator(newValidator()),
+	}
+	if metrics != nil {
+		remoteOpts = append(remoteOpts, services.WithMetrics(metrics))
+		if sendBuffer > 0 {
+			if err := metrics.WatchSendBuffers(connector); err != nil {
+				logger.Log.Fatalf("error registering send buffer metrics: %s", err.Error())
+			}
+		}
+	}
+	registerConnectorRemotes(routes, services.NewConnectorRemote(connector, remoteOpts...))
+	if authenticator != nil {
+		registerRemote(routes, services.NewAdminRemote(connector, authenticator), "adminremote")
+	}
+
+	for _, a := range acceptors {
+		pitaya.AddAcceptor(connector.WrapAcceptor(limit.WrapAcceptor(a)))
+	}
+	return connector
+}
+
+func registerConnectorRemotes(routes *services.Routes, remote *services.ConnectorRemote) {
+	registerRemote(routes, remote, "connectorremote")
+	// RemoteFunc receives raw messages, pitaya only derives routes for remotes receiving proto messages
+	if err := routes.HandleRemote("connectorremote.remotefunc", remote, "RemoteFuncBytes"); err != nil {
+		logger.Log.Fatalf("error registering remote: %s", err.Error())
+	}
+}
 
-	pitaya.AddAcceptor(ws)
+// rustExcluded are the routes used by the go servers among themselves, they get no rust bindings
+var rustExcluded = []string{
+	"connector.connectorremote.claimsession",
+	"connector.connectorremote.openstream",
+	"room.streamreceiver.frame",
+}
+
+// writeRustBindings writes the rust bindings of the remotes registered by the connector and the room servers
+func writeRustBindings(w io.Writer) error {
+	connector := services.NewRoutes()
+	registerConnectorRemotes(connector, services.NewConnectorRemote(services.NewConnector(nil)))
+	room := services.NewRoutes()
+	registerRoomRemotes(room, services.NewRoom())
+
+	return rustgen.Generate(w, []rustgen.Server{
+		{Type: "connector", Remotes: connector.Remotes()},
+		{Type: "room", Remotes: room.Remotes()},
+	}, rustgen.Options{
+		Exclude: rustExcluded,
+		Protos:  map[string]string{"protos": "crate::example_protos"},
+	})
+}
+
+// generateRustBindings writes the rust bindings to path, the server is not started
+func generateRustBindings(path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		logger.Log.Fatalf("error creating rust bindings: %s", err.Error())
+	}
+	defer f.Close()
+	if err := writeRustBindings(f); err != nil {
+		logger.Log.Fatalf("error generating rust bindings: %s", err.Error())
+	}
+}
+
+// configureRPC sets the rpc server and client, compressing the messages exchanged with the other servers
+// and failing fast the calls to servers that keep failing
+func configureRPC(
+	routes *services.Routes,
+	compression *services.Compression,
+	pipeline *services.Pipeline,
+	limit *services.MessageLimit,
+	breaker *services.CircuitBreaker,
+	connector *services.Connector,
+	sd cluster.ServiceDiscovery,
+	clusterTLS *services.ClusterTLS,
+	grpcPort int,
+) {
+	var rpcServer cluster.RPCServer
+	var rpcClient cluster.RPCClient
+	if clusterTLS != nil {
+		// the rpcs go over grpc with mutual tls instead of nats
+		rpcServer = services.NewTLSGRPCServer(fmt.Sprintf(":%d", grpcPort), clusterTLS)
+		tlsClient := services.NewTLSGRPCClient(pitaya.GetServer(), clusterTLS, 0, nil)
+		sd.AddListener(tlsClient)
+		rpcClient = tlsClient
+	} else {
+		natsServer, err := cluster.NewNatsRPCServer(
+			pitaya.GetConfig(),
+			pitaya.GetServer(),
+			pitaya.GetMetricsReporters(),
+			pitaya.GetDieChan(),
+		)
+		if err != nil {
+			logger.Log.Fatalf("error starting cluster rpc server component: %s", err.Error())
+		}
+		natsClient, err := cluster.NewNatsRPCClient(
+			pitaya.GetConfig(),
+			pitaya.GetServer(),
+			pitaya.GetMetricsReporters(),
+			pitaya.GetDieChan(),
+		)
+		if err != nil {
+			logger.Log.Fatalf("error starting cluster rpc client component: %s", err.Error())
+		}
+		rpcServer, rpcClient = natsServer, natsClient
+	}
+	// messages are decompressed and their size checked before the batches are split, then each call
+	// is acked when it is a notify and goes through the middlewares, which run before the routes
+	server := routes.WrapRPCServer(pipeline.WrapRPCServer(services.AckNotifies(services.ServeBatches(limit.WrapRPCServer(compression.WrapRPCServer(rpcServer))), appLogger)))
+	if connector != nil {
+		server = connector.WrapRPCServer(server)
+	}
+	pitaya.SetRPCServer(server)
+
+	client := services.TraceRPCClient(breaker.WrapRPCClient(compression.WrapRPCClient(rpcClient)))
+	if connector != nil {
+		client = connector.WrapRPCClient(client)
+		configureDrain(connector)
+	}
+	pitaya.SetRPCClient(client)
+}
+
+// configureDrain makes the connector drain its sessions when receiving SIGUSR1 and then stop.
+// pitaya closes every session as soon as it gets a SIGTERM, so the drain has to be triggered
+// before it, e.g. by a preStop hook.
+//
+// SIGUSR2 toggles the draining state instead, the sessions stay connected until they leave.
+func configureDrain(connector *services.Connector) {
+	sg := make(chan os.Signal, 1)
+	signal.Notify(sg, syscall.SIGUSR1)
+	go func() {
+		<-sg
+		if err := connector.GracefulShutdown(context.Background()); err != nil {
+			logger.Log.Warnf("connector shutdown: %s", err.Error())
+		}
+		pitaya.Shutdown()
+	}()
+
+	toggle := make(chan os.Signal, 1)
+	signal.Notify(toggle, syscall.SIGUSR2)
+	go func() {
+		for range toggle {
+			connector.SetDraining(!connector.DrainStatus().Draining)
+		}
+	}()
+}
+
+// configureAdmin serves on port the admin endpoints of the connector, nothing is served when port is 0.
+// The sessions are only served when the admins can be authenticated.
+func configureAdmin(port int, connector *services.Connector, authenticator services.Authenticator) {
+	if port == 0 {
+		return
+	}
+	var admin *services.AdminRemote
+	if authenticator != nil {
+		admin = services.NewAdminRemote(connector, authenticator)
+	}
+	server := services.ServeAdmin(fmt.Sprintf(":%d", port), connector, admin)
+	go func() {
+		if err := server.ListenAndServe(); err != nil {
+			logger.Log.Errorf("admin server: %s", err.Error())
+		}
+	}()
 }
 
 func main() {
-	port := flag.Int("port", 3250, "the port to listen")
+	port := flag.Int("port", 3250, "the port listening to websocket clients, disabled if 0")
+	tcpPort := flag.Int("tcpport", 0, "the port listening to tcp clients, disabled if 0")
+	clusterCA := flag.String("clusterca", "", "the ca bundle of the certificates of the servers, the rpcs go over grpc with mutual tls instead of nats when it is set")
+	clusterCert := flag.String("clustercert", "", "the certificate presented to the other servers, reloaded on SIGHUP")
+	clusterKey := flag.String("clusterkey", "", "the key of the clustercert certificate")
+	clusterRequireClientCert := flag.Bool("clusterrequireclientcert", true, "if the callers must present a certificate signed by clusterca")
+	grpcPort := flag.Int("grpcport", 3434, "the port of the grpc rpc server when the rpcs use mutual tls")
+	grpcHostFlag := flag.String("grpchost", "", "the host the other servers reach the grpc rpc server at, the hostname if empty")
+	tlsCert := flag.String("tlscert", "", "the certificate file of the client listeners, which use tls when it is set")
+	tlsKey := flag.String("tlskey", "", "the key file of the tlscert certificate")
 	svType := flag.String("type", "connector", "the server type")
 	isFrontend := flag.Bool("frontend", true, "if server is frontend")
+	redisAddr := flag.String("redis", "", "the redis address used to persist sessions, sessions are kept in memory if empty")
+	sessionTTL := flag.Duration("sessionttl", 24*time.Hour, "how long the data of a disconnected session is kept")
+	drainTimeout := flag.Duration("draintimeout", services.DefaultDrainTimeout, "how long to wait for in flight calls when draining")
+	idleTimeout := flag.Duration("idletimeout", 2*time.Minute, "how long a connection can be idle before being pinged, never pinged if 0")
+	idleGrace := flag.Duration("idlegrace", 30*time.Second, "how long a pinged connection has to answer before being closed, never closed if 0")
+	orderedPushes := flag.Bool("orderedpushes", false, "if the pushes to a session are delivered in the order they were sent")
+	sendBuffer := flag.Int("sendbuffer", 0, "how many pushes are buffered per session for slow clients, unbounded if 0")
+	overflow := flag.String("overflow", services.OverflowBlock.String(), "what a push to a full send buffer does: block, drop-oldest, drop-newest or disconnect")
+	singleSession := flag.String("singlesession", services.SessionAllow.String(), "what binding an uid connected to any connector does: allow, reject the new session or replace the old one")
+	sensitiveKeys := flag.String("sensitivekeys", strings.Join(services.DefaultSensitiveKeys, ","), "the comma separated session data keys redacted from the logs and the admin remotes")
+	discoveryFile := flag.String("discoveryfile", "", "the json file listing the servers of the cluster, etcd is used if empty")
+	metricsPort := flag.Int("metricsport", 0, "the port serving prometheus metrics, disabled if 0")
+	healthPort := flag.Int("healthport", 0, "the port serving the /healthz and /livez probes, disabled if 0")
+	adminPort := flag.Int("adminport", 0, "the port serving the admin endpoints of the connector, disabled if 0")
+	jwtSecret := flag.String("jwtsecret", "", "the secret verifying the tokens of the clients")
+	jwksURL := flag.String("jwksurl", "", "the url of the key set verifying the tokens of the clients, overrides jwtsecret")
+	maxDeadline := flag.Duration("maxdeadline", services.DefaultMaxDeadline, "how long remotes can take at most, unlimited if 0")
+	maxMessageSize := flag.Int("maxmessagesize", services.DefaultMaxMessageSize, "the size of the largest message accepted or answered, unlimited if 0")
+	compressMinSize := flag.Int("compressminsize", services.DefaultCompressionMinSize, "the size from which rpc messages are compressed")
+	idempotencyTTL := flag.Duration("idempotencyttl", services.DefaultIdempotencyTTL, "how long the answers of requests sent with an idempotency key are kept")
+	breakerFailures := flag.Int("breakerfailures", 5, "the consecutive failures after which calls to a server fail fast, never if 0")
+	breakerCooldown := flag.Duration("breakercooldown", services.DefaultBreakerCooldown, "how long calls to a failing server fail fast before probing it")
+	rustBindings := flag.String("rustbindings", "", "writes the rust bindings of the remotes to this path and exits")
 
 	flag.Parse()
 
+	if *rustBindings != "" {
+		generateRustBindings(*rustBindings)
+		return
+	}
+
 	defer pitaya.Shutdown()
 
+	overflowPolicy, err := services.ParseOverflowPolicy(*overflow)
+	if err != nil {
+		logger.Log.Fatalf("invalid overflow: %s", err.Error())
+	}
+	sessionPolicy, err := services.ParseSessionPolicy(*singleSession)
+	if err != nil {
+		logger.Log.Fatalf("invalid singlesession: %s", err.Error())
+	}
+	redactor := services.NewRedactor(strings.Split(*sensitiveKeys, ",")...)
+	appLogger = redactor.Logger(appLogger)
+
 	ser := protobuf.NewSerializer()
 
 	pitaya.SetSerializer(ser)
 
+	metrics := newMetrics(*svType, *metricsPort)
+	concurrency := newConcurrencyLimiter()
+	if metrics != nil {
+		if err := metrics.WatchConcurrency(concurrency); err != nil {
+			logger.Log.Fatalf("error registering concurrency metrics: %s", err.Error())
+		}
+	}
+
+	// spans are reported to the global opentelemetry tracer provider, set with otel.SetTracerProvider,
+	// none are while it is not set. The handlers of the frontends are traced by the pipeline too.
+	pipeline := services.NewPipeline(services.Tracing(), services.Recovery(appLogger), services.Deadline(*maxDeadline), concurrency.Middleware(), services.RequestScope())
+	authenticator := newAuthenticator(*jwtSecret, *jwksURL)
+	limit := services.NewMessageLimit(*maxMessageSize)
+	pitaya.AfterHandler(limit.AfterHandler)
+
+	compression := services.NewCompression(services.CompressionOptions{
+		MinSize: *compressMinSize,
+		MaxSize: *maxMessageSize,
+		Codecs:  []services.Codec{services.NewZstdCodec(), services.NewGzipCodec()},
+	})
+	metadata := map[string]string{
+		services.AcceptEncodingKey: compression.AcceptEncoding(),
+	}
+	clusterTLS := newClusterTLS(*clusterCA, *clusterCert, *clusterKey, *clusterRequireClientCert)
+	if clusterTLS != nil {
+		metadata[constants.GRPCHostKey] = grpcHost(*grpcHostFlag)
+		metadata[constants.GRPCPortKey] = fmt.Sprint(*grpcPort)
+	}
+	pitaya.Configure(*isFrontend, *svType, pitaya.Cluster, metadata)
+
+	sd := configureDiscovery(*discoveryFile)
+	routes := services.NewRoutes()
+	var connector *services.Connector
 	if !*isFrontend {
-		configureBackend()
+		configureBackend(routes, authenticator != nil)
 	} else {
-		configureFrontend(*port)
+		store := newSessionStore(*redisAddr, *sessionTTL, services.NewNATSPubSub(natsConn()))
+		// the idempotent answers are kept at the current version and downgraded for each caller
+		pipeline.Use(newMigrations().Middleware())
+		pipeline.Use(services.Idempotent(newIdempotencyCache(*redisAddr), *idempotencyTTL, appLogger))
+		listeners := newListeners(*port, *tcpPort, *tlsCert, *tlsKey)
+		connector = configureFrontend(routes, listeners, store, *drainTimeout, *idleTimeout, *idleGrace, *orderedPushes, *sendBuffer, overflowPolicy, sessionPolicy, sd, redactor, metrics, authenticator, limit)
+		// the handlers of the frontend go through the middlewares too, the forwarded ones do in
+		// the rpc server of the backend. The other after handlers get the answer of the pipeline.
+		handlers := pipeline.Handlers(ser)
+		pitaya.BeforeHandler(handlers.BeforeHandler)
+		pitayapipeline.AfterHandler.PushFront(handlers.AfterHandler)
 	}
 
-	pitaya.Configure(*isFrontend, *svType, pitaya.Cluster, map[string]string{})
+	if *isFrontend {
+		configureHealth(*healthPort, sd, connector, "room")
+		configureAdmin(*adminPort, connector, authenticator)
+	} else {
+		configureHealth(*healthPort, sd, nil)
+	}
+	breaker := services.NewCircuitBreaker(services.BreakerOptions{Failures: *breakerFailures, Cooldown: *breakerCooldown})
+	configureRPC(routes, compression, pipeline, limit, breaker, connector, sd, clusterTLS, *grpcPort)
 	pitaya.Start()
 }
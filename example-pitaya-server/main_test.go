@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/services"
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+	e "github.com/topfreegames/pitaya/errors"
+)
+
+var update = flag.Bool("update", false, "rewrites the golden files")
+
+// rustBindingsGolden is the module of the crate with the generated bindings
+const rustBindingsGolden = "../src/remotes.rs"
+
+func TestRustBindings(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeRustBindings(&out); err != nil {
+		t.Fatal(err)
+	}
+	if *update {
+		if err := ioutil.WriteFile(rustBindingsGolden, out.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	golden, err := ioutil.ReadFile(rustBindingsGolden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), golden) {
+		t.Fatalf("%s is out of date, run go test -update:\n%s", rustBindingsGolden, out.String())
+	}
+}
+
+func TestValidator(t *testing.T) {
+	validator := newValidator()
+
+	ctx := pcontext.AddToPropagateCtx(context.Background(), constants.RouteKey, "room.room.message")
+	_, err := validator.BeforeHandler(ctx, &protos.UserMessage{Content: strings.Repeat("a", 1025)})
+	pitayaErr, ok := err.(*e.Error)
+	if !ok || pitayaErr.Code != e.ErrBadRequestCode {
+		t.Fatalf("expected the message to be rejected, got %v", err)
+	}
+	for _, field := range []string{"UserMessage.Name", "UserMessage.Content"} {
+		if !strings.Contains(pitayaErr.Metadata["fields"], field) {
+			t.Fatalf("expected %s to fail, got %s", field, pitayaErr.Metadata["fields"])
+		}
+	}
+	if _, err := validator.BeforeHandler(ctx, &protos.UserMessage{Name: "bob", Content: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := validator.Validate(services.RemoteFuncRoute, &protos.RPCMsg{Msg: strings.Repeat("a", 1025)}); err == nil {
+		t.Fatal("expected the remote message to be rejected")
+	}
+}
@@ -31,7 +31,7 @@ func (m *Response) Reset()         { *m = Response{} }
 func (m *Response) String() string { return proto.CompactTextString(m) }
 func (*Response) ProtoMessage()    {}
 func (*Response) Descriptor() ([]byte, []int) {
-	return fileDescriptor_cluster_95360d360239b954, []int{0}
+	return fileDescriptor_cluster_6fa07ec195d60ad3, []int{0}
 }
 func (m *Response) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_Response.Unmarshal(m, b)
@@ -65,10 +65,59 @@ func (m *Response) GetMsg() string {
 	return ""
 }
 
+// BytesResponse is a Response keeping Msg as bytes, both are encoded the same way
+type BytesResponse struct {
+	Code                 int32    `protobuf:"varint,1,opt,name=Code,proto3" json:"Code,omitempty"`
+	Msg                  []byte   `protobuf:"bytes,2,opt,name=Msg,proto3" json:"Msg,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BytesResponse) Reset()         { *m = BytesResponse{} }
+func (m *BytesResponse) String() string { return proto.CompactTextString(m) }
+func (*BytesResponse) ProtoMessage()    {}
+func (*BytesResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_cluster_6fa07ec195d60ad3, []int{1}
+}
+func (m *BytesResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BytesResponse.Unmarshal(m, b)
+}
+func (m *BytesResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BytesResponse.Marshal(b, m, deterministic)
+}
+func (dst *BytesResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BytesResponse.Merge(dst, src)
+}
+func (m *BytesResponse) XXX_Size() int {
+	return xxx_messageInfo_BytesResponse.Size(m)
+}
+func (m *BytesResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_BytesResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BytesResponse proto.InternalMessageInfo
+
+func (m *BytesResponse) GetCode() int32 {
+	if m != nil {
+		return m.Code
+	}
+	return 0
+}
+
+func (m *BytesResponse) GetMsg() []byte {
+	if m != nil {
+		return m.Msg
+	}
+	return nil
+}
+
 // UserMessage represents a message that user sent
 type UserMessage struct {
-	Name                 string   `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
-	Content              string   `protobuf:"bytes,2,opt,name=Content,proto3" json:"Content,omitempty"`
+	// @inject_tag: validate:"required,max=32"
+	Name string `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty" validate:"required,max=32"`
+	// @inject_tag: validate:"required,max=1024"
+	Content              string   `protobuf:"bytes,2,opt,name=Content,proto3" json:"Content,omitempty" validate:"required,max=1024"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -78,7 +127,7 @@ func (m *UserMessage) Reset()         { *m = UserMessage{} }
 func (m *UserMessage) String() string { return proto.CompactTextString(m) }
 func (*UserMessage) ProtoMessage()    {}
 func (*UserMessage) Descriptor() ([]byte, []int) {
-	return fileDescriptor_cluster_95360d360239b954, []int{1}
+	return fileDescriptor_cluster_6fa07ec195d60ad3, []int{2}
 }
 func (m *UserMessage) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_UserMessage.Unmarshal(m, b)
@@ -124,7 +173,7 @@ func (m *NewUser) Reset()         { *m = NewUser{} }
 func (m *NewUser) String() string { return proto.CompactTextString(m) }
 func (*NewUser) ProtoMessage()    {}
 func (*NewUser) Descriptor() ([]byte, []int) {
-	return fileDescriptor_cluster_95360d360239b954, []int{2}
+	return fileDescriptor_cluster_6fa07ec195d60ad3, []int{3}
 }
 func (m *NewUser) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_NewUser.Unmarshal(m, b)
@@ -152,8 +201,9 @@ func (m *NewUser) GetContent() string {
 }
 
 type RPCMsg struct {
-	Route                string   `protobuf:"bytes,1,opt,name=Route,proto3" json:"Route,omitempty"`
-	Msg                  string   `protobuf:"bytes,2,opt,name=Msg,proto3" json:"Msg,omitempty"`
+	Route string `protobuf:"bytes,1,opt,name=Route,proto3" json:"Route,omitempty"`
+	// @inject_tag: validate:"max=1024"
+	Msg                  string   `protobuf:"bytes,2,opt,name=Msg,proto3" json:"Msg,omitempty" validate:"max=1024"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -163,7 +213,7 @@ func (m *RPCMsg) Reset()         { *m = RPCMsg{} }
 func (m *RPCMsg) String() string { return proto.CompactTextString(m) }
 func (*RPCMsg) ProtoMessage()    {}
 func (*RPCMsg) Descriptor() ([]byte, []int) {
-	return fileDescriptor_cluster_95360d360239b954, []int{3}
+	return fileDescriptor_cluster_6fa07ec195d60ad3, []int{4}
 }
 func (m *RPCMsg) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_RPCMsg.Unmarshal(m, b)
@@ -209,7 +259,7 @@ func (m *AllMembers) Reset()         { *m = AllMembers{} }
 func (m *AllMembers) String() string { return proto.CompactTextString(m) }
 func (*AllMembers) ProtoMessage()    {}
 func (*AllMembers) Descriptor() ([]byte, []int) {
-	return fileDescriptor_cluster_95360d360239b954, []int{4}
+	return fileDescriptor_cluster_6fa07ec195d60ad3, []int{5}
 }
 func (m *AllMembers) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_AllMembers.Unmarshal(m, b)
@@ -236,28 +286,715 @@ func (m *AllMembers) GetMembers() []string {
 	return nil
 }
 
+// StreamOpen starts a streaming remote whose frames are sent to ReplyRoute in ReplyServerID
+type StreamOpen struct {
+	StreamID      string `protobuf:"bytes,1,opt,name=StreamID,proto3" json:"StreamID,omitempty"`
+	ReplyServerID string `protobuf:"bytes,2,opt,name=ReplyServerID,proto3" json:"ReplyServerID,omitempty"`
+	ReplyRoute    string `protobuf:"bytes,3,opt,name=ReplyRoute,proto3" json:"ReplyRoute,omitempty"`
+	Message       []byte `protobuf:"bytes,4,opt,name=Message,proto3" json:"Message,omitempty"`
+	// Route is the item stream started, RemoteFuncStream is started when empty
+	Route                string   `protobuf:"bytes,5,opt,name=Route,proto3" json:"Route,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *StreamOpen) Reset()         { *m = StreamOpen{} }
+func (m *StreamOpen) String() string { return proto.CompactTextString(m) }
+func (*StreamOpen) ProtoMessage()    {}
+func (*StreamOpen) Descriptor() ([]byte, []int) {
+	return fileDescriptor_cluster_6fa07ec195d60ad3, []int{6}
+}
+func (m *StreamOpen) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StreamOpen.Unmarshal(m, b)
+}
+func (m *StreamOpen) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StreamOpen.Marshal(b, m, deterministic)
+}
+func (dst *StreamOpen) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StreamOpen.Merge(dst, src)
+}
+func (m *StreamOpen) XXX_Size() int {
+	return xxx_messageInfo_StreamOpen.Size(m)
+}
+func (m *StreamOpen) XXX_DiscardUnknown() {
+	xxx_messageInfo_StreamOpen.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StreamOpen proto.InternalMessageInfo
+
+func (m *StreamOpen) GetStreamID() string {
+	if m != nil {
+		return m.StreamID
+	}
+	return ""
+}
+
+func (m *StreamOpen) GetReplyServerID() string {
+	if m != nil {
+		return m.ReplyServerID
+	}
+	return ""
+}
+
+func (m *StreamOpen) GetReplyRoute() string {
+	if m != nil {
+		return m.ReplyRoute
+	}
+	return ""
+}
+
+func (m *StreamOpen) GetMessage() []byte {
+	if m != nil {
+		return m.Message
+	}
+	return nil
+}
+
+func (m *StreamOpen) GetRoute() string {
+	if m != nil {
+		return m.Route
+	}
+	return ""
+}
+
+// StreamFrame is a message of a streaming remote, the last frame has End set
+type StreamFrame struct {
+	StreamID string    `protobuf:"bytes,1,opt,name=StreamID,proto3" json:"StreamID,omitempty"`
+	Seq      int64     `protobuf:"varint,2,opt,name=Seq,proto3" json:"Seq,omitempty"`
+	Response *Response `protobuf:"bytes,3,opt,name=Response,proto3" json:"Response,omitempty"`
+	End      bool      `protobuf:"varint,4,opt,name=End,proto3" json:"End,omitempty"`
+	Error    string    `protobuf:"bytes,5,opt,name=Error,proto3" json:"Error,omitempty"`
+	// Items are the marshaled items of an item stream
+	Items                [][]byte `protobuf:"bytes,6,rep,name=Items,proto3" json:"Items,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *StreamFrame) Reset()         { *m = StreamFrame{} }
+func (m *StreamFrame) String() string { return proto.CompactTextString(m) }
+func (*StreamFrame) ProtoMessage()    {}
+func (*StreamFrame) Descriptor() ([]byte, []int) {
+	return fileDescriptor_cluster_6fa07ec195d60ad3, []int{7}
+}
+func (m *StreamFrame) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StreamFrame.Unmarshal(m, b)
+}
+func (m *StreamFrame) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StreamFrame.Marshal(b, m, deterministic)
+}
+func (dst *StreamFrame) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StreamFrame.Merge(dst, src)
+}
+func (m *StreamFrame) XXX_Size() int {
+	return xxx_messageInfo_StreamFrame.Size(m)
+}
+func (m *StreamFrame) XXX_DiscardUnknown() {
+	xxx_messageInfo_StreamFrame.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StreamFrame proto.InternalMessageInfo
+
+func (m *StreamFrame) GetStreamID() string {
+	if m != nil {
+		return m.StreamID
+	}
+	return ""
+}
+
+func (m *StreamFrame) GetSeq() int64 {
+	if m != nil {
+		return m.Seq
+	}
+	return 0
+}
+
+func (m *StreamFrame) GetResponse() *Response {
+	if m != nil {
+		return m.Response
+	}
+	return nil
+}
+
+func (m *StreamFrame) GetEnd() bool {
+	if m != nil {
+		return m.End
+	}
+	return false
+}
+
+func (m *StreamFrame) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *StreamFrame) GetItems() [][]byte {
+	if m != nil {
+		return m.Items
+	}
+	return nil
+}
+
+// AuthRequest authenticates the session with a signed token
+type AuthRequest struct {
+	Token                string   `protobuf:"bytes,1,opt,name=Token,proto3" json:"Token,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AuthRequest) Reset()         { *m = AuthRequest{} }
+func (m *AuthRequest) String() string { return proto.CompactTextString(m) }
+func (*AuthRequest) ProtoMessage()    {}
+func (*AuthRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_cluster_6fa07ec195d60ad3, []int{8}
+}
+func (m *AuthRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AuthRequest.Unmarshal(m, b)
+}
+func (m *AuthRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AuthRequest.Marshal(b, m, deterministic)
+}
+func (dst *AuthRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AuthRequest.Merge(dst, src)
+}
+func (m *AuthRequest) XXX_Size() int {
+	return xxx_messageInfo_AuthRequest.Size(m)
+}
+func (m *AuthRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_AuthRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AuthRequest proto.InternalMessageInfo
+
+func (m *AuthRequest) GetToken() string {
+	if m != nil {
+		return m.Token
+	}
+	return ""
+}
+
+// BatchCall is a call of a BatchRequest
+type BatchCall struct {
+	Route                string   `protobuf:"bytes,1,opt,name=Route,proto3" json:"Route,omitempty"`
+	Data                 []byte   `protobuf:"bytes,2,opt,name=Data,proto3" json:"Data,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BatchCall) Reset()         { *m = BatchCall{} }
+func (m *BatchCall) String() string { return proto.CompactTextString(m) }
+func (*BatchCall) ProtoMessage()    {}
+func (*BatchCall) Descriptor() ([]byte, []int) {
+	return fileDescriptor_cluster_6fa07ec195d60ad3, []int{9}
+}
+func (m *BatchCall) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BatchCall.Unmarshal(m, b)
+}
+func (m *BatchCall) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BatchCall.Marshal(b, m, deterministic)
+}
+func (dst *BatchCall) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BatchCall.Merge(dst, src)
+}
+func (m *BatchCall) XXX_Size() int {
+	return xxx_messageInfo_BatchCall.Size(m)
+}
+func (m *BatchCall) XXX_DiscardUnknown() {
+	xxx_messageInfo_BatchCall.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BatchCall proto.InternalMessageInfo
+
+func (m *BatchCall) GetRoute() string {
+	if m != nil {
+		return m.Route
+	}
+	return ""
+}
+
+func (m *BatchCall) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+// BatchRequest carries several calls to the same server in one rpc
+type BatchRequest struct {
+	Calls                []*BatchCall `protobuf:"bytes,1,rep,name=Calls,proto3" json:"Calls,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *BatchRequest) Reset()         { *m = BatchRequest{} }
+func (m *BatchRequest) String() string { return proto.CompactTextString(m) }
+func (*BatchRequest) ProtoMessage()    {}
+func (*BatchRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_cluster_6fa07ec195d60ad3, []int{10}
+}
+func (m *BatchRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BatchRequest.Unmarshal(m, b)
+}
+func (m *BatchRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BatchRequest.Marshal(b, m, deterministic)
+}
+func (dst *BatchRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BatchRequest.Merge(dst, src)
+}
+func (m *BatchRequest) XXX_Size() int {
+	return xxx_messageInfo_BatchRequest.Size(m)
+}
+func (m *BatchRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_BatchRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BatchRequest proto.InternalMessageInfo
+
+func (m *BatchRequest) GetCalls() []*BatchCall {
+	if m != nil {
+		return m.Calls
+	}
+	return nil
+}
+
+// BatchResult is the answer of a BatchCall, either its data or the pitaya error it failed with
+type BatchResult struct {
+	Data                 []byte            `protobuf:"bytes,1,opt,name=Data,proto3" json:"Data,omitempty"`
+	ErrorCode            string            `protobuf:"bytes,2,opt,name=ErrorCode,proto3" json:"ErrorCode,omitempty"`
+	ErrorMsg             string            `protobuf:"bytes,3,opt,name=ErrorMsg,proto3" json:"ErrorMsg,omitempty"`
+	ErrorMetadata        map[string]string `protobuf:"bytes,4,rep,name=ErrorMetadata,proto3" json:"ErrorMetadata,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *BatchResult) Reset()         { *m = BatchResult{} }
+func (m *BatchResult) String() string { return proto.CompactTextString(m) }
+func (*BatchResult) ProtoMessage()    {}
+func (*BatchResult) Descriptor() ([]byte, []int) {
+	return fileDescriptor_cluster_6fa07ec195d60ad3, []int{11}
+}
+func (m *BatchResult) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BatchResult.Unmarshal(m, b)
+}
+func (m *BatchResult) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BatchResult.Marshal(b, m, deterministic)
+}
+func (dst *BatchResult) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BatchResult.Merge(dst, src)
+}
+func (m *BatchResult) XXX_Size() int {
+	return xxx_messageInfo_BatchResult.Size(m)
+}
+func (m *BatchResult) XXX_DiscardUnknown() {
+	xxx_messageInfo_BatchResult.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BatchResult proto.InternalMessageInfo
+
+func (m *BatchResult) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *BatchResult) GetErrorCode() string {
+	if m != nil {
+		return m.ErrorCode
+	}
+	return ""
+}
+
+func (m *BatchResult) GetErrorMsg() string {
+	if m != nil {
+		return m.ErrorMsg
+	}
+	return ""
+}
+
+func (m *BatchResult) GetErrorMetadata() map[string]string {
+	if m != nil {
+		return m.ErrorMetadata
+	}
+	return nil
+}
+
+// BatchResponse has the results of the calls of a BatchRequest, in the same order
+type BatchResponse struct {
+	Results              []*BatchResult `protobuf:"bytes,1,rep,name=Results,proto3" json:"Results,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *BatchResponse) Reset()         { *m = BatchResponse{} }
+func (m *BatchResponse) String() string { return proto.CompactTextString(m) }
+func (*BatchResponse) ProtoMessage()    {}
+func (*BatchResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_cluster_6fa07ec195d60ad3, []int{12}
+}
+func (m *BatchResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BatchResponse.Unmarshal(m, b)
+}
+func (m *BatchResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BatchResponse.Marshal(b, m, deterministic)
+}
+func (dst *BatchResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BatchResponse.Merge(dst, src)
+}
+func (m *BatchResponse) XXX_Size() int {
+	return xxx_messageInfo_BatchResponse.Size(m)
+}
+func (m *BatchResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_BatchResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BatchResponse proto.InternalMessageInfo
+
+func (m *BatchResponse) GetResults() []*BatchResult {
+	if m != nil {
+		return m.Results
+	}
+	return nil
+}
+
+// ListSessionsRequest lists the sessions of a connector whose uid starts with UID, with the
+// session data under Keys. Token authenticates the admin.
+type ListSessionsRequest struct {
+	Token                string   `protobuf:"bytes,1,opt,name=Token,proto3" json:"Token,omitempty"`
+	UID                  string   `protobuf:"bytes,2,opt,name=UID,proto3" json:"UID,omitempty"`
+	Keys                 []string `protobuf:"bytes,3,rep,name=Keys,proto3" json:"Keys,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListSessionsRequest) Reset()         { *m = ListSessionsRequest{} }
+func (m *ListSessionsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListSessionsRequest) ProtoMessage()    {}
+func (*ListSessionsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_cluster_6fa07ec195d60ad3, []int{13}
+}
+func (m *ListSessionsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListSessionsRequest.Unmarshal(m, b)
+}
+func (m *ListSessionsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListSessionsRequest.Marshal(b, m, deterministic)
+}
+func (dst *ListSessionsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListSessionsRequest.Merge(dst, src)
+}
+func (m *ListSessionsRequest) XXX_Size() int {
+	return xxx_messageInfo_ListSessionsRequest.Size(m)
+}
+func (m *ListSessionsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListSessionsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListSessionsRequest proto.InternalMessageInfo
+
+func (m *ListSessionsRequest) GetToken() string {
+	if m != nil {
+		return m.Token
+	}
+	return ""
+}
+
+func (m *ListSessionsRequest) GetUID() string {
+	if m != nil {
+		return m.UID
+	}
+	return ""
+}
+
+func (m *ListSessionsRequest) GetKeys() []string {
+	if m != nil {
+		return m.Keys
+	}
+	return nil
+}
+
+// SessionInfo describes a session, Data holds the json of the requested keys of its data
+type SessionInfo struct {
+	UID        string `protobuf:"bytes,1,opt,name=UID,proto3" json:"UID,omitempty"`
+	RemoteAddr string `protobuf:"bytes,2,opt,name=RemoteAddr,proto3" json:"RemoteAddr,omitempty"`
+	// ConnectedAt is when the session was bound, in unix milliseconds
+	ConnectedAt          int64             `protobuf:"varint,3,opt,name=ConnectedAt,proto3" json:"ConnectedAt,omitempty"`
+	Data                 map[string]string `protobuf:"bytes,4,rep,name=Data,proto3" json:"Data,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *SessionInfo) Reset()         { *m = SessionInfo{} }
+func (m *SessionInfo) String() string { return proto.CompactTextString(m) }
+func (*SessionInfo) ProtoMessage()    {}
+func (*SessionInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_cluster_6fa07ec195d60ad3, []int{14}
+}
+func (m *SessionInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SessionInfo.Unmarshal(m, b)
+}
+func (m *SessionInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SessionInfo.Marshal(b, m, deterministic)
+}
+func (dst *SessionInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SessionInfo.Merge(dst, src)
+}
+func (m *SessionInfo) XXX_Size() int {
+	return xxx_messageInfo_SessionInfo.Size(m)
+}
+func (m *SessionInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_SessionInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SessionInfo proto.InternalMessageInfo
+
+func (m *SessionInfo) GetUID() string {
+	if m != nil {
+		return m.UID
+	}
+	return ""
+}
+
+func (m *SessionInfo) GetRemoteAddr() string {
+	if m != nil {
+		return m.RemoteAddr
+	}
+	return ""
+}
+
+func (m *SessionInfo) GetConnectedAt() int64 {
+	if m != nil {
+		return m.ConnectedAt
+	}
+	return 0
+}
+
+func (m *SessionInfo) GetData() map[string]string {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+// SessionList has the sessions answered to a ListSessionsRequest, sorted by uid
+type SessionList struct {
+	Sessions             []*SessionInfo `protobuf:"bytes,1,rep,name=Sessions,proto3" json:"Sessions,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *SessionList) Reset()         { *m = SessionList{} }
+func (m *SessionList) String() string { return proto.CompactTextString(m) }
+func (*SessionList) ProtoMessage()    {}
+func (*SessionList) Descriptor() ([]byte, []int) {
+	return fileDescriptor_cluster_6fa07ec195d60ad3, []int{15}
+}
+func (m *SessionList) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SessionList.Unmarshal(m, b)
+}
+func (m *SessionList) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SessionList.Marshal(b, m, deterministic)
+}
+func (dst *SessionList) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SessionList.Merge(dst, src)
+}
+func (m *SessionList) XXX_Size() int {
+	return xxx_messageInfo_SessionList.Size(m)
+}
+func (m *SessionList) XXX_DiscardUnknown() {
+	xxx_messageInfo_SessionList.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SessionList proto.InternalMessageInfo
+
+func (m *SessionList) GetSessions() []*SessionInfo {
+	if m != nil {
+		return m.Sessions
+	}
+	return nil
+}
+
+// KickSessionRequest closes the session of UID for Reason. Token authenticates the admin.
+type KickSessionRequest struct {
+	Token                string   `protobuf:"bytes,1,opt,name=Token,proto3" json:"Token,omitempty"`
+	UID                  string   `protobuf:"bytes,2,opt,name=UID,proto3" json:"UID,omitempty"`
+	Reason               string   `protobuf:"bytes,3,opt,name=Reason,proto3" json:"Reason,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *KickSessionRequest) Reset()         { *m = KickSessionRequest{} }
+func (m *KickSessionRequest) String() string { return proto.CompactTextString(m) }
+func (*KickSessionRequest) ProtoMessage()    {}
+func (*KickSessionRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_cluster_6fa07ec195d60ad3, []int{16}
+}
+func (m *KickSessionRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_KickSessionRequest.Unmarshal(m, b)
+}
+func (m *KickSessionRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_KickSessionRequest.Marshal(b, m, deterministic)
+}
+func (dst *KickSessionRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_KickSessionRequest.Merge(dst, src)
+}
+func (m *KickSessionRequest) XXX_Size() int {
+	return xxx_messageInfo_KickSessionRequest.Size(m)
+}
+func (m *KickSessionRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_KickSessionRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_KickSessionRequest proto.InternalMessageInfo
+
+func (m *KickSessionRequest) GetToken() string {
+	if m != nil {
+		return m.Token
+	}
+	return ""
+}
+
+func (m *KickSessionRequest) GetUID() string {
+	if m != nil {
+		return m.UID
+	}
+	return ""
+}
+
+func (m *KickSessionRequest) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+// SessionClaim asks a connector about its session of UID before another connector binds it,
+// the session is kicked when Replace is set
+type SessionClaim struct {
+	UID                  string   `protobuf:"bytes,1,opt,name=UID,proto3" json:"UID,omitempty"`
+	Replace              bool     `protobuf:"varint,2,opt,name=Replace,proto3" json:"Replace,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SessionClaim) Reset()         { *m = SessionClaim{} }
+func (m *SessionClaim) String() string { return proto.CompactTextString(m) }
+func (*SessionClaim) ProtoMessage()    {}
+func (*SessionClaim) Descriptor() ([]byte, []int) {
+	return fileDescriptor_cluster_6fa07ec195d60ad3, []int{17}
+}
+func (m *SessionClaim) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SessionClaim.Unmarshal(m, b)
+}
+func (m *SessionClaim) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SessionClaim.Marshal(b, m, deterministic)
+}
+func (dst *SessionClaim) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SessionClaim.Merge(dst, src)
+}
+func (m *SessionClaim) XXX_Size() int {
+	return xxx_messageInfo_SessionClaim.Size(m)
+}
+func (m *SessionClaim) XXX_DiscardUnknown() {
+	xxx_messageInfo_SessionClaim.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SessionClaim proto.InternalMessageInfo
+
+func (m *SessionClaim) GetUID() string {
+	if m != nil {
+		return m.UID
+	}
+	return ""
+}
+
+func (m *SessionClaim) GetReplace() bool {
+	if m != nil {
+		return m.Replace
+	}
+	return false
+}
+
 func init() {
 	proto.RegisterType((*Response)(nil), "protos.Response")
+	proto.RegisterType((*BytesResponse)(nil), "protos.BytesResponse")
 	proto.RegisterType((*UserMessage)(nil), "protos.UserMessage")
 	proto.RegisterType((*NewUser)(nil), "protos.NewUser")
 	proto.RegisterType((*RPCMsg)(nil), "protos.RPCMsg")
 	proto.RegisterType((*AllMembers)(nil), "protos.AllMembers")
+	proto.RegisterType((*StreamOpen)(nil), "protos.StreamOpen")
+	proto.RegisterType((*StreamFrame)(nil), "protos.StreamFrame")
+	proto.RegisterType((*AuthRequest)(nil), "protos.AuthRequest")
+	proto.RegisterType((*BatchCall)(nil), "protos.BatchCall")
+	proto.RegisterType((*BatchRequest)(nil), "protos.BatchRequest")
+	proto.RegisterType((*BatchResult)(nil), "protos.BatchResult")
+	proto.RegisterMapType((map[string]string)(nil), "protos.BatchResult.ErrorMetadataEntry")
+	proto.RegisterType((*BatchResponse)(nil), "protos.BatchResponse")
+	proto.RegisterType((*ListSessionsRequest)(nil), "protos.ListSessionsRequest")
+	proto.RegisterType((*SessionInfo)(nil), "protos.SessionInfo")
+	proto.RegisterMapType((map[string]string)(nil), "protos.SessionInfo.DataEntry")
+	proto.RegisterType((*SessionList)(nil), "protos.SessionList")
+	proto.RegisterType((*KickSessionRequest)(nil), "protos.KickSessionRequest")
+	proto.RegisterType((*SessionClaim)(nil), "protos.SessionClaim")
 }
 
-func init() { proto.RegisterFile("cluster.proto", fileDescriptor_cluster_95360d360239b954) }
-
-var fileDescriptor_cluster_95360d360239b954 = []byte{
-	// 192 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x8f, 0x31, 0xab, 0x83, 0x30,
-	0x14, 0x85, 0xc9, 0xf3, 0xa9, 0xcf, 0xfb, 0x28, 0x94, 0xd0, 0x21, 0xa3, 0x58, 0x28, 0x4e, 0x45,
-	0xe8, 0xd8, 0xa9, 0x38, 0x47, 0x4a, 0xa0, 0x3f, 0x40, 0xdb, 0x8b, 0x8b, 0x1a, 0xc9, 0x8d, 0xf4,
-	0xef, 0x97, 0x44, 0x85, 0x16, 0x3a, 0xe5, 0x3b, 0x70, 0xbe, 0x43, 0x2e, 0x6c, 0xee, 0xdd, 0x44,
-	0x16, 0xcd, 0x71, 0x34, 0xda, 0x6a, 0x1e, 0xf9, 0x87, 0xb2, 0x02, 0xfe, 0x14, 0xd2, 0xa8, 0x07,
-	0x42, 0xce, 0xe1, 0xb7, 0xd4, 0x0f, 0x14, 0x2c, 0x65, 0x79, 0xa8, 0x3c, 0xf3, 0x2d, 0x04, 0x92,
-	0x5a, 0xf1, 0x93, 0xb2, 0x3c, 0x51, 0x0e, 0xb3, 0x33, 0xfc, 0xdf, 0x08, 0x8d, 0x44, 0xa2, 0xba,
-	0xf5, 0x52, 0x55, 0xf7, 0xb3, 0x94, 0x28, 0xcf, 0x5c, 0x40, 0x5c, 0xea, 0xc1, 0xe2, 0x60, 0x17,
-	0x71, 0x8d, 0xd9, 0x1e, 0xe2, 0x0a, 0x9f, 0xce, 0x7f, 0x2f, 0xb1, 0xcf, 0x52, 0x01, 0x91, 0xba,
-	0x96, 0x92, 0x5a, 0xbe, 0x83, 0x50, 0xe9, 0xc9, 0xae, 0xeb, 0x73, 0xf8, 0xf2, 0xa7, 0x03, 0xc0,
-	0xa5, 0xeb, 0x24, 0xf6, 0x0d, 0x1a, 0x72, 0xcb, 0x0b, 0x0a, 0x96, 0x06, 0x6e, 0x79, 0x89, 0xcd,
-	0x7c, 0xf5, 0xe9, 0x15, 0x00, 0x00, 0xff, 0xff, 0x9e, 0x13, 0x90, 0x17, 0x0d, 0x01, 0x00, 0x00,
+func init() { proto.RegisterFile("cluster.proto", fileDescriptor_cluster_6fa07ec195d60ad3) }
+
+var fileDescriptor_cluster_6fa07ec195d60ad3 = []byte{
+	// 678 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x55, 0xef, 0x4e, 0x13, 0x41,
+	0x10, 0xcf, 0x71, 0x6d, 0x69, 0xa7, 0x6d, 0x52, 0x17, 0x63, 0x2e, 0x44, 0x4d, 0xb3, 0x18, 0xe4,
+	0x83, 0x56, 0xc4, 0x10, 0x0c, 0x26, 0xc6, 0xd2, 0x62, 0xd2, 0x40, 0x51, 0xb7, 0xf0, 0x00, 0x47,
+	0x3b, 0x42, 0xc3, 0xf5, 0xb6, 0xec, 0x6e, 0x31, 0x7d, 0x19, 0xbf, 0xfa, 0x34, 0x3e, 0x89, 0x2f,
+	0x61, 0xf6, 0xdf, 0xf5, 0x1a, 0x90, 0xa8, 0x9f, 0x3a, 0xbf, 0xe9, 0xfc, 0xf9, 0xcd, 0x6f, 0x66,
+	0x73, 0x50, 0x1f, 0x26, 0x33, 0xa9, 0x50, 0xb4, 0xa6, 0x82, 0x2b, 0x4e, 0x4a, 0xe6, 0x47, 0xd2,
+	0x6d, 0x28, 0x33, 0x94, 0x53, 0x9e, 0x4a, 0x24, 0x04, 0x0a, 0x1d, 0x3e, 0xc2, 0x28, 0x68, 0x06,
+	0x5b, 0x45, 0x66, 0x6c, 0xd2, 0x80, 0xb0, 0x2f, 0x2f, 0xa2, 0x95, 0x66, 0xb0, 0x55, 0x61, 0xda,
+	0xa4, 0xbb, 0x50, 0x3f, 0x98, 0x2b, 0x94, 0x7f, 0x9b, 0x56, 0xb3, 0x69, 0xef, 0xa0, 0x7a, 0x26,
+	0x51, 0xf4, 0x51, 0xca, 0xf8, 0xc2, 0x24, 0x9d, 0xc4, 0x13, 0x9b, 0x54, 0x61, 0xc6, 0x26, 0x11,
+	0xac, 0x76, 0x78, 0xaa, 0x30, 0x55, 0xae, 0x9f, 0x87, 0x74, 0x03, 0x56, 0x4f, 0xf0, 0x9b, 0xce,
+	0xcf, 0x07, 0x05, 0xcb, 0x41, 0xdb, 0x50, 0x62, 0x9f, 0x3b, 0x7d, 0x79, 0x41, 0x1e, 0x42, 0x91,
+	0xf1, 0x99, 0xf2, 0xd5, 0x2d, 0xb8, 0x63, 0x94, 0x4d, 0x80, 0x76, 0x92, 0xf4, 0x71, 0x72, 0x8e,
+	0x42, 0xea, 0xca, 0xce, 0x8c, 0x82, 0x66, 0xa8, 0x2b, 0x3b, 0x48, 0xbf, 0x07, 0x00, 0x03, 0x25,
+	0x30, 0x9e, 0x7c, 0x9a, 0x62, 0x4a, 0xd6, 0xa1, 0x6c, 0x51, 0xaf, 0xeb, 0x3a, 0x64, 0x98, 0x3c,
+	0x83, 0x3a, 0xc3, 0x69, 0x32, 0x1f, 0xa0, 0xb8, 0x41, 0xd1, 0xeb, 0xba, 0x76, 0xcb, 0x4e, 0xf2,
+	0x14, 0xc0, 0x38, 0x2c, 0xcb, 0xd0, 0x84, 0xe4, 0x3c, 0x96, 0x8a, 0x11, 0x2a, 0x2a, 0x18, 0x09,
+	0x3d, 0x5c, 0x8c, 0x56, 0xcc, 0x8d, 0x46, 0x7f, 0x04, 0x50, 0xb5, 0x14, 0x3e, 0x0a, 0xad, 0xe4,
+	0x7d, 0x0c, 0x1b, 0x10, 0x0e, 0xf0, 0xda, 0xf0, 0x0a, 0x99, 0x36, 0xc9, 0x8b, 0xc5, 0x0d, 0x18,
+	0x2e, 0xd5, 0x9d, 0x86, 0xbd, 0x12, 0xd9, 0xf2, 0x7e, 0xb6, 0xb8, 0x92, 0x06, 0x84, 0x87, 0xe9,
+	0xc8, 0xf0, 0x2a, 0x33, 0x6d, 0x6a, 0x4e, 0x87, 0x42, 0x70, 0xe1, 0x39, 0x19, 0xa0, 0xbd, 0x3d,
+	0x85, 0x13, 0x19, 0x95, 0x9a, 0xe1, 0x56, 0x8d, 0x59, 0x40, 0x37, 0xa0, 0xda, 0x9e, 0xa9, 0x4b,
+	0x86, 0xd7, 0x33, 0x94, 0x4a, 0x07, 0x9d, 0xf2, 0x2b, 0x4c, 0xfd, 0xa6, 0x0c, 0xa0, 0xbb, 0x50,
+	0x39, 0x88, 0xd5, 0xf0, 0xb2, 0x13, 0x27, 0xc9, 0x1f, 0x96, 0x49, 0xa0, 0xd0, 0x8d, 0x55, 0xec,
+	0x2e, 0xcc, 0xd8, 0x74, 0x0f, 0x6a, 0x26, 0xcd, 0x17, 0x7f, 0x0e, 0x45, 0x5d, 0xc1, 0xae, 0xb3,
+	0xba, 0xf3, 0xc0, 0x0f, 0x95, 0xd5, 0x66, 0xf6, 0x7f, 0xfa, 0x2b, 0x80, 0xaa, 0xcb, 0x94, 0xb3,
+	0x44, 0x65, 0xc5, 0x83, 0x45, 0x71, 0xf2, 0x18, 0x2a, 0x66, 0x2e, 0x73, 0xea, 0x76, 0xa9, 0x0b,
+	0x87, 0x16, 0xdc, 0x00, 0x7d, 0x60, 0x76, 0x9d, 0x19, 0x26, 0xc7, 0x50, 0xb7, 0x36, 0xaa, 0x78,
+	0xa4, 0xcb, 0x16, 0x0c, 0x9d, 0xcd, 0x25, 0x3a, 0xb6, 0x73, 0x6b, 0x29, 0xf0, 0x30, 0x55, 0x62,
+	0xce, 0x96, 0x93, 0xd7, 0x3f, 0x00, 0xb9, 0x1d, 0xa4, 0x97, 0x72, 0x85, 0x73, 0x27, 0x91, 0x36,
+	0xb5, 0x6c, 0x37, 0x71, 0x32, 0xf3, 0x5c, 0x2d, 0xd8, 0x5f, 0x79, 0x1b, 0xd0, 0xf7, 0x50, 0xf7,
+	0x2d, 0xed, 0x46, 0x5f, 0xc2, 0xaa, 0x6d, 0xef, 0x95, 0x5a, 0xbb, 0x83, 0x1a, 0xf3, 0x31, 0xf4,
+	0x0b, 0xac, 0x1d, 0x8f, 0xa5, 0x1a, 0xa0, 0x94, 0x63, 0x9e, 0xca, 0x7b, 0x57, 0xa9, 0x89, 0x9d,
+	0x65, 0xaf, 0x40, 0x9b, 0x5a, 0xdc, 0x23, 0x9c, 0xcb, 0x28, 0x34, 0x6f, 0xcc, 0xd8, 0xf4, 0xa7,
+	0xbe, 0x5f, 0x5b, 0xaf, 0x97, 0x7e, 0xe5, 0x3e, 0x2b, 0x58, 0x64, 0x99, 0x17, 0x33, 0xe1, 0x0a,
+	0xdb, 0xa3, 0x91, 0x70, 0xe5, 0x72, 0x1e, 0xd2, 0x84, 0x6a, 0x87, 0xa7, 0x29, 0x0e, 0x15, 0x8e,
+	0xda, 0xca, 0xec, 0x20, 0x64, 0x79, 0x17, 0x79, 0xed, 0x96, 0x6a, 0xd5, 0x7f, 0xe2, 0x47, 0xcc,
+	0xb5, 0x6d, 0x75, 0x33, 0xd1, 0x4d, 0xe8, 0xfa, 0x1e, 0x54, 0xba, 0xff, 0x29, 0xb1, 0x1f, 0x47,
+	0x2b, 0x45, 0x5e, 0x41, 0xd9, 0xc1, 0x5b, 0x0a, 0xe7, 0xda, 0xb3, 0x2c, 0x88, 0x9e, 0x02, 0x39,
+	0x1a, 0x0f, 0xaf, 0x1c, 0xfe, 0x57, 0x85, 0x1f, 0x41, 0x89, 0x61, 0x2c, 0x79, 0xea, 0x4e, 0xd1,
+	0x21, 0xba, 0x0f, 0x35, 0x57, 0xb1, 0x93, 0xc4, 0xe3, 0xc9, 0x1d, 0x2a, 0x47, 0xfa, 0x12, 0xa6,
+	0x49, 0x3c, 0xb4, 0x33, 0x95, 0x99, 0x87, 0xe7, 0xf6, 0x7b, 0xf1, 0xe6, 0xf7, 0x00, 0x2d, 0xd7,
+	0xf2, 0xd7, 0x47, 0x06, 0x00, 0x00,
 }
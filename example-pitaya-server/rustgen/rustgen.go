@@ -0,0 +1,151 @@
+// Package rustgen generates the rust bindings of the remotes registered by the go servers.
+// The bindings are a module of the pitaya-rs crate calling the remotes through rpc::Client.
+package rustgen
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/services"
+)
+
+// Server is a server type and the remotes it registers
+type Server struct {
+	Type    string
+	Remotes []services.RemoteInfo
+}
+
+// Options configures the generated module
+type Options struct {
+	// Exclude lists the routes, "svtype.service.method", not given bindings
+	Exclude []string
+	// Protos maps each proto package to the rust module with its prost structs, e.g. "crate::protos"
+	Protos map[string]string
+}
+
+type binding struct {
+	Route  string
+	Method string
+	Fn     string
+	// Arg is the rust type of the message, empty for remotes receiving the raw message or nothing
+	Arg   string
+	Raw   bool
+	Reply string
+}
+
+var bindingsTemplate = template.Must(template.New("bindings").Parse(`// Code generated by example-pitaya-server -rustbindings. DO NOT EDIT.
+
+use super::rpc::{call_remote, Client};
+use super::{Error, Server};
+use prost::Message;
+{{range .}}
+/// Calls {{.Method}} at {{.Route}}.
+pub(crate) async fn {{.Fn}}(
+    client: &impl Client,
+    target: &Server,
+{{- if .Raw}}
+    message: &[u8],
+{{- else if .Arg}}
+    message: &{{.Arg}},
+{{- end}}
+) -> Result<{{.Reply}}, Error> {
+{{- if .Raw}}
+    let data = call_remote(client, target, "{{.Route}}", message.to_vec())?;
+{{- else if .Arg}}
+    let mut data = Vec::with_capacity(message.encoded_len());
+    message.encode(&mut data)?;
+    let data = call_remote(client, target, "{{.Route}}", data)?;
+{{- else}}
+    let data = call_remote(client, target, "{{.Route}}", Vec::new())?;
+{{- end}}
+    Ok({{.Reply}}::decode(data.as_ref())?)
+}
+{{end -}}
+`))
+
+// Generate writes to w a rust module with an async function calling each remote of servers.
+// The functions are named after the routes and return the errors answered by the remotes as
+// Error::Remote.
+func Generate(w io.Writer, servers []Server, opts Options) error {
+	excluded := make(map[string]bool, len(opts.Exclude))
+	for _, rt := range opts.Exclude {
+		excluded[rt] = true
+	}
+
+	var bindings []binding
+	for _, sv := range servers {
+		for _, remote := range sv.Remotes {
+			rt := sv.Type + "." + remote.Route
+			if excluded[rt] {
+				continue
+			}
+			b := binding{
+				Route:  rt,
+				Method: remote.Method,
+				Fn:     strings.ReplaceAll(rt, ".", "_"),
+				Raw:    remote.Raw,
+			}
+			var err error
+			if remote.Arg != nil {
+				if b.Arg, err = rustType(remote.Arg, opts.Protos); err != nil {
+					return fmt.Errorf("%s: %w", rt, err)
+				}
+			}
+			if b.Reply, err = rustType(remote.Reply, opts.Protos); err != nil {
+				return fmt.Errorf("%s: %w", rt, err)
+			}
+			bindings = append(bindings, b)
+		}
+	}
+	return bindingsTemplate.Execute(w, bindings)
+}
+
+// rustType returns the path of the prost struct generated for the proto message t
+func rustType(t reflect.Type, modules map[string]string) (string, error) {
+	msg, ok := reflect.New(t).Interface().(proto.Message)
+	if !ok {
+		return "", fmt.Errorf("%s is not a proto message", t)
+	}
+	name := proto.MessageName(msg)
+	if name == "" {
+		return "", fmt.Errorf("%s is not a registered proto message", t)
+	}
+	pkg, message := "", name
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		pkg, message = name[:i], name[i+1:]
+	}
+	module, ok := modules[pkg]
+	if !ok {
+		return "", fmt.Errorf("no rust module for the proto package %q of %s", pkg, name)
+	}
+	return module + "::" + upperCamelCase(message), nil
+}
+
+// upperCamelCase converts a proto message name like prost does, e.g. RPCMsg to RpcMsg
+func upperCamelCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	start := true
+	for i, r := range runes {
+		switch {
+		case r == '_':
+			start = true
+			continue
+		case i > 0 && unicode.IsUpper(r) && unicode.IsLower(runes[i-1]),
+			i > 0 && unicode.IsUpper(r) && unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1]):
+			start = true
+		}
+		if start {
+			b.WriteRune(unicode.ToUpper(r))
+			start = false
+		} else {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,57 @@
+package rustgen
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/services"
+)
+
+func TestUpperCamelCase(t *testing.T) {
+	tables := []struct {
+		name     string
+		expected string
+	}{
+		{"Response", "Response"},
+		{"RPCMsg", "RpcMsg"},
+		{"StreamOpen", "StreamOpen"},
+		{"new_user", "NewUser"},
+	}
+	for _, table := range tables {
+		if got := upperCamelCase(table.name); got != table.expected {
+			t.Errorf("expected %s to be %s, got %s", table.name, table.expected, got)
+		}
+	}
+}
+
+var streamRPC = services.RemoteInfo{
+	Route:  "room.streamrpc",
+	Method: "Room.StreamRPC",
+	Arg:    reflect.TypeOf(protos.RPCMsg{}),
+	Reply:  reflect.TypeOf(protos.Response{}),
+}
+
+func TestGenerateExclude(t *testing.T) {
+	servers := []Server{{Type: "room", Remotes: []services.RemoteInfo{streamRPC}}}
+	var out bytes.Buffer
+	err := Generate(&out, servers, Options{
+		Exclude: []string{"room.room.streamrpc"},
+		Protos:  map[string]string{"protos": "crate::protos"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "fn ") {
+		t.Fatalf("excluded routes should not get bindings, got:\n%s", out.String())
+	}
+}
+
+func TestGenerateUnknownProtoPackage(t *testing.T) {
+	servers := []Server{{Type: "room", Remotes: []services.RemoteInfo{streamRPC}}}
+	if err := Generate(&bytes.Buffer{}, servers, Options{}); err == nil {
+		t.Fatal("expected an error for a proto package without rust module")
+	}
+}
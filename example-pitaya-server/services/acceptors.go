@@ -0,0 +1,211 @@
+package services
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/topfreegames/pitaya/acceptor"
+	"github.com/topfreegames/pitaya/conn/codec"
+	"github.com/topfreegames/pitaya/constants"
+	"github.com/topfreegames/pitaya/logger"
+)
+
+// ListenerOptions configures the listeners of a connector, each one is enabled independently.
+// Both serve the same handlers and remotes, and their sessions go through the same lifecycle once
+// wrapped by Connector.WrapAcceptor.
+type ListenerOptions struct {
+	// TCPAddr is the address of the listener speaking the pitaya protocol over raw tcp, disabled when empty
+	TCPAddr string
+	// WSAddr is the address of the listener framing the pitaya packets in websocket messages, for
+	// browsers, disabled when empty
+	WSAddr string
+	// TLS makes both listeners use tls, the websocket one serves wss, when not nil
+	TLS *tls.Config
+}
+
+// NewAcceptors returns the acceptors of the listeners enabled by opts
+func NewAcceptors(opts ListenerOptions) []acceptor.Acceptor {
+	var acceptors []acceptor.Acceptor
+	if opts.TCPAddr != "" {
+		acceptors = append(acceptors, NewTCPAcceptor(opts.TCPAddr, opts.TLS))
+	}
+	if opts.WSAddr != "" {
+		acceptors = append(acceptors, NewWSAcceptor(opts.WSAddr, opts.TLS))
+	}
+	return acceptors
+}
+
+// listener is the net.Listener shared by the acceptors, closed by Stop
+type listener struct {
+	addr     string
+	tls      *tls.Config
+	conns    chan acceptor.PlayerConn
+	mutex    sync.Mutex
+	listener net.Listener
+	stopped  bool
+}
+
+func (l *listener) listen() (net.Listener, error) {
+	ln, err := net.Listen("tcp", l.addr)
+	if err != nil {
+		return nil, err
+	}
+	if l.tls != nil {
+		ln = tls.NewListener(ln, l.tls)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.stopped {
+		ln.Close()
+		return nil, errors.New("acceptor stopped")
+	}
+	l.listener = ln
+	return ln, nil
+}
+
+// GetAddr returns the address listened, or an empty string before listening
+func (l *listener) GetAddr() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.listener == nil {
+		return ""
+	}
+	return l.listener.Addr().String()
+}
+
+// GetConnChan returns the channel of the accepted connections
+func (l *listener) GetConnChan() chan acceptor.PlayerConn {
+	return l.conns
+}
+
+// Stop stops accepting connections, the accepted ones stay open
+func (l *listener) Stop() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.stopped = true
+	if l.listener != nil {
+		l.listener.Close()
+	}
+}
+
+func (l *listener) isStopped() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.stopped
+}
+
+// TCPAcceptor accepts clients speaking the pitaya protocol over tcp, or tls when configured
+type TCPAcceptor struct {
+	listener
+}
+
+// NewTCPAcceptor returns an acceptor listening on addr, with tls when tlsConfig is not nil
+func NewTCPAcceptor(addr string, tlsConfig *tls.Config) *TCPAcceptor {
+	return &TCPAcceptor{listener{addr: addr, tls: tlsConfig, conns: make(chan acceptor.PlayerConn)}}
+}
+
+// ListenAndServe accepts connections until Stop is called
+func (a *TCPAcceptor) ListenAndServe() {
+	ln, err := a.listen()
+	if err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if a.isStopped() {
+				return
+			}
+			logger.Log.Errorf("Failed to accept TCP connection: %s", err.Error())
+			continue
+		}
+		a.conns <- &tcpConn{Conn: conn}
+	}
+}
+
+type tcpConn struct {
+	net.Conn
+}
+
+func (c *tcpConn) GetNextMessage() ([]byte, error) {
+	return readPacket(c.Conn, nil)
+}
+
+// readPacket reads the next pitaya packet of r, check can refuse its size before the body is read
+func readPacket(r io.Reader, check func(size int) error) ([]byte, error) {
+	header := make([]byte, codec.HeadLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	size, _, err := codec.ParseHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	if check != nil {
+		if err := check(size); err != nil {
+			return nil, err
+		}
+	}
+
+	msg := make([]byte, codec.HeadLength+size)
+	copy(msg, header)
+	if _, err := io.ReadFull(r, msg[codec.HeadLength:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, constants.ErrReceivedMsgSmallerThanExpected
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+// WSAcceptor accepts clients sending the pitaya packets in websocket messages on any path,
+// over wss when tls is configured
+type WSAcceptor struct {
+	listener
+	upgrader websocket.Upgrader
+}
+
+// NewWSAcceptor returns an acceptor listening on addr, serving wss when tlsConfig is not nil.
+// Browsers of any origin can connect.
+func NewWSAcceptor(addr string, tlsConfig *tls.Config) *WSAcceptor {
+	return &WSAcceptor{
+		listener: listener{addr: addr, tls: tlsConfig, conns: make(chan acceptor.PlayerConn)},
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  constants.IOBufferBytesSize,
+			WriteBufferSize: constants.IOBufferBytesSize,
+			CheckOrigin:     func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+// ListenAndServe accepts connections until Stop is called
+func (a *WSAcceptor) ListenAndServe() {
+	ln, err := a.listen()
+	if err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+	if err := http.Serve(ln, a); err != nil && !a.isStopped() {
+		logger.Log.Errorf("Failed to serve websockets: %s", err.Error())
+	}
+}
+
+// ServeHTTP upgrades the requests to websocket connections
+func (a *WSAcceptor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := a.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader answered the error
+		return
+	}
+	c, err := acceptor.NewWSConn(conn)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	a.conns <- c
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/websocket"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/acceptor"
+	"github.com/topfreegames/pitaya/conn/codec"
+	"github.com/topfreegames/pitaya/conn/message"
+	"github.com/topfreegames/pitaya/conn/packet"
+)
+
+// selfSignedTLS returns the config of a server for 127.0.0.1 and the pool of a client trusting it
+func selfSignedTLS(t *testing.T) (*tls.Config, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "connector"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		// lets the certificate sign itself
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}, pool
+}
+
+func waitListening(t *testing.T, a acceptor.Acceptor) string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for a.GetAddr() == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("the acceptor is not listening")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return a.GetAddr()
+}
+
+// serveRemoteFunc answers the requests of the connections accepted by a with RemoteFunc, like the
+// handler service of pitaya does once the handshake is done, until a is stopped
+func serveRemoteFunc(a acceptor.Acceptor, remote *ConnectorRemote) {
+	go a.ListenAndServe()
+	go func() {
+		for conn := range a.GetConnChan() {
+			go func(conn acceptor.PlayerConn) {
+				defer conn.Close()
+				decoder := codec.NewPomeloPacketDecoder()
+				encoder := codec.NewPomeloPacketEncoder()
+				messages := message.NewMessagesEncoder(false)
+				for {
+					data, err := conn.GetNextMessage()
+					if err != nil {
+						return
+					}
+					packets, err := decoder.Decode(data)
+					if err != nil {
+						return
+					}
+					for _, p := range packets {
+						req, err := message.Decode(p.Data)
+						if err != nil {
+							return
+						}
+						res, err := remote.RemoteFunc(context.Background(), req.Data)
+						if err != nil {
+							return
+						}
+						answer, err := proto.Marshal(res)
+						if err != nil {
+							return
+						}
+						encoded, err := messages.Encode(&message.Message{Type: message.Response, ID: req.ID, Data: answer})
+						if err != nil {
+							return
+						}
+						out, err := encoder.Encode(packet.Data, encoded)
+						if err != nil {
+							return
+						}
+						if _, err := conn.Write(out); err != nil {
+							return
+						}
+					}
+				}
+			}(conn)
+		}
+	}()
+}
+
+// requestPacket returns the packet of a request to route with data, as sent by the clients
+func requestPacket(t *testing.T, route string, data []byte) []byte {
+	t.Helper()
+	encoded, err := message.NewMessagesEncoder(false).Encode(&message.Message{Type: message.Request, ID: 1, Route: route, Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkt, err := codec.NewPomeloPacketEncoder().Encode(packet.Data, encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkt
+}
+
+// checkRemoteFuncAnswer checks pkt is the answer of RemoteFunc to the request of requestPacket with data
+func checkRemoteFuncAnswer(t *testing.T, pkt []byte, data []byte) {
+	t.Helper()
+	packets, err := codec.NewPomeloPacketDecoder().Decode(pkt)
+	if err != nil || len(packets) != 1 {
+		t.Fatalf("expected an answer packet, got %v %v", packets, err)
+	}
+	msg, err := message.Decode(packets[0].Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := &protos.Response{}
+	if err := proto.Unmarshal(msg.Data, res); err != nil {
+		t.Fatal(err)
+	}
+	// messages without content type are json, echoed as they are
+	if msg.Type != message.Response || msg.ID != 1 || msg.Err || res.Msg != string(data) {
+		t.Fatalf("unexpected answer %v %v", msg, res)
+	}
+}
+
+// TestListeners calls RemoteFunc through every transport, their connections go through the lifecycle
+// of the connector like in main
+func TestListeners(t *testing.T) {
+	serverTLS, roots := selfSignedTLS(t)
+	ws := NewWSAcceptor("127.0.0.1:0", nil)
+	wss := NewWSAcceptor("127.0.0.1:0", serverTLS)
+	tcp := NewTCPAcceptor("127.0.0.1:0", nil)
+	tcps := NewTCPAcceptor("127.0.0.1:0", serverTLS)
+
+	connector := NewConnector(NewMemorySessionStore(0))
+	remote := NewConnectorRemote(connector)
+	for _, a := range []acceptor.Acceptor{ws, wss, tcp, tcps} {
+		serveRemoteFunc(connector.WrapAcceptor(a), remote)
+		defer a.Stop()
+	}
+	data, err := proto.Marshal(&protos.RPCMsg{Msg: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := requestPacket(t, RemoteFuncRoute, data)
+
+	websockets := []struct {
+		name   string
+		url    string
+		dialer *websocket.Dialer
+	}{
+		{"ws", "ws://" + waitListening(t, ws) + "/", &websocket.Dialer{}},
+		{"wss", "wss://" + waitListening(t, wss) + "/", &websocket.Dialer{TLSClientConfig: &tls.Config{RootCAs: roots}}},
+	}
+	for _, table := range websockets {
+		t.Run(table.name, func(t *testing.T) {
+			c, _, err := table.dialer.Dial(table.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			c.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if err := c.WriteMessage(websocket.BinaryMessage, req); err != nil {
+				t.Fatal(err)
+			}
+			_, pkt, err := c.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkRemoteFuncAnswer(t, pkt, data)
+		})
+	}
+
+	sockets := []struct {
+		name string
+		dial func() (net.Conn, error)
+	}{
+		{"tcp", func() (net.Conn, error) { return net.Dial("tcp", waitListening(t, tcp)) }},
+		{"tls", func() (net.Conn, error) {
+			return tls.Dial("tcp", waitListening(t, tcps), &tls.Config{RootCAs: roots})
+		}},
+	}
+	for _, table := range sockets {
+		t.Run(table.name, func(t *testing.T) {
+			c, err := table.dial()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			c.SetDeadline(time.Now().Add(5 * time.Second))
+			if _, err := c.Write(req); err != nil {
+				t.Fatal(err)
+			}
+			pkt, err := readPacket(c, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkRemoteFuncAnswer(t, pkt, data)
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/component"
+	e "github.com/topfreegames/pitaya/errors"
+)
+
+const (
+	// ErrForbiddenCode is the pitaya error code returned to authenticated callers that are not allowed
+	ErrForbiddenCode = "PIT-403"
+	// AdminClaim is the claim that must be true in the tokens of the admins
+	AdminClaim = "admin"
+)
+
+// ErrForbidden is returned when an authenticated caller is not an admin
+var ErrForbidden = errors.New("forbidden")
+
+// ServeAdmin exposes on addr the endpoints operating the connector, /drain toggles its draining
+// state, see DrainHandler, and /sessions serves admin when not nil, see AdminRemote.ServeHTTP.
+// It must not be reachable by the clients.
+func ServeAdmin(addr string, c *Connector, admin *AdminRemote) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/drain", c.DrainHandler())
+	if admin != nil {
+		mux.Handle("/sessions", admin)
+	}
+	return &http.Server{Addr: addr, Handler: mux}
+}
+
+// AdminSession is what the admins see of a session, *session.Session implements it
+type AdminSession interface {
+	UID() string
+	RemoteAddr() net.Addr
+	HasKey(key string) bool
+	Get(key string) interface{}
+}
+
+// BoundSession is a session bound to a uid and the time it was bound
+type BoundSession struct {
+	Session AdminSession
+	BoundAt time.Time
+}
+
+// SessionSource holds the sessions operated by the admin remotes, the connector's by default
+type SessionSource interface {
+	// BoundSessions returns the sessions bound to a uid
+	BoundSessions() []BoundSession
+	// Kick closes the session of uid, its disconnect hooks are given reason. It fails with
+	// ErrSessionGone when no session is bound to uid.
+	Kick(ctx context.Context, uid string, reason DisconnectReason) error
+}
+
+// BoundSessions returns the sessions bound to a uid on the connector
+func (c *Connector) BoundSessions() []BoundSession {
+	c.drain.mutex.Lock()
+	defer c.drain.mutex.Unlock()
+	sessions := make([]BoundSession, 0, len(c.drain.sessions))
+	for id, s := range c.drain.sessions {
+		sessions = append(sessions, BoundSession{Session: s, BoundAt: c.drain.boundAt[id]})
+	}
+	return sessions
+}
+
+// Kick closes the session of uid, its disconnect hooks are given reason
+func (c *Connector) Kick(ctx context.Context, uid string, reason DisconnectReason) error {
+	s := c.sessions(uid)
+	if s == nil {
+		return ErrSessionGone
+	}
+	return c.kick(ctx, s, reason)
+}
+
+// AdminRemote are the remotes inspecting and kicking the sessions of a connector. Every call
+// carries a token verified by the authenticator whose claims must set AdminClaim.
+type AdminRemote struct {
+	component.Base
+	connector     *Connector
+	sessions      SessionSource
+	authenticator Authenticator
+}
+
+// NewAdminRemote returns the admin remotes of connector, authenticating the admins with authenticator
+func NewAdminRemote(connector *Connector, authenticator Authenticator) *AdminRemote {
+	return &AdminRemote{connector: connector, sessions: connector, authenticator: authenticator}
+}
+
+// authorize returns the uid of the admin token belongs to
+func (a *AdminRemote) authorize(ctx context.Context, token string) (string, error) {
+	if a.authenticator == nil {
+		return "", NewError(ErrUnauthenticatedCode, "authentication is not enabled")
+	}
+	uid, claims, err := a.authenticator.Authenticate(ctx, token)
+	if err != nil {
+		return "", Wrap(err, ErrUnauthenticatedCode, "invalid admin token")
+	}
+	if admin, _ := claims[AdminClaim].(bool); !admin {
+		return "", Wrap(fmt.Errorf("%w: %s is not an admin", ErrForbidden, uid), ErrForbiddenCode, "not an admin")
+	}
+	return uid, nil
+}
+
+// ListSessions answers the sessions bound to the connector whose uid starts with req.UID, every
+// session when it is empty, with the json of the session data under req.Keys. The sensitive
+// values are Redacted, see WithRedactor.
+func (a *AdminRemote) ListSessions(ctx context.Context, req *protos.ListSessionsRequest) (*protos.SessionList, error) {
+	if _, err := a.authorize(ctx, req.Token); err != nil {
+		return nil, err
+	}
+
+	var sessions []BoundSession
+	for _, bound := range a.sessions.BoundSessions() {
+		if strings.HasPrefix(bound.Session.UID(), req.UID) {
+			sessions = append(sessions, bound)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Session.UID() < sessions[j].Session.UID() })
+
+	list := &protos.SessionList{Sessions: make([]*protos.SessionInfo, 0, len(sessions))}
+	for _, bound := range sessions {
+		s := bound.Session
+		info := &protos.SessionInfo{
+			UID:         s.UID(),
+			ConnectedAt: bound.BoundAt.UnixNano() / int64(time.Millisecond),
+		}
+		if addr := s.RemoteAddr(); addr != nil {
+			info.RemoteAddr = addr.String()
+		}
+		for _, key := range req.Keys {
+			if !s.HasKey(key) {
+				continue
+			}
+			if info.Data == nil {
+				info.Data = make(map[string]string, len(req.Keys))
+			}
+			value := s.Get(key)
+			if a.connector.redactor.Sensitive(key, value) {
+				info.Data[key] = Redacted
+				continue
+			}
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			info.Data[key] = string(encoded)
+		}
+		list.Sessions = append(list.Sessions, info)
+	}
+	return list, nil
+}
+
+// KickSession closes the session of req.UID, its disconnect hooks are given DisconnectAdminKick
+func (a *AdminRemote) KickSession(ctx context.Context, req *protos.KickSessionRequest) (*protos.Response, error) {
+	admin, err := a.authorize(ctx, req.Token)
+	if err != nil {
+		return nil, err
+	}
+	a.connector.logger.Info("kicking session", "uid", req.UID, "admin", admin, "reason", req.Reason)
+	if err := a.sessions.Kick(ctx, req.UID, DisconnectAdminKick); err != nil {
+		if errors.Is(err, ErrSessionGone) {
+			return nil, Wrap(err, e.ErrNotFoundCode, "session not found").WithMetadata("uid", req.UID)
+		}
+		return nil, err
+	}
+	return &protos.Response{Code: 200, Msg: "ok"}, nil
+}
+
+// ServeHTTP serves the admin remotes over http with the token in the Authorization header as a
+// bearer token. GET lists the sessions whose uid starts with the uid query parameter with the
+// comma separated keys, answering the SessionList in json, and DELETE kicks the session of uid
+// with reason.
+func (a *AdminRemote) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	query := r.URL.Query()
+	var answer interface{}
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		var keys []string
+		if query.Get("keys") != "" {
+			keys = strings.Split(query.Get("keys"), ",")
+		}
+		answer, err = a.ListSessions(r.Context(), &protos.ListSessionsRequest{Token: token, UID: query.Get("uid"), Keys: keys})
+	case http.MethodDelete:
+		answer, err = a.KickSession(r.Context(), &protos.KickSessionRequest{Token: token, UID: query.Get("uid"), Reason: query.Get("reason")})
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		pitayaErr := toPitayaError(err)
+		w.WriteHeader(httpStatus(pitayaErr.Code))
+		json.NewEncoder(w).Encode(pitayaErr)
+		return
+	}
+	json.NewEncoder(w).Encode(answer)
+}
+
+// httpStatus returns the http status of the pitaya error code
+func httpStatus(code string) int {
+	switch code {
+	case e.ErrBadRequestCode:
+		return http.StatusBadRequest
+	case ErrUnauthenticatedCode:
+		return http.StatusUnauthorized
+	case ErrForbiddenCode:
+		return http.StatusForbidden
+	case e.ErrNotFoundCode:
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
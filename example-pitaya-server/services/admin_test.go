@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	e "github.com/topfreegames/pitaya/errors"
+	"github.com/topfreegames/pitaya/session"
+)
+
+// adminEntities are the entities of the sessions of newAdminConnector by uid
+type adminEntities map[string]*addrEntity
+
+func (a adminEntities) kicked(uid string) bool {
+	a[uid].mutex.Lock()
+	defer a[uid].mutex.Unlock()
+	return a[uid].kicked
+}
+
+func newAdminConnector(t *testing.T, disconnects chan disconnection) (*Connector, *AdminRemote, map[string]*session.Session, adminEntities) {
+	c := lifecycleConnector(disconnects)
+	sessions := make(map[string]*session.Session)
+	entities := make(adminEntities)
+	for i, uid := range []string{"player-2", "player-1", "bot-1"} {
+		entities[uid] = &addrEntity{addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4000 + i}}
+		s := session.New(entities[uid], true, uid)
+		if err := c.trackSession(context.Background(), s); err != nil {
+			t.Fatal(err)
+		}
+		sessions[uid] = s
+	}
+	c.sessions = func(uid string) *session.Session { return sessions[uid] }
+	return c, NewAdminRemote(c, NewJWTAuthenticator(StaticKey(testSecret))), sessions, entities
+}
+
+// adminSession is a session listed by fakeSessions
+type adminSession struct {
+	uid  string
+	addr net.Addr
+	data map[string]interface{}
+}
+
+func (s *adminSession) UID() string                { return s.uid }
+func (s *adminSession) RemoteAddr() net.Addr       { return s.addr }
+func (s *adminSession) HasKey(key string) bool     { _, ok := s.data[key]; return ok }
+func (s *adminSession) Get(key string) interface{} { return s.data[key] }
+
+// fakeSessions is a session source recording the kicks
+type fakeSessions struct {
+	mutex    sync.Mutex
+	sessions []BoundSession
+	kicked   []string
+}
+
+func (f *fakeSessions) BoundSessions() []BoundSession {
+	return f.sessions
+}
+
+func (f *fakeSessions) Kick(ctx context.Context, uid string, reason DisconnectReason) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, s := range f.sessions {
+		if s.Session.UID() == uid {
+			f.kicked = append(f.kicked, uid+" "+reason.String())
+			return nil
+		}
+	}
+	return ErrSessionGone
+}
+
+// newAdminServer serves the admin remotes of fake sessions over http
+func newAdminServer(t *testing.T) (*httptest.Server, *fakeSessions) {
+	boundAt := time.Unix(1700000000, 0)
+	sessions := &fakeSessions{}
+	for i, uid := range []string{"player-2", "player-1", "bot-1"} {
+		sessions.sessions = append(sessions.sessions, BoundSession{
+			Session: &adminSession{uid: uid, addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4000 + i}},
+			BoundAt: boundAt,
+		})
+	}
+	sessions.sessions[1].Session.(*adminSession).data = map[string]interface{}{"level": 3, "token": "eyJhbGciOi"}
+
+	admin := NewAdminRemote(NewConnector(nil), NewJWTAuthenticator(StaticKey(testSecret)))
+	admin.sessions = sessions
+	server := httptest.NewServer(admin)
+	t.Cleanup(server.Close)
+	return server, sessions
+}
+
+// adminRequest sends a request to the admin server with token, decoding the json answered into v
+func adminRequest(t *testing.T, server *httptest.Server, method, query, token string, v interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+"/sessions?"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode
+}
+
+func TestAdminListSessions(t *testing.T) {
+	server, _ := newAdminServer(t)
+	token := signHS256(t, jwt.MapClaims{"sub": "ops", AdminClaim: true})
+
+	list := &protos.SessionList{}
+	if status := adminRequest(t, server, http.MethodGet, "uid=player-&keys=level,token,missing", token, list); status != http.StatusOK {
+		t.Fatalf("expected the sessions, got %d", status)
+	}
+	if len(list.Sessions) != 2 || list.Sessions[0].UID != "player-1" || list.Sessions[1].UID != "player-2" {
+		t.Fatalf("expected the players sorted by uid, got %v", list.Sessions)
+	}
+	first := list.Sessions[0]
+	if first.RemoteAddr != "10.0.0.1:4001" || first.ConnectedAt != 1700000000000 {
+		t.Fatalf("expected the address and connection time of the session, got %v", first)
+	}
+	if len(first.Data) != 2 || first.Data["level"] != "3" || first.Data["token"] != Redacted || list.Sessions[1].Data != nil {
+		t.Fatalf("expected only the keys set, got %v and %v", first.Data, list.Sessions[1].Data)
+	}
+
+	all := &protos.SessionList{}
+	if status := adminRequest(t, server, http.MethodGet, "", token, all); status != http.StatusOK || len(all.Sessions) != 3 {
+		t.Fatalf("expected every session without filter, got %d %v", status, all)
+	}
+}
+
+func TestAdminKickSession(t *testing.T) {
+	disconnects := make(chan disconnection, 1)
+	c, admin, sessions, entities := newAdminConnector(t, disconnects)
+	token := signHS256(t, jwt.MapClaims{"sub": "ops", AdminClaim: true})
+
+	if _, err := admin.KickSession(context.Background(), &protos.KickSessionRequest{
+		Token:  token,
+		UID:    "player-1",
+		Reason: "cheating",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	kicked := sessions["player-1"]
+	if !entities.kicked("player-1") {
+		t.Fatal("the session should be kicked")
+	}
+	if entities.kicked("player-2") {
+		t.Fatal("only the kicked uid should be kicked")
+	}
+	c.onSessionClose(kicked)
+	if d := receive(t, disconnects); d.session != kicked || d.reason != DisconnectAdminKick || d.reason.String() != "admin kick" {
+		t.Fatalf("expected an admin kick, got %s", d.reason)
+	}
+
+	_, err := admin.KickSession(context.Background(), &protos.KickSessionRequest{Token: token, UID: "player-3"})
+	if pitayaErr := toPitayaError(err); pitayaErr.Code != e.ErrNotFoundCode || pitayaErr.Metadata["uid"] != "player-3" {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+	if _, err := admin.KickSession(context.Background(), &protos.KickSessionRequest{UID: "player-2"}); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("expected ErrUnauthenticated, got %v", err)
+	}
+}
+
+func TestAdminAccessControl(t *testing.T) {
+	server, sessions := newAdminServer(t)
+	tables := []struct {
+		name   string
+		token  string
+		status int
+		code   string
+	}{
+		{"no token", "", http.StatusUnauthorized, ErrUnauthenticatedCode},
+		{"invalid token", "invalid", http.StatusUnauthorized, ErrUnauthenticatedCode},
+		{"not an admin", signHS256(t, jwt.MapClaims{"sub": "player-1"}), http.StatusForbidden, ErrForbiddenCode},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			for _, method := range []string{http.MethodGet, http.MethodDelete} {
+				pitayaErr := &e.Error{}
+				if status := adminRequest(t, server, method, "uid=player-1", table.token, pitayaErr); status != table.status || pitayaErr.Code != table.code {
+					t.Fatalf("expected %s with %d on %s, got %d %v", table.code, table.status, method, status, pitayaErr)
+				}
+			}
+		})
+	}
+	if len(sessions.kicked) != 0 {
+		t.Fatal("the session should not be kicked without an admin token")
+	}
+
+	token := signHS256(t, jwt.MapClaims{"sub": "ops", AdminClaim: true})
+	res := &protos.Response{}
+	if status := adminRequest(t, server, http.MethodDelete, "uid=player-1&reason=cheating", token, res); status != http.StatusOK || res.Msg != "ok" {
+		t.Fatalf("expected the session to be kicked, got %d %v", status, res)
+	}
+	if len(sessions.kicked) != 1 || sessions.kicked[0] != "player-1 admin kick" {
+		t.Fatalf("expected player-1 to be kicked by an admin, got %v", sessions.kicked)
+	}
+	pitayaErr := &e.Error{}
+	if status := adminRequest(t, server, http.MethodDelete, "uid=player-3", token, pitayaErr); status != http.StatusNotFound || pitayaErr.Metadata["uid"] != "player-3" {
+		t.Fatalf("expected an unknown uid to be not found, got %d %v", status, pitayaErr)
+	}
+}
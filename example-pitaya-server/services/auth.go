@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya"
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+	"github.com/topfreegames/pitaya/session"
+)
+
+const (
+	// ErrUnauthenticatedCode is the pitaya error code returned to clients that did not authenticate
+	ErrUnauthenticatedCode = "PIT-401"
+	// ClaimsKey is the session data key holding the claims of the authenticated token
+	ClaimsKey = "claims"
+)
+
+var (
+	// ErrUnauthenticated is returned when a token is invalid or a protected route is called before authenticating
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrKeyNotFound is returned by a KeyProvider without a key for the token
+	ErrKeyNotFound = errors.New("signing key not found")
+)
+
+// Authenticator validates the token of a client and returns who it belongs to
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (uid string, claims map[string]interface{}, err error)
+}
+
+// KeyProvider returns the key verifying tokens signed by kid with alg.
+// Keys are []byte for HMAC, *rsa.PublicKey for RSA and *ecdsa.PublicKey for ECDSA.
+type KeyProvider interface {
+	Key(ctx context.Context, kid, alg string) (interface{}, error)
+}
+
+type staticKeyProvider struct {
+	key interface{}
+}
+
+// StaticKey returns a KeyProvider verifying every token with key
+func StaticKey(key interface{}) KeyProvider {
+	return &staticKeyProvider{key: key}
+}
+
+func (s *staticKeyProvider) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	return s.key, nil
+}
+
+// JWKSKeyProvider fetches the RSA keys published in a JSON Web Key Set.
+// The set is fetched again when a token uses an unknown key, at most once per refresh interval.
+type JWKSKeyProvider struct {
+	url       string
+	client    *http.Client
+	refresh   time.Duration
+	mutex     sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// NewJWKSKeyProvider returns a new key provider for the key set published at url
+func NewJWKSKeyProvider(url string, refresh time.Duration) *JWKSKeyProvider {
+	return &JWKSKeyProvider{
+		url:     url,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		refresh: refresh,
+		keys:    make(map[string]*rsa.PublicKey),
+	}
+}
+
+// Key returns the key kid of the set
+func (j *JWKSKeyProvider) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if key, ok := j.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(j.fetchedAt) < j.refresh {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, kid)
+	}
+	if err := j.fetch(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := j.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, kid)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// fetch replaces the keys with the ones currently published, it must be called with the mutex held
+func (j *JWKSKeyProvider) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := j.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch key set: %s", res.Status)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return err
+	}
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return err
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	j.keys = keys
+	j.fetchedAt = time.Now()
+	return nil
+}
+
+// JWTAuthenticator authenticates clients with a signed JWT, the uid is its subject
+type JWTAuthenticator struct {
+	keys KeyProvider
+}
+
+// NewJWTAuthenticator returns a new authenticator verifying tokens with the keys of keys
+func NewJWTAuthenticator(keys KeyProvider) *JWTAuthenticator {
+	return &JWTAuthenticator{keys: keys}
+}
+
+// Authenticate checks the signature, expiration and subject of token
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, token string) (string, map[string]interface{}, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := a.keys.Key(ctx, kid, t.Method.Alg())
+		if err != nil {
+			return nil, err
+		}
+		// the algorithm of the token must match the kind of key, tokens choose their algorithm
+		ok := false
+		switch key.(type) {
+		case []byte:
+			_, ok = t.Method.(*jwt.SigningMethodHMAC)
+		case *rsa.PublicKey:
+			_, ok = t.Method.(*jwt.SigningMethodRSA)
+		case *ecdsa.PublicKey:
+			_, ok = t.Method.(*jwt.SigningMethodECDSA)
+		}
+		if !ok {
+			return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+		}
+		return key, nil
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %s", ErrUnauthenticated, err.Error())
+	}
+
+	uid, _ := claims["sub"].(string)
+	if uid == "" {
+		return "", nil, fmt.Errorf("%w: token has no subject", ErrUnauthenticated)
+	}
+	return uid, map[string]interface{}(claims), nil
+}
+
+// WithAuthenticator enables the auth handler of the connector
+func WithAuthenticator(a Authenticator) ConnectorOption {
+	return func(c *Connector) {
+		c.authenticator = a
+	}
+}
+
+// Auth authenticates the client, binding the session to its uid and keeping the claims in the session data
+func (c *Connector) Auth(ctx context.Context, req *protos.AuthRequest) (*protos.Response, error) {
+	if c.authenticator == nil {
+		return nil, pitaya.Error(errors.New("authentication is not enabled"), ErrUnauthenticatedCode)
+	}
+	uid, claims, err := c.authenticator.Authenticate(ctx, req.Token)
+	if err != nil {
+		return nil, pitaya.Error(err, ErrUnauthenticatedCode)
+	}
+
+	s := pitaya.GetSessionFromCtx(ctx)
+	if err := s.Bind(ctx, uid); err != nil {
+		code := ErrUnauthenticatedCode
+		if err == ErrDuplicateSession {
+			code = ErrSessionConflictCode
+		}
+		return nil, pitaya.Error(err, code)
+	}
+	if err := s.Set(ClaimsKey, claims); err != nil {
+		return nil, err
+	}
+	return &protos.Response{Code: 200, Msg: uid}, nil
+}
+
+// RequireAuth returns a pitaya handler pipeline rejecting calls to routes from sessions without an uid
+func RequireAuth(routes ...string) func(ctx context.Context, in interface{}) (interface{}, error) {
+	protected := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		protected[route] = true
+	}
+	return func(ctx context.Context, in interface{}) (interface{}, error) {
+		route, _ := pcontext.GetFromPropagateCtx(ctx, constants.RouteKey).(string)
+		if !protected[route] {
+			return in, nil
+		}
+		if s, ok := ctx.Value(constants.SessionCtxKey).(*session.Session); ok && s != nil && s.UID() != "" {
+			return in, nil
+		}
+		return nil, pitaya.Error(fmt.Errorf("%w: %s requires authentication", ErrUnauthenticated, route), ErrUnauthenticatedCode)
+	}
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+	e "github.com/topfreegames/pitaya/errors"
+	"github.com/topfreegames/pitaya/session"
+)
+
+var testSecret = []byte("secret")
+
+func signHS256(t *testing.T, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func newAuthSession() (context.Context, *session.Session) {
+	s := session.New(&fakeEntity{}, true)
+	return context.WithValue(context.Background(), constants.SessionCtxKey, s), s
+}
+
+func TestAuthBindsSession(t *testing.T) {
+	c := NewConnector(nil, WithAuthenticator(NewJWTAuthenticator(StaticKey(testSecret))))
+	ctx, s := newAuthSession()
+
+	token := signHS256(t, jwt.MapClaims{
+		"sub":  "uid1",
+		"exp":  time.Now().Add(time.Hour).Unix(),
+		"role": "player",
+	})
+	res, err := c.Auth(ctx, &protos.AuthRequest{Token: token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Code != 200 || s.UID() != "uid1" {
+		t.Fatalf("the session should be bound to uid1, got %q", s.UID())
+	}
+	claims, ok := s.Get(ClaimsKey).(map[string]interface{})
+	if !ok || claims["role"] != "player" {
+		t.Fatalf("the claims should be kept in the session data, got %v", s.Get(ClaimsKey))
+	}
+}
+
+func TestAuthRejectsExpiredToken(t *testing.T) {
+	authenticator := NewJWTAuthenticator(StaticKey(testSecret))
+	token := signHS256(t, jwt.MapClaims{
+		"sub": "uid1",
+		"exp": time.Now().Add(-time.Minute).Unix(),
+	})
+
+	if _, _, err := authenticator.Authenticate(context.Background(), token); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("expected ErrUnauthenticated, got %v", err)
+	}
+
+	c := NewConnector(nil, WithAuthenticator(authenticator))
+	ctx, s := newAuthSession()
+	_, err := c.Auth(ctx, &protos.AuthRequest{Token: token})
+	pitayaErr, ok := err.(*e.Error)
+	if !ok || pitayaErr.Code != ErrUnauthenticatedCode {
+		t.Fatalf("expected an unauthenticated pitaya error, got %#v", err)
+	}
+	if s.UID() != "" {
+		t.Fatal("the session should not be bound")
+	}
+}
+
+func TestAuthRejectsAlgorithmOfOtherKeys(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator := NewJWTAuthenticator(StaticKey(&key.PublicKey))
+
+	// a token signed with hmac must not be verified with the public key as the secret
+	token := signHS256(t, jwt.MapClaims{"sub": "uid1"})
+	if _, _, err := authenticator.Authenticate(context.Background(), token); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("expected ErrUnauthenticated, got %v", err)
+	}
+}
+
+func TestJWKSKeyProvider(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "key-1",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	defer server.Close()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"sub": "uid1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = "key-1"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator := NewJWTAuthenticator(NewJWKSKeyProvider(server.URL, time.Minute))
+	uid, _, err := authenticator.Authenticate(context.Background(), signed)
+	if err != nil || uid != "uid1" {
+		t.Fatalf("expected uid1, got %q %v", uid, err)
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	guard := RequireAuth("room.room.join")
+	ctx, s := newAuthSession()
+	ctx = pcontext.AddToPropagateCtx(ctx, constants.RouteKey, "room.room.join")
+
+	_, err := guard(ctx, nil)
+	if pitayaErr, ok := err.(*e.Error); !ok || pitayaErr.Code != ErrUnauthenticatedCode {
+		t.Fatalf("expected an unauthenticated pitaya error, got %#v", err)
+	}
+
+	if err := s.Bind(ctx, "uid1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := guard(ctx, nil); err != nil {
+		t.Fatalf("authenticated sessions should pass, got %s", err)
+	}
+}
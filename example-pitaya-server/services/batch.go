@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/cluster"
+	e "github.com/topfreegames/pitaya/errors"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/route"
+)
+
+// BatchRoute is the route, without the server type, of the rpcs carrying the calls of a Batch.
+// They are served by the server returned by ServeBatches.
+const BatchRoute = "batch.call"
+
+// ErrBatchExecuted is returned when executing a batch twice
+var ErrBatchExecuted = errors.New("batch already executed")
+
+// Batch sends several calls in as few rpcs as possible: the calls to the same server are sent in
+// one rpc, the rpcs to different servers are sent concurrently. Calls without server id go to
+// the server picked by the router of the client, the ones left share a rpc to any server of their type.
+type Batch struct {
+	client   *RemoteClient
+	ctx      context.Context
+	calls    []batchEntry
+	executed bool
+}
+
+type batchEntry struct {
+	serverID string
+	route    string
+	arg      proto.Message
+}
+
+// Result is the answer of a call of a batch
+type Result struct {
+	Route string
+	// Data is the encoded answer of the remote
+	Data []byte
+	// Err is the *RPCError the call failed with, the other calls of the batch are not affected
+	Err error
+}
+
+// Decode decodes the answer of the call into reply, returning the error of the call if it failed
+func (r Result) Decode(reply proto.Message) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	return proto.Unmarshal(r.Data, reply)
+}
+
+// Batch returns an empty batch of calls propagating ctx
+func (r *RemoteClient) Batch(ctx context.Context) *Batch {
+	return &Batch{client: r, ctx: ctx}
+}
+
+// Add adds a call to route, which must have a server type, with arg
+func (b *Batch) Add(route string, arg proto.Message) *Batch {
+	return b.AddTo("", route, arg)
+}
+
+// AddTo adds a call to route in the server serverID with arg
+func (b *Batch) AddTo(serverID, route string, arg proto.Message) *Batch {
+	b.calls = append(b.calls, batchEntry{serverID: serverID, route: route, arg: arg})
+	return b
+}
+
+// batchTarget is a server receiving a rpc of the batch, serverID is empty for any server of svType
+type batchTarget struct {
+	serverID string
+	svType   string
+}
+
+type batchGroup struct {
+	target  batchTarget
+	indexes []int
+	req     *protos.BatchRequest
+}
+
+// Execute sends the calls and returns their results in the order they were added.
+// Failing calls don't fail the batch, their error is in their result.
+func (b *Batch) Execute() ([]Result, error) {
+	if b.executed {
+		return nil, ErrBatchExecuted
+	}
+	b.executed = true
+
+	ctx := b.client.context(b.ctx)
+	results := make([]Result, len(b.calls))
+	groups := make(map[batchTarget]*batchGroup)
+	var ordered []*batchGroup
+	for i, call := range b.calls {
+		results[i].Route = call.route
+		target, data, err := b.prepare(ctx, call)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		g, ok := groups[target]
+		if !ok {
+			g = &batchGroup{target: target, req: &protos.BatchRequest{}}
+			groups[target] = g
+			ordered = append(ordered, g)
+		}
+		g.indexes = append(g.indexes, i)
+		g.req.Calls = append(g.req.Calls, &protos.BatchCall{Route: call.route, Data: data})
+	}
+
+	var wg sync.WaitGroup
+	for _, g := range ordered {
+		wg.Add(1)
+		go func(g *batchGroup) {
+			defer wg.Done()
+			b.send(ctx, g, results)
+		}(g)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// prepare returns the server receiving call and its encoded message
+func (b *Batch) prepare(ctx context.Context, call batchEntry) (batchTarget, []byte, error) {
+	rt, err := route.Decode(call.route)
+	if err != nil {
+		return batchTarget{}, nil, &RPCError{Route: call.route, Err: err}
+	}
+	if rt.SvType == "" {
+		return batchTarget{}, nil, &RPCError{Route: call.route, Err: fmt.Errorf("route %s has no server type", call.route)}
+	}
+	serverID, err := b.client.route(ctx, call.serverID, call.route)
+	if err != nil {
+		return batchTarget{}, nil, err
+	}
+	data, err := proto.Marshal(call.arg)
+	if err != nil {
+		return batchTarget{}, nil, &RPCError{Route: call.route, Err: err}
+	}
+	return batchTarget{serverID: serverID, svType: rt.SvType}, data, nil
+}
+
+// send sends the calls of g in one rpc and scatters its results
+func (b *Batch) send(ctx context.Context, g *batchGroup, results []Result) {
+	res := &protos.BatchResponse{}
+	err := b.client.send(ctx, g.target.serverID, g.target.svType+"."+BatchRoute, res, g.req)
+	if err == nil && len(res.Results) != len(g.indexes) {
+		err = &RPCError{
+			Route: g.target.svType + "." + BatchRoute,
+			Err:   fmt.Errorf("batch answered %d results for %d calls", len(res.Results), len(g.indexes)),
+		}
+	}
+	for n, i := range g.indexes {
+		if err != nil {
+			rpcErr := err.(*RPCError)
+			results[i].Err = &RPCError{Route: results[i].Route, Err: rpcErr.Err, Attempts: rpcErr.Attempts}
+			continue
+		}
+		result := res.Results[n]
+		if result.ErrorCode != "" {
+			results[i].Err = &RPCError{
+				Route:    results[i].Route,
+				Err:      classifyRPCError(e.NewError(errors.New(result.ErrorMsg), result.ErrorCode, result.ErrorMetadata)),
+				Attempts: 1,
+			}
+			continue
+		}
+		results[i].Data = result.Data
+	}
+}
+
+// ServeBatches serves the rpcs carrying a BatchRequest received by server, each of their calls is
+// sent as a rpc of its own to the wrappers of server, going through the middlewares one by one.
+// It must wrap the server returned by MessageLimit.WrapRPCServer so the batches are decompressed
+// and their size checked, and be wrapped by the other ones.
+func ServeBatches(server cluster.RPCServer) cluster.RPCServer {
+	return &batchesRPCServer{RPCServer: server}
+}
+
+type batchesRPCServer struct {
+	cluster.RPCServer
+}
+
+func (s *batchesRPCServer) SetPitayaServer(server pitayaprotos.PitayaServer) {
+	s.RPCServer.SetPitayaServer(&batchesPitayaServer{PitayaServer: server})
+}
+
+type batchesPitayaServer struct {
+	pitayaprotos.PitayaServer
+}
+
+func (s *batchesPitayaServer) Call(ctx context.Context, req *pitayaprotos.Request) (*pitayaprotos.Response, error) {
+	if req.Type != pitayaprotos.RPCType_User || req.Msg == nil {
+		return s.PitayaServer.Call(ctx, req)
+	}
+	if rt, err := route.Decode(req.Msg.Route); err != nil || rt.Short() != BatchRoute {
+		return s.PitayaServer.Call(ctx, req)
+	}
+	return s.batch(ctx, req)
+}
+
+// batch serves a rpc carrying a BatchRequest, calling each of its routes in order
+func (s *batchesPitayaServer) batch(ctx context.Context, req *pitayaprotos.Request) (*pitayaprotos.Response, error) {
+	batch := &protos.BatchRequest{}
+	if err := proto.Unmarshal(req.Msg.Data, batch); err != nil {
+		return pitayaErrorResponse(e.NewError(err, e.ErrBadRequestCode)), nil
+	}
+	// the calls are not compressed, only the rpc carrying them
+	metadata := withoutEncodings(req.Metadata)
+
+	res := &protos.BatchResponse{Results: make([]*protos.BatchResult, len(batch.Calls))}
+	for i, call := range batch.Calls {
+		out, err := s.PitayaServer.Call(ctx, &pitayaprotos.Request{
+			Type:       req.Type,
+			Msg:        &pitayaprotos.Msg{Route: call.Route, Data: call.Data, Type: req.Msg.Type},
+			FrontendID: req.FrontendID,
+			Session:    req.Session,
+			Metadata:   metadata,
+		})
+		if err == nil && out.Error != nil {
+			err = e.NewError(errors.New(out.Error.Msg), out.Error.Code, out.Error.Metadata)
+		}
+		if err != nil {
+			perr := toPitayaError(err)
+			res.Results[i] = &protos.BatchResult{ErrorCode: perr.Code, ErrorMsg: perr.Message, ErrorMetadata: perr.Metadata}
+			continue
+		}
+		res.Results[i] = &protos.BatchResult{Data: out.Data}
+	}
+
+	data, err := proto.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return &pitayaprotos.Response{Data: data}, nil
+}
+
+// withoutEncodings removes the compression of the rpc from its encoded propagated context
+func withoutEncodings(metadata []byte) []byte {
+	if len(metadata) == 0 {
+		return metadata
+	}
+	decoded := map[string]interface{}{}
+	if err := json.Unmarshal(metadata, &decoded); err != nil {
+		return metadata
+	}
+	_, content := decoded[ContentEncodingKey]
+	_, accept := decoded[AcceptEncodingKey]
+	if !content && !accept {
+		return metadata
+	}
+	delete(decoded, ContentEncodingKey)
+	delete(decoded, AcceptEncodingKey)
+	encoded, err := json.Marshal(decoded)
+	if err != nil {
+		return metadata
+	}
+	return encoded
+}
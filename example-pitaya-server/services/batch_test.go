@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	nats "github.com/nats-io/nats.go"
+	"github.com/topfreegames/pitaya/component"
+	e "github.com/topfreegames/pitaya/errors"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+)
+
+// batchPitayaServer answers the route and message of the calls, failing the calls to room.room.fail
+type batchPitayaServer struct {
+	pitayaprotos.PitayaServer
+}
+
+func (batchPitayaServer) Call(ctx context.Context, req *pitayaprotos.Request) (*pitayaprotos.Response, error) {
+	if req.Msg.Route == "room.room.fail" {
+		return &pitayaprotos.Response{Error: &pitayaprotos.Error{Code: e.ErrBadRequestCode, Msg: "failed"}}, nil
+	}
+	msg := &protos.RPCMsg{}
+	if err := proto.Unmarshal(req.Msg.Data, msg); err != nil {
+		return nil, err
+	}
+	data, err := proto.Marshal(&protos.Response{Code: 200, Msg: req.Msg.Route + ":" + msg.Msg})
+	if err != nil {
+		return nil, err
+	}
+	return &pitayaprotos.Response{Data: data}, nil
+}
+
+// batchRPC sends the rpcs to servers serving the batches, recording the routes sent to each server
+type batchRPC struct {
+	server *fakeRPCServer
+	mutex  sync.Mutex
+	sent   map[string][]string
+	fail   map[string]error
+}
+
+func newBatchRPC() *batchRPC {
+	server := &fakeRPCServer{}
+	newTestRoutes().WrapRPCServer(ServeBatches(server)).SetPitayaServer(batchPitayaServer{})
+	return &batchRPC{server: server, sent: make(map[string][]string), fail: make(map[string]error)}
+}
+
+func (b *batchRPC) rpc(ctx context.Context, serverID, route string, reply, arg proto.Message) error {
+	b.mutex.Lock()
+	b.sent[serverID] = append(b.sent[serverID], route)
+	err := b.fail[serverID]
+	b.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	data, err := proto.Marshal(arg)
+	if err != nil {
+		return err
+	}
+	res, err := b.server.pitayaServer.Call(ctx, &pitayaprotos.Request{
+		Type: pitayaprotos.RPCType_User,
+		Msg:  &pitayaprotos.Msg{Route: route, Data: data},
+	})
+	if err != nil {
+		return err
+	}
+	if res.Error != nil {
+		return e.NewError(errors.New(res.Error.Msg), res.Error.Code, res.Error.Metadata)
+	}
+	return proto.Unmarshal(res.Data, reply)
+}
+
+func expectResult(t *testing.T, result Result, msg string) {
+	t.Helper()
+	res := &protos.Response{}
+	if err := result.Decode(res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Msg != msg {
+		t.Fatalf("expected %s, got %s", msg, res.Msg)
+	}
+}
+
+func TestBatchSameServer(t *testing.T) {
+	rpc := newBatchRPC()
+	client := NewRemoteClient(rpc.rpc)
+
+	results, err := client.Batch(context.Background()).
+		AddTo("room-1", "room.room.a", &protos.RPCMsg{Msg: "1"}).
+		AddTo("room-2", "room.room.b", &protos.RPCMsg{Msg: "2"}).
+		AddTo("room-1", "room.room.fail", &protos.RPCMsg{}).
+		AddTo("room-1", "room.room.c", &protos.RPCMsg{Msg: "3"}).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rpc.sent["room-1"]) != 1 || len(rpc.sent["room-2"]) != 1 || rpc.sent["room-1"][0] != "room."+BatchRoute {
+		t.Fatalf("expected one rpc to each server, got %v", rpc.sent)
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(results))
+	}
+	expectResult(t, results[0], "room.room.a:1")
+	expectResult(t, results[1], "room.room.b:2")
+	expectResult(t, results[3], "room.room.c:3")
+
+	var rpcErr *RPCError
+	var pitayaErr *e.Error
+	if !errors.As(results[2].Err, &rpcErr) || rpcErr.Route != "room.room.fail" ||
+		!errors.As(results[2].Err, &pitayaErr) || pitayaErr.Code != e.ErrBadRequestCode {
+		t.Fatalf("expected the failed call to have its error, got %v", results[2].Err)
+	}
+}
+
+func TestBatchServerFailure(t *testing.T) {
+	rpc := newBatchRPC()
+	rpc.fail["room-2"] = nats.ErrTimeout
+	client := NewRemoteClient(rpc.rpc)
+
+	results, err := client.Batch(context.Background()).
+		AddTo("room-1", "room.room.a", &protos.RPCMsg{Msg: "1"}).
+		AddTo("room-2", "room.room.b", &protos.RPCMsg{Msg: "2"}).
+		AddTo("room-2", "room.room.c", &protos.RPCMsg{Msg: "3"}).
+		Add("room", &protos.RPCMsg{}).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectResult(t, results[0], "room.room.a:1")
+	for _, result := range results[1:3] {
+		var rpcErr *RPCError
+		if !errors.As(result.Err, &rpcErr) || rpcErr.Route != result.Route || !errors.Is(result.Err, ErrRPCTimeout) {
+			t.Fatalf("expected a timeout of %s, got %v", result.Route, result.Err)
+		}
+	}
+	if results[3].Err == nil {
+		t.Fatal("routes without server type should fail")
+	}
+}
+
+func TestBatchAnyServer(t *testing.T) {
+	rpc := newBatchRPC()
+	client := NewRemoteClient(rpc.rpc)
+
+	results, err := client.Batch(context.Background()).
+		Add("room.room.a", &protos.RPCMsg{Msg: "1"}).
+		Add("room.room.b", &protos.RPCMsg{Msg: "2"}).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rpc.sent[""]) != 1 {
+		t.Fatalf("calls to any server of a type should share a rpc, got %v", rpc.sent)
+	}
+	expectResult(t, results[0], "room.room.a:1")
+	expectResult(t, results[1], "room.room.b:2")
+}
+
+func TestBatchExecutedOnce(t *testing.T) {
+	batch := NewRemoteClient(newBatchRPC().rpc).Batch(context.Background())
+	if _, err := batch.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := batch.Execute(); err != ErrBatchExecuted {
+		t.Fatalf("expected ErrBatchExecuted, got %v", err)
+	}
+}
+
+func TestBatchWithoutEncodings(t *testing.T) {
+	metadata, err := json.Marshal(map[string]interface{}{
+		ContentEncodingKey: "zstd",
+		AcceptEncodingKey:  "zstd",
+		"correlation-id":   "abc",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := map[string]interface{}{}
+	if err := json.Unmarshal(withoutEncodings(metadata), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 || decoded["correlation-id"] != "abc" {
+		t.Fatalf("expected only the encodings to be removed, got %v", decoded)
+	}
+}
+
+// panickyRemote panics on every call
+type panickyRemote struct {
+	component.Base
+}
+
+func (panickyRemote) Panic(ctx context.Context, message []byte) (*protos.Response, error) {
+	panic("boom")
+}
+
+func TestBatchCallsGoThroughTheMiddlewares(t *testing.T) {
+	routes := newTestRoutes()
+	if err := routes.HandleRemote("room.panic", &panickyRemote{}, "Panic"); err != nil {
+		t.Fatal(err)
+	}
+	limiter := NewConcurrencyLimiter(ConcurrencyOptions{
+		Routes: map[string]ConcurrencyRule{"room.room.busy": {Limit: 1}},
+	})
+	release, err := limiter.Acquire(context.Background(), "room.room.busy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	server := &fakeRPCServer{}
+	pipeline := NewPipeline(Recovery(NewNopLogger()), limiter.Middleware())
+	routes.WrapRPCServer(pipeline.WrapRPCServer(ServeBatches(server))).SetPitayaServer(batchPitayaServer{})
+	rpc := &batchRPC{server: server, sent: make(map[string][]string), fail: make(map[string]error)}
+
+	results, err := NewRemoteClient(rpc.rpc).Batch(context.Background()).
+		AddTo("room-1", "room.room.panic", &protos.RPCMsg{}).
+		AddTo("room-1", "room.room.busy", &protos.RPCMsg{}).
+		AddTo("room-1", "room.room.a", &protos.RPCMsg{Msg: "1"}).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rpc.sent["room-1"]) != 1 {
+		t.Fatalf("expected the calls to share a rpc, got %v", rpc.sent)
+	}
+
+	var pitayaErr *e.Error
+	if !errors.As(results[0].Err, &pitayaErr) || pitayaErr.Code != e.ErrInternalCode {
+		t.Fatalf("expected the panic to be recovered, got %v", results[0].Err)
+	}
+	if !errors.As(results[1].Err, &pitayaErr) || pitayaErr.Code != ErrUnavailableCode {
+		t.Fatalf("expected the capped route to be overloaded, got %v", results[1].Err)
+	}
+	expectResult(t, results[2], "room.room.a:1")
+}
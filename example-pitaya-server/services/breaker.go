@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/topfreegames/pitaya/cluster"
+	"github.com/topfreegames/pitaya/conn/message"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/route"
+	"github.com/topfreegames/pitaya/session"
+)
+
+// DefaultBreakerCooldown is how long a breaker stays open when no cooldown is configured
+const DefaultBreakerCooldown = 10 * time.Second
+
+// ErrCircuitOpen is returned without calling the server while its breaker is open
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitState is the state of the breaker of a server
+type CircuitState int
+
+// States of the breakers
+const (
+	// CircuitClosed lets the calls through, counting the consecutive failures
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails the calls with ErrCircuitOpen until the cooldown elapsed
+	CircuitOpen
+	// CircuitHalfOpen lets one call through to probe the server, failing the others
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerOptions configures a CircuitBreaker
+type BreakerOptions struct {
+	// Failures is the number of consecutive failures opening the breaker, 0 disables the breaker
+	Failures int
+	// Cooldown is how long the breaker stays open before probing the server, DefaultBreakerCooldown when 0
+	Cooldown time.Duration
+}
+
+// BreakerState is a snapshot of the breaker of a server, meant to be exported as metrics
+type BreakerState struct {
+	ServerID string
+	State    CircuitState
+	Failures int
+}
+
+type breaker struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// CircuitBreaker stops calling the servers that keep failing. A call fails when the server didn't
+// answer, e.g. on timeouts, or answered a deadline exceeded error; errors answered by the remotes
+// mean the server is up and don't count.
+type CircuitBreaker struct {
+	mutex    sync.Mutex
+	opts     BreakerOptions
+	breakers map[string]*breaker
+	clock    Clock
+}
+
+// NewCircuitBreaker returns a new circuit breaker keeping a breaker per server
+func NewCircuitBreaker(opts BreakerOptions) *CircuitBreaker {
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = DefaultBreakerCooldown
+	}
+	return &CircuitBreaker{
+		opts:     opts,
+		breakers: make(map[string]*breaker),
+		clock:    RealClock,
+	}
+}
+
+// allow returns nil when a call to serverID can be made, it must be followed by a call to done or release
+func (c *CircuitBreaker) allow(serverID string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	b, ok := c.breakers[serverID]
+	if !ok {
+		return nil
+	}
+	switch b.state {
+	case CircuitOpen:
+		if c.clock.Now().Sub(b.openedAt) < c.opts.Cooldown {
+			return fmt.Errorf("%w: server %s", ErrCircuitOpen, serverID)
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		return nil
+	case CircuitHalfOpen:
+		if b.probing {
+			return fmt.Errorf("%w: server %s is being probed", ErrCircuitOpen, serverID)
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// release ends a call to serverID without outcome, e.g. canceled by its caller
+func (c *CircuitBreaker) release(serverID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if b, ok := c.breakers[serverID]; ok {
+		b.probing = false
+	}
+}
+
+// done records the outcome of a call to serverID
+func (c *CircuitBreaker) done(serverID string, failed bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	b, ok := c.breakers[serverID]
+	if !failed {
+		// healthy servers have no breaker
+		delete(c.breakers, serverID)
+		return
+	}
+	if !ok {
+		b = &breaker{}
+		c.breakers[serverID] = b
+	}
+	b.failures++
+	b.probing = false
+	if b.state == CircuitHalfOpen || b.failures >= c.opts.Failures {
+		b.state = CircuitOpen
+		b.openedAt = c.clock.Now()
+	}
+}
+
+// State returns the state of the breaker of serverID
+func (c *CircuitBreaker) State(serverID string) CircuitState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if b, ok := c.breakers[serverID]; ok {
+		return b.state
+	}
+	return CircuitClosed
+}
+
+// States returns the state of the servers that failed since their last successful call, sorted by server id
+func (c *CircuitBreaker) States() []BreakerState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	states := make([]BreakerState, 0, len(c.breakers))
+	for serverID, b := range c.breakers {
+		states = append(states, BreakerState{ServerID: serverID, State: b.state, Failures: b.failures})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].ServerID < states[j].ServerID })
+	return states
+}
+
+// isBreakerFailure returns whether the call answered res and err because the server is unhealthy
+func isBreakerFailure(res *pitayaprotos.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return res != nil && res.Error != nil && res.Error.Code == ErrDeadlineExceededCode
+}
+
+// WrapRPCClient makes the calls of client go through the breaker of the server they are sent to,
+// client is returned as is when the breaker is disabled
+func (c *CircuitBreaker) WrapRPCClient(client cluster.RPCClient) cluster.RPCClient {
+	if c.opts.Failures <= 0 {
+		return client
+	}
+	return &breakerRPCClient{RPCClient: client, breaker: c}
+}
+
+type breakerRPCClient struct {
+	cluster.RPCClient
+	breaker *CircuitBreaker
+}
+
+func (r *breakerRPCClient) Call(
+	ctx context.Context,
+	rpcType pitayaprotos.RPCType,
+	route *route.Route,
+	session *session.Session,
+	msg *message.Message,
+	server *cluster.Server,
+) (*pitayaprotos.Response, error) {
+	if err := r.breaker.allow(server.ID); err != nil {
+		return nil, err
+	}
+	res, err := r.RPCClient.Call(ctx, rpcType, route, session, msg, server)
+	if errors.Is(err, context.Canceled) {
+		r.breaker.release(server.ID)
+		return res, err
+	}
+	r.breaker.done(server.ID, isBreakerFailure(res, err))
+	return res, err
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/topfreegames/pitaya/cluster"
+	"github.com/topfreegames/pitaya/conn/message"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/route"
+	"github.com/topfreegames/pitaya/session"
+)
+
+// flakyRPCClient fails the calls while failing is set, counting the calls that reached it
+type flakyRPCClient struct {
+	cluster.RPCClient
+	failing error
+	calls   int
+}
+
+func (f *flakyRPCClient) Call(
+	ctx context.Context,
+	rpcType pitayaprotos.RPCType,
+	route *route.Route,
+	session *session.Session,
+	msg *message.Message,
+	server *cluster.Server,
+) (*pitayaprotos.Response, error) {
+	f.calls++
+	if f.failing != nil {
+		return nil, f.failing
+	}
+	return &pitayaprotos.Response{}, nil
+}
+
+func callServer(client cluster.RPCClient, serverID string) error {
+	_, err := client.Call(context.Background(), pitayaprotos.RPCType_User, route.NewRoute("room", "room", "join"),
+		nil, &message.Message{}, &cluster.Server{ID: serverID})
+	return err
+}
+
+func TestBreakerCycle(t *testing.T) {
+	clock := newFakeClock()
+	breaker := NewCircuitBreaker(BreakerOptions{Failures: 3, Cooldown: 10 * time.Second})
+	breaker.clock = clock
+	flaky := &flakyRPCClient{failing: nats.ErrTimeout}
+	client := breaker.WrapRPCClient(flaky)
+
+	// closed: the failures reach the server until the threshold
+	for i := 0; i < 3; i++ {
+		if breaker.State("room-1") == CircuitOpen {
+			t.Fatalf("the breaker opened after %d failures", i)
+		}
+		if err := callServer(client, "room-1"); err != nats.ErrTimeout {
+			t.Fatalf("expected the error of the server, got %v", err)
+		}
+	}
+
+	// open: the calls fail fast
+	if state := breaker.State("room-1"); state != CircuitOpen {
+		t.Fatalf("expected the breaker to be open, got %s", state)
+	}
+	if err := callServer(client, "room-1"); !errors.Is(err, ErrCircuitOpen) || flaky.calls != 3 {
+		t.Fatalf("expected ErrCircuitOpen without calling the server, got %v after %d calls", err, flaky.calls)
+	}
+	// other servers are not affected
+	flaky.failing = nil
+	if err := callServer(client, "room-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// half-open: a failing probe opens the breaker again
+	flaky.failing = nats.ErrTimeout
+	clock.Advance(10 * time.Second)
+	if err := callServer(client, "room-1"); err != nats.ErrTimeout {
+		t.Fatalf("expected the probe to reach the server, got %v", err)
+	}
+	if state := breaker.State("room-1"); state != CircuitOpen {
+		t.Fatalf("a failing probe should open the breaker, got %s", state)
+	}
+	clock.Advance(5 * time.Second)
+	if err := callServer(client, "room-1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("the cooldown should restart after a failing probe, got %v", err)
+	}
+
+	// half-open: a successful probe closes the breaker
+	flaky.failing = nil
+	clock.Advance(5 * time.Second)
+	if err := callServer(client, "room-1"); err != nil {
+		t.Fatal(err)
+	}
+	if state := breaker.State("room-1"); state != CircuitClosed || len(breaker.States()) != 0 {
+		t.Fatalf("expected the breaker to be closed, got %s and %v", state, breaker.States())
+	}
+}
+
+func TestBreakerSingleProbe(t *testing.T) {
+	clock := newFakeClock()
+	breaker := NewCircuitBreaker(BreakerOptions{Failures: 1})
+	breaker.clock = clock
+	breaker.done("room-1", true)
+
+	clock.Advance(DefaultBreakerCooldown)
+	if err := breaker.allow("room-1"); err != nil {
+		t.Fatal(err)
+	}
+	if state := breaker.State("room-1"); state != CircuitHalfOpen {
+		t.Fatalf("expected the breaker to be half-open, got %s", state)
+	}
+	if err := breaker.allow("room-1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("only one probe should be made at a time, got %v", err)
+	}
+	// a canceled probe lets another one through
+	breaker.release("room-1")
+	if err := breaker.allow("room-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	states := breaker.States()
+	if len(states) != 1 || states[0].ServerID != "room-1" || states[0].State != CircuitHalfOpen || states[0].Failures != 1 {
+		t.Fatalf("unexpected states %v", states)
+	}
+}
+
+func TestBreakerFailures(t *testing.T) {
+	tables := []struct {
+		name   string
+		res    *pitayaprotos.Response
+		err    error
+		failed bool
+	}{
+		{"ok", &pitayaprotos.Response{}, nil, false},
+		{"timeout", nil, nats.ErrTimeout, true},
+		{"deadline", &pitayaprotos.Response{Error: &pitayaprotos.Error{Code: ErrDeadlineExceededCode}}, nil, true},
+		{"remote error", &pitayaprotos.Response{Error: &pitayaprotos.Error{Code: "PIT-400"}}, nil, false},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			if failed := isBreakerFailure(table.res, table.err); failed != table.failed {
+				t.Fatalf("expected failed to be %v", table.failed)
+			}
+		})
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	flaky := &flakyRPCClient{}
+	if NewCircuitBreaker(BreakerOptions{}).WrapRPCClient(flaky) != flaky {
+		t.Fatal("the client should not be wrapped without failures threshold")
+	}
+}
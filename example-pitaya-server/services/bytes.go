@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	// pooledBufferSize is the initial capacity of the pooled buffers
+	pooledBufferSize = 4 * 1024
+	// maxPooledBufferSize is the capacity above which buffers are left to the gc instead of pooled,
+	// so a few large messages do not keep their memory around
+	maxPooledBufferSize = 64 * 1024
+)
+
+var buffers = sync.Pool{
+	New: func() interface{} {
+		return proto.NewBuffer(make([]byte, 0, pooledBufferSize))
+	},
+}
+
+// marshalPooled encodes msg into a pooled buffer. The bytes are only valid until release is called,
+// so they must not be handed to the transport, which keeps them after the remote returns.
+// Anything keeping them longer, like a middleware caching the answers, must copy them.
+func marshalPooled(msg proto.Message) (data []byte, release func(), err error) {
+	b := buffers.Get().(*proto.Buffer)
+	release = func() { releaseBuffer(b) }
+	if err := b.Marshal(msg); err != nil {
+		release()
+		return nil, nil, err
+	}
+	return b.Bytes(), release, nil
+}
+
+// releaseBuffer gives back b to the pool, it must not be used afterwards
+func releaseBuffer(b *proto.Buffer) {
+	if cap(b.Bytes()) > maxPooledBufferSize {
+		return
+	}
+	b.Reset()
+	buffers.Put(b)
+}
+
+// pooledAnswers is the context of a rpc whose remote may encode its answer into a pooled buffer
+type pooledAnswers struct {
+	context.Context
+	buffer *proto.Buffer
+}
+
+type pooledAnswersKey struct{}
+
+func (a *pooledAnswers) Value(key interface{}) interface{} {
+	if key == (pooledAnswersKey{}) {
+		return a
+	}
+	return a.Context.Value(key)
+}
+
+// withPooledAnswers returns a ctx letting the remotes called with it encode their answer into a
+// pooled buffer, see marshalAnswer. The buffer is given back by pooledAnswers.release once the
+// middlewares returned.
+func withPooledAnswers(ctx context.Context) *pooledAnswers {
+	return &pooledAnswers{Context: ctx}
+}
+
+// marshalAnswer encodes the answer of a remote, into a pooled buffer when ctx allows it
+func marshalAnswer(ctx context.Context, msg proto.Message) ([]byte, error) {
+	answers, ok := ctx.Value(pooledAnswersKey{}).(*pooledAnswers)
+	if !ok || answers.buffer != nil {
+		return proto.Marshal(msg)
+	}
+	b := buffers.Get().(*proto.Buffer)
+	if err := b.Marshal(msg); err != nil {
+		releaseBuffer(b)
+		return nil, err
+	}
+	answers.buffer = b
+	return b.Bytes(), nil
+}
+
+// release gives back the buffer of the answer and returns out, the answer sent to the transport,
+// copied when it is in the buffer. It must only be called once the handlers using the answer
+// returned, the buffer is left to the gc when the call failed as the handlers may still be
+// running past the deadline.
+func (a *pooledAnswers) release(out []byte) []byte {
+	if a.buffer == nil {
+		return out
+	}
+	if data := a.buffer.Bytes(); cap(out) > 0 && cap(data) > 0 && &out[:cap(out)][cap(out)-1] == &data[:cap(data)][cap(data)-1] {
+		// out is a slice of the buffer, their capacities end at its end
+		out = append([]byte(nil), out...)
+	}
+	releaseBuffer(a.buffer)
+	a.buffer = nil
+	return out
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	pcontext "github.com/topfreegames/pitaya/context"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+)
+
+func TestRemoteFuncBytesReferencesMessage(t *testing.T) {
+	remote := NewConnectorRemote(nil)
+	message := []byte(`{"msg":"hi"}`)
+	res, err := remote.RemoteFuncBytes(context.Background(), message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if &res.Msg[0] != &message[0] {
+		t.Fatal("json messages should be echoed without a copy")
+	}
+
+	// both responses have the same encoding
+	data, err := proto.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &protos.Response{}
+	if err := proto.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Msg != string(message) {
+		t.Fatalf("expected %s, got %v", message, decoded)
+	}
+}
+
+func TestPipelinedResponseOutlivesPooledBuffer(t *testing.T) {
+	remote := NewConnectorRemote(nil, WithPipeline(NewPipeline()))
+	message := payload(4 * 1024)
+	res, err := remote.RemoteFuncBytes(context.Background(), message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// reuse the released buffers
+	for i := 0; i < 10; i++ {
+		_, release, err := marshalPooled(&protos.BytesResponse{Msg: bytes.Repeat([]byte("x"), len(message))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	if !bytes.Equal(res.Msg, message) {
+		t.Fatal("the response should not reference the pooled buffer")
+	}
+}
+
+// remoteFuncRPC returns the rpc server calling RemoteFunc through the middlewares of pipeline like main
+func remoteFuncRPC(t testing.TB, pipeline *Pipeline) *fakeRPCServer {
+	routes := newTestRoutes()
+	if err := routes.HandleRemote("connectorremote.remotefunc", NewConnectorRemote(nil), "RemoteFuncBytes"); err != nil {
+		t.Fatal(err)
+	}
+	rpcServer := &fakeRPCServer{}
+	routes.WrapRPCServer(pipeline.WrapRPCServer(rpcServer)).SetPitayaServer(&countingPitayaServer{})
+	return rpcServer
+}
+
+// callRemoteFuncRPC calls RemoteFunc with message propagating ctx and returns the data of the answer
+func callRemoteFuncRPC(t testing.TB, rpcServer *fakeRPCServer, ctx context.Context, message []byte) []byte {
+	metadata, err := pcontext.Encode(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := rpcServer.pitayaServer.Call(context.Background(), &pitayaprotos.Request{
+		Type:     pitayaprotos.RPCType_User,
+		Msg:      &pitayaprotos.Msg{Route: RemoteFuncRoute, Data: message},
+		Metadata: metadata,
+	})
+	if err != nil || res.Error != nil {
+		t.Fatalf("unexpected answer: %v %v", res, err)
+	}
+	return res.Data
+}
+
+func TestRPCAnswerOutlivesPooledBuffer(t *testing.T) {
+	rpcServer := remoteFuncRPC(t, NewPipeline())
+	message := []byte(`{"nick":"` + strings.Repeat("x", 4*1024) + `"}`)
+	data := callRemoteFuncRPC(t, rpcServer, context.Background(), message)
+	expected, err := proto.Marshal(&protos.BytesResponse{Msg: message})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// reuse the released buffers while the transport still holds the answer
+	for i := 0; i < 10; i++ {
+		_, release, err := marshalPooled(&protos.BytesResponse{Msg: bytes.Repeat([]byte("y"), len(message))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	if !bytes.Equal(data, expected) {
+		t.Fatal("the answer sent to the transport should not reference the pooled buffer")
+	}
+}
+
+func TestPooledAnswersRelease(t *testing.T) {
+	answer := &protos.BytesResponse{Code: 200, Msg: []byte("hi")}
+	expected, err := proto.Marshal(answer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	answers := withPooledAnswers(context.Background())
+	data, err := marshalAnswer(answers, answer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := answers.release(data[1:]); &out[0] == &data[1] || !bytes.Equal(out, expected[1:]) {
+		t.Fatal("an answer in the pooled buffer should be copied out of it")
+	}
+
+	// the answers replaced by the middlewares are left as is
+	answers = withPooledAnswers(context.Background())
+	if _, err := marshalAnswer(answers, answer); err != nil {
+		t.Fatal(err)
+	}
+	replaced := []byte("replaced")
+	if out := answers.release(replaced); &out[0] != &replaced[0] {
+		t.Fatal("an answer out of the pooled buffer should not be copied")
+	}
+}
+
+func TestMarshalPooledReset(t *testing.T) {
+	_, release, err := marshalPooled(&protos.BytesResponse{Msg: payload(1024)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	small := &protos.BytesResponse{Code: 200, Msg: []byte("hi")}
+	data, release, err := marshalPooled(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	expected, err := proto.Marshal(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, expected) {
+		t.Fatalf("released buffers should be reset, got %x", data)
+	}
+}
+
+func benchmarkRemote(b *testing.B, remote *ConnectorRemote, method string) {
+	named, err := newNamedRemote(remote, method)
+	if err != nil {
+		b.Fatal(err)
+	}
+	message := payload(4 * 1024)
+	ctx := context.Background()
+	b.SetBytes(int64(len(message)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := named.call(ctx, message); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRemoteFunc4KB calls the remotes like their explicit routes do, decoding and encoding the messages
+func BenchmarkRemoteFunc4KB(b *testing.B) {
+	b.Run("string", func(b *testing.B) {
+		benchmarkRemote(b, NewConnectorRemote(nil), "RemoteFunc")
+	})
+	b.Run("bytes", func(b *testing.B) {
+		benchmarkRemote(b, NewConnectorRemote(nil), "RemoteFuncBytes")
+	})
+	b.Run("bytes pipelined", func(b *testing.B) {
+		benchmarkRemote(b, NewConnectorRemote(nil, WithPipeline(NewPipeline())), "RemoteFuncBytes")
+	})
+}
+
+// BenchmarkRemoteFuncRPC4KB calls RemoteFunc through the rpc server of main, the answers to the
+// callers at an older schema version are downgraded out of the pooled buffer
+func BenchmarkRemoteFuncRPC4KB(b *testing.B) {
+	message := []byte(`{"nick":"` + strings.Repeat("x", 4*1024) + `"}`)
+	for _, bench := range []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"current version", context.Background()},
+		{"migrated", WithSchemaVersion(context.Background(), 2)},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			rpcServer := remoteFuncRPC(b, NewPipeline(newTestMigrations().Middleware()))
+			b.SetBytes(int64(len(message)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				callRemoteFuncRPC(b, rpcServer, bench.ctx, message)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package services
+
+import "time"
+
+// Clock tells the time to the components measuring it, so tests can move it by hand, see testkit.FakeClock
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a time.Timer of a Clock
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// RealClock is the clock of the system, the one of the components unless a test replaces it
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// WithClock measures the idle timeouts, the reconnections and the connection times of the sessions with clock
+func WithClock(clock Clock) ConnectorOption {
+	return func(c *Connector) {
+		c.idle.clock = clock
+		c.lifecycle.clock = clock
+		c.drain.clock = clock
+	}
+}
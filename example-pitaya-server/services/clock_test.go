@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when advanced
+type fakeClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	timers  []*fakeTimer
+	waiting chan struct{}
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	at    time.Time
+	ch    chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(0, 0), waiting: make(chan struct{}, 16)}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+func (f *fakeClock) NewTimer(d time.Duration) Timer {
+	timer := &fakeTimer{clock: f, ch: make(chan time.Time, 1)}
+	timer.Reset(d)
+	return timer
+}
+
+// wait waits for a goroutine to wait on the clock
+func (f *fakeClock) wait(t *testing.T) {
+	select {
+	case <-f.waiting:
+	case <-time.After(time.Second):
+		t.Fatal("nothing waits on the clock")
+	}
+}
+
+// Advance moves the clock by d, firing the timers that are due
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.now = f.now.Add(d)
+	pending := f.timers[:0]
+	for _, timer := range f.timers {
+		if timer.at.After(f.now) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.ch <- f.now
+	}
+	f.timers = pending
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	return t.stop()
+}
+
+// stop removes the timer from the clock, it must be called with the mutex of the clock held
+func (t *fakeTimer) stop() bool {
+	for i, timer := range t.clock.timers {
+		if timer == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	active := t.stop()
+	t.at = t.clock.now.Add(d)
+	t.clock.timers = append(t.clock.timers, t)
+	t.clock.waiting <- struct{}{}
+	return active
+}
+
+func TestRetryWaitsOnClock(t *testing.T) {
+	clock := newFakeClock()
+	policy := RetryPolicy{MaxAttempts: 2, BaseDelay: time.Second, Retryable: func(error) bool { return true }}
+	waited := make(chan bool)
+	go func() {
+		waited <- policy.wait(context.Background(), clock, 1, errors.New("timeout"))
+	}()
+
+	clock.wait(t)
+	select {
+	case <-waited:
+		t.Fatal("expected the retry to wait for the clock")
+	default:
+	}
+	clock.Advance(time.Second)
+	if !<-waited {
+		t.Fatal("expected the call to be retried")
+	}
+	if policy.wait(context.Background(), clock, 2, errors.New("last attempt")) {
+		t.Fatal("expected the exhausted policy not to retry")
+	}
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// ErrUntrustedPeer is returned when the certificate of a server of the cluster is not signed by the CA
+var ErrUntrustedPeer = errors.New("untrusted peer certificate")
+
+// ClusterTLSOptions configures the mutual tls of the rpcs between the servers of the cluster
+type ClusterTLSOptions struct {
+	// CAFile is the pem bundle of the authorities signing the certificates of the servers
+	CAFile string
+	// CertFile and KeyFile are the certificate presented by this server, both to its callers and
+	// to the servers it calls
+	CertFile string
+	KeyFile  string
+	// RequireClientCert rejects the callers without a certificate signed by the CA, the
+	// certificates of the callers are only verified when presented otherwise
+	RequireClientCert bool
+	// ServerName is the name the certificates of the servers called must be valid for, any
+	// certificate signed by the CA is accepted when empty as the servers are dialed by address
+	ServerName string
+}
+
+// ClusterTLS holds the certificates of the rpcs between the servers, see NewTLSGRPCServer and
+// NewTLSGRPCClient. The certificates can be reloaded without a restart, the connections
+// established keep the certificates they were established with.
+type ClusterTLS struct {
+	opts  ClusterTLSOptions
+	mutex sync.RWMutex
+	cert  *tls.Certificate
+	pool  *x509.CertPool
+}
+
+// NewClusterTLS loads the certificates configured by opts
+func NewClusterTLS(opts ClusterTLSOptions) (*ClusterTLS, error) {
+	t := &ClusterTLS{opts: opts}
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Reload reads the certificates again, they are kept when reading them fails
+func (t *ClusterTLS) Reload() error {
+	cert, err := tls.LoadX509KeyPair(t.opts.CertFile, t.opts.KeyFile)
+	if err != nil {
+		return err
+	}
+	bundle, err := ioutil.ReadFile(t.opts.CAFile)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return fmt.Errorf("no certificate found in %s", t.opts.CAFile)
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.cert = &cert
+	t.pool = pool
+	return nil
+}
+
+// ReloadOn reloads the certificates whenever the process receives one of signals, usually
+// SIGHUP, until the returned func is called
+func (t *ClusterTLS) ReloadOn(logger Logger, signals ...os.Signal) func() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ch:
+			case <-done:
+				return
+			}
+			if err := t.Reload(); err != nil {
+				logger.Error("failed to reload the cluster certificates", "error", err.Error())
+				continue
+			}
+			logger.Info("reloaded the cluster certificates", "cert", t.opts.CertFile)
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+func (t *ClusterTLS) current() (*tls.Certificate, *x509.CertPool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.cert, t.pool
+}
+
+// ServerConfig returns the tls config of the rpc servers, the handshake of the callers whose
+// certificate is missing or not signed by the CA fails before any rpc is read
+func (t *ClusterTLS) ServerConfig() *tls.Config {
+	clientAuth := tls.VerifyClientCertIfGiven
+	if t.opts.RequireClientCert {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := t.current()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientCAs:    pool,
+				ClientAuth:   clientAuth,
+			}, nil
+		},
+	}
+}
+
+// ClientConfig returns the tls config of the rpc clients, presenting the certificate of this
+// server and verifying the servers called against the CA
+func (t *ClusterTLS) ClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := t.current()
+			return cert, nil
+		},
+		// the servers are verified by VerifyConnection against the CA loaded last, the default
+		// verification would keep the CA of the config and check the address dialed
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return t.verifyServer(cs.PeerCertificates)
+		},
+	}
+}
+
+// verifyServer checks that the chain presented by a server is signed by the CA
+func (t *ClusterTLS) verifyServer(certs []*x509.Certificate) error {
+	if len(certs) == 0 {
+		return ErrUntrustedPeer
+	}
+	_, pool := t.current()
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName:       t.opts.ServerName,
+		Roots:         pool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrUntrustedPeer, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,385 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/topfreegames/pitaya/cluster"
+	"github.com/topfreegames/pitaya/conn/message"
+	pcontext "github.com/topfreegames/pitaya/context"
+	e "github.com/topfreegames/pitaya/errors"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/route"
+	"github.com/topfreegames/pitaya/session"
+)
+
+const (
+	// AcceptEncodingKey is the server metadata and propagated context key listing the encodings a server can read
+	AcceptEncodingKey = "accept-encoding"
+	// ContentEncodingKey is the propagated context key with the encoding of the rpc message
+	ContentEncodingKey = "content-encoding"
+	// DefaultCompressionMinSize is the size below which payloads are not worth compressing
+	DefaultCompressionMinSize = 1024
+)
+
+// ErrUnsupportedEncoding is returned when a payload was compressed with an unknown encoding
+var ErrUnsupportedEncoding = errors.New("unsupported encoding")
+
+// Codec compresses rpc payloads
+type Codec interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	// Decompress fails with a *MessageTooLargeError when data decompresses to more than max
+	// bytes, without decompressing the rest. Any size is accepted when max is 0.
+	Decompress(data []byte, max int) ([]byte, error)
+}
+
+type gzipCodec struct{}
+
+// NewGzipCodec returns a codec compressing with gzip
+func NewGzipCodec() Codec {
+	return gzipCodec{}
+}
+
+func (gzipCodec) Name() string {
+	return "gzip"
+}
+
+func (gzipCodec) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decompress(data []byte, max int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if max <= 0 {
+		return ioutil.ReadAll(r)
+	}
+	// one more byte than the limit tells the payloads at the limit from the larger ones
+	out, err := ioutil.ReadAll(io.LimitReader(r, int64(max)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > max {
+		return nil, &MessageTooLargeError{Size: len(out), Max: max}
+	}
+	return out, nil
+}
+
+type zstdCodec struct {
+	encoder  *zstd.Encoder
+	mutex    sync.Mutex
+	decoders map[int]*zstd.Decoder
+}
+
+// NewZstdCodec returns a codec compressing with zstd
+func NewZstdCodec() Codec {
+	// single segment frames need a window of their size only, readers limiting their memory
+	// accept the payloads up to their limit
+	encoder, _ := zstd.NewWriter(nil, zstd.WithSingleSegment(true))
+	return &zstdCodec{encoder: encoder, decoders: make(map[int]*zstd.Decoder)}
+}
+
+// decoder returns the decoder allocating at most max bytes, created on first use
+func (z *zstdCodec) decoder(max int) (*zstd.Decoder, error) {
+	z.mutex.Lock()
+	defer z.mutex.Unlock()
+	if decoder, ok := z.decoders[max]; ok {
+		return decoder, nil
+	}
+	var opts []zstd.DOption
+	if max > 0 {
+		opts = append(opts, zstd.WithDecoderMaxMemory(uint64(max)))
+	}
+	decoder, err := zstd.NewReader(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	z.decoders[max] = decoder
+	return decoder, nil
+}
+
+func (z *zstdCodec) Name() string {
+	return "zstd"
+}
+
+func (z *zstdCodec) Compress(data []byte) ([]byte, error) {
+	return z.encoder.EncodeAll(data, nil), nil
+}
+
+func (z *zstdCodec) Decompress(data []byte, max int) ([]byte, error) {
+	decoder, err := z.decoder(max)
+	if err != nil {
+		return nil, err
+	}
+	out, err := decoder.DecodeAll(data, nil)
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+		return nil, &MessageTooLargeError{Size: len(out), Max: max}
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the frames of unknown size are only bounded one at a time
+	if max > 0 && len(out) > max {
+		return nil, &MessageTooLargeError{Size: len(out), Max: max}
+	}
+	return out, nil
+}
+
+// CompressionOptions configures a Compression
+type CompressionOptions struct {
+	// MinSize is the size below which payloads are sent uncompressed
+	MinSize int
+	// MaxSize is the size of the largest payload decompressed, usually the MessageLimit, the
+	// larger ones fail with ErrMessageTooLargeCode. Payloads of any size are accepted when 0.
+	MaxSize int
+	// Codecs are the supported encodings in order of preference, gzip is used when empty
+	Codecs []Codec
+}
+
+// Compression compresses rpc messages and their responses with an encoding both servers support.
+//
+// Servers advertise the encodings they read in their metadata. A caller compresses the message
+// for servers that advertised one of its encodings and sends the encodings it reads in the
+// propagated context, the receiver then compresses the response with the first one it supports.
+// Responses to callers accepting compression are framed with the name of their encoding,
+// empty when the response was too small to be compressed.
+type Compression struct {
+	minSize int
+	maxSize int
+	codecs  []Codec
+}
+
+// NewCompression returns a new compression configured by opts
+func NewCompression(opts CompressionOptions) *Compression {
+	if len(opts.Codecs) == 0 {
+		opts.Codecs = []Codec{NewGzipCodec()}
+	}
+	return &Compression{
+		minSize: opts.MinSize,
+		maxSize: opts.MaxSize,
+		codecs:  opts.Codecs,
+	}
+}
+
+// AcceptEncoding returns the encodings the server reads, to be set in its metadata under AcceptEncodingKey
+func (c *Compression) AcceptEncoding() string {
+	names := make([]string, len(c.codecs))
+	for i, codec := range c.codecs {
+		names[i] = codec.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (c *Compression) codec(name string) (Codec, bool) {
+	for _, codec := range c.codecs {
+		if codec.Name() == name {
+			return codec, true
+		}
+	}
+	return nil, false
+}
+
+// negotiate returns the preferred codec among the accepted encodings
+func (c *Compression) negotiate(accept string) (Codec, bool) {
+	accepted := strings.Split(accept, ",")
+	for _, codec := range c.codecs {
+		for _, name := range accepted {
+			if strings.TrimSpace(name) == codec.Name() {
+				return codec, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// compress returns data compressed with codec, or nil when it is below the threshold
+func (c *Compression) compress(codec Codec, data []byte) ([]byte, error) {
+	if len(data) < c.minSize {
+		return nil, nil
+	}
+	return codec.Compress(data)
+}
+
+func (c *Compression) decompress(encoding string, data []byte) ([]byte, error) {
+	codec, ok := c.codec(encoding)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, encoding)
+	}
+	return codec.Decompress(data, c.maxSize)
+}
+
+// frame prefixes data with the length of the encoding name and the name itself
+func frame(encoding string, data []byte) []byte {
+	framed := make([]byte, 0, 1+len(encoding)+len(data))
+	framed = append(framed, byte(len(encoding)))
+	framed = append(framed, encoding...)
+	return append(framed, data...)
+}
+
+func unframe(framed []byte) (string, []byte, error) {
+	if len(framed) == 0 || len(framed) < 1+int(framed[0]) {
+		return "", nil, errors.New("malformed compressed response")
+	}
+	n := 1 + int(framed[0])
+	return string(framed[1:n]), framed[n:], nil
+}
+
+// compressResponse encodes data for a caller accepting the encodings in accept
+func (c *Compression) compressResponse(accept string, data []byte) ([]byte, error) {
+	codec, ok := c.negotiate(accept)
+	if !ok {
+		return frame("", data), nil
+	}
+	compressed, err := c.compress(codec, data)
+	if err != nil || compressed == nil {
+		return frame("", data), err
+	}
+	return frame(codec.Name(), compressed), nil
+}
+
+func (c *Compression) decompressResponse(framed []byte) ([]byte, error) {
+	encoding, data, err := unframe(framed)
+	if err != nil || encoding == "" {
+		return data, err
+	}
+	return c.decompress(encoding, data)
+}
+
+// WrapRPCClient compresses the messages sent by client and decompresses their responses
+func (c *Compression) WrapRPCClient(client cluster.RPCClient) cluster.RPCClient {
+	return &compressionRPCClient{RPCClient: client, compression: c}
+}
+
+type compressionRPCClient struct {
+	cluster.RPCClient
+	compression *Compression
+}
+
+func (r *compressionRPCClient) Call(
+	ctx context.Context,
+	rpcType pitayaprotos.RPCType,
+	route *route.Route,
+	session *session.Session,
+	msg *message.Message,
+	server *cluster.Server,
+) (*pitayaprotos.Response, error) {
+	c := r.compression
+	// servers without compression neither read compressed messages nor frame their responses
+	advertised := server.Metadata[AcceptEncodingKey]
+	encoding, accept := "", ""
+	if advertised != "" {
+		accept = c.AcceptEncoding()
+	}
+	if codec, ok := c.negotiate(advertised); ok && msg != nil {
+		compressed, err := c.compress(codec, msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		if compressed != nil {
+			copied := *msg
+			copied.Data = compressed
+			msg = &copied
+			encoding = codec.Name()
+		}
+	}
+	// the context may carry the encodings of the rpc being handled
+	ctx = pcontext.AddToPropagateCtx(ctx, ContentEncodingKey, encoding)
+	ctx = pcontext.AddToPropagateCtx(ctx, AcceptEncodingKey, accept)
+
+	res, err := r.RPCClient.Call(ctx, rpcType, route, session, msg, server)
+	if err != nil || res == nil || res.Error != nil || accept == "" {
+		return res, err
+	}
+	if res.Data, err = c.decompressResponse(res.Data); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// WrapRPCServer decompresses the messages received by server and compresses their responses
+func (c *Compression) WrapRPCServer(server cluster.RPCServer) cluster.RPCServer {
+	return &compressionRPCServer{RPCServer: server, compression: c}
+}
+
+type compressionRPCServer struct {
+	cluster.RPCServer
+	compression *Compression
+}
+
+func (r *compressionRPCServer) SetPitayaServer(server pitayaprotos.PitayaServer) {
+	r.RPCServer.SetPitayaServer(&compressionPitayaServer{PitayaServer: server, compression: r.compression})
+}
+
+type compressionPitayaServer struct {
+	pitayaprotos.PitayaServer
+	compression *Compression
+}
+
+// requestEncodings returns the content and accepted encodings propagated in the request metadata
+func requestEncodings(req *pitayaprotos.Request) (string, string) {
+	if len(req.Metadata) == 0 {
+		return "", ""
+	}
+	metadata := map[string]interface{}{}
+	if err := json.Unmarshal(req.Metadata, &metadata); err != nil {
+		return "", ""
+	}
+	contentEncoding, _ := metadata[ContentEncodingKey].(string)
+	acceptEncoding, _ := metadata[AcceptEncodingKey].(string)
+	return contentEncoding, acceptEncoding
+}
+
+func (s *compressionPitayaServer) Call(ctx context.Context, req *pitayaprotos.Request) (*pitayaprotos.Response, error) {
+	c := s.compression
+	contentEncoding, acceptEncoding := requestEncodings(req)
+	if contentEncoding != "" && req.Msg != nil {
+		data, err := c.decompress(contentEncoding, req.Msg.Data)
+		if errors.Is(err, ErrMessageTooLarge) {
+			return pitayaErrorResponse(err), nil
+		}
+		if err != nil {
+			return errorResponse(e.ErrBadRequestCode, err), nil
+		}
+		req.Msg.Data = data
+	}
+
+	res, err := s.PitayaServer.Call(ctx, req)
+	if err != nil || res == nil || res.Error != nil || acceptEncoding == "" {
+		return res, err
+	}
+	if res.Data, err = c.compressResponse(acceptEncoding, res.Data); err != nil {
+		return errorResponse(e.ErrInternalCode, err), nil
+	}
+	return res, nil
+}
+
+// errorResponse builds the response pitaya answers for failed rpcs, the rpc servers ignore returned errors
+func errorResponse(code string, err error) *pitayaprotos.Response {
+	return &pitayaprotos.Response{
+		Error: &pitayaprotos.Error{
+			Code: code,
+			Msg:  err.Error(),
+		},
+	}
+}
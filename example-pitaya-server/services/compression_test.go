@@ -0,0 +1,242 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/topfreegames/pitaya/cluster"
+	"github.com/topfreegames/pitaya/conn/message"
+	pcontext "github.com/topfreegames/pitaya/context"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/route"
+	"github.com/topfreegames/pitaya/session"
+)
+
+// echoPitayaServer answers every call with the data it received
+type echoPitayaServer struct {
+	pitayaprotos.PitayaServer
+	received []byte
+}
+
+func (s *echoPitayaServer) Call(ctx context.Context, req *pitayaprotos.Request) (*pitayaprotos.Response, error) {
+	s.received = req.Msg.Data
+	return &pitayaprotos.Response{Data: req.Msg.Data}, nil
+}
+
+type fakeRPCServer struct {
+	cluster.RPCServer
+	pitayaServer pitayaprotos.PitayaServer
+}
+
+func (f *fakeRPCServer) SetPitayaServer(server pitayaprotos.PitayaServer) {
+	f.pitayaServer = server
+}
+
+// wireRPCClient builds the request like the nats client and hands it to a server in process,
+// recording the bytes that went through the wire
+type wireRPCClient struct {
+	cluster.RPCClient
+	server       *fakeRPCServer
+	requestSize  int
+	responseSize int
+}
+
+func (w *wireRPCClient) Call(
+	ctx context.Context,
+	rpcType pitayaprotos.RPCType,
+	route *route.Route,
+	session *session.Session,
+	msg *message.Message,
+	server *cluster.Server,
+) (*pitayaprotos.Response, error) {
+	metadata, err := pcontext.Encode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req := &pitayaprotos.Request{
+		Type:     rpcType,
+		Msg:      &pitayaprotos.Msg{Route: route.String(), Data: msg.Data},
+		Metadata: metadata,
+	}
+	w.requestSize = len(msg.Data)
+	res, err := w.server.pitayaServer.Call(ctx, req)
+	if res != nil {
+		w.responseSize = len(res.Data)
+	}
+	return res, err
+}
+
+type compressionChain struct {
+	client cluster.RPCClient
+	wire   *wireRPCClient
+	echo   *echoPitayaServer
+	target *cluster.Server
+}
+
+func newCompressionChain(minSize int, codecs ...Codec) *compressionChain {
+	compression := NewCompression(CompressionOptions{MinSize: minSize, Codecs: codecs})
+	echo := &echoPitayaServer{}
+	rpcServer := &fakeRPCServer{}
+	compression.WrapRPCServer(rpcServer).SetPitayaServer(echo)
+	wire := &wireRPCClient{server: rpcServer}
+	return &compressionChain{
+		client: compression.WrapRPCClient(wire),
+		wire:   wire,
+		echo:   echo,
+		target: &cluster.Server{
+			ID:       "connector-1",
+			Type:     "connector",
+			Metadata: map[string]string{AcceptEncodingKey: compression.AcceptEncoding()},
+		},
+	}
+}
+
+func (c *compressionChain) call(t testing.TB, data []byte) []byte {
+	r := route.NewRoute("connector", "connectorremote", "remotefunc")
+	res, err := c.client.Call(context.Background(), pitayaprotos.RPCType_User, r, nil, &message.Message{Data: data}, c.target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Error != nil {
+		t.Fatal(res.Error.Msg)
+	}
+	return res.Data
+}
+
+// payload returns compressible data resembling a serialized game state
+func payload(size int) []byte {
+	random := rand.New(rand.NewSource(1))
+	var buf bytes.Buffer
+	for buf.Len() < size {
+		fmt.Fprintf(&buf, `{"player":"%d","x":%d,"y":%d,"state":"running"},`, random.Intn(1000), random.Intn(500), random.Intn(500))
+	}
+	return buf.Bytes()[:size]
+}
+
+func TestCompressionThreshold(t *testing.T) {
+	const minSize = 1024
+	tables := []struct {
+		name       string
+		size       int
+		compressed bool
+	}{
+		{"below threshold", minSize - 1, false},
+		{"at threshold", minSize, true},
+		{"above threshold", minSize + 1, true},
+	}
+
+	for _, codec := range []Codec{NewGzipCodec(), NewZstdCodec()} {
+		for _, table := range tables {
+			t.Run(codec.Name()+" "+table.name, func(t *testing.T) {
+				chain := newCompressionChain(minSize, codec)
+				data := payload(table.size)
+
+				res := chain.call(t, data)
+				if !bytes.Equal(res, data) {
+					t.Fatal("the response should be decompressed transparently")
+				}
+				if !bytes.Equal(chain.echo.received, data) {
+					t.Fatal("the server should see the decompressed message")
+				}
+
+				compressed := chain.wire.requestSize < table.size
+				if compressed != table.compressed {
+					t.Fatalf("expected compressed to be %v, sent %d bytes out of %d", table.compressed, chain.wire.requestSize, table.size)
+				}
+				// the response carries the encoding frame
+				compressed = chain.wire.responseSize < table.size
+				if compressed != table.compressed {
+					t.Fatalf("expected the response compressed to be %v, got %d bytes out of %d", table.compressed, chain.wire.responseSize, table.size)
+				}
+			})
+		}
+	}
+}
+
+func TestCompressionServerWithoutSupport(t *testing.T) {
+	chain := newCompressionChain(0)
+	chain.target.Metadata = map[string]string{}
+
+	data := payload(4096)
+	res := chain.call(t, data)
+	if !bytes.Equal(res, data) || chain.wire.requestSize != len(data) || chain.wire.responseSize != len(data) {
+		t.Fatal("messages to servers that did not advertise compression should be sent as is")
+	}
+}
+
+func TestCompressionBomb(t *testing.T) {
+	const max = 1 << 20
+	bomb := make([]byte, 64<<20)
+	for _, codec := range []Codec{NewGzipCodec(), NewZstdCodec()} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			compressed, err := codec.Compress(bomb)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compression := NewCompression(CompressionOptions{MaxSize: max, Codecs: []Codec{codec}})
+			echo := &echoPitayaServer{}
+			rpcServer := &fakeRPCServer{}
+			compression.WrapRPCServer(rpcServer).SetPitayaServer(echo)
+			metadata, err := pcontext.Encode(pcontext.AddToPropagateCtx(context.Background(), ContentEncodingKey, codec.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			res, err := rpcServer.pitayaServer.Call(context.Background(), &pitayaprotos.Request{
+				Type:     pitayaprotos.RPCType_User,
+				Msg:      &pitayaprotos.Msg{Route: "connector.connectorremote.remotefunc", Data: compressed},
+				Metadata: metadata,
+			})
+			runtime.ReadMemStats(&after)
+
+			if err != nil || res.Error == nil || res.Error.Code != ErrMessageTooLargeCode {
+				t.Fatalf("expected the %d bytes bomb to be too large, got %v %v", len(compressed), res, err)
+			}
+			if echo.received != nil {
+				t.Fatal("expected the bomb not to reach the remote")
+			}
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 16*max {
+				t.Fatalf("expected the decompression to stop at the limit, allocated %d bytes", allocated)
+			}
+
+			// the payloads at the limit are still accepted
+			data := payload(max)
+			if compressed, err = codec.Compress(data); err != nil {
+				t.Fatal(err)
+			}
+			if out, err := codec.Decompress(compressed, max); err != nil || !bytes.Equal(out, data) {
+				t.Fatalf("expected a payload at the limit to be decompressed, got %v", err)
+			}
+		})
+	}
+}
+
+func benchmarkCompression(b *testing.B, chain *compressionChain) {
+	data := payload(256 * 1024)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		chain.call(b, data)
+	}
+	b.ReportMetric(float64(chain.wire.requestSize+chain.wire.responseSize), "wire-bytes/op")
+}
+
+func BenchmarkCompression256KB(b *testing.B) {
+	b.Run("uncompressed", func(b *testing.B) {
+		chain := newCompressionChain(0)
+		chain.target.Metadata = map[string]string{}
+		benchmarkCompression(b, chain)
+	})
+	b.Run("gzip", func(b *testing.B) {
+		benchmarkCompression(b, newCompressionChain(DefaultCompressionMinSize, NewGzipCodec()))
+	})
+	b.Run("zstd", func(b *testing.B) {
+		benchmarkCompression(b, newCompressionChain(DefaultCompressionMinSize, NewZstdCodec()))
+	})
+}
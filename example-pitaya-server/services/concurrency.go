@@ -0,0 +1,214 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+)
+
+// ErrOverloaded is returned when a call finds its route running as many calls as its limit with a
+// full queue, it reaches the caller with ErrUnavailableCode
+var ErrOverloaded = errors.New("route overloaded")
+
+// ConcurrencyRule caps the calls of a route running at once
+type ConcurrencyRule struct {
+	// Limit is how many calls of the route run at once, a zero limit disables the cap
+	Limit int64
+	// Queue is how many calls wait for a running call to return once the limit is reached, the
+	// calls beyond it fail with ErrOverloaded. A zero queue fails them right away.
+	Queue int
+}
+
+// ConcurrencyOptions configures a ConcurrencyLimiter
+type ConcurrencyOptions struct {
+	// Default is the rule applied to routes without an override
+	Default ConcurrencyRule
+	// Routes overrides the default rule per route
+	Routes map[string]ConcurrencyRule
+}
+
+// semaphore is a weighted semaphore whose waiters are served in order, up to queue of them
+type semaphore struct {
+	size    int64
+	queue   int
+	mutex   sync.Mutex
+	cur     int64
+	waiters list.List
+}
+
+type waiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+// acquire takes n slots, waiting for them while ctx is not done when the queue has room
+func (s *semaphore) acquire(ctx context.Context, n int64) error {
+	s.mutex.Lock()
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		s.mutex.Unlock()
+		return nil
+	}
+	if n > s.size || s.waiters.Len() >= s.queue {
+		s.mutex.Unlock()
+		return ErrOverloaded
+	}
+	w := waiter{n: n, ready: make(chan struct{})}
+	elem := s.waiters.PushBack(w)
+	s.mutex.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.mutex.Lock()
+		select {
+		case <-w.ready:
+			// acquired while giving up, the slots are given back
+			s.mutex.Unlock()
+			s.release(n)
+		default:
+			head := s.waiters.Front() == elem
+			s.waiters.Remove(elem)
+			// the waiters behind the head may fit in the slots it was waiting for
+			if head {
+				s.notify()
+			}
+			s.mutex.Unlock()
+		}
+		return ctx.Err()
+	}
+}
+
+// release gives back n slots to the waiters
+func (s *semaphore) release(n int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.cur -= n
+	s.notify()
+}
+
+// notify hands the free slots to the waiters in order, it must be called with the mutex held
+func (s *semaphore) notify() {
+	for {
+		next := s.waiters.Front()
+		if next == nil {
+			return
+		}
+		w := next.Value.(waiter)
+		if s.size-s.cur < w.n {
+			return
+		}
+		s.cur += w.n
+		s.waiters.Remove(next)
+		close(w.ready)
+	}
+}
+
+// running returns the number of slots taken
+func (s *semaphore) running() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.cur
+}
+
+// ConcurrencyLimiter caps the calls running at once per route, so an expensive remote can't take
+// the goroutines of the others
+type ConcurrencyLimiter struct {
+	mutex      sync.Mutex
+	opts       ConcurrencyOptions
+	semaphores map[string]*semaphore
+}
+
+// NewConcurrencyLimiter returns a new concurrency limiter, see ConcurrencyLimiter.Middleware
+func NewConcurrencyLimiter(opts ConcurrencyOptions) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		opts:       opts,
+		semaphores: make(map[string]*semaphore),
+	}
+}
+
+func (l *ConcurrencyLimiter) rule(route string) ConcurrencyRule {
+	if rule, ok := l.opts.Routes[route]; ok {
+		return rule
+	}
+	return l.opts.Default
+}
+
+// semaphore returns the semaphore of route, nil when its calls are not capped
+func (l *ConcurrencyLimiter) semaphore(route string) *semaphore {
+	rule := l.rule(route)
+	if rule.Limit <= 0 {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	sem, ok := l.semaphores[route]
+	if !ok {
+		sem = &semaphore{size: rule.Limit, queue: rule.Queue}
+		l.semaphores[route] = sem
+	}
+	return sem
+}
+
+// Acquire waits until a call of route may run, see ConcurrencyRule. The returned func must be
+// called once the call returned. It fails with ErrOverloaded or with the error of ctx when it is
+// done while queued.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, route string) (func(), error) {
+	sem := l.semaphore(route)
+	if sem == nil {
+		return func() {}, nil
+	}
+	if err := sem.acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	return func() { once.Do(func() { sem.release(1) }) }, nil
+}
+
+// Middleware returns a middleware capping the calls of the route being called, the calls
+// overloading it are answered with ErrUnavailableCode. Running after Deadline, the calls give up
+// waiting at their deadline.
+func (l *ConcurrencyLimiter) Middleware() MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, in []byte) ([]byte, error) {
+			route, _ := pcontext.GetFromPropagateCtx(ctx, constants.RouteKey).(string)
+			release, err := l.Acquire(ctx, route)
+			if errors.Is(err, ErrOverloaded) {
+				return nil, Wrap(err, ErrUnavailableCode, "too many calls of "+route).WithMetadata("route", route)
+			}
+			if err != nil {
+				return nil, err
+			}
+			defer release()
+			return next(ctx, in)
+		}
+	}
+}
+
+// InFlight returns the number of calls of route running
+func (l *ConcurrencyLimiter) InFlight(route string) int64 {
+	l.mutex.Lock()
+	sem, ok := l.semaphores[route]
+	l.mutex.Unlock()
+	if !ok {
+		return 0
+	}
+	return sem.running()
+}
+
+// InFlights returns the number of calls running per capped route, meant to be exported as metrics
+func (l *ConcurrencyLimiter) InFlights() map[string]int64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	running := make(map[string]int64, len(l.semaphores))
+	for route, sem := range l.semaphores {
+		running[route] = sem.running()
+	}
+	return running
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+)
+
+// routeContext is the context of a call to route
+func routeContext(route string) context.Context {
+	return pcontext.AddToPropagateCtx(context.Background(), constants.RouteKey, route)
+}
+
+// blockingCalls runs the calls of a handler returning once released
+type blockingCalls struct {
+	h        HandlerFunc
+	started  chan struct{}
+	released chan struct{}
+}
+
+func newBlockingCalls(l *ConcurrencyLimiter) *blockingCalls {
+	b := &blockingCalls{started: make(chan struct{}, 10), released: make(chan struct{})}
+	b.h = NewPipeline(l.Middleware()).Then(func(ctx context.Context, in []byte) ([]byte, error) {
+		b.started <- struct{}{}
+		<-b.released
+		return in, nil
+	})
+	return b
+}
+
+// call calls route in the background, its error is sent on the returned channel
+func (b *blockingCalls) call(ctx context.Context) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.h(ctx, nil)
+		done <- err
+	}()
+	return done
+}
+
+func (b *blockingCalls) waitStarted(t *testing.T) {
+	t.Helper()
+	select {
+	case <-b.started:
+	case <-time.After(time.Second):
+		t.Fatal("expected a call to start")
+	}
+}
+
+// waitQueued waits until n calls are queued on sem
+func waitQueued(t *testing.T, sem *semaphore, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		sem.mutex.Lock()
+		queued := sem.waiters.Len()
+		sem.mutex.Unlock()
+		if queued == n {
+			return
+		}
+	}
+	t.Fatalf("expected %d queued calls", n)
+}
+
+func TestConcurrencyLimitRejects(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyOptions{
+		Routes: map[string]ConcurrencyRule{"room.room.matchmake": {Limit: 2}},
+	})
+	b := newBlockingCalls(l)
+	ctx := routeContext("room.room.matchmake")
+	first, second := b.call(ctx), b.call(ctx)
+	b.waitStarted(t)
+	b.waitStarted(t)
+	if running := l.InFlight("room.room.matchmake"); running != 2 {
+		t.Fatalf("expected 2 calls in flight, got %d", running)
+	}
+
+	_, err := b.h(ctx, nil)
+	var pitayaErr *PitayaError
+	if !errors.Is(err, ErrOverloaded) || !errors.As(err, &pitayaErr) || pitayaErr.Code != ErrUnavailableCode {
+		t.Fatalf("expected the third call to be overloaded, got %v", err)
+	}
+
+	// the other routes are not capped
+	other := b.call(routeContext("room.room.join"))
+	b.waitStarted(t)
+
+	close(b.released)
+	for _, done := range []<-chan error{first, second, other} {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if running := l.InFlight("room.room.matchmake"); running != 0 {
+		t.Fatalf("expected no call in flight, got %d", running)
+	}
+	if _, err := b.h(ctx, nil); err != nil {
+		t.Fatalf("expected a call once the others returned, got %v", err)
+	}
+}
+
+func TestConcurrencyLimitQueues(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyOptions{
+		Default: ConcurrencyRule{Limit: 1, Queue: 1},
+	})
+	b := newBlockingCalls(l)
+	ctx := routeContext("room.room.matchmake")
+	first := b.call(ctx)
+	b.waitStarted(t)
+	queued := b.call(ctx)
+	waitQueued(t, l.semaphore("room.room.matchmake"), 1)
+
+	// the queue is full
+	if _, err := b.h(ctx, nil); !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("expected the third call to be overloaded, got %v", err)
+	}
+
+	b.released <- struct{}{}
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	b.waitStarted(t)
+	if running := l.InFlight("room.room.matchmake"); running != 1 {
+		t.Fatalf("expected the queued call to run alone, got %d in flight", running)
+	}
+	b.released <- struct{}{}
+	if err := <-queued; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConcurrencyQueueGivesUp(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyOptions{
+		Default: ConcurrencyRule{Limit: 1, Queue: 1},
+	})
+	b := newBlockingCalls(l)
+	first := b.call(routeContext("room.room.matchmake"))
+	b.waitStarted(t)
+
+	ctx, cancel := context.WithCancel(routeContext("room.room.matchmake"))
+	queued := b.call(ctx)
+	waitQueued(t, l.semaphore("room.room.matchmake"), 1)
+	cancel()
+	if err := <-queued; err != context.Canceled {
+		t.Fatalf("expected the queued call to give up, got %v", err)
+	}
+	// its place in the queue is free again
+	next := b.call(routeContext("room.room.matchmake"))
+	waitQueued(t, l.semaphore("room.room.matchmake"), 1)
+
+	close(b.released)
+	for _, done := range []<-chan error{first, next} {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSemaphoreServesWaitersInOrder(t *testing.T) {
+	sem := &semaphore{size: 3, queue: 2}
+	if err := sem.acquire(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+	heavy := make(chan error, 1)
+	go func() { heavy <- sem.acquire(context.Background(), 3) }()
+	waitQueued(t, sem, 1)
+
+	// a free slot doesn't let a light call pass the queued heavy one
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := sem.acquire(ctx, 1); err != context.DeadlineExceeded {
+		t.Fatalf("expected the light call to wait behind the heavy one, got %v", err)
+	}
+	if err := sem.acquire(context.Background(), 4); err != ErrOverloaded {
+		t.Fatalf("expected a call larger than the semaphore to be overloaded, got %v", err)
+	}
+	sem.release(2)
+	if err := <-heavy; err != nil || sem.running() != 3 {
+		t.Fatalf("expected the heavy call to take the semaphore, got %v with %d taken", err, sem.running())
+	}
+}
+
+func TestConcurrencyMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics("room", registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewConcurrencyLimiter(ConcurrencyOptions{Default: ConcurrencyRule{Limit: 2}})
+	if err := metrics.WatchConcurrency(l); err != nil {
+		t.Fatal(err)
+	}
+	release, err := l.Acquire(context.Background(), "room.room.matchmake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]string{"route": "room.room.matchmake", "server_type": "room"}
+	if v := gatherValue(t, registry, "pitaya_example_calls_in_flight", labels); v != 1 {
+		t.Fatalf("expected 1 call in flight, got %v", v)
+	}
+	release()
+	release()
+	if v := gatherValue(t, registry, "pitaya_example_calls_in_flight", labels); v != 0 {
+		t.Fatalf("expected released calls to be released once, got %v in flight", v)
+	}
+}
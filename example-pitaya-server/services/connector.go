@@ -3,19 +3,90 @@ package services
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya"
+	"github.com/topfreegames/pitaya/acceptor"
 	"github.com/topfreegames/pitaya/component"
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+	e "github.com/topfreegames/pitaya/errors"
+	"github.com/topfreegames/pitaya/session"
 )
 
 // ConnectorRemote is a remote that will receive rpc's
 type ConnectorRemote struct {
 	component.Base
+	connector  *Connector
+	limiter    *RateLimiter
+	metrics    *Metrics
+	rpc        RPCFunc
+	validator  *Validator
+	pipeline   *Pipeline
+	items      map[string]ItemsFunc
+	streamIdle time.Duration
+}
+
+// RemoteOption configures a ConnectorRemote
+type RemoteOption func(r *ConnectorRemote)
+
+// WithRateLimiter limits the calls made to the remote
+func WithRateLimiter(limiter *RateLimiter) RemoteOption {
+	return func(r *ConnectorRemote) {
+		r.limiter = limiter
+	}
+}
+
+// WithMetrics records the calls made to the remote in metrics
+func WithMetrics(metrics *Metrics) RemoteOption {
+	return func(r *ConnectorRemote) {
+		r.metrics = metrics
+	}
+}
+
+// WithValidator validates the decoded messages of the remote routes enabled in validator
+func WithValidator(validator *Validator) RemoteOption {
+	return func(r *ConnectorRemote) {
+		r.validator = validator
+	}
+}
+
+// WithPipeline runs the middlewares of pipeline around the calls made to the remote
+func WithPipeline(pipeline *Pipeline) RemoteOption {
+	return func(r *ConnectorRemote) {
+		r.pipeline = pipeline
+	}
 }
 
 // Connector struct
 type Connector struct {
 	component.Base
+	store          SessionStore
+	acceptors      []acceptor.Acceptor
+	drain          *drainState
+	drainTimeout   time.Duration
+	kickRoute      string
+	kickMsg        interface{}
+	beforeShutdown []func(sessions []*session.Session)
+	logger         Logger
+	groupsMutex    sync.Mutex
+	groups         map[string]*Group
+	authenticator  Authenticator
+	serializers    *SerializerRegistry
+	sessions       func(uid string) *session.Session
+	undeliverable  UndeliverableFunc
+	lifecycle      *lifecycle
+	idle           idleConfig
+	ordered        bool
+	queuesMutex    sync.Mutex
+	queues         map[int64]*pushQueue
+	sendBuffer     int
+	overflow       OverflowPolicy
+	redactor       *Redactor
+	single         singleSession
 }
 
 // SessionData is the session data struct
@@ -23,10 +94,289 @@ type SessionData struct {
 	Data map[string]interface{} `json:"data"`
 }
 
+// NewConnector returns a new connector that persists session data in store
+func NewConnector(store SessionStore, opts ...ConnectorOption) *Connector {
+	c := &Connector{
+		store:        store,
+		drain:        newDrainState(),
+		drainTimeout: DefaultDrainTimeout,
+		kickRoute:    "onServerGoingAway",
+		kickMsg:      defaultShutdownKick(),
+		logger:       NewNopLogger(),
+		groups:       make(map[string]*Group),
+		serializers:  defaultSerializers,
+		sessions:     session.GetSessionByUID,
+		idle:         newIdleConfig(),
+		queues:       make(map[int64]*pushQueue),
+		redactor:     defaultRedactor,
+	}
+	c.lifecycle = newLifecycle(func() Logger { return c.logger })
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.logger = c.redactor.Logger(c.logger)
+	return c
+}
+
+// NewConnectorRemote returns a new connector remote whose calls are drained by connector on shutdown
+func NewConnectorRemote(connector *Connector, opts ...RemoteOption) *ConnectorRemote {
+	r := &ConnectorRemote{
+		connector:  connector,
+		rpc:        pitaya.RPCTo,
+		streamIdle: StreamIdleTimeout,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// WithLogger sets the logger of the connector and of its remotes
+func WithLogger(l Logger) ConnectorOption {
+	return func(c *Connector) {
+		c.logger = l
+	}
+}
+
+func (c *ConnectorRemote) logger() Logger {
+	if c.connector == nil {
+		return NewNopLogger()
+	}
+	return c.connector.logger
+}
+
+func (c *ConnectorRemote) serializers() *SerializerRegistry {
+	if c.connector == nil {
+		return defaultSerializers
+	}
+	return c.connector.serializers
+}
+
+// Group returns the group name of this connector, its members are persisted in the session store
+func (c *Connector) Group(ctx context.Context, name string) (*Group, error) {
+	c.groupsMutex.Lock()
+	defer c.groupsMutex.Unlock()
+	if g, ok := c.groups[name]; ok {
+		return g, nil
+	}
+	g, err := NewGroup(ctx, name, c.store)
+	if err != nil {
+		return nil, err
+	}
+	g.sessions = c.sessions
+	g.push = c.push
+	g.SetUndeliverable(c.undeliverable)
+	c.groups[name] = g
+	return g, nil
+}
+
+// connectors are the connectors initialized in the process. pitaya ignores a session callback
+// whose code is already registered, which is the case of the methods of a second connector,
+// so the callbacks are registered once and call every connector.
+var (
+	connectorsMutex sync.RWMutex
+	connectors      []*Connector
+	connectorsOnce  sync.Once
+)
+
+// Init runs on service initialization
+func (c *Connector) Init() {
+	connectorsMutex.Lock()
+	connectors = append(connectors, c)
+	connectorsMutex.Unlock()
+
+	connectorsOnce.Do(func() {
+		session.OnSessionBind(func(ctx context.Context, s *session.Session) error {
+			return eachConnector(func(c *Connector) error { return c.trackSession(ctx, s) })
+		})
+		session.OnAfterSessionBind(func(ctx context.Context, s *session.Session) error {
+			return eachConnector(func(c *Connector) error { return c.afterSessionBind(ctx, s) })
+		})
+		session.OnSessionClose(func(s *session.Session) {
+			eachConnector(func(c *Connector) error {
+				c.onSessionClose(s)
+				return nil
+			})
+		})
+	})
+}
+
+// Shutdown stops calling the session callbacks of the connector
+func (c *Connector) Shutdown() {
+	connectorsMutex.Lock()
+	defer connectorsMutex.Unlock()
+	for i, other := range connectors {
+		if other == c {
+			connectors = append(connectors[:i], connectors[i+1:]...)
+			return
+		}
+	}
+}
+
+// eachConnector calls f with every initialized connector until it fails
+func eachConnector(f func(c *Connector) error) error {
+	connectorsMutex.RLock()
+	initialized := append([]*Connector(nil), connectors...)
+	connectorsMutex.RUnlock()
+	for _, c := range initialized {
+		if err := f(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Connector) afterSessionBind(ctx context.Context, s *session.Session) error {
+	if err := c.sessionBound(ctx, s); err != nil {
+		return err
+	}
+	if c.store == nil {
+		return nil
+	}
+	return c.hydrateSession(ctx, s)
+}
+
+func (c *Connector) onSessionClose(s *session.Session) {
+	c.untrackSession(s)
+	c.dropPushQueue(s)
+	c.sessionClosed(s)
+	if c.store != nil {
+		c.persistSession(s)
+	}
+}
+
+// hydrateSession restores the data of an uid that is reconnecting
+func (c *Connector) hydrateSession(ctx context.Context, s *session.Session) error {
+	if !s.IsFrontend {
+		return nil
+	}
+
+	stored, err := c.store.Get(ctx, s.UID())
+	if err == ErrSessionDataNotFound {
+		return nil
+	}
+	if err != nil {
+		LoggerFromCtx(ctx, c.logger).Error("failed to load session data", "uid", s.UID(), "error", err)
+		return nil
+	}
+
+	// values set before the bind win over the stored ones
+	data := stored.Data
+	for k, v := range s.GetData() {
+		data[k] = v
+	}
+	return s.SetData(data)
+}
+
+// persistSession saves the session data so it can be restored when the uid reconnects
+func (c *Connector) persistSession(s *session.Session) {
+	if s.UID() == "" {
+		return
+	}
+
+	err := c.store.Set(context.Background(), s.UID(), SessionData{Data: s.GetData()})
+	if err != nil {
+		c.logger.Error("failed to persist session data", "uid", s.UID(), "error", err)
+	}
+}
+
 // RemoteFunc is a function that will be called remotelly
+//
+// Protobuf messages are decoded into a RPCMsg, json messages are echoed back as a string.
+// The serializer is picked by the registry of the connector, see SerializerRegistry.ForRoute.
+// The message is copied into the string Msg of the response, see RemoteFuncBytes.
 func (c *ConnectorRemote) RemoteFunc(ctx context.Context, message []byte) (*protos.Response, error) {
-	fmt.Printf("received a remote call with this message: %s\n", message)
-	return &protos.Response{
-		Msg: string(message),
+	res, err := c.RemoteFuncBytes(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return &protos.Response{Code: res.Code, Msg: string(res.Msg)}, nil
+}
+
+// RemoteFuncBytes is RemoteFunc answering a BytesResponse, which is encoded like a Response.
+// Json messages are echoed back without being copied, the response references message.
+func (c *ConnectorRemote) RemoteFuncBytes(ctx context.Context, message []byte) (*protos.BytesResponse, error) {
+	if c.connector != nil {
+		defer c.connector.drain.track(nil)()
+	}
+	start := time.Now()
+	res, err := c.pipelined(ctx, RemoteFuncRoute, message, c.remoteFunc)
+	if c.metrics != nil {
+		c.metrics.observe(RemoteFuncRoute, time.Since(start), err)
+	}
+	return res, err
+}
+
+// pipelined calls f through the middlewares of the remote
+func (c *ConnectorRemote) pipelined(
+	ctx context.Context,
+	route string,
+	message []byte,
+	f func(ctx context.Context, message []byte) (*protos.BytesResponse, error),
+) (*protos.BytesResponse, error) {
+	if c.pipeline == nil {
+		return f(ctx, message)
+	}
+
+	// the pooled buffer is released once decoded, which copies it. It is left to the gc when the
+	// call failed, the remote may still be running past its deadline.
+	var release func()
+	h := c.pipeline.Then(func(ctx context.Context, in []byte) ([]byte, error) {
+		res, err := f(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		out, done, err := marshalPooled(res)
+		release = done
+		return out, err
+	})
+	out, err := h(pcontext.AddToPropagateCtx(ctx, constants.RouteKey, route), message)
+	if err != nil {
+		return nil, err
+	}
+	res := &protos.BytesResponse{}
+	err = proto.Unmarshal(out, res)
+	if release != nil {
+		release()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *ConnectorRemote) remoteFunc(ctx context.Context, message []byte) (*protos.BytesResponse, error) {
+	if c.limiter != nil {
+		if err := c.limiter.limit(ctx, RemoteFuncRoute); err != nil {
+			return nil, err
+		}
+	}
+	LoggerFromCtx(ctx, c.logger()).Info("received a remote call",
+		"route", RemoteFuncRoute,
+		"size", len(message),
+	)
+
+	ser, err := c.serializers().ForRoute(ctx, RemoteFuncRoute)
+	if err != nil {
+		return nil, pitaya.Error(err, e.ErrBadRequestCode)
+	}
+	if ser.ContentType() == ContentTypeJSON {
+		return &protos.BytesResponse{
+			Msg: message,
+		}, nil
+	}
+
+	req := &protos.RPCMsg{}
+	if err := ser.Unmarshal(message, req); err != nil {
+		return nil, pitaya.Error(fmt.Errorf("invalid %s message: %w", ser.ContentType(), err), e.ErrBadRequestCode)
+	}
+	if c.validator != nil {
+		if err := c.validator.validateMessage(RemoteFuncRoute, req); err != nil {
+			return nil, err
+		}
+	}
+	return &protos.BytesResponse{
+		Code: 200,
+		Msg:  []byte(req.Msg),
 	}, nil
 }
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+	e "github.com/topfreegames/pitaya/errors"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+)
+
+const (
+	// DeadlineKey is the propagated context key with the deadline of the caller, in unix milliseconds
+	DeadlineKey = "deadline"
+	// ErrDeadlineExceededCode is the pitaya error code returned when a call did not finish before its deadline
+	ErrDeadlineExceededCode = "PIT-504"
+	// DefaultMaxDeadline is how long remotes can take when the caller did not set a shorter deadline
+	DefaultMaxDeadline = 5 * time.Second
+)
+
+// withPropagatedDeadline sends the deadline of ctx, if any, to the servers it calls
+func withPropagatedDeadline(ctx context.Context) context.Context {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return ctx
+	}
+	return pcontext.AddToPropagateCtx(ctx, DeadlineKey, deadline.UnixNano()/int64(time.Millisecond))
+}
+
+// withoutPropagatedDeadline returns ctx without the deadline propagated in it. The propagated values
+// are copied, pitaya adds to them in place and ctx may still be used by the call it belongs to.
+func withoutPropagatedDeadline(ctx context.Context) context.Context {
+	propagated := make(map[string]interface{})
+	for key, value := range pcontext.ToMap(ctx) {
+		if key != DeadlineKey {
+			propagated[key] = value
+		}
+	}
+	return context.WithValue(ctx, constants.PropagateCtxKey, propagated)
+}
+
+// propagatedDeadline returns the deadline sent by the caller, it is decoded as a float64
+// when it was propagated from another server
+func propagatedDeadline(ctx context.Context) (time.Time, bool) {
+	var ms int64
+	switch deadline := pcontext.GetFromPropagateCtx(ctx, DeadlineKey).(type) {
+	case int64:
+		ms = deadline
+	case float64:
+		ms = int64(deadline)
+	default:
+		return time.Time{}, false
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)), true
+}
+
+// remoteContext returns the context of the remote called by req, rebuilt from the metadata like
+// pitaya does. It is done at the deadline sent by the caller or once ctx, the context of the rpc, is,
+// and when the remote returns. Remotes working after they returned, like OpenStream, detach from it.
+func remoteContext(ctx context.Context, req *pitayaprotos.Request) (context.Context, context.CancelFunc) {
+	remoteCtx := requestContext(ctx, req)
+	var cancel context.CancelFunc
+	if deadline, ok := propagatedDeadline(remoteCtx); ok {
+		remoteCtx, cancel = context.WithDeadline(remoteCtx, deadline)
+	} else {
+		remoteCtx, cancel = context.WithCancel(remoteCtx)
+	}
+	stop := context.AfterFunc(ctx, cancel)
+	return remoteCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// RemainingDeadline returns how long the call in ctx has until its deadline, so handlers can limit their work
+func RemainingDeadline(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline, ok = propagatedDeadline(ctx)
+	}
+	if !ok {
+		return 0, false
+	}
+	if remaining := time.Until(deadline); remaining > 0 {
+		return remaining, true
+	}
+	return 0, true
+}
+
+// Deadline returns a middleware cancelling the context of the next handlers at the deadline sent by
+// the caller, or after max when it is sooner. A max of zero only applies the deadline of the caller.
+//
+// The caller is answered with ErrDeadlineExceededCode as soon as the deadline passes, handlers that
+// ignore ctx.Done() keep running in the background until they return. Panics of the next handlers
+// are raised again in the goroutine of the call so they reach the middlewares before this one.
+func Deadline(max time.Duration) MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, in []byte) ([]byte, error) {
+			deadline, ok := propagatedDeadline(ctx)
+			if limit := time.Now().Add(max); max > 0 && (!ok || limit.Before(deadline)) {
+				deadline, ok = limit, true
+			}
+			if !ok {
+				return next(ctx, in)
+			}
+			ctx, cancel := context.WithDeadline(ctx, deadline)
+			defer cancel()
+			// the remote is rebuilt from the metadata, it gets the deadline of the call
+			ctx = withPropagatedDeadline(ctx)
+
+			type result struct {
+				out     []byte
+				err     error
+				panicky interface{}
+			}
+			done := make(chan result, 1)
+			go func() {
+				defer func() {
+					if rec := recover(); rec != nil {
+						done <- result{panicky: rec}
+					}
+				}()
+				out, err := next(ctx, in)
+				done <- result{out: out, err: err}
+			}()
+
+			select {
+			case res := <-done:
+				if res.panicky != nil {
+					panic(res.panicky)
+				}
+				return res.out, res.err
+			case <-ctx.Done():
+				return nil, e.NewError(ctx.Err(), ErrDeadlineExceededCode)
+			}
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/component"
+	pcontext "github.com/topfreegames/pitaya/context"
+	e "github.com/topfreegames/pitaya/errors"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+)
+
+// propagated returns ctx as seen by the server receiving a rpc made with it
+func propagated(t *testing.T, ctx context.Context) context.Context {
+	encoded, err := pcontext.Encode(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := pcontext.Decode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestDeadlineExceeded(t *testing.T) {
+	h := NewPipeline(Deadline(time.Minute)).Then(func(ctx context.Context, in []byte) ([]byte, error) {
+		// a remote ignoring its context
+		time.Sleep(time.Second)
+		return in, nil
+	})
+
+	callerCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := h(propagated(t, withPropagatedDeadline(callerCtx)), nil)
+
+	pitayaErr, ok := err.(*e.Error)
+	if !ok || pitayaErr.Code != ErrDeadlineExceededCode {
+		t.Fatalf("expected a deadline exceeded error, got %#v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("the caller should be answered at the deadline, took %s", elapsed)
+	}
+}
+
+func TestDeadlineCancelsRemote(t *testing.T) {
+	released := make(chan error, 1)
+	h := NewPipeline(Deadline(20 * time.Millisecond)).Then(func(ctx context.Context, in []byte) ([]byte, error) {
+		if _, ok := RemainingDeadline(ctx); !ok {
+			t.Error("the remote should know its deadline")
+		}
+		<-ctx.Done()
+		released <- ctx.Err()
+		return nil, ctx.Err()
+	})
+
+	// the caller has no deadline, the max applies
+	if _, err := h(context.Background(), nil); err == nil {
+		t.Fatal("expected a deadline exceeded error")
+	}
+	select {
+	case err := <-released:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the remote context to exceed its deadline, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the remote should have been cancelled")
+	}
+}
+
+func TestRemoteClientDeadline(t *testing.T) {
+	h := NewPipeline(Deadline(0)).Then(func(ctx context.Context, in []byte) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	client := NewRemoteClient(func(ctx context.Context, serverID, route string, reply, arg proto.Message) error {
+		_, err := h(propagated(t, ctx), nil)
+		return err
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := client.CallRemoteFunc(ctx, &protos.RPCMsg{})
+	if !errors.Is(err, ErrRPCTimeout) {
+		t.Fatalf("expected ErrRPCTimeout, got %v", err)
+	}
+}
+
+func TestRemainingDeadline(t *testing.T) {
+	if _, ok := RemainingDeadline(context.Background()); ok {
+		t.Fatal("calls without deadline have no remaining time")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	remaining, ok := RemainingDeadline(propagated(t, withPropagatedDeadline(ctx)))
+	if !ok || remaining <= 58*time.Second || remaining > time.Minute {
+		t.Fatalf("expected about a minute, got %s", remaining)
+	}
+}
+
+// WaitingRemote answers once its context is done, pitaya only registers exported types
+type WaitingRemote struct {
+	component.Base
+	remaining chan time.Duration
+	done      chan error
+}
+
+func (w *WaitingRemote) Wait(ctx context.Context) (*protos.Response, error) {
+	remaining, _ := RemainingDeadline(ctx)
+	w.remaining <- remaining
+	<-ctx.Done()
+	w.done <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+func TestDeadlineReachesTheRemotes(t *testing.T) {
+	remote := &WaitingRemote{remaining: make(chan time.Duration, 1), done: make(chan error, 1)}
+	routes := newTestRoutes()
+	if err := routes.RegisterRemote(remote, component.WithName("waiting"), component.WithNameFunc(strings.ToLower)); err != nil {
+		t.Fatal(err)
+	}
+	rpcServer := &fakeRPCServer{}
+	routes.WrapRPCServer(NewPipeline(Deadline(50 * time.Millisecond)).WrapRPCServer(rpcServer)).SetPitayaServer(&countingPitayaServer{})
+
+	// the caller allows a minute, the max of the server applies
+	callerCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	metadata, err := pcontext.Encode(withPropagatedDeadline(callerCtx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := rpcServer.pitayaServer.Call(context.Background(), &pitayaprotos.Request{
+		Type:     pitayaprotos.RPCType_User,
+		Msg:      &pitayaprotos.Msg{Route: "room.waiting.wait"},
+		Metadata: metadata,
+	})
+	if err != nil || res.Error == nil {
+		t.Fatalf("expected the call to fail at its deadline, got %v %v", res, err)
+	}
+	if remaining := <-remote.remaining; remaining <= 0 || remaining > 50*time.Millisecond {
+		t.Fatalf("expected the remote to have at most the max deadline, got %s", remaining)
+	}
+	select {
+	case err := <-remote.done:
+		// the remote context is done at its deadline or with the rpc, whichever is first
+		if err == nil {
+			t.Fatal("expected the remote context to be done")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the remote should have been cancelled")
+	}
+}
+
+// ReturningRemote keeps the context of its last call, pitaya only registers exported types
+type ReturningRemote struct {
+	component.Base
+	ctx context.Context
+}
+
+func (r *ReturningRemote) Return(ctx context.Context) (*protos.Response, error) {
+	r.ctx = ctx
+	return &protos.Response{Code: 200}, nil
+}
+
+func TestRemoteContextEndsWithTheCall(t *testing.T) {
+	remote := &ReturningRemote{}
+	routes := newTestRoutes()
+	if err := routes.RegisterRemote(remote, component.WithName("returning"), component.WithNameFunc(strings.ToLower)); err != nil {
+		t.Fatal(err)
+	}
+	rpcServer := &fakeRPCServer{}
+	routes.WrapRPCServer(NewPipeline().WrapRPCServer(rpcServer)).SetPitayaServer(&countingPitayaServer{})
+
+	res, err := rpcServer.pitayaServer.Call(context.Background(), &pitayaprotos.Request{
+		Type: pitayaprotos.RPCType_User,
+		Msg:  &pitayaprotos.Msg{Route: "room.returning.return"},
+	})
+	if err != nil || res.Error != nil {
+		t.Fatalf("unexpected answer: %v %v", res, err)
+	}
+	// the work left by a remote stops with the call, streams detach from it, see TestStreamOutlivesTheOpen
+	if remote.ctx.Err() != context.Canceled {
+		t.Fatalf("expected the remote context to be cancelled once it returned, got %v", remote.ctx.Err())
+	}
+}
+
+func TestWithoutPropagatedDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	ctx = withPropagatedDeadline(ctx)
+	detached := pcontext.AddToPropagateCtx(withoutPropagatedDeadline(ctx), UIDKey, "player-1")
+	if _, ok := propagatedDeadline(detached); ok {
+		t.Fatal("the deadline should not be propagated anymore")
+	}
+	if _, ok := propagatedDeadline(ctx); !ok || pcontext.GetFromPropagateCtx(ctx, UIDKey) != nil {
+		t.Fatal("the propagated values of the original context should be left as they were")
+	}
+}
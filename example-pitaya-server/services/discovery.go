@@ -0,0 +1,366 @@
+package services
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/topfreegames/pitaya/cluster"
+	"github.com/topfreegames/pitaya/constants"
+)
+
+// DefaultDiscoveryReload is how often FileDiscovery checks its file when no interval is configured
+const DefaultDiscoveryReload = 5 * time.Second
+
+// DiscoveryEventType tells how the servers of the cluster changed
+type DiscoveryEventType int
+
+// Types of the discovery events
+const (
+	// ServerAdded is a server that joined the cluster
+	ServerAdded DiscoveryEventType = iota
+	// ServerRemoved is a server that left the cluster
+	ServerRemoved
+)
+
+func (t DiscoveryEventType) String() string {
+	switch t {
+	case ServerAdded:
+		return "added"
+	case ServerRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// DiscoveryEvent is a change of the servers of the cluster. A server whose entry changed is
+// removed and added again.
+type DiscoveryEvent struct {
+	Type   DiscoveryEventType
+	Server *cluster.Server
+}
+
+// Discovery keeps the servers of the cluster, whatever the backend storing them
+type Discovery interface {
+	// Register adds sv to the cluster, replacing the server with the same id
+	Register(sv *cluster.Server) error
+	// Unregister removes the server registered with serverID
+	Unregister(serverID string) error
+	// Servers returns the servers of svType, or every server when it is empty, sorted by id
+	Servers(svType string) ([]*cluster.Server, error)
+	// Watch returns a channel receiving the changes of the servers until the discovery is closed,
+	// it must be drained
+	Watch() <-chan DiscoveryEvent
+}
+
+// FileDiscovery is a Discovery reading the topology of the cluster from a json file holding a list
+// of servers, for environments without etcd. The file is reloaded when it changes, the servers
+// registered by this process are kept in memory only.
+type FileDiscovery struct {
+	path     string
+	interval time.Duration
+	logger   Logger
+
+	mutex      sync.Mutex
+	file       map[string]*cluster.Server
+	registered map[string]*cluster.Server
+	modTime    time.Time
+	size       int64
+	watchers   []chan DiscoveryEvent
+	closed     bool
+	// notify serializes the events so watchers receive them in order
+	notify sync.Mutex
+	done   chan struct{}
+}
+
+// NewFileDiscovery returns the discovery of the servers listed in the file at path, checking it for
+// changes every interval or DefaultDiscoveryReload when it is 0. A negative interval never reloads
+// the file by itself, see Reload. Errors reloading the file are logged and keep the servers loaded.
+func NewFileDiscovery(path string, interval time.Duration, logger Logger) (*FileDiscovery, error) {
+	if interval == 0 {
+		interval = DefaultDiscoveryReload
+	}
+	d := &FileDiscovery{
+		path:       path,
+		interval:   interval,
+		logger:     logger,
+		file:       make(map[string]*cluster.Server),
+		registered: make(map[string]*cluster.Server),
+		done:       make(chan struct{}),
+	}
+	if err := d.Reload(); err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		go d.poll()
+	}
+	return d, nil
+}
+
+func (d *FileDiscovery) poll() {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-d.done:
+			return
+		}
+		info, err := os.Stat(d.path)
+		if err != nil {
+			d.logger.Warn("error checking discovery file", "path", d.path, "error", err.Error())
+			continue
+		}
+		d.mutex.Lock()
+		changed := !info.ModTime().Equal(d.modTime) || info.Size() != d.size
+		d.mutex.Unlock()
+		if !changed {
+			continue
+		}
+		if err := d.Reload(); err != nil {
+			d.logger.Warn("error reloading discovery file", "path", d.path, "error", err.Error())
+		}
+	}
+}
+
+// Reload reads the file again and sends the changes to the watchers
+func (d *FileDiscovery) Reload() error {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return err
+	}
+	encoded, err := ioutil.ReadFile(d.path)
+	if err != nil {
+		return err
+	}
+	var servers []*cluster.Server
+	if err := json.Unmarshal(encoded, &servers); err != nil {
+		return err
+	}
+	file := make(map[string]*cluster.Server, len(servers))
+	for _, sv := range servers {
+		file[sv.ID] = sv
+	}
+
+	d.update(func() {
+		d.file = file
+		d.modTime = info.ModTime()
+		d.size = info.Size()
+	})
+	return nil
+}
+
+// Register adds sv to the servers of this process
+func (d *FileDiscovery) Register(sv *cluster.Server) error {
+	d.update(func() { d.registered[sv.ID] = sv })
+	return nil
+}
+
+// Unregister removes the server registered by this process with serverID
+func (d *FileDiscovery) Unregister(serverID string) error {
+	d.update(func() { delete(d.registered, serverID) })
+	return nil
+}
+
+// servers returns the servers of the file and the registered ones, which replace the file entries
+// with the same id. It must be called with the mutex held.
+func (d *FileDiscovery) servers() map[string]*cluster.Server {
+	servers := make(map[string]*cluster.Server, len(d.file)+len(d.registered))
+	for id, sv := range d.file {
+		servers[id] = sv
+	}
+	for id, sv := range d.registered {
+		servers[id] = sv
+	}
+	return servers
+}
+
+// update applies change and sends the servers it added and removed to the watchers
+func (d *FileDiscovery) update(change func()) {
+	d.notify.Lock()
+	defer d.notify.Unlock()
+
+	d.mutex.Lock()
+	before := d.servers()
+	change()
+	after := d.servers()
+	watchers := d.watchers
+	d.mutex.Unlock()
+
+	events := diffServers(before, after)
+	for _, ch := range watchers {
+		for _, event := range events {
+			ch <- event
+		}
+	}
+}
+
+func diffServers(before, after map[string]*cluster.Server) []DiscoveryEvent {
+	var events []DiscoveryEvent
+	for _, id := range sortedServerIDs(before) {
+		if sv, ok := after[id]; !ok || !reflect.DeepEqual(sv, before[id]) {
+			events = append(events, DiscoveryEvent{Type: ServerRemoved, Server: before[id]})
+		}
+	}
+	for _, id := range sortedServerIDs(after) {
+		if sv, ok := before[id]; !ok || !reflect.DeepEqual(sv, after[id]) {
+			events = append(events, DiscoveryEvent{Type: ServerAdded, Server: after[id]})
+		}
+	}
+	return events
+}
+
+func sortedServerIDs(servers map[string]*cluster.Server) []string {
+	ids := make([]string, 0, len(servers))
+	for id := range servers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Servers returns the servers of svType, or every server when it is empty
+func (d *FileDiscovery) Servers(svType string) ([]*cluster.Server, error) {
+	d.mutex.Lock()
+	servers := d.servers()
+	d.mutex.Unlock()
+
+	list := make([]*cluster.Server, 0, len(servers))
+	for _, id := range sortedServerIDs(servers) {
+		if sv := servers[id]; svType == "" || sv.Type == svType {
+			list = append(list, sv)
+		}
+	}
+	return list, nil
+}
+
+// Watch returns a channel receiving the changes of the servers until Close is called
+func (d *FileDiscovery) Watch() <-chan DiscoveryEvent {
+	ch := make(chan DiscoveryEvent, 16)
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.closed {
+		close(ch)
+		return ch
+	}
+	d.watchers = append(d.watchers, ch)
+	return ch
+}
+
+// Close stops reloading the file and closes the channels of the watchers
+func (d *FileDiscovery) Close() {
+	d.notify.Lock()
+	defer d.notify.Unlock()
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.closed {
+		return
+	}
+	d.closed = true
+	close(d.done)
+	for _, ch := range d.watchers {
+		close(ch)
+	}
+	d.watchers = nil
+}
+
+// PitayaServiceDiscovery makes a Discovery the service discovery of pitaya, given to
+// pitaya.SetServiceDiscoveryClient, so its rpc client routes to the servers of the Discovery.
+// The server is registered when the module starts and unregistered when it shuts down.
+type PitayaServiceDiscovery struct {
+	discovery Discovery
+	server    *cluster.Server
+
+	mutex     sync.Mutex
+	listeners []cluster.SDListener
+}
+
+// NewPitayaServiceDiscovery returns the pitaya service discovery of server backed by discovery
+func NewPitayaServiceDiscovery(discovery Discovery, server *cluster.Server) *PitayaServiceDiscovery {
+	p := &PitayaServiceDiscovery{discovery: discovery, server: server}
+	go p.watch(discovery.Watch())
+	return p
+}
+
+func (p *PitayaServiceDiscovery) watch(events <-chan DiscoveryEvent) {
+	for event := range events {
+		p.mutex.Lock()
+		listeners := p.listeners
+		p.mutex.Unlock()
+		for _, l := range listeners {
+			if event.Type == ServerAdded {
+				l.AddServer(event.Server)
+			} else {
+				l.RemoveServer(event.Server)
+			}
+		}
+	}
+}
+
+// GetServersByType returns the servers of serverType by id
+func (p *PitayaServiceDiscovery) GetServersByType(serverType string) (map[string]*cluster.Server, error) {
+	servers, err := p.discovery.Servers(serverType)
+	if err != nil {
+		return nil, err
+	}
+	if len(servers) == 0 {
+		return nil, constants.ErrNoServersAvailableOfType
+	}
+	byID := make(map[string]*cluster.Server, len(servers))
+	for _, sv := range servers {
+		byID[sv.ID] = sv
+	}
+	return byID, nil
+}
+
+// GetServer returns the server with id
+func (p *PitayaServiceDiscovery) GetServer(id string) (*cluster.Server, error) {
+	servers, err := p.discovery.Servers("")
+	if err != nil {
+		return nil, err
+	}
+	for _, sv := range servers {
+		if sv.ID == id {
+			return sv, nil
+		}
+	}
+	return nil, constants.ErrNoServerWithID
+}
+
+// GetServers returns every server of the cluster
+func (p *PitayaServiceDiscovery) GetServers() []*cluster.Server {
+	servers, _ := p.discovery.Servers("")
+	return servers
+}
+
+// SyncServers does nothing, the discovery keeps the servers up to date
+func (p *PitayaServiceDiscovery) SyncServers() error {
+	return nil
+}
+
+// AddListener calls listener with the servers added and removed from now on
+func (p *PitayaServiceDiscovery) AddListener(listener cluster.SDListener) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.listeners = append(p.listeners, listener)
+}
+
+// Init registers the server
+func (p *PitayaServiceDiscovery) Init() error {
+	return p.discovery.Register(p.server)
+}
+
+// AfterInit does nothing
+func (p *PitayaServiceDiscovery) AfterInit() {}
+
+// BeforeShutdown does nothing
+func (p *PitayaServiceDiscovery) BeforeShutdown() {}
+
+// Shutdown unregisters the server
+func (p *PitayaServiceDiscovery) Shutdown() error {
+	return p.discovery.Unregister(p.server.ID)
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/topfreegames/pitaya/cluster"
+	"github.com/topfreegames/pitaya/conn/message"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/route"
+	"github.com/topfreegames/pitaya/router"
+)
+
+func writeServers(t *testing.T, path string, servers ...*cluster.Server) {
+	t.Helper()
+	encoded, err := json.Marshal(servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, encoded, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func receiveEvent(t *testing.T, events <-chan DiscoveryEvent) DiscoveryEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no discovery event")
+	}
+	return DiscoveryEvent{}
+}
+
+// recordingListener sends the changes received from the pitaya service discovery
+type recordingListener struct {
+	events chan DiscoveryEvent
+}
+
+func (r *recordingListener) AddServer(sv *cluster.Server) {
+	r.events <- DiscoveryEvent{Type: ServerAdded, Server: sv}
+}
+
+func (r *recordingListener) RemoveServer(sv *cluster.Server) {
+	r.events <- DiscoveryEvent{Type: ServerRemoved, Server: sv}
+}
+
+func TestFileDiscoveryRouting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "servers.json")
+	writeServers(t, path, &cluster.Server{ID: "room-1", Type: "room"})
+
+	discovery, err := NewFileDiscovery(path, -1, NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer discovery.Close()
+	sd := NewPitayaServiceDiscovery(discovery, &cluster.Server{ID: "connector-1", Type: "connector", Frontend: true})
+	listener := &recordingListener{events: make(chan DiscoveryEvent, 4)}
+	sd.AddListener(listener)
+	if err := sd.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if event := receiveEvent(t, listener.events); event.Type != ServerAdded || event.Server.ID != "connector-1" {
+		t.Fatalf("expected the connector to be registered, got %v", event)
+	}
+
+	r := router.New()
+	r.SetServiceDiscovery(sd)
+	routeTo := func() (*cluster.Server, error) {
+		return r.Route(context.Background(), pitayaprotos.RPCType_User, "room", route.NewRoute("room", "room", "join"), &message.Message{})
+	}
+	if sv, err := routeTo(); err != nil || sv.ID != "room-1" {
+		t.Fatalf("expected to route to room-1, got %v and %v", sv, err)
+	}
+
+	writeServers(t, path, &cluster.Server{ID: "room-2", Type: "room"})
+	if err := discovery.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if sv, err := routeTo(); err != nil || sv.ID != "room-2" {
+		t.Fatalf("expected to route to room-2 once reloaded, got %v and %v", sv, err)
+	}
+	removed, added := receiveEvent(t, listener.events), receiveEvent(t, listener.events)
+	if removed.Type != ServerRemoved || removed.Server.ID != "room-1" || added.Type != ServerAdded || added.Server.ID != "room-2" {
+		t.Fatalf("expected room-1 to be replaced by room-2, got %v and %v", removed, added)
+	}
+
+	if sv, err := sd.GetServer("connector-1"); err != nil || !sv.Frontend {
+		t.Fatalf("the registered server should be kept on reload, got %v and %v", sv, err)
+	}
+	if err := sd.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if servers := sd.GetServers(); len(servers) != 1 || servers[0].ID != "room-2" {
+		t.Fatalf("expected the connector to be unregistered, got %v", servers)
+	}
+}
+
+func TestFileDiscoveryWatchesFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "servers.json")
+	writeServers(t, path)
+
+	discovery, err := NewFileDiscovery(path, 10*time.Millisecond, NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := discovery.Watch()
+
+	writeServers(t, path, &cluster.Server{ID: "room-1", Type: "room"})
+	if event := receiveEvent(t, events); event.Type != ServerAdded || event.Server.ID != "room-1" {
+		t.Fatalf("expected room-1 to be added, got %v", event)
+	}
+
+	discovery.Close()
+	if _, ok := <-events; ok {
+		t.Fatal("the channel should be closed with the discovery")
+	}
+}
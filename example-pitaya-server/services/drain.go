@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ErrConnectorDraining is the health failure of a connector that is draining, see SetDraining
+var ErrConnectorDraining = errors.New("connector is draining")
+
+// DrainStatus is the drain state of a connector
+type DrainStatus struct {
+	Draining bool `json:"draining"`
+	// Sessions is the number of bound sessions
+	Sessions int `json:"sessions"`
+}
+
+// SetDraining toggles the draining state of the connector. While draining, the connections
+// accepted are closed right away and the health of the connector fails with ErrConnectorDraining,
+// so the load balancers stop sending it clients, while the connected sessions and their rpcs are
+// served until they disconnect.
+//
+// The server stays registered in the service discovery: the other servers reach the connected
+// sessions through it to push them messages, kick them or forward their rpcs.
+func (c *Connector) SetDraining(draining bool) {
+	c.drain.mutex.Lock()
+	changed := c.drain.draining != draining
+	c.drain.draining = draining
+	c.drain.mutex.Unlock()
+	if changed {
+		c.logger.Info("connector draining changed", "draining", draining)
+	}
+}
+
+// DrainStatus returns whether the connector is draining and how many sessions are bound
+func (c *Connector) DrainStatus() DrainStatus {
+	c.drain.mutex.Lock()
+	defer c.drain.mutex.Unlock()
+	return DrainStatus{Draining: c.drain.draining, Sessions: len(c.drain.sessions)}
+}
+
+func (d *drainState) isDraining() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.draining
+}
+
+// DrainingCheck fails with ErrConnectorDraining while the connector is draining
+func (c *Connector) DrainingCheck() HealthCheck {
+	return func(ctx context.Context) error {
+		if c.drain.isDraining() {
+			return ErrConnectorDraining
+		}
+		return nil
+	}
+}
+
+// DrainHandler answers the drain status of the connector on GET, starts draining on POST and stops
+// on DELETE
+func (c *Connector) DrainHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			c.SetDraining(true)
+		case http.MethodDelete:
+			c.SetDraining(false)
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.DrainStatus())
+	})
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/topfreegames/pitaya/acceptor"
+	"github.com/topfreegames/pitaya/conn/message"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/route"
+)
+
+func TestDrainingStopsNewSessions(t *testing.T) {
+	c := NewConnector(nil)
+	s, _ := newBoundSession(t, c, "uid1")
+	conns := make(chan acceptor.PlayerConn)
+	wrapped := c.WrapAcceptor(&fakeAcceptor{conns: conns}).GetConnChan()
+
+	c.SetDraining(true)
+	refused := newPipeConn(4000)
+	conns <- refused
+
+	// the connected sessions keep their rpcs
+	client := c.WrapRPCClient(&flakyRPCClient{})
+	if _, err := client.Call(context.Background(), pitayaprotos.RPCType_Sys, route.NewRoute("room", "room", "join"),
+		s, &message.Message{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if status := c.DrainStatus(); !status.Draining || status.Sessions != 1 {
+		t.Fatalf("expected the connector to drain its session, got %+v", status)
+	}
+	if err := c.DrainingCheck()(context.Background()); err != ErrConnectorDraining {
+		t.Fatalf("expected the health to fail while draining, got %v", err)
+	}
+
+	c.SetDraining(false)
+	accepted := newPipeConn(4001)
+	conns <- accepted
+	select {
+	case conn := <-wrapped:
+		if conn.RemoteAddr() != accepted.RemoteAddr() {
+			t.Fatalf("the connection accepted while draining should not be served, got %v", conn.RemoteAddr())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the connection was not accepted once the drain stopped")
+	}
+	if !refused.isClosed() || accepted.isClosed() {
+		t.Fatal("only the connection accepted while draining should be closed")
+	}
+	if err := c.DrainingCheck()(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDrainHandler(t *testing.T) {
+	c := NewConnector(nil)
+	newBoundSession(t, c, "uid1")
+	server := httptest.NewServer(c.DrainHandler())
+	defer server.Close()
+
+	tables := []struct {
+		method   string
+		draining bool
+	}{
+		{http.MethodGet, false},
+		{http.MethodPost, true},
+		{http.MethodGet, true},
+		{http.MethodDelete, false},
+	}
+	for _, table := range tables {
+		req, err := http.NewRequest(table.method, server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		status := DrainStatus{}
+		err = json.NewDecoder(res.Body).Decode(&status)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Draining != table.draining || status.Sessions != 1 {
+			t.Fatalf("%s: unexpected status %+v", table.method, status)
+		}
+	}
+}
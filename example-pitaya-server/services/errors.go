@@ -0,0 +1,172 @@
+package services
+
+import (
+	"fmt"
+
+	e "github.com/topfreegames/pitaya/errors"
+)
+
+const (
+	// ErrUnavailableCode is the pitaya error code of the errors answered when a dependency of the
+	// server is down, the request may succeed when retried later
+	ErrUnavailableCode = "PIT-503"
+	// CategoryKey is the metadata key of the pitaya errors holding the category of the error
+	CategoryKey = "category"
+)
+
+// ErrorCategory groups the error codes by how the callers should react to them
+type ErrorCategory int
+
+// Categories of the errors
+const (
+	// CategoryUnknown is the category of the codes without category
+	CategoryUnknown ErrorCategory = iota
+	// CategoryValidation errors are caused by the request and fail again when retried as is
+	CategoryValidation
+	// CategoryAuth errors are caused by a missing or invalid authentication
+	CategoryAuth
+	// CategoryInternal errors are bugs of the server
+	CategoryInternal
+	// CategoryUnavailable errors are temporary, the request may succeed when retried later
+	CategoryUnavailable
+)
+
+func (c ErrorCategory) String() string {
+	switch c {
+	case CategoryValidation:
+		return "validation"
+	case CategoryAuth:
+		return "auth"
+	case CategoryInternal:
+		return "internal"
+	case CategoryUnavailable:
+		return "unavailable"
+	}
+	return "unknown"
+}
+
+func parseErrorCategory(s string) ErrorCategory {
+	for _, c := range []ErrorCategory{CategoryValidation, CategoryAuth, CategoryInternal, CategoryUnavailable} {
+		if c.String() == s {
+			return c
+		}
+	}
+	return CategoryUnknown
+}
+
+// codeCategories are the categories of the codes used by pitaya and this package
+var codeCategories = map[string]ErrorCategory{
+	e.ErrBadRequestCode:     CategoryValidation,
+	e.ErrNotFoundCode:       CategoryValidation,
+	ErrMessageTooLargeCode:  CategoryValidation,
+	ErrUnauthenticatedCode:  CategoryAuth,
+	ErrForbiddenCode:        CategoryAuth,
+	ErrSessionConflictCode:  CategoryValidation,
+	e.ErrUnknownCode:        CategoryInternal,
+	e.ErrInternalCode:       CategoryInternal,
+	ErrUnavailableCode:      CategoryUnavailable,
+	ErrRateLimitedCode:      CategoryUnavailable,
+	ErrDeadlineExceededCode: CategoryUnavailable,
+}
+
+// PitayaError is an error with a machine readable code, a message meant for humans and metadata.
+// Returned by remotes and handlers, it reaches the caller in the error of the pitaya response
+// with its code, message, metadata and category; the cause in Err stays on the server.
+type PitayaError struct {
+	Code     string
+	Message  string
+	Metadata map[string]string
+	// Err is the cause of the error, it is not sent to the caller
+	Err      error
+	category ErrorCategory
+}
+
+// NewError returns a new error with code and msg
+func NewError(code, msg string) *PitayaError {
+	return &PitayaError{Code: code, Message: msg}
+}
+
+// Wrap returns a new error with code and msg caused by err
+func Wrap(err error, code, msg string) *PitayaError {
+	return &PitayaError{Code: code, Message: msg, Err: err}
+}
+
+// WithMetadata sets key to value in the metadata of the error and returns it
+func (p *PitayaError) WithMetadata(key, value string) *PitayaError {
+	if p.Metadata == nil {
+		p.Metadata = make(map[string]string)
+	}
+	p.Metadata[key] = value
+	return p
+}
+
+// WithCategory sets the category of the error and returns it, for codes without category
+func (p *PitayaError) WithCategory(category ErrorCategory) *PitayaError {
+	p.category = category
+	return p
+}
+
+func (p *PitayaError) Error() string {
+	if p.Err != nil {
+		return fmt.Sprintf("%s: %s", p.Message, p.Err.Error())
+	}
+	return p.Message
+}
+
+// Unwrap returns the cause of the error
+func (p *PitayaError) Unwrap() error {
+	return p.Err
+}
+
+// Is makes errors.Is match the errors with the same code, either a *PitayaError or a *e.Error
+func (p *PitayaError) Is(target error) bool {
+	switch t := target.(type) {
+	case *PitayaError:
+		return t.Code == p.Code
+	case *e.Error:
+		return t.Code == p.Code
+	}
+	return false
+}
+
+// As makes errors.As convert the error into the *e.Error sent to the caller
+func (p *PitayaError) As(target interface{}) bool {
+	if t, ok := target.(**e.Error); ok {
+		*t = p.PitayaError()
+		return true
+	}
+	return false
+}
+
+// Category returns the category set by WithCategory, or the category of the code
+func (p *PitayaError) Category() ErrorCategory {
+	if p.category != CategoryUnknown {
+		return p.category
+	}
+	return codeCategories[p.Code]
+}
+
+// PitayaError converts the error into the pitaya error sent to the caller
+func (p *PitayaError) PitayaError() *e.Error {
+	metadata := make(map[string]string, len(p.Metadata)+1)
+	for k, v := range p.Metadata {
+		metadata[k] = v
+	}
+	if category := p.Category(); category != CategoryUnknown {
+		metadata[CategoryKey] = category.String()
+	}
+	return &e.Error{Code: p.Code, Message: p.Message, Metadata: metadata}
+}
+
+// fromPitayaError rebuilds the error answered by another server
+func fromPitayaError(err *e.Error) *PitayaError {
+	p := &PitayaError{Code: err.Code, Message: err.Message}
+	for k, v := range err.Metadata {
+		if k == CategoryKey {
+			p.category = parseErrorCategory(v)
+			continue
+		}
+		p.WithMetadata(k, v)
+	}
+	return p
+}
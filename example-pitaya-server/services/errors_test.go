@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/component"
+	e "github.com/topfreegames/pitaya/errors"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+)
+
+type failingRemote struct {
+	component.Base
+	err error
+}
+
+func (f *failingRemote) Fail(ctx context.Context, msg *protos.RPCMsg) (*protos.Response, error) {
+	return nil, f.err
+}
+
+func TestPitayaErrorRoundTrip(t *testing.T) {
+	tables := []struct {
+		name     string
+		err      error
+		category ErrorCategory
+	}{
+		{"returned", NewError(e.ErrBadRequestCode, "invalid room").WithMetadata("room", "lobby"), CategoryValidation},
+		{"wrapped", fmt.Errorf("joining: %w", Wrap(errors.New("redis down"), ErrUnavailableCode, "try again").
+			WithMetadata("room", "lobby")), CategoryUnavailable},
+		{"custom code", NewError("ROOM-001", "room is full").WithMetadata("room", "lobby").WithCategory(CategoryValidation),
+			CategoryValidation},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			routes := newTestRoutes()
+			if err := routes.HandleRemote("room.fail", &failingRemote{err: table.err}, "Fail"); err != nil {
+				t.Fatal(err)
+			}
+			server := &fakeRPCServer{}
+			routes.WrapRPCServer(server).SetPitayaServer(notFoundPitayaServer{})
+			res, err := server.pitayaServer.Call(context.Background(), &pitayaprotos.Request{
+				Type: pitayaprotos.RPCType_User,
+				Msg:  &pitayaprotos.Msg{Route: "room.room.fail"},
+			})
+			if err != nil || res.Error == nil {
+				t.Fatalf("expected an error response, got %v and %v", res, err)
+			}
+
+			err = classifyRPCError(&e.Error{Code: res.Error.Code, Message: res.Error.Msg, Metadata: res.Error.Metadata})
+			var expected, perr *PitayaError
+			errors.As(table.err, &expected)
+			if !errors.As(err, &perr) || perr.Code != expected.Code || perr.Message != expected.Message {
+				t.Fatalf("expected %v, got %v", expected, err)
+			}
+			if perr.Metadata["room"] != "lobby" || len(perr.Metadata) != 1 || perr.Category() != table.category {
+				t.Fatalf("expected the metadata and category to be kept, got %v and %s", perr.Metadata, perr.Category())
+			}
+			if perr.Err != nil {
+				t.Fatal("the cause should not be sent")
+			}
+			if !errors.Is(err, NewError(expected.Code, "")) {
+				t.Fatal("errors with the same code should match")
+			}
+		})
+	}
+}
+
+func TestErrorCategories(t *testing.T) {
+	tables := []struct {
+		err      *PitayaError
+		category ErrorCategory
+	}{
+		{NewError(e.ErrBadRequestCode, ""), CategoryValidation},
+		{NewError(ErrUnauthenticatedCode, ""), CategoryAuth},
+		{NewError(e.ErrInternalCode, ""), CategoryInternal},
+		{NewError(ErrRateLimitedCode, ""), CategoryUnavailable},
+		{NewError("ROOM-001", ""), CategoryUnknown},
+	}
+	for _, table := range tables {
+		t.Run(table.err.Code, func(t *testing.T) {
+			if category := table.err.Category(); category != table.category {
+				t.Fatalf("expected %s, got %s", table.category, category)
+			}
+		})
+	}
+}
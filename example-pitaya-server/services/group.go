@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/topfreegames/pitaya/serialize"
+	"github.com/topfreegames/pitaya/serialize/protobuf"
+	"github.com/topfreegames/pitaya/session"
+)
+
+// groupKeyPrefix namespaces the groups among the uids of the SessionStore
+const groupKeyPrefix = "group:"
+
+// ErrReservedUID is returned when binding or adding to a group an uid starting with the prefix
+// of the groups, its session data would overwrite the members of a group
+var ErrReservedUID = errors.New("uid is reserved")
+
+// checkUID fails with ErrReservedUID when uid would collide with a group in the SessionStore
+func checkUID(uid string) error {
+	if strings.HasPrefix(uid, groupKeyPrefix) {
+		return fmt.Errorf("%w: %s starts with %s", ErrReservedUID, uid, groupKeyPrefix)
+	}
+	return nil
+}
+
+// BroadcastError is returned by Broadcast when some members could not be sent the message
+type BroadcastError struct {
+	Route  string
+	Errors map[string]error
+}
+
+func (b *BroadcastError) Error() string {
+	return fmt.Sprintf("failed to broadcast %s to %d members", b.Route, len(b.Errors))
+}
+
+// Group is a set of uids connected to this frontend that receive broadcasts together.
+// Its members are persisted in a SessionStore so they survive connector restarts,
+// the stored membership expires with the ttl of the store after the last change.
+type Group struct {
+	name          string
+	store         SessionStore
+	serializer    serialize.Serializer
+	sessions      func(uid string) *session.Session
+	push          func(s *session.Session, route string, payload []byte) error
+	undeliverable UndeliverableFunc
+	mutex         sync.RWMutex
+	members       map[string]struct{}
+}
+
+// NewGroup returns the group name, restoring the members persisted in store.
+// The store can be nil when the group does not need to survive restarts.
+func NewGroup(ctx context.Context, name string, store SessionStore) (*Group, error) {
+	g := &Group{
+		name:       name,
+		store:      store,
+		serializer: protobuf.NewSerializer(),
+		sessions:   session.GetSessionByUID,
+		push:       pushSession,
+		members:    make(map[string]struct{}),
+	}
+	if store == nil {
+		return g, nil
+	}
+
+	stored, err := store.Get(ctx, groupKeyPrefix+name)
+	if err == ErrSessionDataNotFound {
+		return g, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	members, _ := stored.Data["members"].([]interface{})
+	for _, uid := range members {
+		if uid, ok := uid.(string); ok {
+			g.members[uid] = struct{}{}
+		}
+	}
+	return g, nil
+}
+
+// SetSerializer changes the serializer of the broadcasts, it must be the one given to pitaya.SetSerializer
+func (g *Group) SetSerializer(ser serialize.Serializer) {
+	g.serializer = ser
+}
+
+// SetUndeliverable calls f for each member whose session is gone when broadcasting
+func (g *Group) SetUndeliverable(f UndeliverableFunc) {
+	g.undeliverable = f
+}
+
+// Add adds uid to the group, uids starting with the prefix of the groups are rejected with ErrReservedUID
+func (g *Group) Add(uid string) error {
+	if err := checkUID(uid); err != nil {
+		return err
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if _, ok := g.members[uid]; ok {
+		return nil
+	}
+	g.members[uid] = struct{}{}
+	if err := g.persist(); err != nil {
+		delete(g.members, uid)
+		return err
+	}
+	return nil
+}
+
+// Remove removes uid from the group
+func (g *Group) Remove(uid string) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if _, ok := g.members[uid]; !ok {
+		return nil
+	}
+	delete(g.members, uid)
+	if err := g.persist(); err != nil {
+		g.members[uid] = struct{}{}
+		return err
+	}
+	return nil
+}
+
+// Members returns the uids in the group, sorted
+func (g *Group) Members() []string {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	return g.sortedMembers()
+}
+
+func (g *Group) sortedMembers() []string {
+	members := make([]string, 0, len(g.members))
+	for uid := range g.members {
+		members = append(members, uid)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// persist saves the members in the store, it must be called with the mutex held
+func (g *Group) persist() error {
+	if g.store == nil {
+		return nil
+	}
+	members := make([]interface{}, 0, len(g.members))
+	for _, uid := range g.sortedMembers() {
+		members = append(members, uid)
+	}
+	data := SessionData{Data: map[string]interface{}{"members": members}}
+	return g.store.Set(context.Background(), groupKeyPrefix+g.name, data)
+}
+
+// pushSession pushes payload to s right away
+func pushSession(s *session.Session, route string, payload []byte) error {
+	return s.Push(route, payload)
+}
+
+// Broadcast pushes msg to every connected member, members without a session are skipped.
+// The groups of a connector push like Connector.Push, with its ordering and send buffer.
+// The message is serialized once for all of them. Failing pushes don't stop the broadcast,
+// they are returned together in a *BroadcastError. Members whose session is gone are given
+// to the undeliverable func instead.
+func (g *Group) Broadcast(ctx context.Context, route string, msg proto.Message) error {
+	data, err := g.serializer.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	var errs map[string]error
+	for _, uid := range g.Members() {
+		s := g.sessions(uid)
+		if s == nil {
+			g.deadLetter(uid, route, data)
+			continue
+		}
+		err := g.push(s, route, data)
+		if isSessionGone(err) {
+			g.deadLetter(uid, route, data)
+			continue
+		}
+		if err != nil {
+			if errs == nil {
+				errs = make(map[string]error)
+			}
+			errs[uid] = err
+		}
+	}
+	if errs != nil {
+		return &BroadcastError{Route: route, Errors: errs}
+	}
+	return nil
+}
+
+func (g *Group) deadLetter(uid, route string, payload []byte) {
+	if g.undeliverable != nil {
+		g.undeliverable(uid, route, payload)
+	}
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/session"
+)
+
+// failingEntity is a client whose connection broke without the session being closed yet
+type failingEntity struct {
+	fakeEntity
+}
+
+func (f *failingEntity) Push(route string, v interface{}) error {
+	return errors.New("broken pipe")
+}
+
+func newTestGroup(t *testing.T, store SessionStore, sessions map[string]*session.Session) *Group {
+	g, err := NewGroup(context.Background(), "chat", store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.sessions = func(uid string) *session.Session {
+		return sessions[uid]
+	}
+	return g
+}
+
+func TestGroupBroadcast(t *testing.T) {
+	alice, bob := &fakeEntity{}, &fakeEntity{}
+	sessions := map[string]*session.Session{
+		"alice": session.New(alice, true, "alice"),
+		"bob":   session.New(bob, true, "bob"),
+	}
+	g := newTestGroup(t, nil, sessions)
+	for _, uid := range []string{"alice", "bob", "carol"} {
+		if err := g.Add(uid); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// carol has disconnected, she has no session
+	if err := g.Broadcast(context.Background(), "onMessage", &protos.UserMessage{Content: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	for uid, entity := range map[string]*fakeEntity{"alice": alice, "bob": bob} {
+		if !reflect.DeepEqual(entity.pushes, []string{"onMessage"}) {
+			t.Fatalf("%s should have received the broadcast, got %v", uid, entity.pushes)
+		}
+	}
+}
+
+func TestGroupBroadcastCollectsErrors(t *testing.T) {
+	alice := &fakeEntity{}
+	sessions := map[string]*session.Session{
+		"alice": session.New(alice, true, "alice"),
+		"bob":   session.New(&failingEntity{}, true, "bob"),
+	}
+	g := newTestGroup(t, nil, sessions)
+	g.Add("alice")
+	g.Add("bob")
+
+	err := g.Broadcast(context.Background(), "onMessage", &protos.UserMessage{Content: "hi"})
+	var berr *BroadcastError
+	if !errors.As(err, &berr) || len(berr.Errors) != 1 || berr.Errors["bob"] == nil {
+		t.Fatalf("expected bob to fail, got %v", err)
+	}
+	if len(alice.pushes) != 1 {
+		t.Fatal("a failing member should not stop the broadcast")
+	}
+}
+
+func TestGroupPersistsMembers(t *testing.T) {
+	store := NewMemorySessionStore(0)
+	g := newTestGroup(t, store, nil)
+	g.Add("alice")
+	g.Add("bob")
+	g.Add("carol")
+	g.Remove("bob")
+
+	// a restarted connector gets the same group back
+	restored := newTestGroup(t, store, nil)
+	if members := restored.Members(); !reflect.DeepEqual(members, []string{"alice", "carol"}) {
+		t.Fatalf("unexpected members: %v", members)
+	}
+}
+
+func TestGroupReservedUID(t *testing.T) {
+	store := NewMemorySessionStore(0)
+	g := newTestGroup(t, store, nil)
+	if err := g.Add("group:chat"); !errors.Is(err, ErrReservedUID) {
+		t.Fatalf("expected a group key to be rejected as member, got %v", err)
+	}
+
+	c := NewConnector(store)
+	if err := c.trackSession(context.Background(), session.New(&fakeEntity{}, true, "group:chat")); !errors.Is(err, ErrReservedUID) {
+		t.Fatalf("expected the bind of a group key to be rejected, got %v", err)
+	}
+	if err := c.trackSession(context.Background(), session.New(&fakeEntity{}, true, "chat")); err != nil {
+		t.Fatal(err)
+	}
+}
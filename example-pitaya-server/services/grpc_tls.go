@@ -0,0 +1,329 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/topfreegames/pitaya/cluster"
+	"github.com/topfreegames/pitaya/conn/message"
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+	e "github.com/topfreegames/pitaya/errors"
+	"github.com/topfreegames/pitaya/interfaces"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/route"
+	"github.com/topfreegames/pitaya/session"
+	"github.com/topfreegames/pitaya/tracing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// DefaultRPCTimeout is how long the rpcs of a TLSGRPCClient wait for an answer when no timeout is configured
+const DefaultRPCTimeout = 5 * time.Second
+
+// TLSGRPCServer is a rpc server of pitaya serving the rpcs over grpc with mutual tls, the servers
+// find it through the grpcHost and grpcPort metadata of pitaya. The connections presenting an
+// invalid certificate are closed during the handshake, before any rpc is dispatched.
+type TLSGRPCServer struct {
+	addr         string
+	tls          *ClusterTLS
+	pitayaServer pitayaprotos.PitayaServer
+
+	mutex    sync.Mutex
+	server   *grpc.Server
+	listener net.Listener
+}
+
+// NewTLSGRPCServer returns a rpc server listening on addr with the certificates of t
+func NewTLSGRPCServer(addr string, t *ClusterTLS) *TLSGRPCServer {
+	return &TLSGRPCServer{addr: addr, tls: t}
+}
+
+// SetPitayaServer sets the server the rpcs are dispatched to
+func (s *TLSGRPCServer) SetPitayaServer(server pitayaprotos.PitayaServer) {
+	s.pitayaServer = server
+}
+
+// Init starts listening
+func (s *TLSGRPCServer) Init() error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(s.tls.ServerConfig())))
+	pitayaprotos.RegisterPitayaServer(server, s.pitayaServer)
+
+	s.mutex.Lock()
+	s.server = server
+	s.listener = ln
+	s.mutex.Unlock()
+	go server.Serve(ln)
+	return nil
+}
+
+// Addr returns the address listened, or an empty string before Init
+func (s *TLSGRPCServer) Addr() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+// AfterInit does nothing
+func (s *TLSGRPCServer) AfterInit() {}
+
+// BeforeShutdown does nothing
+func (s *TLSGRPCServer) BeforeShutdown() {}
+
+// Shutdown stops accepting rpcs and waits for the ones running
+func (s *TLSGRPCServer) Shutdown() error {
+	s.mutex.Lock()
+	server := s.server
+	s.mutex.Unlock()
+	if server != nil {
+		server.GracefulStop()
+	}
+	return nil
+}
+
+// TLSGRPCClient is a rpc client of pitaya calling the TLSGRPCServer of the other servers. It must
+// be added as a listener of the service discovery to know them. Pushes and kicks to an uid whose
+// frontend is not given need a binding storage.
+type TLSGRPCClient struct {
+	server   *cluster.Server
+	tls      *ClusterTLS
+	timeout  time.Duration
+	bindings interfaces.BindingStorage
+
+	mutex sync.Mutex
+	conns map[string]*grpc.ClientConn
+}
+
+// NewTLSGRPCClient returns a rpc client of server with the certificates of t, its rpcs wait for an
+// answer for timeout or DefaultRPCTimeout when it is 0. bindings can be nil.
+func NewTLSGRPCClient(server *cluster.Server, t *ClusterTLS, timeout time.Duration, bindings interfaces.BindingStorage) *TLSGRPCClient {
+	if timeout == 0 {
+		timeout = DefaultRPCTimeout
+	}
+	return &TLSGRPCClient{
+		server:   server,
+		tls:      t,
+		timeout:  timeout,
+		bindings: bindings,
+		conns:    make(map[string]*grpc.ClientConn),
+	}
+}
+
+// AddServer dials sv, the connection is established on its first rpc
+func (c *TLSGRPCClient) AddServer(sv *cluster.Server) {
+	host, port := sv.Metadata[constants.GRPCHostKey], sv.Metadata[constants.GRPCPortKey]
+	if host == "" || port == "" {
+		return
+	}
+	conn, err := grpc.Dial(net.JoinHostPort(host, port), grpc.WithTransportCredentials(credentials.NewTLS(c.tls.ClientConfig())))
+	if err != nil {
+		return
+	}
+	c.mutex.Lock()
+	old := c.conns[sv.ID]
+	c.conns[sv.ID] = conn
+	c.mutex.Unlock()
+	if old != nil {
+		old.Close()
+	}
+}
+
+// RemoveServer closes the connection to sv
+func (c *TLSGRPCClient) RemoveServer(sv *cluster.Server) {
+	c.mutex.Lock()
+	conn := c.conns[sv.ID]
+	delete(c.conns, sv.ID)
+	c.mutex.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// client returns the client of the server with id
+func (c *TLSGRPCClient) client(serverID string) (pitayaprotos.PitayaClient, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	conn, ok := c.conns[serverID]
+	if !ok {
+		return nil, constants.ErrNoConnectionToServer
+	}
+	return pitayaprotos.NewPitayaClient(conn), nil
+}
+
+// request builds the request of a rpc like the rpc clients of pitaya
+func (c *TLSGRPCClient) request(
+	ctx context.Context,
+	rpcType pitayaprotos.RPCType,
+	route *route.Route,
+	session *session.Session,
+	msg *message.Message,
+) (*pitayaprotos.Request, error) {
+	req := &pitayaprotos.Request{
+		Type: rpcType,
+		Msg:  &pitayaprotos.Msg{Route: route.String(), Data: msg.Data},
+	}
+	if injected, err := tracing.InjectSpan(ctx); err == nil {
+		ctx = injected
+	}
+	ctx = pcontext.AddToPropagateCtx(ctx, constants.PeerIDKey, c.server.ID)
+	ctx = pcontext.AddToPropagateCtx(ctx, constants.PeerServiceKey, c.server.Type)
+	metadata, err := pcontext.Encode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req.Metadata = metadata
+	if c.server.Frontend {
+		req.FrontendID = c.server.ID
+	}
+	switch msg.Type {
+	case message.Request:
+		req.Msg.Type = pitayaprotos.MsgType_MsgRequest
+	case message.Notify:
+		req.Msg.Type = pitayaprotos.MsgType_MsgNotify
+	}
+	if rpcType == pitayaprotos.RPCType_Sys {
+		if msg.Type == message.Request {
+			req.Msg.Id = uint64(msg.ID)
+		}
+		req.Session = &pitayaprotos.Session{
+			Id:   session.ID(),
+			Uid:  session.UID(),
+			Data: session.GetDataEncoded(),
+		}
+	}
+	return req, nil
+}
+
+// Call sends the rpc to server and returns its answer, an answered error is returned as a *errors.Error
+func (c *TLSGRPCClient) Call(
+	ctx context.Context,
+	rpcType pitayaprotos.RPCType,
+	route *route.Route,
+	session *session.Session,
+	msg *message.Message,
+	server *cluster.Server,
+) (*pitayaprotos.Response, error) {
+	client, err := c.client(server.ID)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.request(ctx, rpcType, route, session, msg)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	res, err := client.Call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if res.Error != nil {
+		code := res.Error.Code
+		if code == "" {
+			code = e.ErrUnknownCode
+		}
+		return nil, &e.Error{Code: code, Message: res.Error.Msg, Metadata: res.Error.Metadata}
+	}
+	return res, nil
+}
+
+// Send is not supported over grpc
+func (c *TLSGRPCClient) Send(route string, data []byte) error {
+	return constants.ErrNotImplemented
+}
+
+// frontend returns the id of the frontend of uid among the servers of svType
+func (c *TLSGRPCClient) frontend(uid, svType string) (string, error) {
+	if c.bindings == nil {
+		return "", constants.ErrNoBindingStorageModule
+	}
+	return c.bindings.GetUserFrontendID(uid, svType)
+}
+
+// SendPush sends push to the frontend of userID, frontendSv when its id is set
+func (c *TLSGRPCClient) SendPush(userID string, frontendSv *cluster.Server, push *pitayaprotos.Push) error {
+	svID := frontendSv.ID
+	if svID == "" {
+		var err error
+		if svID, err = c.frontend(userID, frontendSv.Type); err != nil {
+			return err
+		}
+	}
+	client, err := c.client(svID)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	_, err = client.PushToUser(ctx, push)
+	return err
+}
+
+// SendKick kicks userID from its frontend of serverType
+func (c *TLSGRPCClient) SendKick(userID string, serverType string, kick *pitayaprotos.KickMsg) error {
+	svID, err := c.frontend(userID, serverType)
+	if err != nil {
+		return err
+	}
+	client, err := c.client(svID)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	_, err = client.KickUser(ctx, kick)
+	return err
+}
+
+// BroadcastSessionBind tells the frontend of uid among the servers of this type that it is bound here
+func (c *TLSGRPCClient) BroadcastSessionBind(uid string) error {
+	fid, err := c.frontend(uid, c.server.Type)
+	if err != nil || fid == "" {
+		return err
+	}
+	client, err := c.client(fid)
+	if err != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	_, err = client.SessionBindRemote(ctx, &pitayaprotos.BindMsg{Uid: uid, Fid: c.server.ID})
+	return err
+}
+
+// Init does nothing, the servers are dialed as they are discovered
+func (c *TLSGRPCClient) Init() error {
+	return nil
+}
+
+// AfterInit does nothing
+func (c *TLSGRPCClient) AfterInit() {}
+
+// BeforeShutdown does nothing
+func (c *TLSGRPCClient) BeforeShutdown() {}
+
+// Shutdown closes the connections to the servers
+func (c *TLSGRPCClient) Shutdown() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for id, conn := range c.conns {
+		conn.Close()
+		delete(c.conns, id)
+	}
+	return nil
+}
+
+// String describes the client in the logs
+func (c *TLSGRPCClient) String() string {
+	return fmt.Sprintf("tls grpc client of %s", c.server.ID)
+}
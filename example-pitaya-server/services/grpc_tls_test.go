@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/topfreegames/pitaya/cluster"
+	"github.com/topfreegames/pitaya/conn/message"
+	"github.com/topfreegames/pitaya/constants"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/route"
+)
+
+// testCA signs the certificates of the cluster tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, der: der}
+}
+
+// writeCert writes to dir the ca bundle and a certificate of name signed by ca, for both server
+// and client auth, and returns the options loading them
+func (ca *testCA) writeCert(t *testing.T, dir, name string) ClusterTLSOptions {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := ClusterTLSOptions{
+		CAFile:   filepath.Join(dir, name+"-ca.pem"),
+		CertFile: filepath.Join(dir, name+".pem"),
+		KeyFile:  filepath.Join(dir, name+"-key.pem"),
+	}
+	writePEM(t, opts.CAFile, "CERTIFICATE", ca.der)
+	writePEM(t, opts.CertFile, "CERTIFICATE", der)
+	writePEM(t, opts.KeyFile, "EC PRIVATE KEY", keyDER)
+	return opts
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// countingPitayaServer answers every call with its data, counting the calls dispatched
+type countingPitayaServer struct {
+	pitayaprotos.PitayaServer
+	calls int32
+}
+
+func (s *countingPitayaServer) Call(ctx context.Context, req *pitayaprotos.Request) (*pitayaprotos.Response, error) {
+	atomic.AddInt32(&s.calls, 1)
+	return &pitayaprotos.Response{Data: req.Msg.Data}, nil
+}
+
+func newClusterTLS(t *testing.T, opts ClusterTLSOptions) *ClusterTLS {
+	clusterTLS, err := NewClusterTLS(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clusterTLS
+}
+
+// callRoom sends a rpc from a client with clientTLS to the room server listening on addr
+func callRoom(t *testing.T, clientTLS *ClusterTLS, addr string) (*pitayaprotos.Response, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	room := &cluster.Server{ID: "room-1", Type: "room", Metadata: map[string]string{
+		constants.GRPCHostKey: host,
+		constants.GRPCPortKey: port,
+	}}
+	client := NewTLSGRPCClient(&cluster.Server{ID: "connector-1", Type: "connector", Frontend: true}, clientTLS, time.Second, nil)
+	defer client.Shutdown()
+	client.AddServer(room)
+
+	rt, _ := route.Decode("room.roomremote.join")
+	return client.Call(context.Background(), pitayaprotos.RPCType_User, rt, nil, &message.Message{Type: message.Request, Data: []byte("hello")}, room)
+}
+
+func TestClusterMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clustertls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t, "cluster ca")
+	serverOpts := ca.writeCert(t, dir, "room")
+	serverOpts.RequireClientCert = true
+	remote := &countingPitayaServer{}
+	server := NewTLSGRPCServer("127.0.0.1:0", newClusterTLS(t, serverOpts))
+	server.SetPitayaServer(remote)
+	if err := server.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Shutdown()
+
+	t.Run("trusted", func(t *testing.T) {
+		res, err := callRoom(t, newClusterTLS(t, ca.writeCert(t, dir, "connector")), server.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(res.Data) != "hello" {
+			t.Fatalf("expected the answer of the remote, got %q", res.Data)
+		}
+	})
+	if calls := atomic.LoadInt32(&remote.calls); calls != 1 {
+		t.Fatalf("expected the trusted call to be dispatched, got %d calls", calls)
+	}
+
+	t.Run("untrusted", func(t *testing.T) {
+		// signed by another ca, which the client trusts so only the server rejects it
+		rogue := newTestCA(t, "rogue ca")
+		opts := rogue.writeCert(t, dir, "rogue")
+		opts.CAFile = serverOpts.CAFile
+		if _, err := callRoom(t, newClusterTLS(t, opts), server.Addr()); err == nil {
+			t.Fatal("expected the untrusted certificate to be rejected")
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		conn, err := tls.Dial("tcp", server.Addr(), &tls.Config{InsecureSkipVerify: true})
+		if err == nil {
+			// with tls 1.3 the server rejects the client after the client finished its handshake
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			_, err = conn.Read(make([]byte, 1))
+		}
+		if err == nil {
+			t.Fatal("expected the client without a certificate to be rejected")
+		}
+	})
+
+	t.Run("untrusted server", func(t *testing.T) {
+		opts := newTestCA(t, "other ca").writeCert(t, dir, "lost")
+		if _, err := callRoom(t, newClusterTLS(t, opts), server.Addr()); err == nil {
+			t.Fatal("expected the server signed by another ca to be rejected")
+		}
+	})
+	if calls := atomic.LoadInt32(&remote.calls); calls != 1 {
+		t.Fatalf("expected the rejected calls not to be dispatched, got %d calls", calls)
+	}
+}
+
+func TestClusterTLSReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clustertls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := newTestCA(t, "old ca").writeCert(t, dir, "room")
+	clusterTLS := newClusterTLS(t, opts)
+	old, _ := clusterTLS.current()
+
+	// the certificates are kept when the files are broken
+	if err := ioutil.WriteFile(opts.CertFile, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := clusterTLS.Reload(); err == nil {
+		t.Fatal("expected reloading a broken certificate to fail")
+	}
+	if cert, _ := clusterTLS.current(); cert != old {
+		t.Fatal("expected the certificate to be kept")
+	}
+
+	newTestCA(t, "new ca").writeCert(t, dir, "room")
+	if err := clusterTLS.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if cert, _ := clusterTLS.current(); cert == old {
+		t.Fatal("expected the certificate to be replaced")
+	}
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/topfreegames/pitaya/cluster"
+)
+
+// Status of the health endpoints
+const (
+	HealthOK          = "ok"
+	HealthUnavailable = "unavailable"
+)
+
+// HealthCheckTimeout is how long health checks can take before the server is reported unavailable
+const HealthCheckTimeout = time.Second
+
+// HealthCheck returns an error when a dependency of the server is unreachable
+type HealthCheck func(ctx context.Context) error
+
+// Health reports whether the server can serve rpc's: every check passes and the
+// cluster has a server of each required type. It listens to the service discovery
+// so the membership is always the current one.
+type Health struct {
+	mutex    sync.RWMutex
+	checks   map[string]HealthCheck
+	required []string
+	servers  map[string]map[string]bool
+}
+
+// NewHealth returns the health of a server that needs a server of each of requiredTypes,
+// discovery must be the one given to pitaya.SetServiceDiscoveryClient
+func NewHealth(discovery cluster.ServiceDiscovery, requiredTypes ...string) *Health {
+	h := &Health{
+		checks:   make(map[string]HealthCheck),
+		required: requiredTypes,
+		servers:  make(map[string]map[string]bool),
+	}
+	for _, sv := range discovery.GetServers() {
+		h.AddServer(sv)
+	}
+	discovery.AddListener(h)
+	return h
+}
+
+// AddCheck adds a dependency to the health, replacing the check with the same name
+func (h *Health) AddCheck(name string, check HealthCheck) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.checks[name] = check
+}
+
+// AddServer is called by the service discovery when a server joins the cluster
+func (h *Health) AddServer(sv *cluster.Server) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.servers[sv.Type] == nil {
+		h.servers[sv.Type] = make(map[string]bool)
+	}
+	h.servers[sv.Type][sv.ID] = true
+}
+
+// RemoveServer is called by the service discovery when a server leaves the cluster
+func (h *Health) RemoveServer(sv *cluster.Server) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.servers[sv.Type], sv.ID)
+}
+
+// Check returns the error of each failing dependency, the server is healthy when it is empty
+func (h *Health) Check(ctx context.Context) map[string]error {
+	h.mutex.RLock()
+	failures := make(map[string]error)
+	for _, svType := range h.required {
+		if len(h.servers[svType]) == 0 {
+			failures["servers:"+svType] = fmt.Errorf("no %s server in the cluster", svType)
+		}
+	}
+	checks := make(map[string]HealthCheck, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	h.mutex.RUnlock()
+
+	for name, check := range checks {
+		if err := check(ctx); err != nil {
+			failures[name] = err
+		}
+	}
+	return failures
+}
+
+type healthResponse struct {
+	Status string            `json:"status"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// Healthz answers 200 when the server can serve rpc's and 503 with the failing dependencies otherwise
+func (h *Health) Healthz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), HealthCheckTimeout)
+	defer cancel()
+
+	res := healthResponse{Status: HealthOK}
+	if failures := h.Check(ctx); len(failures) > 0 {
+		res.Status = HealthUnavailable
+		res.Errors = make(map[string]string, len(failures))
+		for name, err := range failures {
+			res.Errors[name] = err.Error()
+		}
+	}
+	writeHealth(w, res)
+}
+
+// Livez answers 200 while the process serves requests. It checks no dependency,
+// so the process is not restarted when the cluster is the one failing.
+func (h *Health) Livez(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, healthResponse{Status: HealthOK})
+}
+
+func writeHealth(w http.ResponseWriter, res healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if res.Status != HealthOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// DiscoveryCheck fails when serverID, usually this server, is not registered in discovery
+func DiscoveryCheck(discovery cluster.ServiceDiscovery, serverID string) HealthCheck {
+	return func(ctx context.Context) error {
+		_, err := discovery.GetServer(serverID)
+		return err
+	}
+}
+
+// NATSCheck fails when conn is not connected to its server
+func NATSCheck(conn *nats.Conn) HealthCheck {
+	return func(ctx context.Context) error {
+		if !conn.IsConnected() {
+			return errors.New("nats is not connected")
+		}
+		return nil
+	}
+}
+
+// ServeHealth exposes the health on addr at /healthz and /livez
+func ServeHealth(addr string, h *Health) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", h.Healthz)
+	mux.HandleFunc("/livez", h.Livez)
+	return &http.Server{Addr: addr, Handler: mux}
+}
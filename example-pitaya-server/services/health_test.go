@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/topfreegames/pitaya/cluster"
+	"github.com/topfreegames/pitaya/constants"
+)
+
+// fakeDiscovery notifies its listeners of the servers going up and down
+type fakeDiscovery struct {
+	cluster.ServiceDiscovery
+	servers   map[string]*cluster.Server
+	listeners []cluster.SDListener
+}
+
+func newFakeDiscovery(servers ...*cluster.Server) *fakeDiscovery {
+	d := &fakeDiscovery{servers: make(map[string]*cluster.Server)}
+	for _, sv := range servers {
+		d.servers[sv.ID] = sv
+	}
+	return d
+}
+
+func (d *fakeDiscovery) GetServers() []*cluster.Server {
+	servers := make([]*cluster.Server, 0, len(d.servers))
+	for _, sv := range d.servers {
+		servers = append(servers, sv)
+	}
+	return servers
+}
+
+func (d *fakeDiscovery) GetServer(id string) (*cluster.Server, error) {
+	if sv, ok := d.servers[id]; ok {
+		return sv, nil
+	}
+	return nil, constants.ErrNoServerWithID
+}
+
+func (d *fakeDiscovery) AddListener(l cluster.SDListener) {
+	d.listeners = append(d.listeners, l)
+}
+
+func (d *fakeDiscovery) up(sv *cluster.Server) {
+	d.servers[sv.ID] = sv
+	for _, l := range d.listeners {
+		l.AddServer(sv)
+	}
+}
+
+func (d *fakeDiscovery) down(sv *cluster.Server) {
+	delete(d.servers, sv.ID)
+	for _, l := range d.listeners {
+		l.RemoveServer(sv)
+	}
+}
+
+func healthz(t *testing.T, h *Health) (int, healthResponse) {
+	w := httptest.NewRecorder()
+	h.Healthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	var res healthResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, res
+}
+
+func TestHealthFollowsMembership(t *testing.T) {
+	self := &cluster.Server{ID: "connector-1", Type: "connector"}
+	room := &cluster.Server{ID: "room-1", Type: "room"}
+	discovery := newFakeDiscovery(self)
+	h := NewHealth(discovery, "room")
+	h.AddCheck("discovery", DiscoveryCheck(discovery, self.ID))
+
+	if code, res := healthz(t, h); code != http.StatusServiceUnavailable || res.Errors["servers:room"] == "" {
+		t.Fatalf("expected unavailable without a room server, got %d %v", code, res)
+	}
+
+	discovery.up(room)
+	if code, res := healthz(t, h); code != http.StatusOK || res.Status != HealthOK {
+		t.Fatalf("expected ok with a room server, got %d %v", code, res)
+	}
+
+	discovery.down(room)
+	if code, _ := healthz(t, h); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected unavailable once the room server is down, got %d", code)
+	}
+
+	discovery.up(room)
+	discovery.down(self)
+	if code, res := healthz(t, h); code != http.StatusServiceUnavailable || res.Errors["discovery"] == "" {
+		t.Fatalf("expected unavailable when this server is not registered, got %d %v", code, res)
+	}
+}
+
+func TestHealthChecks(t *testing.T) {
+	h := NewHealth(newFakeDiscovery())
+	rpcErr := errors.New("nats is not connected")
+	h.AddCheck("rpc", func(ctx context.Context) error { return rpcErr })
+
+	code, res := healthz(t, h)
+	if code != http.StatusServiceUnavailable || res.Errors["rpc"] != rpcErr.Error() {
+		t.Fatalf("expected the rpc check to fail, got %d %v", code, res)
+	}
+
+	// liveness does not depend on the cluster
+	w := httptest.NewRecorder()
+	h.Livez(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the process to be live, got %d", w.Code)
+	}
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+)
+
+const (
+	// IdempotencyKey is the key of the propagated context under which callers send the idempotency
+	// key of a request, retries of the request must send the same key
+	IdempotencyKey = "idempotency-key"
+	// DefaultIdempotencyTTL is how long the answers are cached when no ttl is configured
+	DefaultIdempotencyTTL = 10 * time.Minute
+)
+
+// IdempotencyCache keeps the answers of the requests sent with an idempotency key
+type IdempotencyCache interface {
+	// Get returns the answer cached for key, ok is false when there is none
+	Get(ctx context.Context, key string) (answer []byte, ok bool, err error)
+	// Set caches answer for key during ttl, keeping the answer already cached for key if any
+	Set(ctx context.Context, key string, answer []byte, ttl time.Duration) error
+}
+
+// MemoryIdempotencyCache is an IdempotencyCache keeping the answers in memory, the duplicates of a
+// request are only detected when they reach the same server
+type MemoryIdempotencyCache struct {
+	mutex   sync.Mutex
+	entries map[string]memoryEntry
+	clock   Clock
+}
+
+// NewMemoryIdempotencyCache returns a new in memory idempotency cache
+func NewMemoryIdempotencyCache() *MemoryIdempotencyCache {
+	return &MemoryIdempotencyCache{
+		entries: make(map[string]memoryEntry),
+		clock:   RealClock,
+	}
+}
+
+// Get returns the answer cached for key
+func (m *MemoryIdempotencyCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	entry, ok := m.entries[key]
+	if ok && !m.clock.Now().Before(entry.expireAt) {
+		delete(m.entries, key)
+		return nil, false, nil
+	}
+	return entry.encoded, ok, nil
+}
+
+// Set caches answer for key during ttl unless an answer is already cached
+func (m *MemoryIdempotencyCache) Set(ctx context.Context, key string, answer []byte, ttl time.Duration) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := m.clock.Now()
+	if entry, ok := m.entries[key]; ok && now.Before(entry.expireAt) {
+		return nil
+	}
+	m.entries[key] = memoryEntry{encoded: answer, expireAt: now.Add(ttl)}
+	return nil
+}
+
+// RedisIdempotencyCache is an IdempotencyCache backed by redis, shared by the servers using it
+type RedisIdempotencyCache struct {
+	pool   *redis.Pool
+	prefix string
+}
+
+// NewRedisIdempotencyCache returns a new redis idempotency cache connected to address
+func NewRedisIdempotencyCache(address string) *RedisIdempotencyCache {
+	pool := &redis.Pool{
+		MaxIdle:     10,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", address)
+		},
+	}
+	return NewRedisIdempotencyCacheWithPool(pool)
+}
+
+// NewRedisIdempotencyCacheWithPool returns a new redis idempotency cache using an existing pool
+func NewRedisIdempotencyCacheWithPool(pool *redis.Pool) *RedisIdempotencyCache {
+	return &RedisIdempotencyCache{pool: pool, prefix: "pitaya:idempotency:"}
+}
+
+func (r *RedisIdempotencyCache) key(key string) string {
+	return fmt.Sprintf("%s%s", r.prefix, key)
+}
+
+// Get returns the answer cached for key
+func (r *RedisIdempotencyCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	answer, err := redis.Bytes(conn.Do("GET", r.key(key)))
+	if err == redis.ErrNil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return answer, true, nil
+}
+
+// Set caches answer for key during ttl unless an answer is already cached
+func (r *RedisIdempotencyCache) Set(ctx context.Context, key string, answer []byte, ttl time.Duration) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", r.key(key), answer, "PX", int64(ttl/time.Millisecond), "NX")
+	if err == redis.ErrNil {
+		// NX answers nil when the key exists
+		return nil
+	}
+	return err
+}
+
+// idempotentCall is a request being served, its duplicates wait for its answer
+type idempotentCall struct {
+	done chan struct{}
+	out  []byte
+	err  error
+}
+
+// Idempotent returns a middleware answering the requests sent with an idempotency key with the
+// first answer to the same key and route, during ttl or DefaultIdempotencyTTL when it is 0.
+// Duplicates received while the first request is being served wait for its answer instead of being
+// served too. Errors are not cached, so the request is served again when retried after failing.
+//
+// The request fails when the cache can't be read, rather than risking to be served twice.
+func Idempotent(cache IdempotencyCache, ttl time.Duration, logger Logger) MiddlewareFunc {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	var mutex sync.Mutex
+	calls := make(map[string]*idempotentCall)
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, in []byte) ([]byte, error) {
+			idempotencyKey, _ := pcontext.GetFromPropagateCtx(ctx, IdempotencyKey).(string)
+			if idempotencyKey == "" {
+				return next(ctx, in)
+			}
+			route, _ := pcontext.GetFromPropagateCtx(ctx, constants.RouteKey).(string)
+			key := route + ":" + idempotencyKey
+
+			mutex.Lock()
+			if call, ok := calls[key]; ok {
+				mutex.Unlock()
+				select {
+				case <-call.done:
+					return call.out, call.err
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+			call := &idempotentCall{done: make(chan struct{})}
+			calls[key] = call
+			mutex.Unlock()
+
+			defer func() {
+				mutex.Lock()
+				delete(calls, key)
+				mutex.Unlock()
+				close(call.done)
+			}()
+
+			cached, ok, err := cache.Get(ctx, key)
+			switch {
+			case err != nil:
+				call.err = err
+			case ok:
+				call.out = cached
+			default:
+				call.out, call.err = next(ctx, in)
+				if call.err == nil {
+					// the answer may be in a pooled buffer reused once the call returns, the
+					// duplicates waiting for it get the copy
+					call.out = append([]byte(nil), call.out...)
+					if err := cache.Set(ctx, key, call.out, ttl); err != nil {
+						LoggerFromCtx(ctx, logger).Warn("error caching idempotent answer", "route", route, "error", err.Error())
+					}
+				}
+			}
+			return call.out, call.err
+		}
+	}
+}
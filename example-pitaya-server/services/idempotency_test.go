@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+)
+
+func idempotentCtx(key string) context.Context {
+	ctx := pcontext.AddToPropagateCtx(context.Background(), constants.RouteKey, "connector.connectorremote.remotefunc")
+	return pcontext.AddToPropagateCtx(ctx, IdempotencyKey, key)
+}
+
+// noopIdempotencyCache caches nothing, so only the requests being served are deduplicated
+type noopIdempotencyCache struct{}
+
+func (noopIdempotencyCache) Get(context.Context, string) ([]byte, bool, error) {
+	return nil, false, nil
+}
+
+func (noopIdempotencyCache) Set(context.Context, string, []byte, time.Duration) error {
+	return nil
+}
+
+func TestIdempotentDuplicate(t *testing.T) {
+	var served int32
+	h := Idempotent(NewMemoryIdempotencyCache(), time.Minute, NewNopLogger())(func(ctx context.Context, in []byte) ([]byte, error) {
+		n := atomic.AddInt32(&served, 1)
+		return []byte{byte(n)}, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		out, err := h(idempotentCtx("a"), nil)
+		if err != nil || len(out) != 1 || out[0] != 1 {
+			t.Fatalf("expected the first answer, got %v and %v", out, err)
+		}
+	}
+	if out, _ := h(idempotentCtx("b"), nil); out[0] != 2 {
+		t.Fatal("other keys should be served")
+	}
+	if out, _ := h(context.Background(), nil); out[0] != 3 {
+		t.Fatal("requests without key should be served")
+	}
+}
+
+func TestIdempotentCoalesce(t *testing.T) {
+	var served int32
+	release := make(chan struct{})
+	h := Idempotent(noopIdempotencyCache{}, time.Minute, NewNopLogger())(func(ctx context.Context, in []byte) ([]byte, error) {
+		atomic.AddInt32(&served, 1)
+		<-release
+		return []byte("answer"), nil
+	})
+
+	var wg sync.WaitGroup
+	answers := make([][]byte, 5)
+	for i := range answers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			answers[i], _ = h(idempotentCtx("a"), nil)
+		}(i)
+	}
+	// lets the duplicates wait for the first request
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if served != 1 {
+		t.Fatalf("expected the concurrent duplicates to be served once, got %d", served)
+	}
+	for _, answer := range answers {
+		if string(answer) != "answer" {
+			t.Fatalf("expected every duplicate to get the answer, got %q", answer)
+		}
+	}
+}
+
+func TestIdempotentExpiry(t *testing.T) {
+	clock := newFakeClock()
+	cache := NewMemoryIdempotencyCache()
+	cache.clock = clock
+	var served int32
+	h := Idempotent(cache, time.Minute, NewNopLogger())(func(ctx context.Context, in []byte) ([]byte, error) {
+		n := atomic.AddInt32(&served, 1)
+		return []byte{byte(n)}, nil
+	})
+
+	h(idempotentCtx("a"), nil)
+	clock.Advance(59 * time.Second)
+	if out, _ := h(idempotentCtx("a"), nil); out[0] != 1 {
+		t.Fatal("the answer should be cached during the ttl")
+	}
+	clock.Advance(time.Second)
+	if out, _ := h(idempotentCtx("a"), nil); out[0] != 2 {
+		t.Fatal("the request should be served again once the ttl elapsed")
+	}
+}
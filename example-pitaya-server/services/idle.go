@@ -0,0 +1,163 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/topfreegames/pitaya/acceptor"
+	"github.com/topfreegames/pitaya/conn/codec"
+	"github.com/topfreegames/pitaya/conn/packet"
+)
+
+// ErrIdleTimeout ends the connections of the clients that didn't answer the keepalive ping in time
+var ErrIdleTimeout = errors.New("idle timeout")
+
+// heartbeatPacket is the keepalive ping, clients answer the heartbeats of pitaya with a heartbeat
+var heartbeatPacket, _ = codec.NewPomeloPacketEncoder().Encode(packet.Heartbeat, nil)
+
+// WithIdleTimeout pings the connections that didn't send or receive anything for timeout, closing
+// them with DisconnectIdleTimeout when the client doesn't answer within grace. Connections are
+// pinged again after each timeout without being closed when grace is 0, and never when timeout is 0.
+// The heartbeats pitaya sends are not activity, the ones clients send are.
+func WithIdleTimeout(timeout, grace time.Duration) ConnectorOption {
+	return func(c *Connector) {
+		c.idle.timeout = timeout
+		c.idle.grace = grace
+	}
+}
+
+// idleConfig are the idle timeouts of the connections of a connector
+type idleConfig struct {
+	timeout time.Duration
+	grace   time.Duration
+	clock   Clock
+}
+
+func newIdleConfig() idleConfig {
+	return idleConfig{clock: RealClock}
+}
+
+// wrap returns conn closed when idle, conn itself when the timeout is disabled
+func (i idleConfig) wrap(conn acceptor.PlayerConn) acceptor.PlayerConn {
+	if i.timeout <= 0 {
+		return conn
+	}
+	c := &idleConn{
+		PlayerConn: conn,
+		config:     i,
+		last:       i.clock.Now(),
+		done:       make(chan struct{}),
+	}
+	go c.watch()
+	return c
+}
+
+// idleConn is a connection pinged by a goroutine while idle. pitaya writes from the goroutine of
+// its heartbeats too, so writes are serialized.
+type idleConn struct {
+	acceptor.PlayerConn
+	config     idleConfig
+	writeMutex sync.Mutex
+	closeOnce  sync.Once
+	done       chan struct{}
+
+	mutex sync.Mutex
+	// last is when the connection was last active, activity counts the reads and writes
+	last     time.Time
+	activity int
+	timedOut bool
+}
+
+func (c *idleConn) GetNextMessage() ([]byte, error) {
+	b, err := c.PlayerConn.GetNextMessage()
+	if err != nil {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if c.timedOut {
+			return nil, ErrIdleTimeout
+		}
+		return nil, err
+	}
+	c.active(true)
+	return b, nil
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	c.writeMutex.Lock()
+	n, err := c.PlayerConn.Write(b)
+	c.writeMutex.Unlock()
+	if err == nil && !isHeartbeat(b) {
+		c.active(true)
+	}
+	return n, err
+}
+
+func (c *idleConn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return c.PlayerConn.Close()
+}
+
+// active resets the idle timeout, counting it as activity answering the ping when counted
+func (c *idleConn) active(counted bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.last = c.config.clock.Now()
+	if counted {
+		c.activity++
+	}
+}
+
+// watch pings the connection each time it becomes idle until it is closed
+func (c *idleConn) watch() {
+	for {
+		c.mutex.Lock()
+		wait := c.config.timeout - c.config.clock.Now().Sub(c.last)
+		activity := c.activity
+		c.mutex.Unlock()
+		if wait > 0 {
+			if !c.sleep(wait) {
+				return
+			}
+			continue
+		}
+
+		c.writeMutex.Lock()
+		_, err := c.PlayerConn.Write(heartbeatPacket)
+		c.writeMutex.Unlock()
+		if err != nil {
+			// the connection is broken, reading from it fails too
+			return
+		}
+		if c.config.grace <= 0 {
+			c.active(false)
+			continue
+		}
+		if !c.sleep(c.config.grace) {
+			return
+		}
+
+		c.mutex.Lock()
+		answered := c.activity != activity
+		c.timedOut = !answered
+		c.mutex.Unlock()
+		if !answered {
+			c.PlayerConn.Close()
+			return
+		}
+	}
+}
+
+// sleep waits for d, returning false if the connection is closed first
+func (c *idleConn) sleep(d time.Duration) bool {
+	select {
+	case <-c.config.clock.After(d):
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+func isHeartbeat(b []byte) bool {
+	return len(b) == codec.HeadLength && packet.Type(b[0]) == packet.Heartbeat
+}
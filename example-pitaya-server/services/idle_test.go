@@ -0,0 +1,209 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/topfreegames/pitaya/acceptor"
+)
+
+const (
+	testIdleTimeout = 30 * time.Second
+	testIdleGrace   = 10 * time.Second
+)
+
+// pipeConn is a client sending the messages of its channel and recording the writes of the server
+type pipeConn struct {
+	net.Conn
+	addr     net.Addr
+	messages chan []byte
+	writes   chan []byte
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func newPipeConn(port int) *pipeConn {
+	return &pipeConn{
+		addr:     &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: port},
+		messages: make(chan []byte),
+		writes:   make(chan []byte, 16),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (p *pipeConn) GetNextMessage() ([]byte, error) {
+	select {
+	case msg := <-p.messages:
+		return msg, nil
+	case <-p.closed:
+		return nil, io.ErrClosedPipe
+	}
+}
+
+func (p *pipeConn) Write(b []byte) (int, error) {
+	p.writes <- b
+	return len(b), nil
+}
+
+func (p *pipeConn) Close() error {
+	p.once.Do(func() { close(p.closed) })
+	return nil
+}
+
+func (p *pipeConn) RemoteAddr() net.Addr {
+	return p.addr
+}
+
+func (p *pipeConn) expectPing(t *testing.T) {
+	select {
+	case b := <-p.writes:
+		if !bytes.Equal(b, heartbeatPacket) {
+			t.Fatalf("expected a ping, got %v", b)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the connection was not pinged")
+	}
+}
+
+func (p *pipeConn) expectNoPing(t *testing.T) {
+	select {
+	case b := <-p.writes:
+		t.Fatalf("unexpected write %v", b)
+	default:
+	}
+}
+
+func (p *pipeConn) isClosed() bool {
+	select {
+	case <-p.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// idleConnector returns a connector with the idle timeouts driven by clock
+func idleConnector(disconnects chan disconnection, clock *fakeClock, timeout, grace time.Duration) *Connector {
+	c := lifecycleConnector(disconnects, WithIdleTimeout(timeout, grace))
+	c.idle.clock = clock
+	return c
+}
+
+func accept(c *Connector, conn acceptor.PlayerConn) acceptor.PlayerConn {
+	conns := make(chan acceptor.PlayerConn, 1)
+	conns <- conn
+	return <-c.WrapAcceptor(&fakeAcceptor{conns: conns}).GetConnChan()
+}
+
+func TestIdlePingAnswered(t *testing.T) {
+	clock := newFakeClock()
+	client := newPipeConn(5000)
+	conn := accept(idleConnector(nil, clock, testIdleTimeout, testIdleGrace), client)
+	defer conn.Close()
+
+	clock.wait(t)
+	clock.Advance(testIdleTimeout - time.Second)
+	client.expectNoPing(t)
+	clock.Advance(time.Second)
+	client.expectPing(t)
+
+	// the client answers with a heartbeat
+	clock.wait(t)
+	go func() { client.messages <- heartbeatPacket }()
+	if _, err := conn.GetNextMessage(); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(testIdleGrace)
+	clock.wait(t)
+	if client.isClosed() {
+		t.Fatal("a connection answering the ping should stay open")
+	}
+
+	// it is pinged again once idle for the timeout since its answer
+	clock.Advance(testIdleTimeout - testIdleGrace - time.Second)
+	client.expectNoPing(t)
+	clock.Advance(time.Second)
+	client.expectPing(t)
+}
+
+func TestIdleDisconnect(t *testing.T) {
+	disconnects := make(chan disconnection, 1)
+	clock := newFakeClock()
+	client := newPipeConn(5001)
+	c := idleConnector(disconnects, clock, testIdleTimeout, testIdleGrace)
+	conn := accept(c, client)
+
+	clock.wait(t)
+	clock.Advance(testIdleTimeout)
+	client.expectPing(t)
+	clock.wait(t)
+	clock.Advance(testIdleGrace - time.Second)
+	if client.isClosed() {
+		t.Fatal("the connection should be closed after the grace only")
+	}
+	clock.Advance(time.Second)
+
+	if _, err := conn.GetNextMessage(); err != ErrIdleTimeout {
+		t.Fatalf("expected ErrIdleTimeout, got %v", err)
+	}
+	if !client.isClosed() {
+		t.Fatal("the connection should be closed")
+	}
+	s := newAddrSession("uid1", 5001)
+	c.sessionClosed(s)
+	if d := receive(t, disconnects); d.reason != DisconnectIdleTimeout || d.reason.String() != "idle timeout" {
+		t.Fatalf("expected an idle timeout, got %s", d.reason)
+	}
+}
+
+func TestIdleWrites(t *testing.T) {
+	clock := newFakeClock()
+	client := newPipeConn(5002)
+	conn := accept(idleConnector(nil, clock, testIdleTimeout, testIdleGrace), client)
+	defer conn.Close()
+
+	clock.wait(t)
+	clock.Advance(testIdleTimeout / 2)
+	// pushes are activity, the heartbeats of pitaya are not
+	if _, err := conn.Write([]byte("push")); err != nil {
+		t.Fatal(err)
+	}
+	<-client.writes
+	if _, err := conn.Write(heartbeatPacket); err != nil {
+		t.Fatal(err)
+	}
+	<-client.writes
+	clock.Advance(testIdleTimeout / 2)
+	clock.wait(t)
+	client.expectNoPing(t)
+	clock.Advance(testIdleTimeout / 2)
+	client.expectPing(t)
+}
+
+func TestIdleWithoutGrace(t *testing.T) {
+	clock := newFakeClock()
+	client := newPipeConn(5003)
+	conn := accept(idleConnector(nil, clock, testIdleTimeout, 0), client)
+	defer conn.Close()
+
+	for i := 0; i < 3; i++ {
+		clock.wait(t)
+		clock.Advance(testIdleTimeout)
+		client.expectPing(t)
+	}
+	if client.isClosed() {
+		t.Fatal("connections should only be pinged without grace")
+	}
+}
+
+func TestIdleDisabled(t *testing.T) {
+	client := newPipeConn(5004)
+	conn := accept(lifecycleConnector(nil, WithIdleTimeout(0, testIdleGrace)), client)
+	if _, ok := conn.(*lifecycleConn).PlayerConn.(*idleConn); ok {
+		t.Fatal("connections should not be watched without timeout")
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+)
+
+const (
+	// itemsPerFrame is how many items an item stream sends per frame at most
+	itemsPerFrame = 64
+	// itemsFrameSize is the size from which the items of a frame are sent without waiting for more
+	itemsFrameSize = 32 * 1024
+)
+
+// ItemIterator yields the items of a list one at a time, Next returns io.EOF after the last one
+type ItemIterator interface {
+	Next(ctx context.Context) (proto.Message, error)
+}
+
+// ItemIteratorFunc is a func yielding items as an ItemIterator
+type ItemIteratorFunc func(ctx context.Context) (proto.Message, error)
+
+// Next returns the next item
+func (f ItemIteratorFunc) Next(ctx context.Context) (proto.Message, error) {
+	return f(ctx)
+}
+
+// ItemsFunc is a remote answering a list through an iterator, message is the request of the caller
+type ItemsFunc func(ctx context.Context, message []byte) (ItemIterator, error)
+
+// WithItems serves the item stream route with f, callers open it with RemoteClient.StreamItems.
+// The items are marshaled and sent as they are yielded, a few frames ahead of the caller at most:
+// Next isn't called while the caller is not reading.
+func WithItems(route string, f ItemsFunc) RemoteOption {
+	return func(r *ConnectorRemote) {
+		if r.items == nil {
+			r.items = make(map[string]ItemsFunc)
+		}
+		r.items[route] = f
+	}
+}
+
+// streamItems sends the items of the iterator f returns for message to stream
+func streamItems(ctx context.Context, stream *rpcStream, f ItemsFunc, message []byte) error {
+	it, err := f(ctx, message)
+	if err != nil {
+		return err
+	}
+	// the items of a frame are marshaled in one buffer, which the frame keeps
+	buf := proto.NewBuffer(nil)
+	ends := make([]int, 0, itemsPerFrame)
+	flush := func() error {
+		encoded := buf.Bytes()
+		items := make([][]byte, len(ends))
+		start := 0
+		for i, end := range ends {
+			items[i] = encoded[start:end]
+			start = end
+		}
+		buf.SetBuf(make([]byte, 0, cap(encoded)))
+		ends = ends[:0]
+		return stream.send(&protos.StreamFrame{Items: items})
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return ErrStreamClosed
+		}
+		item, err := it.Next(ctx)
+		if err == io.EOF {
+			if len(ends) == 0 {
+				return nil
+			}
+			return flush()
+		}
+		if err != nil {
+			return err
+		}
+		if err := buf.Marshal(item); err != nil {
+			return err
+		}
+		ends = append(ends, len(buf.Bytes()))
+		if len(ends) == itemsPerFrame || len(buf.Bytes()) >= itemsFrameSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ItemStream is the caller side of an item stream, the items are decoded as they are read
+type ItemStream struct {
+	stream *Stream
+	items  [][]byte
+}
+
+// Next decodes the next item into item, io.EOF is returned after the last one
+func (s *ItemStream) Next(ctx context.Context, item proto.Message) error {
+	for len(s.items) == 0 {
+		frame, err := s.stream.recv(ctx)
+		if err != nil {
+			return err
+		}
+		s.items = frame.Items
+	}
+	encoded := s.items[0]
+	s.items[0] = nil
+	s.items = s.items[1:]
+	return proto.Unmarshal(encoded, item)
+}
+
+// Close stops reading the stream, the remote is cancelled on its next frame
+func (s *ItemStream) Close() {
+	s.stream.Close()
+}
+
+// StreamItems opens the item stream route in any connector, the frames are received by receiver.
+// The stream must be closed when not read until io.EOF.
+func (r *RemoteClient) StreamItems(ctx context.Context, receiver *StreamReceiver, route string, req proto.Message) (*ItemStream, error) {
+	s, err := r.openStream(ctx, receiver, route, req)
+	if err != nil {
+		return nil, err
+	}
+	return &ItemStream{stream: s}, nil
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+)
+
+const countRoute = "connector.connectorremote.count"
+
+// countItems yields the numbers from 0 to the number in the message, counting the items yielded
+func countItems(produced *int64) ItemsFunc {
+	return func(ctx context.Context, message []byte) (ItemIterator, error) {
+		req := &protos.RPCMsg{}
+		if err := proto.Unmarshal(message, req); err != nil {
+			return nil, err
+		}
+		total, err := strconv.Atoi(req.Msg)
+		if err != nil {
+			return nil, err
+		}
+		item := &protos.Response{}
+		return ItemIteratorFunc(func(ctx context.Context) (proto.Message, error) {
+			n := atomic.LoadInt64(produced)
+			if int(n) == total {
+				return nil, io.EOF
+			}
+			atomic.AddInt64(produced, 1)
+			item.Code = 200
+			item.Msg = strconv.FormatInt(n, 10)
+			return item, nil
+		}), nil
+	}
+}
+
+func newTestItemStream(t testing.TB, total int, produced *int64) *ItemStream {
+	remote := NewConnectorRemote(NewConnector(nil), WithItems(countRoute, countItems(produced)))
+	receiver := NewStreamReceiver("room")
+	receiver.serverID = func() string { return "room-1" }
+	remote.rpc = streamRPC(remote, receiver)
+
+	client := NewRemoteClient(remote.rpc)
+	stream, err := client.StreamItems(context.Background(), receiver, countRoute, &protos.RPCMsg{Msg: strconv.Itoa(total)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+func heapAlloc() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+func TestStreamItems(t *testing.T) {
+	const total = 100000
+	var produced int64
+	stream := newTestItemStream(t, total, &produced)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	// the remote is at most the frames buffered by the receiver, the one blocked in Frame and the
+	// one being filled ahead of the reader
+	maxAhead := int64((streamBuffer + 2) * itemsPerFrame)
+	var before uint64
+	item := &protos.Response{}
+	for i := 0; ; i++ {
+		err := stream.Next(ctx, item)
+		if err == io.EOF {
+			if i != total {
+				t.Fatalf("expected %d items, got %d", total, i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Msg != strconv.Itoa(i) {
+			t.Fatalf("expected item %d, got %s", i, item.Msg)
+		}
+		if ahead := atomic.LoadInt64(&produced) - int64(i); ahead > maxAhead {
+			t.Fatalf("the remote is %d items ahead of the reader", ahead)
+		}
+		switch i {
+		case total / 10:
+			before = heapAlloc()
+		case total - total/10:
+			if after := heapAlloc(); after > before+1<<20 {
+				t.Fatalf("the heap grew from %d to %d bytes while streaming", before, after)
+			}
+		}
+	}
+}
+
+func TestStreamItemsUnknownRoute(t *testing.T) {
+	remote := NewConnectorRemote(NewConnector(nil))
+	receiver := NewStreamReceiver("room")
+	remote.rpc = streamRPC(remote, receiver)
+
+	_, err := NewRemoteClient(remote.rpc).StreamItems(context.Background(), receiver, countRoute, &protos.RPCMsg{})
+	if !errors.Is(err, ErrRemoteNotFound) {
+		t.Fatalf("expected ErrRemoteNotFound, got %v", err)
+	}
+}
+
+// BenchmarkStreamItems measures the cost of an item streamed, the streams are opened out of the timer
+func BenchmarkStreamItems(b *testing.B) {
+	const total = 100000
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		var produced int64
+		stream := newTestItemStream(b, total, &produced)
+		item := &protos.Response{}
+		b.StartTimer()
+		read := 0
+		for {
+			err := stream.Next(context.Background(), item)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+			read++
+		}
+		if produced := atomic.LoadInt64(&produced); read != total || produced != total {
+			b.Fatalf("expected %d items, read %d of the %d produced", total, read, produced)
+		}
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*total), "ns/item")
+}
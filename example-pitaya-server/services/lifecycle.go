@@ -0,0 +1,385 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/topfreegames/pitaya/acceptor"
+	"github.com/topfreegames/pitaya/cluster"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/session"
+)
+
+// DefaultReconnectWindow is how long after a disconnection binding the same uid is a reconnection
+const DefaultReconnectWindow = time.Minute
+
+// DisconnectReason tells why a session was closed
+type DisconnectReason int
+
+// Reasons of the disconnections
+const (
+	// DisconnectClientClose is a connection closed by the client
+	DisconnectClientClose DisconnectReason = iota
+	// DisconnectKick is a session kicked by this connector or by another server
+	DisconnectKick
+	// DisconnectTransportError is a connection that failed while reading from the client
+	DisconnectTransportError
+	// DisconnectServerClose is a connection closed by pitaya without a kick, e.g. on heartbeat timeout
+	DisconnectServerClose
+	// DisconnectIdleTimeout is a connection that didn't answer the keepalive ping, see WithIdleTimeout
+	DisconnectIdleTimeout
+	// DisconnectAdminKick is a session kicked by an admin, see AdminRemote.KickSession
+	DisconnectAdminKick
+	// DisconnectSlowConsumer is a session whose send buffer overflowed, see OverflowDisconnect
+	DisconnectSlowConsumer
+	// DisconnectReplaced is a session kicked by a new login of its uid, see SessionReplace
+	DisconnectReplaced
+)
+
+func (r DisconnectReason) String() string {
+	switch r {
+	case DisconnectClientClose:
+		return "client close"
+	case DisconnectKick:
+		return "kick"
+	case DisconnectTransportError:
+		return "transport error"
+	case DisconnectServerClose:
+		return "server close"
+	case DisconnectIdleTimeout:
+		return "idle timeout"
+	case DisconnectAdminKick:
+		return "admin kick"
+	case DisconnectSlowConsumer:
+		return "slow consumer"
+	case DisconnectReplaced:
+		return "replaced by new login"
+	}
+	return "unknown"
+}
+
+// OnSessionConnect calls f when a client binds its session to an uid that was not connected
+func OnSessionConnect(f func(s *session.Session)) ConnectorOption {
+	return func(c *Connector) {
+		c.lifecycle.connect = append(c.lifecycle.connect, f)
+	}
+}
+
+// OnSessionDisconnect calls f when a bound session is closed
+func OnSessionDisconnect(f func(s *session.Session, reason DisconnectReason)) ConnectorOption {
+	return func(c *Connector) {
+		c.lifecycle.disconnect = append(c.lifecycle.disconnect, f)
+	}
+}
+
+// OnSessionReconnect calls f when a client binds its session to an uid that is still connected
+// or that disconnected within the reconnect window, instead of the connect hooks
+func OnSessionReconnect(f func(old, new *session.Session)) ConnectorOption {
+	return func(c *Connector) {
+		c.lifecycle.reconnect = append(c.lifecycle.reconnect, f)
+	}
+}
+
+// WithReconnectWindow sets how long after a disconnection binding the same uid is a reconnection
+func WithReconnectWindow(window time.Duration) ConnectorOption {
+	return func(c *Connector) {
+		c.lifecycle.window = window
+	}
+}
+
+// lifecycle detects the connections, disconnections and reconnections of the sessions.
+// Hooks run one at a time in the order of the events, outside of the goroutines of pitaya.
+type lifecycle struct {
+	connect    []func(s *session.Session)
+	disconnect []func(s *session.Session, reason DisconnectReason)
+	reconnect  []func(old, new *session.Session)
+	window     time.Duration
+	clock      Clock
+	hooks      *hookQueue
+
+	mutex sync.Mutex
+	// readErrs holds the error that ended the connection of each remote address
+	readErrs map[string]error
+	kicked   map[string]DisconnectReason
+	closed   map[string]closedSession
+}
+
+type closedSession struct {
+	session *session.Session
+	at      time.Time
+}
+
+func newLifecycle(logger func() Logger) *lifecycle {
+	return &lifecycle{
+		window:   DefaultReconnectWindow,
+		clock:    RealClock,
+		hooks:    &hookQueue{logger: logger},
+		readErrs: make(map[string]error),
+		kicked:   make(map[string]DisconnectReason),
+		closed:   make(map[string]closedSession),
+	}
+}
+
+// bound runs the connect or reconnect hooks of s, old is the session of the uid that is still connected
+func (l *lifecycle) bound(s, old *session.Session) {
+	l.mutex.Lock()
+	if old == nil {
+		if prev, ok := l.closed[s.UID()]; ok && l.clock.Now().Sub(prev.at) <= l.window {
+			old = prev.session
+		}
+	}
+	delete(l.closed, s.UID())
+	l.mutex.Unlock()
+
+	if old != nil {
+		for _, f := range l.reconnect {
+			f := f
+			l.hooks.run(func() { f(old, s) })
+		}
+		return
+	}
+	for _, f := range l.connect {
+		f := f
+		l.hooks.run(func() { f(s) })
+	}
+}
+
+// sessionClosed runs the disconnect hooks of s with the reason it was closed
+func (l *lifecycle) sessionClosed(s *session.Session) {
+	reason := l.reason(s)
+	if s.UID() == "" {
+		return
+	}
+
+	l.mutex.Lock()
+	now := l.clock.Now()
+	for uid, prev := range l.closed {
+		if now.Sub(prev.at) > l.window {
+			delete(l.closed, uid)
+		}
+	}
+	l.closed[s.UID()] = closedSession{session: s, at: now}
+	l.mutex.Unlock()
+
+	for _, f := range l.disconnect {
+		f := f
+		l.hooks.run(func() { f(s, reason) })
+	}
+}
+
+func (l *lifecycle) reason(s *session.Session) DisconnectReason {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var addr string
+	if remote := s.RemoteAddr(); remote != nil {
+		addr = remote.String()
+	}
+	err, failed := l.readErrs[addr]
+	delete(l.readErrs, addr)
+	kick, kicked := l.kicked[s.UID()]
+	kicked = kicked && s.UID() != ""
+	delete(l.kicked, s.UID())
+
+	switch {
+	case kicked:
+		return kick
+	case !failed:
+		return DisconnectServerClose
+	case errors.Is(err, ErrIdleTimeout):
+		return DisconnectIdleTimeout
+	case err == io.EOF, websocket.IsCloseError(err,
+		websocket.CloseNormalClosure,
+		websocket.CloseGoingAway,
+		websocket.CloseNoStatusReceived,
+	):
+		return DisconnectClientClose
+	}
+	return DisconnectTransportError
+}
+
+// readFailed records the error that ended reading from the client at addr
+func (l *lifecycle) readFailed(addr string, err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.readErrs[addr] = err
+}
+
+// kicking records that the session of uid is closed by a kick for reason
+func (l *lifecycle) kicking(uid string, reason DisconnectReason) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.kicked[uid] = reason
+}
+
+// kickFailed forgets the kick of uid, its session was not closed
+func (l *lifecycle) kickFailed(uid string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.kicked, uid)
+}
+
+// hookQueue runs funcs one at a time in the order they were queued, recovering their panics.
+// A goroutine runs while there are funcs queued.
+type hookQueue struct {
+	logger  func() Logger
+	mutex   sync.Mutex
+	pending []func()
+	running bool
+}
+
+func (q *hookQueue) run(f func()) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.pending = append(q.pending, f)
+	if !q.running {
+		q.running = true
+		go q.loop()
+	}
+}
+
+func (q *hookQueue) loop() {
+	for {
+		q.mutex.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			q.mutex.Unlock()
+			return
+		}
+		f := q.pending[0]
+		q.pending = q.pending[1:]
+		q.mutex.Unlock()
+
+		q.safely(f)
+	}
+}
+
+func (q *hookQueue) safely(f func()) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			q.logger().Error("session hook panicked", "panic", rec, "stack", string(debug.Stack()))
+		}
+	}()
+	f()
+}
+
+// sessionBound is called after a session is bound, pitaya still returns the previous session of the uid
+func (c *Connector) sessionBound(ctx context.Context, s *session.Session) error {
+	if !s.IsFrontend {
+		return nil
+	}
+	c.lifecycle.bound(s, c.sessions(s.UID()))
+	return nil
+}
+
+func (c *Connector) sessionClosed(s *session.Session) {
+	c.lifecycle.sessionClosed(s)
+}
+
+// kick closes s, its disconnect hooks are given reason
+func (c *Connector) kick(ctx context.Context, s *session.Session, reason DisconnectReason) error {
+	c.lifecycle.kicking(s.UID(), reason)
+	err := s.Kick(ctx)
+	if err != nil {
+		c.lifecycle.kickFailed(s.UID())
+	}
+	return err
+}
+
+// WrapAcceptor returns an acceptor telling the connector why the connections accepted by a ended,
+// closing them when idle or while draining, it must be the one given to pitaya.AddAcceptor
+func (c *Connector) WrapAcceptor(a acceptor.Acceptor) acceptor.Acceptor {
+	return &lifecycleAcceptor{
+		Acceptor:  a,
+		lifecycle: c.lifecycle,
+		idle:      c.idle,
+		drain:     c.drain,
+		conns:     make(chan acceptor.PlayerConn),
+	}
+}
+
+type lifecycleAcceptor struct {
+	acceptor.Acceptor
+	lifecycle *lifecycle
+	idle      idleConfig
+	drain     *drainState
+	once      sync.Once
+	conns     chan acceptor.PlayerConn
+}
+
+func (a *lifecycleAcceptor) GetConnChan() chan acceptor.PlayerConn {
+	a.once.Do(func() {
+		go func() {
+			for conn := range a.Acceptor.GetConnChan() {
+				if a.drain.isDraining() {
+					conn.Close()
+					continue
+				}
+				a.conns <- &lifecycleConn{PlayerConn: a.idle.wrap(conn), lifecycle: a.lifecycle}
+			}
+			close(a.conns)
+		}()
+	})
+	return a.conns
+}
+
+type lifecycleConn struct {
+	acceptor.PlayerConn
+	lifecycle *lifecycle
+}
+
+func (c *lifecycleConn) GetNextMessage() ([]byte, error) {
+	b, err := c.PlayerConn.GetNextMessage()
+	if err != nil {
+		c.lifecycle.readFailed(c.RemoteAddr().String(), err)
+	}
+	return b, err
+}
+
+// WrapRPCServer returns a rpc server telling the connector about the kicks sent by other servers and
+// delivering their pushes like Push, it should wrap the server given to pitaya.SetRPCServer
+func (c *Connector) WrapRPCServer(server cluster.RPCServer) cluster.RPCServer {
+	return &lifecycleRPCServer{RPCServer: server, connector: c}
+}
+
+type lifecycleRPCServer struct {
+	cluster.RPCServer
+	connector *Connector
+}
+
+func (s *lifecycleRPCServer) SetPitayaServer(server pitayaprotos.PitayaServer) {
+	s.RPCServer.SetPitayaServer(&lifecyclePitayaServer{PitayaServer: server, connector: s.connector, lifecycle: s.connector.lifecycle})
+}
+
+type lifecyclePitayaServer struct {
+	pitayaprotos.PitayaServer
+	connector *Connector
+	lifecycle *lifecycle
+}
+
+// PushToUser delivers the pushes of the other servers, e.g. the pushes of the backends to their
+// sessions, in order and through the send buffer of the session when they are enabled
+func (s *lifecyclePitayaServer) PushToUser(ctx context.Context, push *pitayaprotos.Push) (*pitayaprotos.Response, error) {
+	sess := s.connector.sessions(push.Uid)
+	if sess == nil {
+		return s.PitayaServer.PushToUser(ctx, push)
+	}
+	if err := s.connector.push(sess, push.Route, push.Data); err != nil {
+		return nil, err
+	}
+	return &pitayaprotos.Response{Data: []byte("ack")}, nil
+}
+
+func (s *lifecyclePitayaServer) KickUser(ctx context.Context, kick *pitayaprotos.KickMsg) (*pitayaprotos.KickAnswer, error) {
+	s.lifecycle.kicking(kick.UserId, DisconnectKick)
+	answer, err := s.PitayaServer.KickUser(ctx, kick)
+	if err != nil || !answer.GetKicked() {
+		s.lifecycle.kickFailed(kick.UserId)
+	}
+	return answer, err
+}
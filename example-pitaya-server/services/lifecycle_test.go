@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/topfreegames/pitaya/acceptor"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/session"
+)
+
+// addrEntity is a client connected from its own address
+type addrEntity struct {
+	fakeEntity
+	addr net.Addr
+}
+
+func (a *addrEntity) RemoteAddr() net.Addr {
+	return a.addr
+}
+
+// fakeConn ends with err on the first read
+type fakeConn struct {
+	net.Conn
+	addr net.Addr
+	err  error
+}
+
+func (f *fakeConn) GetNextMessage() ([]byte, error) {
+	return nil, f.err
+}
+
+func (f *fakeConn) RemoteAddr() net.Addr {
+	return f.addr
+}
+
+type fakeAcceptor struct {
+	acceptor.Acceptor
+	conns chan acceptor.PlayerConn
+}
+
+func (f *fakeAcceptor) GetConnChan() chan acceptor.PlayerConn {
+	return f.conns
+}
+
+type disconnection struct {
+	session *session.Session
+	reason  DisconnectReason
+}
+
+func lifecycleConnector(disconnects chan disconnection, opts ...ConnectorOption) *Connector {
+	opts = append(opts, OnSessionDisconnect(func(s *session.Session, reason DisconnectReason) {
+		disconnects <- disconnection{s, reason}
+	}))
+	c := NewConnector(nil, opts...)
+	c.sessions = func(uid string) *session.Session { return nil }
+	return c
+}
+
+func newAddrSession(uid string, port int) *session.Session {
+	return session.New(&addrEntity{addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: port}}, true, uid)
+}
+
+func receive(t *testing.T, ch chan disconnection) disconnection {
+	select {
+	case d := <-ch:
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("the hook was not called")
+	}
+	return disconnection{}
+}
+
+func TestDisconnectReasons(t *testing.T) {
+	disconnects := make(chan disconnection, 1)
+	c := lifecycleConnector(disconnects)
+	conns := make(chan acceptor.PlayerConn, 1)
+	wrapped := c.WrapAcceptor(&fakeAcceptor{conns: conns})
+
+	tables := []struct {
+		name     string
+		readErr  error
+		kick     bool
+		expected DisconnectReason
+	}{
+		{"client close", io.EOF, false, DisconnectClientClose},
+		{"websocket close", &websocket.CloseError{Code: websocket.CloseNormalClosure}, false, DisconnectClientClose},
+		{"transport error", errors.New("connection reset by peer"), false, DisconnectTransportError},
+		{"kick", nil, true, DisconnectKick},
+		{"server close", nil, false, DisconnectServerClose},
+	}
+	for i, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			s := newAddrSession("uid1", 4000+i)
+			if table.readErr != nil {
+				conns <- &fakeConn{addr: s.RemoteAddr(), err: table.readErr}
+				conn := <-wrapped.GetConnChan()
+				if _, err := conn.GetNextMessage(); err != table.readErr {
+					t.Fatalf("the read error should be returned, got %v", err)
+				}
+			}
+			if table.kick {
+				if err := c.kick(context.Background(), s, DisconnectKick); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			c.sessionClosed(s)
+			d := receive(t, disconnects)
+			if d.session != s || d.reason != table.expected {
+				t.Fatalf("expected %s, got %s", table.expected, d.reason)
+			}
+		})
+	}
+}
+
+type kickingPitayaServer struct {
+	pitayaprotos.PitayaServer
+}
+
+func (kickingPitayaServer) KickUser(ctx context.Context, kick *pitayaprotos.KickMsg) (*pitayaprotos.KickAnswer, error) {
+	return &pitayaprotos.KickAnswer{Kicked: true}, nil
+}
+
+func TestKickFromOtherServer(t *testing.T) {
+	disconnects := make(chan disconnection, 1)
+	c := lifecycleConnector(disconnects)
+	rpcServer := &fakeRPCServer{}
+	c.WrapRPCServer(rpcServer).SetPitayaServer(kickingPitayaServer{})
+
+	s := newAddrSession("uid1", 4000)
+	if _, err := rpcServer.pitayaServer.KickUser(context.Background(), &pitayaprotos.KickMsg{UserId: "uid1"}); err != nil {
+		t.Fatal(err)
+	}
+	c.sessionClosed(s)
+	if d := receive(t, disconnects); d.reason != DisconnectKick {
+		t.Fatalf("expected a kick, got %s", d.reason)
+	}
+}
+
+func TestConnectAndReconnect(t *testing.T) {
+	disconnects := make(chan disconnection, 1)
+	connects := make(chan *session.Session, 1)
+	reconnects := make(chan [2]*session.Session, 1)
+	c := lifecycleConnector(disconnects,
+		OnSessionConnect(func(s *session.Session) { connects <- s }),
+		OnSessionReconnect(func(old, new *session.Session) { reconnects <- [2]*session.Session{old, new} }),
+	)
+	clock := newFakeClock()
+	c.lifecycle.clock = clock
+
+	first := newAddrSession("uid1", 4000)
+	if err := c.sessionBound(context.Background(), first); err != nil {
+		t.Fatal(err)
+	}
+	if s := <-connects; s != first {
+		t.Fatal("the first bind should be a connection")
+	}
+
+	c.sessionClosed(first)
+	receive(t, disconnects)
+	second := newAddrSession("uid1", 4001)
+	if err := c.sessionBound(context.Background(), second); err != nil {
+		t.Fatal(err)
+	}
+	if r := <-reconnects; r[0] != first || r[1] != second {
+		t.Fatal("binding within the window should be a reconnection")
+	}
+
+	// the previous session is still connected
+	c.sessions = func(uid string) *session.Session { return second }
+	third := newAddrSession("uid1", 4002)
+	if err := c.sessionBound(context.Background(), third); err != nil {
+		t.Fatal(err)
+	}
+	if r := <-reconnects; r[0] != second || r[1] != third {
+		t.Fatal("binding a connected uid should be a reconnection")
+	}
+
+	c.sessions = func(uid string) *session.Session { return nil }
+	c.sessionClosed(third)
+	receive(t, disconnects)
+	clock.Advance(DefaultReconnectWindow + time.Second)
+	fourth := newAddrSession("uid1", 4003)
+	if err := c.sessionBound(context.Background(), fourth); err != nil {
+		t.Fatal(err)
+	}
+	if s := <-connects; s != fourth {
+		t.Fatal("binding after the window should be a connection")
+	}
+}
+
+func TestHookPanicsAreRecovered(t *testing.T) {
+	disconnects := make(chan disconnection, 1)
+	c := lifecycleConnector(disconnects, OnSessionConnect(func(s *session.Session) {
+		panic("hook failed")
+	}))
+
+	s := newAddrSession("uid1", 4000)
+	if err := c.sessionBound(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+	c.sessionClosed(s)
+	if d := receive(t, disconnects); d.session != s {
+		t.Fatal("hooks should keep running after a panic")
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+	"github.com/topfreegames/pitaya/session"
+)
+
+// UIDKey is the propagated context key carrying the uid of the session that originated a rpc
+const UIDKey = "uid"
+
+// Logger is a structured logger, keyvals are alternating keys and values
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+	With(keyvals ...interface{}) Logger
+}
+
+type nopLogger struct{}
+
+// NewNopLogger returns a logger that discards everything, it is the default of the components
+func NewNopLogger() Logger {
+	return nopLogger{}
+}
+
+func (nopLogger) Debug(msg string, keyvals ...interface{}) {}
+func (nopLogger) Info(msg string, keyvals ...interface{})  {}
+func (nopLogger) Warn(msg string, keyvals ...interface{})  {}
+func (nopLogger) Error(msg string, keyvals ...interface{}) {}
+func (n nopLogger) With(keyvals ...interface{}) Logger     { return n }
+
+// CorrelationID returns the id that identifies the request across servers.
+// It is the request id pitaya assigns to every client request and propagates through rpcs.
+func CorrelationID(ctx context.Context) string {
+	id, _ := pcontext.GetFromPropagateCtx(ctx, constants.RequestIDKey).(string)
+	return id
+}
+
+// WithCorrelationID returns a ctx that propagates id to the servers it calls
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return pcontext.AddToPropagateCtx(ctx, constants.RequestIDKey, id)
+}
+
+// ensureCorrelationID assigns a correlation id to calls that did not start from a client request
+func ensureCorrelationID(ctx context.Context) context.Context {
+	if CorrelationID(ctx) != "" {
+		return ctx
+	}
+	return WithCorrelationID(ctx, uuid.New().String())
+}
+
+// requestUID returns the uid of the session in ctx, or the one propagated by the caller
+func requestUID(ctx context.Context) string {
+	if s, ok := ctx.Value(constants.SessionCtxKey).(*session.Session); ok && s != nil {
+		return s.UID()
+	}
+	uid, _ := pcontext.GetFromPropagateCtx(ctx, UIDKey).(string)
+	return uid
+}
+
+// propagateRequest prepares ctx for a downstream rpc so the callee can trace it back and knows its deadline
+func propagateRequest(ctx context.Context) context.Context {
+	ctx = withPropagatedDeadline(ensureCorrelationID(ctx))
+	if uid := requestUID(ctx); uid != "" {
+		ctx = pcontext.AddToPropagateCtx(ctx, UIDKey, uid)
+	}
+	return ctx
+}
+
+// LoggerFromCtx decorates l with the correlation id and uid of the request in ctx
+func LoggerFromCtx(ctx context.Context, l Logger) Logger {
+	keyvals := []interface{}{"correlationId", CorrelationID(ctx)}
+	if uid := requestUID(ctx); uid != "" {
+		keyvals = append(keyvals, "uid", uid)
+	}
+	return l.With(keyvals...)
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+)
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger returns a Logger writing to a slog logger
+func NewSlogLogger(l *slog.Logger) Logger {
+	return &slogLogger{logger: l}
+}
+
+func (s *slogLogger) Debug(msg string, keyvals ...interface{}) {
+	s.logger.Log(context.Background(), slog.LevelDebug, msg, keyvals...)
+}
+
+func (s *slogLogger) Info(msg string, keyvals ...interface{}) {
+	s.logger.Log(context.Background(), slog.LevelInfo, msg, keyvals...)
+}
+
+func (s *slogLogger) Warn(msg string, keyvals ...interface{}) {
+	s.logger.Log(context.Background(), slog.LevelWarn, msg, keyvals...)
+}
+
+func (s *slogLogger) Error(msg string, keyvals ...interface{}) {
+	s.logger.Log(context.Background(), slog.LevelError, msg, keyvals...)
+}
+
+func (s *slogLogger) With(keyvals ...interface{}) Logger {
+	return &slogLogger{logger: s.logger.With(keyvals...)}
+}
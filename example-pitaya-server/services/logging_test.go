@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	pcontext "github.com/topfreegames/pitaya/context"
+)
+
+type logEntry struct {
+	level   string
+	msg     string
+	keyvals map[string]interface{}
+}
+
+// recordingLogger keeps every entry logged through it or through the loggers derived from it
+type recordingLogger struct {
+	mutex   *sync.Mutex
+	entries *[]logEntry
+	fields  []interface{}
+}
+
+func newRecordingLogger() *recordingLogger {
+	return &recordingLogger{mutex: &sync.Mutex{}, entries: &[]logEntry{}}
+}
+
+func (r *recordingLogger) log(level, msg string, keyvals []interface{}) {
+	all := append(append([]interface{}{}, r.fields...), keyvals...)
+	entry := logEntry{level: level, msg: msg, keyvals: map[string]interface{}{}}
+	for i := 0; i+1 < len(all); i += 2 {
+		entry.keyvals[all[i].(string)] = all[i+1]
+	}
+	r.mutex.Lock()
+	*r.entries = append(*r.entries, entry)
+	r.mutex.Unlock()
+}
+
+func (r *recordingLogger) Debug(msg string, keyvals ...interface{}) { r.log("debug", msg, keyvals) }
+func (r *recordingLogger) Info(msg string, keyvals ...interface{})  { r.log("info", msg, keyvals) }
+func (r *recordingLogger) Warn(msg string, keyvals ...interface{})  { r.log("warn", msg, keyvals) }
+func (r *recordingLogger) Error(msg string, keyvals ...interface{}) { r.log("error", msg, keyvals) }
+func (r *recordingLogger) With(keyvals ...interface{}) Logger {
+	return &recordingLogger{
+		mutex:   r.mutex,
+		entries: r.entries,
+		fields:  append(append([]interface{}{}, r.fields...), keyvals...),
+	}
+}
+
+func (r *recordingLogger) last() logEntry {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return (*r.entries)[len(*r.entries)-1]
+}
+
+func TestRemoteFuncLogsCorrelationID(t *testing.T) {
+	logger := newRecordingLogger()
+	remote := NewConnectorRemote(NewConnector(nil, WithLogger(logger)))
+
+	// the backend calls the connector while handling a client request
+	ctx := WithCorrelationID(context.Background(), "req-1")
+	ctx = pcontext.AddToPropagateCtx(ctx, UIDKey, "uid1")
+
+	// the correlation id must survive a downstream rpc
+	client := NewRemoteClient(func(ctx context.Context, serverID, route string, reply, arg proto.Message) error {
+		encoded, err := pcontext.Encode(ctx)
+		if err != nil {
+			return err
+		}
+		remoteCtx, err := pcontext.Decode(encoded)
+		if err != nil {
+			return err
+		}
+		return loopbackRPC(remote)(remoteCtx, serverID, route, reply, arg)
+	})
+	if _, err := client.CallRemoteFunc(ctx, &protos.RPCMsg{Msg: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+
+	entry := logger.last()
+	if entry.msg != "received a remote call" {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+	if entry.keyvals["correlationId"] != "req-1" || entry.keyvals["uid"] != "uid1" || entry.keyvals["route"] != RemoteFuncRoute {
+		t.Fatalf("entry is missing the request fields: %+v", entry.keyvals)
+	}
+}
+
+func TestRemoteClientAssignsCorrelationID(t *testing.T) {
+	var propagated string
+	client := NewRemoteClient(func(ctx context.Context, serverID, route string, reply, arg proto.Message) error {
+		propagated = CorrelationID(ctx)
+		return nil
+	})
+	if _, err := client.CallRemoteFunc(context.Background(), &protos.RPCMsg{}); err != nil {
+		t.Fatal(err)
+	}
+	if propagated == "" {
+		t.Fatal("calls outside of a client request should get a correlation id")
+	}
+}
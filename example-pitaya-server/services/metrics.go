@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+)
+
+// Status label values of the call metrics
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// Metrics records the count, errors and latency of remote and handler calls per route
+type Metrics struct {
+	serverType string
+	registerer prometheus.Registerer
+	calls      *prometheus.CounterVec
+	errors     *prometheus.CounterVec
+	latency    *prometheus.HistogramVec
+}
+
+// NewMetrics returns new metrics for serverType registered in registerer
+func NewMetrics(serverType string, registerer prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		serverType: serverType,
+		registerer: registerer,
+		calls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "pitaya",
+			Subsystem: "example",
+			Name:      "calls_total",
+			Help:      "the number of remote and handler calls",
+		}, []string{"route", "status", "server_type"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "pitaya",
+			Subsystem: "example",
+			Name:      "call_errors_total",
+			Help:      "the number of remote and handler calls that returned an error",
+		}, []string{"route", "status", "server_type"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "pitaya",
+			Subsystem: "example",
+			Name:      "call_duration_seconds",
+			Help:      "the latency of remote and handler calls",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "status", "server_type"}),
+	}
+	for _, c := range []prometheus.Collector{m.calls, m.errors, m.latency} {
+		if err := registerer.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// observe records a call to route that took elapsed and returned err
+func (m *Metrics) observe(route string, elapsed time.Duration, err error) {
+	status := StatusOK
+	if err != nil {
+		status = StatusError
+		m.errors.WithLabelValues(route, status, m.serverType).Inc()
+	}
+	m.calls.WithLabelValues(route, status, m.serverType).Inc()
+	m.latency.WithLabelValues(route, status, m.serverType).Observe(elapsed.Seconds())
+}
+
+// WatchSendBuffers reports the largest and the total number of pushes buffered for the sessions of c,
+// see WithSendBuffer. The sessions are not labeled, the depth of one is given by Connector.SendBufferDepth.
+func (m *Metrics) WatchSendBuffers(c *Connector) error {
+	return m.registerer.Register(&sendBufferCollector{
+		connector: c,
+		maxDepth: prometheus.NewDesc(
+			prometheus.BuildFQName("pitaya", "example", "send_buffer_depth_max"),
+			"the largest number of pushes buffered for a session",
+			[]string{"server_type"}, nil,
+		),
+		buffered: prometheus.NewDesc(
+			prometheus.BuildFQName("pitaya", "example", "send_buffer_pushes"),
+			"the number of pushes buffered for all the sessions",
+			[]string{"server_type"}, nil,
+		),
+		serverType: m.serverType,
+	})
+}
+
+// sendBufferCollector collects the depths of the send buffers of a connector when scraped
+type sendBufferCollector struct {
+	connector  *Connector
+	maxDepth   *prometheus.Desc
+	buffered   *prometheus.Desc
+	serverType string
+}
+
+func (s *sendBufferCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.maxDepth
+	ch <- s.buffered
+}
+
+func (s *sendBufferCollector) Collect(ch chan<- prometheus.Metric) {
+	maxDepth, buffered := 0, 0
+	for _, depth := range s.connector.SendBufferDepths() {
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		buffered += depth
+	}
+	ch <- prometheus.MustNewConstMetric(s.maxDepth, prometheus.GaugeValue, float64(maxDepth), s.serverType)
+	ch <- prometheus.MustNewConstMetric(s.buffered, prometheus.GaugeValue, float64(buffered), s.serverType)
+}
+
+// WatchConcurrency reports the number of calls running for each route capped by l
+func (m *Metrics) WatchConcurrency(l *ConcurrencyLimiter) error {
+	return m.registerer.Register(&concurrencyCollector{
+		limiter: l,
+		inFlight: prometheus.NewDesc(
+			prometheus.BuildFQName("pitaya", "example", "calls_in_flight"),
+			"the number of calls of a capped route running",
+			[]string{"route", "server_type"}, nil,
+		),
+		serverType: m.serverType,
+	})
+}
+
+// concurrencyCollector collects the calls running per route of a concurrency limiter when scraped
+type concurrencyCollector struct {
+	limiter    *ConcurrencyLimiter
+	inFlight   *prometheus.Desc
+	serverType string
+}
+
+func (c *concurrencyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.inFlight
+}
+
+func (c *concurrencyCollector) Collect(ch chan<- prometheus.Metric) {
+	for route, running := range c.limiter.InFlights() {
+		ch <- prometheus.MustNewConstMetric(c.inFlight, prometheus.GaugeValue, float64(running), route, c.serverType)
+	}
+}
+
+// AfterHandler is a pitaya after handler pipeline recording the handler calls,
+// the latency is measured from the moment the frontend received the request
+func (m *Metrics) AfterHandler(ctx context.Context, out interface{}, err error) (interface{}, error) {
+	route, _ := pcontext.GetFromPropagateCtx(ctx, constants.RouteKey).(string)
+	var elapsed time.Duration
+	if start, ok := requestStart(ctx); ok {
+		elapsed = time.Since(start)
+	}
+	m.observe(route, elapsed, err)
+	return out, err
+}
+
+// requestStart returns the time pitaya received the request, it is decoded
+// as a float64 when it was propagated from another server
+func requestStart(ctx context.Context) (time.Time, bool) {
+	switch start := pcontext.GetFromPropagateCtx(ctx, constants.StartTimeKey).(type) {
+	case int64:
+		return time.Unix(0, start), true
+	case float64:
+		return time.Unix(0, int64(start)), true
+	}
+	return time.Time{}, false
+}
+
+// ServeMetrics exposes the metrics gathered by gatherer on addr at /metrics
+func ServeMetrics(addr string, gatherer prometheus.Gatherer) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	return &http.Server{Addr: addr, Handler: mux}
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gatherValue returns the value of the metric name with labels in registry
+func gatherValue(t *testing.T, registry *prometheus.Registry, name string, labels map[string]string) float64 {
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if !hasLabels(metric, labels) {
+				continue
+			}
+			if family.GetType() == dto.MetricType_HISTOGRAM {
+				return float64(metric.GetHistogram().GetSampleCount())
+			}
+			if family.GetType() == dto.MetricType_GAUGE {
+				return metric.GetGauge().GetValue()
+			}
+			return metric.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func hasLabels(metric *dto.Metric, labels map[string]string) bool {
+	matched := 0
+	for _, pair := range metric.GetLabel() {
+		if v, ok := labels[pair.GetName()]; ok && v == pair.GetValue() {
+			matched++
+		}
+	}
+	return matched == len(labels)
+}
+
+func TestRemoteFuncMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics("connector", registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote := NewConnectorRemote(nil, WithMetrics(metrics))
+
+	for i := 0; i < 2; i++ {
+		if _, err := remote.RemoteFunc(context.Background(), []byte(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := WithContentType(context.Background(), "xml")
+	if _, err := remote.RemoteFunc(ctx, []byte(`<msg/>`)); err == nil {
+		t.Fatal("expected an unsupported content type error")
+	}
+
+	ok := map[string]string{"route": RemoteFuncRoute, "status": StatusOK, "server_type": "connector"}
+	failed := map[string]string{"route": RemoteFuncRoute, "status": StatusError, "server_type": "connector"}
+	tables := []struct {
+		name   string
+		metric string
+		labels map[string]string
+		value  float64
+	}{
+		{"ok calls", "pitaya_example_calls_total", ok, 2},
+		{"failed calls", "pitaya_example_calls_total", failed, 1},
+		{"errors", "pitaya_example_call_errors_total", failed, 1},
+		{"latency", "pitaya_example_call_duration_seconds", ok, 2},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			if v := gatherValue(t, registry, table.metric, table.labels); v != table.value {
+				t.Fatalf("expected %s to be %v, got %v", table.metric, table.value, v)
+			}
+		})
+	}
+}
+
+func TestSendBufferMetrics(t *testing.T) {
+	c, entity, _, _ := saturate(t, OverflowBlock)
+	defer close(entity.release)
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics("connector", registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := metrics.WatchSendBuffers(c); err != nil {
+		t.Fatal(err)
+	}
+
+	labels := map[string]string{"server_type": "connector"}
+	if v := gatherValue(t, registry, "pitaya_example_send_buffer_depth_max", labels); v != 2 {
+		t.Fatalf("expected the largest buffer to hold 2 pushes, got %v", v)
+	}
+	if v := gatherValue(t, registry, "pitaya_example_send_buffer_pushes", labels); v != 2 {
+		t.Fatalf("expected 2 pushes buffered, got %v", v)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			if len(metric.GetLabel()) != 1 {
+				t.Fatalf("expected %s to be labeled by the server type only, got %v", family.GetName(), metric.GetLabel())
+			}
+		}
+	}
+}
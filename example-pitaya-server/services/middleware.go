@@ -0,0 +1,354 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sync"
+
+	"github.com/topfreegames/pitaya/cluster"
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+	e "github.com/topfreegames/pitaya/errors"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/serialize"
+)
+
+// HandlerFunc handles a serialized message and returns the serialized answer
+type HandlerFunc func(ctx context.Context, in []byte) (out []byte, err error)
+
+// MiddlewareFunc wraps a HandlerFunc, it can act on the message before and after calling next
+type MiddlewareFunc func(next HandlerFunc) HandlerFunc
+
+// Pipeline is a chain of middlewares applied to remotes and handlers.
+// Middlewares run in the order they were registered on the way in and in the reverse order on the way out.
+type Pipeline struct {
+	middlewares []MiddlewareFunc
+}
+
+// NewPipeline returns a new pipeline running middlewares
+func NewPipeline(middlewares ...MiddlewareFunc) *Pipeline {
+	return &Pipeline{middlewares: middlewares}
+}
+
+// Use appends middleware to the pipeline, it must not be called once the server started
+func (p *Pipeline) Use(middleware MiddlewareFunc) {
+	p.middlewares = append(p.middlewares, middleware)
+}
+
+// Then returns h wrapped by the middlewares of the pipeline
+func (p *Pipeline) Then(h HandlerFunc) HandlerFunc {
+	for i := len(p.middlewares) - 1; i >= 0; i-- {
+		h = p.middlewares[i](h)
+	}
+	return h
+}
+
+// PanicError is returned when a handler panicked
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", p.Value)
+}
+
+// PitayaError converts the error so it reaches the caller as an internal error, without the stack
+func (p *PanicError) PitayaError() *e.Error {
+	return e.NewError(p, e.ErrInternalCode)
+}
+
+// PanicFunc maps a panic recovered while serving route into the error answered to the caller,
+// the *PanicError of the panic is answered when it returns nil
+type PanicFunc func(recovered interface{}, route string) *PitayaError
+
+// RecoveryOption configures Recovery
+type RecoveryOption func(r *recovery)
+
+// OnPanic makes Recovery answer the errors f maps the panics into
+func OnPanic(f PanicFunc) RecoveryOption {
+	return func(r *recovery) {
+		r.onPanic = f
+	}
+}
+
+type recovery struct {
+	logger  Logger
+	onPanic PanicFunc
+}
+
+// mapPanic returns the error the OnPanic hook maps rec into, nil when there is none or it panicked too
+func (r *recovery) mapPanic(rec interface{}, route string) (mapped *PitayaError) {
+	if r.onPanic == nil {
+		return nil
+	}
+	defer func() {
+		if hookRec := recover(); hookRec != nil {
+			r.logger.Error("panic hook panicked", "route", route, "panic", fmt.Sprint(hookRec))
+			mapped = nil
+		}
+	}()
+	return r.onPanic(rec, route)
+}
+
+// Recovery returns a middleware converting panics of the next handlers into a *PanicError
+// sent to the caller as a pitaya internal error, or into the error of the OnPanic hook.
+// The panic is logged with its stack and the server keeps serving, including the connection of
+// the client when the handler was called through a frontend.
+func Recovery(logger Logger, opts ...RecoveryOption) MiddlewareFunc {
+	r := &recovery{logger: logger}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, in []byte) (out []byte, err error) {
+			defer func() {
+				if rec := recover(); rec != nil {
+					perr := &PanicError{Value: rec, Stack: debug.Stack()}
+					route, _ := pcontext.GetFromPropagateCtx(ctx, constants.RouteKey).(string)
+					LoggerFromCtx(ctx, logger).Error("recovered from panic",
+						"route", route,
+						"panic", perr.Error(),
+						"stack", string(perr.Stack),
+					)
+					if mapped := r.mapPanic(rec, route); mapped != nil {
+						out, err = nil, mapped
+						return
+					}
+					out, err = nil, perr.PitayaError()
+				}
+			}()
+			return next(ctx, in)
+		}
+	}
+}
+
+// toPitayaError converts err into the error sent to the caller
+func toPitayaError(err error) *e.Error {
+	if perr, ok := err.(*e.Error); ok {
+		return perr
+	}
+	// errors wrapping a *PitayaError keep its code
+	var converter interface{ PitayaError() *e.Error }
+	if errors.As(err, &converter) {
+		return converter.PitayaError()
+	}
+	return e.NewError(err, e.ErrUnknownCode)
+}
+
+// pitayaErrorResponse builds the response of a rpc that failed with err, see toPitayaError
+func pitayaErrorResponse(err error) *pitayaprotos.Response {
+	perr := toPitayaError(err)
+	return &pitayaprotos.Response{
+		Error: &pitayaprotos.Error{
+			Code:     perr.Code,
+			Msg:      perr.Message,
+			Metadata: perr.Metadata,
+		},
+	}
+}
+
+// WrapRPCServer runs the pipeline on every rpc received by server, both the remote calls and the
+// handlers forwarded by frontends. Handlers of frontends are not received through rpcs, see Handlers.
+func (p *Pipeline) WrapRPCServer(server cluster.RPCServer) cluster.RPCServer {
+	return &pipelineRPCServer{RPCServer: server, pipeline: p}
+}
+
+type pipelineRPCServer struct {
+	cluster.RPCServer
+	pipeline *Pipeline
+}
+
+func (r *pipelineRPCServer) SetPitayaServer(server pitayaprotos.PitayaServer) {
+	r.RPCServer.SetPitayaServer(&pipelinePitayaServer{PitayaServer: server, pipeline: r.pipeline})
+}
+
+type pipelinePitayaServer struct {
+	pitayaprotos.PitayaServer
+	pipeline *Pipeline
+}
+
+// requestContext returns the context propagated by the caller of req
+func requestContext(ctx context.Context, req *pitayaprotos.Request) context.Context {
+	if len(req.Metadata) > 0 {
+		if decoded, err := pcontext.Decode(req.Metadata); err == nil && decoded != nil {
+			ctx = decoded
+		}
+	}
+	return pcontext.AddToPropagateCtx(ctx, constants.RouteKey, req.Msg.Route)
+}
+
+func (s *pipelinePitayaServer) Call(ctx context.Context, req *pitayaprotos.Request) (*pitayaprotos.Response, error) {
+	if req.Msg == nil {
+		return s.PitayaServer.Call(ctx, req)
+	}
+
+	// the answer of the remote, nil when a middleware answered without calling it
+	var res *pitayaprotos.Response
+	h := s.pipeline.Then(func(ctx context.Context, in []byte) ([]byte, error) {
+		// the remote service rebuilds the context from the metadata
+		metadata, err := pcontext.Encode(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Metadata = metadata
+		req.Msg.Data = in
+		answer, err := s.PitayaServer.Call(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if answer.Error != nil {
+			return nil, &e.Error{
+				Code:     answer.Error.Code,
+				Message:  answer.Error.Msg,
+				Metadata: answer.Error.Metadata,
+			}
+		}
+		res = answer
+		return answer.Data, nil
+	})
+
+	// the remotes encode their answer into pooled buffers, they are only transient when the
+	// middlewares replace it
+	answers := withPooledAnswers(requestContext(ctx, req))
+	out, err := h(answers, req.Msg.Data)
+	if err != nil {
+		return pitayaErrorResponse(err), nil
+	}
+	if res == nil {
+		res = &pitayaprotos.Response{}
+	}
+	res.Data = answers.release(out)
+	return res, nil
+}
+
+// Handlers returns the pitaya hooks running the pipeline around the handlers of a frontend, the
+// messages go through the middlewares encoded by serializer, the serializer of pitaya
+func (p *Pipeline) Handlers(serializer serialize.Serializer) *HandlerHooks {
+	return &HandlerHooks{pipeline: p, serializer: serializer}
+}
+
+// HandlerHooks run a pipeline around the handlers through the before and after handlers of pitaya,
+// which calls the handlers itself. The middlewares get the message before the handler and its
+// answer after, but the handlers keep the context of pitaya. A middleware answering without
+// calling the next ones fails the call with its error, or replaces the answer of the handler,
+// which still runs.
+type HandlerHooks struct {
+	pipeline   *Pipeline
+	serializer serialize.Serializer
+	calls      sync.Map
+}
+
+type handlerResult struct {
+	out []byte
+	err error
+}
+
+// handlerCall is a call of a handler going through the pipeline
+type handlerCall struct {
+	// in is the message once through the middlewares
+	in chan []byte
+	// answer is the answer of the handler
+	answer chan handlerResult
+	// done is the answer of the pipeline
+	done chan handlerResult
+}
+
+// BeforeHandler sends the message through the middlewares, it must be the last one given to
+// pitaya.BeforeHandler so the handler is called once it returned
+func (h *HandlerHooks) BeforeHandler(ctx context.Context, in interface{}) (interface{}, error) {
+	data, err := h.encode(in)
+	if err != nil {
+		return nil, err
+	}
+	call := &handlerCall{
+		in:     make(chan []byte, 1),
+		answer: make(chan handlerResult, 1),
+		done:   make(chan handlerResult, 1),
+	}
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				call.done <- handlerResult{err: (&PanicError{Value: rec, Stack: debug.Stack()}).PitayaError()}
+			}
+		}()
+		out, err := h.pipeline.Then(func(ctx context.Context, in []byte) ([]byte, error) {
+			call.in <- in
+			res := <-call.answer
+			return res.out, res.err
+		})(ctx, data)
+		call.done <- handlerResult{out: out, err: err}
+	}()
+
+	select {
+	case data := <-call.in:
+		arg, err := h.decode(in, data)
+		if err != nil {
+			call.answer <- handlerResult{err: err}
+			return nil, err
+		}
+		h.calls.Store(ctx, call)
+		return arg, nil
+	case res := <-call.done:
+		if res.err != nil {
+			return nil, res.err
+		}
+		call.done <- res
+		h.calls.Store(ctx, call)
+		return in, nil
+	}
+}
+
+// AfterHandler sends the answer of the handler through the middlewares, it must be the first one
+// given to pitaya so the others get the answer of the pipeline
+func (h *HandlerHooks) AfterHandler(ctx context.Context, out interface{}, err error) (interface{}, error) {
+	value, ok := h.calls.LoadAndDelete(ctx)
+	if !ok {
+		return out, err
+	}
+	call := value.(*handlerCall)
+	res := handlerResult{err: err}
+	if err == nil {
+		res.out, res.err = h.encode(out)
+	}
+	call.answer <- res
+	res = <-call.done
+	if res.err != nil {
+		return nil, res.err
+	}
+	return res.out, nil
+}
+
+// encode encodes a message or an answer of a handler, the raw ones are left as is
+func (h *HandlerHooks) encode(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return v, nil
+	}
+	data, err := h.serializer.Marshal(v)
+	if err != nil {
+		return nil, e.NewError(err, e.ErrInternalCode)
+	}
+	return data, nil
+}
+
+// decode decodes data, the message of the handler once through the middlewares, into a new
+// value of the type of in, the message pitaya decoded
+func (h *HandlerHooks) decode(in interface{}, data []byte) (interface{}, error) {
+	switch in.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return data, nil
+	}
+	arg := reflect.New(reflect.TypeOf(in).Elem()).Interface()
+	if err := h.serializer.Unmarshal(data, arg); err != nil {
+		return nil, e.NewError(err, e.ErrBadRequestCode)
+	}
+	return arg, nil
+}
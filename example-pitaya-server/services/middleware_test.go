@@ -0,0 +1,231 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/constants"
+	e "github.com/topfreegames/pitaya/errors"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/serialize/json"
+	"github.com/topfreegames/pitaya/util"
+)
+
+func recordingMiddleware(name string, calls *[]string) MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, in []byte) ([]byte, error) {
+			*calls = append(*calls, "in "+name)
+			out, err := next(ctx, in)
+			*calls = append(*calls, "out "+name)
+			return out, err
+		}
+	}
+}
+
+func TestPipelineOrdering(t *testing.T) {
+	var calls []string
+	pipeline := NewPipeline(recordingMiddleware("first", &calls))
+	pipeline.Use(recordingMiddleware("second", &calls))
+
+	h := pipeline.Then(func(ctx context.Context, in []byte) ([]byte, error) {
+		calls = append(calls, "handler")
+		return in, nil
+	})
+	if _, err := h(context.Background(), []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"in first", "in second", "handler", "out second", "out first"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("expected %v, got %v", expected, calls)
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	var calls []string
+	pipeline := NewPipeline(recordingMiddleware("outer", &calls), Recovery(NewNopLogger()))
+
+	h := pipeline.Then(func(ctx context.Context, in []byte) ([]byte, error) {
+		panic("boom")
+	})
+	_, err := h(context.Background(), nil)
+	pitayaErr, ok := err.(*e.Error)
+	if !ok || pitayaErr.Code != e.ErrInternalCode || pitayaErr.Message != "panic: boom" {
+		t.Fatalf("expected an internal pitaya error, got %#v", err)
+	}
+	if !reflect.DeepEqual(calls, []string{"in outer", "out outer"}) {
+		t.Fatalf("the outer middlewares should see the recovered error, got %v", calls)
+	}
+}
+
+func TestRemoteFuncPipeline(t *testing.T) {
+	var calls []string
+	pipeline := NewPipeline(recordingMiddleware("remote", &calls))
+	remote := NewConnectorRemote(nil, WithPipeline(pipeline))
+
+	res, err := remote.RemoteFunc(context.Background(), []byte(`{"msg":"hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Msg != `{"msg":"hi"}` || !reflect.DeepEqual(calls, []string{"in remote", "out remote"}) {
+		t.Fatalf("unexpected response %v or calls %v", res, calls)
+	}
+}
+
+// panickingPitayaServer panics with the message, "handler panicked" when it is empty
+type panickingPitayaServer struct {
+	pitayaprotos.PitayaServer
+}
+
+func (panickingPitayaServer) Call(ctx context.Context, req *pitayaprotos.Request) (*pitayaprotos.Response, error) {
+	if len(req.Msg.Data) > 0 {
+		panic(string(req.Msg.Data))
+	}
+	panic("handler panicked")
+}
+
+func TestPipelineRPCServerRecovers(t *testing.T) {
+	pipeline := NewPipeline(Recovery(NewNopLogger()))
+	rpcServer := &fakeRPCServer{}
+	pipeline.WrapRPCServer(rpcServer).SetPitayaServer(panickingPitayaServer{})
+
+	res, err := rpcServer.pitayaServer.Call(context.Background(), &pitayaprotos.Request{
+		Msg: &pitayaprotos.Msg{Route: "room.room.join"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Error == nil || res.Error.Code != e.ErrInternalCode {
+		t.Fatalf("expected the panic to be answered as an internal error, got %v", res)
+	}
+}
+
+func TestRecoveryOnPanic(t *testing.T) {
+	var recovered []interface{}
+	var routes []string
+	pipeline := NewPipeline(Recovery(NewNopLogger(), OnPanic(func(rec interface{}, route string) *PitayaError {
+		recovered = append(recovered, rec)
+		routes = append(routes, route)
+		if rec == "unmapped" {
+			return nil
+		}
+		if rec == "hook panics" {
+			panic("hook panicked")
+		}
+		return NewError(e.ErrInternalCode, "something went wrong").WithMetadata("route", route)
+	})))
+	rpcServer := &fakeRPCServer{}
+	pipeline.WrapRPCServer(rpcServer).SetPitayaServer(panickingPitayaServer{})
+
+	call := func(route, value string) *pitayaprotos.Response {
+		t.Helper()
+		res, err := rpcServer.pitayaServer.Call(context.Background(), &pitayaprotos.Request{
+			Msg: &pitayaprotos.Msg{Route: route, Data: []byte(value)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := call("room.room.join", "")
+	if res.Error == nil || res.Error.Code != e.ErrInternalCode || res.Error.Msg != "something went wrong" ||
+		res.Error.Metadata["route"] != "room.room.join" || res.Error.Metadata[CategoryKey] != "internal" {
+		t.Fatalf("expected the error of the hook, got %v", res.Error)
+	}
+	if !reflect.DeepEqual(recovered, []interface{}{"handler panicked"}) || !reflect.DeepEqual(routes, []string{"room.room.join"}) {
+		t.Fatalf("the hook should receive the panic and the route, got %v and %v", recovered, routes)
+	}
+
+	// the server keeps serving, the default error is answered when the hook doesn't map the panic
+	for _, value := range []string{"unmapped", "hook panics"} {
+		if res := call("room.room.message", value); res.Error == nil || res.Error.Code != e.ErrInternalCode || res.Error.Msg != "panic: "+value {
+			t.Fatalf("expected the default internal error, got %v", res.Error)
+		}
+	}
+}
+
+// callHandler calls handler with msg like pitaya calls the handlers of a frontend, between the
+// before and after handlers of hooks
+func callHandler(hooks *HandlerHooks, msg interface{}, handler func(ctx context.Context, msg interface{}) (interface{}, error)) ([]byte, error) {
+	ctx := context.WithValue(routeContext("connector.connector.entry"), constants.SessionCtxKey, nil)
+	arg, err := hooks.BeforeHandler(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	out, err := handler(ctx, arg)
+	out, err = hooks.AfterHandler(ctx, out, err)
+	if err != nil {
+		return nil, err
+	}
+	return util.SerializeOrRaw(json.NewSerializer(), out)
+}
+
+// replacing returns a middleware replacing from with to in the messages and the answers
+func replacing(from, to string) MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, in []byte) ([]byte, error) {
+			out, err := next(ctx, bytes.ReplaceAll(in, []byte(from), []byte(to)))
+			return bytes.ReplaceAll(out, []byte(from), []byte(to)), err
+		}
+	}
+}
+
+func TestHandlerPipeline(t *testing.T) {
+	var calls []string
+	hooks := NewPipeline(recordingMiddleware("outer", &calls), replacing("hi", "ho")).Handlers(json.NewSerializer())
+
+	out, err := callHandler(hooks, &protos.RPCMsg{Msg: "hi"}, func(ctx context.Context, msg interface{}) (interface{}, error) {
+		calls = append(calls, "handler")
+		return &protos.Response{Code: 200, Msg: msg.(*protos.RPCMsg).Msg + " hi"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"Code":200,"Msg":"ho ho"}` {
+		t.Fatalf("expected the middlewares to change the message and the answer, got %s", out)
+	}
+	if !reflect.DeepEqual(calls, []string{"in outer", "handler", "out outer"}) {
+		t.Fatalf("expected the handler to run inside the middlewares, got %v", calls)
+	}
+
+	// the errors of the handler go through the middlewares
+	calls = nil
+	_, err = callHandler(hooks, []byte("raw"), func(ctx context.Context, msg interface{}) (interface{}, error) {
+		return nil, e.NewError(errors.New("failed"), e.ErrBadRequestCode)
+	})
+	var pitayaErr *e.Error
+	if !errors.As(err, &pitayaErr) || pitayaErr.Code != e.ErrBadRequestCode || len(calls) != 2 {
+		t.Fatalf("expected the error of the handler through the middlewares, got %v after %v", err, calls)
+	}
+	hooks.calls.Range(func(key, value interface{}) bool {
+		t.Fatal("the calls should be forgotten once answered")
+		return false
+	})
+}
+
+func TestHandlerPipelineRejects(t *testing.T) {
+	limiter := NewConcurrencyLimiter(ConcurrencyOptions{
+		Routes: map[string]ConcurrencyRule{"connector.connector.entry": {Limit: 1}},
+	})
+	release, err := limiter.Acquire(context.Background(), "connector.connector.entry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	hooks := NewPipeline(Recovery(NewNopLogger()), limiter.Middleware()).Handlers(json.NewSerializer())
+
+	called := false
+	_, err = callHandler(hooks, &protos.RPCMsg{}, func(ctx context.Context, msg interface{}) (interface{}, error) {
+		called = true
+		return &protos.Response{}, nil
+	})
+	var pitayaErr *PitayaError
+	if !errors.Is(err, ErrOverloaded) || !errors.As(err, &pitayaErr) || pitayaErr.Code != ErrUnavailableCode || called {
+		t.Fatalf("expected the handler not to be called on an overloaded route, got %v", err)
+	}
+}
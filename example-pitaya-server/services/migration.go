@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	pcontext "github.com/topfreegames/pitaya/context"
+	e "github.com/topfreegames/pitaya/errors"
+)
+
+// SchemaVersionKey is the propagated context key with the schema version of the messages of the caller
+const SchemaVersionKey = "schema-version"
+
+// ErrUnsupportedVersion is returned when a message has a schema version no migration chain
+// converts from or to the current version
+var ErrUnsupportedVersion = errors.New("unsupported schema version")
+
+// MigrationFunc converts an encoded message from a schema version to another
+type MigrationFunc func(payload []byte) ([]byte, error)
+
+// WithSchemaVersion returns a ctx that tells the remote the schema version of the outgoing message
+func WithSchemaVersion(ctx context.Context, version int) context.Context {
+	return pcontext.AddToPropagateCtx(ctx, SchemaVersionKey, version)
+}
+
+// schemaVersion returns the schema version sent by the caller, it is decoded as a float64 when
+// it was propagated from another server
+func schemaVersion(ctx context.Context) (int, bool) {
+	switch version := pcontext.GetFromPropagateCtx(ctx, SchemaVersionKey).(type) {
+	case int:
+		return version, true
+	case float64:
+		return int(version), true
+	}
+	return 0, false
+}
+
+// Migrations upgrades the requests of callers using an older schema version to the current one,
+// and downgrades the answers back to the version of the caller
+type Migrations struct {
+	mutex   sync.RWMutex
+	current int
+	steps   map[int]map[int]MigrationFunc
+}
+
+// NewMigrations returns a new migration registry whose messages are at version current
+func NewMigrations(current int) *Migrations {
+	return &Migrations{current: current, steps: make(map[int]map[int]MigrationFunc)}
+}
+
+// RegisterMigration registers migrate converting the messages at version from to version to.
+// Upgrades, with from older than to, are applied to the requests, and downgrades to the answers.
+func (m *Migrations) RegisterMigration(from, to int, migrate MigrationFunc) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.steps[from] == nil {
+		m.steps[from] = make(map[int]MigrationFunc)
+	}
+	m.steps[from][to] = migrate
+}
+
+// chain returns the shortest chain of migrations converting from version from to version to,
+// it fails with ErrUnsupportedVersion when there is none
+func (m *Migrations) chain(from, to int) ([]MigrationFunc, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	type hop struct {
+		version int
+		prev    *hop
+		migrate MigrationFunc
+	}
+	visited := map[int]bool{from: true}
+	queue := []*hop{{version: from}}
+	for len(queue) > 0 {
+		h := queue[0]
+		queue = queue[1:]
+		if h.version == to {
+			var chain []MigrationFunc
+			for ; h.prev != nil; h = h.prev {
+				chain = append([]MigrationFunc{h.migrate}, chain...)
+			}
+			return chain, nil
+		}
+		for next, migrate := range m.steps[h.version] {
+			// a downgrade chain never upgrades and an upgrade chain never downgrades
+			if visited[next] || (next > h.version) != (to > from) {
+				continue
+			}
+			visited[next] = true
+			queue = append(queue, &hop{version: next, prev: h, migrate: migrate})
+		}
+	}
+	return nil, fmt.Errorf("%w %d, the current version is %d", ErrUnsupportedVersion, from, m.current)
+}
+
+// migrate converts payload from version from to version to
+func (m *Migrations) migrate(from, to int, payload []byte) ([]byte, error) {
+	chain, err := m.chain(from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, migrate := range chain {
+		if payload, err = migrate(payload); err != nil {
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
+// Upgrade converts payload from version to the current version
+func (m *Migrations) Upgrade(version int, payload []byte) ([]byte, error) {
+	if version > m.current {
+		return nil, fmt.Errorf("%w %d, the current version is %d", ErrUnsupportedVersion, version, m.current)
+	}
+	return m.migrate(version, m.current, payload)
+}
+
+// Downgrade converts payload from the current version to version
+func (m *Migrations) Downgrade(version int, payload []byte) ([]byte, error) {
+	if version > m.current {
+		return nil, fmt.Errorf("%w %d, the current version is %d", ErrUnsupportedVersion, version, m.current)
+	}
+	return m.migrate(m.current, version, payload)
+}
+
+// Middleware returns a middleware upgrading the messages of the callers that sent an older schema
+// version, see WithSchemaVersion, and downgrading the answers of the next handlers to it. The
+// messages of callers without version are at the current version. The unsupported versions are
+// answered with e.ErrBadRequestCode before the next handlers run.
+func (m *Migrations) Middleware() MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, in []byte) ([]byte, error) {
+			version, ok := schemaVersion(ctx)
+			if !ok || version == m.current {
+				return next(ctx, in)
+			}
+			upgraded, err := m.Upgrade(version, in)
+			if err != nil {
+				return nil, m.pitayaError(err, version)
+			}
+			out, err := next(WithSchemaVersion(ctx, m.current), upgraded)
+			if err != nil {
+				return nil, err
+			}
+			downgraded, err := m.Downgrade(version, out)
+			if err != nil {
+				return nil, m.pitayaError(err, version)
+			}
+			return downgraded, nil
+		}
+	}
+}
+
+// pitayaError converts the unsupported versions to bad requests telling the current version
+func (m *Migrations) pitayaError(err error, version int) error {
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		return err
+	}
+	return Wrap(err, e.ErrBadRequestCode, err.Error()).
+		WithMetadata("version", strconv.Itoa(version)).
+		WithMetadata("currentVersion", strconv.Itoa(m.current))
+}
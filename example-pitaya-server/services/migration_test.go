@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	e "github.com/topfreegames/pitaya/errors"
+)
+
+// jsonMigration converts the json object of a request with f
+func jsonMigration(f func(msg map[string]interface{})) MigrationFunc {
+	return func(payload []byte) ([]byte, error) {
+		msg := make(map[string]interface{})
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			return nil, err
+		}
+		f(msg)
+		return json.Marshal(msg)
+	}
+}
+
+// responseMigration converts the json object answered in the message of a BytesResponse with f
+func responseMigration(f func(msg map[string]interface{})) MigrationFunc {
+	return func(payload []byte) ([]byte, error) {
+		res := &protos.BytesResponse{}
+		if err := proto.Unmarshal(payload, res); err != nil {
+			return nil, err
+		}
+		msg, err := jsonMigration(f)(res.Msg)
+		if err != nil {
+			return nil, err
+		}
+		res.Msg = msg
+		return proto.Marshal(res)
+	}
+}
+
+func rename(from, to string) func(msg map[string]interface{}) {
+	return func(msg map[string]interface{}) {
+		msg[to] = msg[from]
+		delete(msg, from)
+	}
+}
+
+// newTestMigrations returns migrations at version 3: v2 renamed name to nick and v3 added level
+func newTestMigrations() *Migrations {
+	m := NewMigrations(3)
+	m.RegisterMigration(1, 2, jsonMigration(rename("name", "nick")))
+	m.RegisterMigration(2, 3, jsonMigration(func(msg map[string]interface{}) { msg["level"] = 1 }))
+	m.RegisterMigration(3, 2, responseMigration(func(msg map[string]interface{}) { delete(msg, "level") }))
+	m.RegisterMigration(2, 1, responseMigration(rename("nick", "name")))
+	return m
+}
+
+// migratedRemote returns a remote echoing json messages behind the migrations, the messages it
+// receives are recorded in seen
+func migratedRemote(m *Migrations, seen *[]byte) *ConnectorRemote {
+	recording := func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, in []byte) ([]byte, error) {
+			*seen = in
+			return next(ctx, in)
+		}
+	}
+	return NewConnectorRemote(nil, WithPipeline(NewPipeline(m.Middleware(), recording)))
+}
+
+func TestMigrationsUpgradeAndDowngrade(t *testing.T) {
+	var seen []byte
+	remote := migratedRemote(newTestMigrations(), &seen)
+
+	ctx := propagated(t, WithSchemaVersion(context.Background(), 1))
+	res, err := remote.RemoteFunc(ctx, []byte(`{"name":"ana"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(seen) != `{"level":1,"nick":"ana"}` {
+		t.Fatalf("expected the remote to receive a v3 message, got %s", seen)
+	}
+	if res.Msg != `{"name":"ana"}` {
+		t.Fatalf("expected a v1 answer, got %s", res.Msg)
+	}
+
+	// the messages at the current version or without version are not migrated
+	for _, ctx := range []context.Context{context.Background(), WithSchemaVersion(context.Background(), 3)} {
+		res, err := remote.RemoteFunc(ctx, []byte(`{"level":2,"nick":"bob"}`))
+		if err != nil || res.Msg != `{"level":2,"nick":"bob"}` || string(seen) != res.Msg {
+			t.Fatalf("expected the message to be left as is, got %v %v", res, err)
+		}
+	}
+}
+
+func TestMigrationsUnsupportedVersion(t *testing.T) {
+	m := newTestMigrations()
+	for _, version := range []int{0, 4} {
+		var seen []byte
+		_, err := migratedRemote(m, &seen).RemoteFunc(WithSchemaVersion(context.Background(), version), []byte(`{}`))
+		var pitayaErr *PitayaError
+		if !errors.Is(err, ErrUnsupportedVersion) || !errors.As(err, &pitayaErr) || pitayaErr.Code != e.ErrBadRequestCode || pitayaErr.Metadata["version"] == "" {
+			t.Fatalf("expected version %d to be a bad request, got %#v", version, err)
+		}
+		if seen != nil {
+			t.Fatalf("expected the remote not to be called with version %d", version)
+		}
+	}
+
+	if _, err := m.Upgrade(0, []byte(`{}`)); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("expected a too old version to be unsupported, got %v", err)
+	}
+	if _, err := m.Downgrade(4, []byte(`{}`)); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("expected an unknown version to be unsupported, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	e "github.com/topfreegames/pitaya/errors"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+)
+
+// ErrRouteNotFound is matched by the RouteNotFoundError answered for remote calls to unknown routes
+var ErrRouteNotFound = errors.New("route not found")
+
+// RouteNotFoundError is answered for remote calls to routes served by no remote
+type RouteNotFoundError struct {
+	Route string
+}
+
+func (r *RouteNotFoundError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrRouteNotFound, r.Route)
+}
+
+// Is makes errors.Is match ErrRouteNotFound, and ErrRemoteNotFound as there is no remote for the route
+func (r *RouteNotFoundError) Is(target error) bool {
+	return target == ErrRouteNotFound || target == ErrRemoteNotFound
+}
+
+// PitayaError converts the error so the attempted route reaches the caller on the wire
+func (r *RouteNotFoundError) PitayaError() *e.Error {
+	return e.NewError(r, e.ErrNotFoundCode, map[string]string{"route": r.Route})
+}
+
+// NotFoundHandler answers the remote calls to routes served by no remote, msg is the encoded
+// message of the call. The returned response is sent to the caller as any remote answer.
+type NotFoundHandler func(ctx context.Context, route string, msg []byte) (*protos.Response, error)
+
+// SetNotFoundHandler makes f answer the remote calls to unknown routes instead of the default
+// RouteNotFoundError. It runs in place of the remote, so the calls still go through the pipeline
+// and the other wrappers of the server. Handlers forwarded by frontends are not affected.
+func (r *Routes) SetNotFoundHandler(f NotFoundHandler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.notFound = f
+}
+
+// isRemoteNotFound tells whether res is the answer of pitaya to a remote call to an unknown route
+func isRemoteNotFound(res *pitayaprotos.Response) bool {
+	return res != nil && res.Error != nil && res.Error.Code == e.ErrNotFoundCode && res.Error.Msg == "route not found"
+}
+
+// notFound answers the remote call req to an unknown route
+func (s *routesPitayaServer) notFound(ctx context.Context, req *pitayaprotos.Request) *pitayaprotos.Response {
+	s.routes.mutex.RLock()
+	f := s.routes.notFound
+	s.routes.mutex.RUnlock()
+	if f == nil {
+		return pitayaErrorResponse(&RouteNotFoundError{Route: req.Msg.Route})
+	}
+
+	res, err := f(requestContext(ctx, req), req.Msg.Route, req.Msg.Data)
+	if err != nil {
+		return pitayaErrorResponse(err)
+	}
+	data, err := proto.Marshal(res)
+	if err != nil {
+		return pitayaErrorResponse(err)
+	}
+	return &pitayaprotos.Response{Data: data}
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+	e "github.com/topfreegames/pitaya/errors"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+)
+
+// notFoundPitayaServer answers remote calls like pitaya does when no remote serves the route
+type notFoundPitayaServer struct {
+	pitayaprotos.PitayaServer
+}
+
+func (notFoundPitayaServer) Call(ctx context.Context, req *pitayaprotos.Request) (*pitayaprotos.Response, error) {
+	return &pitayaprotos.Response{Error: &pitayaprotos.Error{Code: e.ErrNotFoundCode, Msg: "route not found"}}, nil
+}
+
+func callUnknownRoute(t *testing.T, server *fakeRPCServer) *pitayaprotos.Response {
+	t.Helper()
+	res, err := server.pitayaServer.Call(context.Background(), &pitayaprotos.Request{
+		Type: pitayaprotos.RPCType_User,
+		Msg:  &pitayaprotos.Msg{Route: "room.room.gone", Data: []byte("hi")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestRouteNotFound(t *testing.T) {
+	server := &fakeRPCServer{}
+	newTestRoutes().WrapRPCServer(server).SetPitayaServer(notFoundPitayaServer{})
+
+	res := callUnknownRoute(t, server)
+	if res.Error == nil || res.Error.Code != e.ErrNotFoundCode || res.Error.Metadata["route"] != "room.room.gone" {
+		t.Fatalf("expected a not found error with the route, got %v", res.Error)
+	}
+
+	// callers get the route back
+	err := classifyRPCError(&e.Error{Code: res.Error.Code, Message: res.Error.Msg, Metadata: res.Error.Metadata})
+	var notFound *RouteNotFoundError
+	if !errors.As(err, &notFound) || notFound.Route != "room.room.gone" ||
+		!errors.Is(err, ErrRouteNotFound) || !errors.Is(err, ErrRemoteNotFound) {
+		t.Fatalf("expected a RouteNotFoundError, got %v", err)
+	}
+}
+
+func TestNotFoundHandler(t *testing.T) {
+	routes := newTestRoutes()
+	var route string
+	routes.SetNotFoundHandler(func(ctx context.Context, rt string, msg []byte) (*protos.Response, error) {
+		route, _ = pcontext.GetFromPropagateCtx(ctx, constants.RouteKey).(string)
+		return &protos.Response{Code: 200, Msg: rt + ":" + string(msg)}, nil
+	})
+	var wrapped bool
+	pipeline := NewPipeline(func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, in []byte) ([]byte, error) {
+			out, err := next(ctx, in)
+			wrapped = err == nil
+			return out, err
+		}
+	})
+	server := &fakeRPCServer{}
+	routes.WrapRPCServer(pipeline.WrapRPCServer(server)).SetPitayaServer(notFoundPitayaServer{})
+
+	res := callUnknownRoute(t, server)
+	if res.Error != nil {
+		t.Fatalf("unexpected error %v", res.Error)
+	}
+	answer := &protos.Response{}
+	if err := proto.Unmarshal(res.Data, answer); err != nil {
+		t.Fatal(err)
+	}
+	if answer.Msg != "room.room.gone:hi" || route != "room.room.gone" {
+		t.Fatalf("expected the canned response, got %v for %s", answer, route)
+	}
+	if !wrapped {
+		t.Fatal("the fallback should run through the pipeline")
+	}
+}
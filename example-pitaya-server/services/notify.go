@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/cluster"
+	pcontext "github.com/topfreegames/pitaya/context"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+)
+
+// AckedNotifyKey is the key of the propagated context marking the notifies acked on receipt
+const AckedNotifyKey = "ackedNotify"
+
+// DeadLetterFunc receives the notifies to route that were never acked, arg is the marshaled
+// argument and err the failure of the last attempt
+type DeadLetterFunc func(route string, arg []byte, err error)
+
+// NotifyPolicy configures the acked notifies of a RemoteClient
+type NotifyPolicy struct {
+	// Timeout is how long each attempt waits for the ack
+	Timeout time.Duration
+	// Retry retries the attempts that were not acked, the timeouts and the transient errors
+	// when Retry.Retryable is nil
+	Retry RetryPolicy
+	// DeadLetter receives the notifies that failed every attempt
+	DeadLetter DeadLetterFunc
+}
+
+// DefaultNotifyPolicy waits a second for each ack and retries as DefaultRetryPolicy
+var DefaultNotifyPolicy = NotifyPolicy{
+	Timeout: time.Second,
+	Retry:   DefaultRetryPolicy,
+}
+
+// WithNotifyPolicy sends the notifies of the client according to policy
+func WithNotifyPolicy(policy NotifyPolicy) RemoteClientOption {
+	return func(r *RemoteClient) {
+		r.notify = policy
+	}
+}
+
+// isNotifyRetryable retries the notifies whose ack timed out on top of the transient errors.
+// The notify may have been received anyway, so it is delivered at least once.
+func isNotifyRetryable(err error) bool {
+	return errors.Is(err, ErrRPCTimeout) || IsTransient(err)
+}
+
+// Notify sends arg to route in serverID, or in the server routed to when empty, and returns once the
+// receiving server acked it, before the remote runs. The remote answer is discarded. Attempts that
+// are not acked within the timeout of the notify policy are retried, so the remote may receive the
+// notify more than once; the dead-letter callback is called when every attempt failed.
+// The receiving server must wrap its rpc server with AckNotifies.
+func (r *RemoteClient) Notify(ctx context.Context, serverID, route string, arg proto.Message) error {
+	payload, err := proto.Marshal(arg)
+	if err != nil {
+		return err
+	}
+	err = r.sendNotify(ctx, serverID, route, arg)
+	if err != nil && r.notify.DeadLetter != nil {
+		r.notify.DeadLetter(route, payload, err)
+	}
+	return err
+}
+
+func (r *RemoteClient) sendNotify(ctx context.Context, serverID, route string, arg proto.Message) error {
+	// the attempt timeouts are set after propagating the context so they don't bound the remote
+	ctx = pcontext.AddToPropagateCtx(r.context(ctx), AckedNotifyKey, true)
+	serverID, err := r.route(ctx, serverID, route)
+	if err != nil {
+		return err
+	}
+	policy := r.notify.Retry
+	if policy.Retryable == nil {
+		policy.Retryable = isNotifyRetryable
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := r.notifyAttempt(ctx, serverID, route, arg)
+		if err == nil {
+			return nil
+		}
+		err = classifyRPCError(err)
+		if !policy.wait(ctx, r.clock, attempt, err) {
+			return &RPCError{
+				Route:    route,
+				Err:      err,
+				Attempts: attempt,
+			}
+		}
+	}
+}
+
+func (r *RemoteClient) notifyAttempt(ctx context.Context, serverID, route string, arg proto.Message) error {
+	if r.notify.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.notify.Timeout)
+		defer cancel()
+	}
+	return r.rpc(ctx, serverID, route, &protos.Response{}, arg)
+}
+
+// AckNotifies returns a rpc server acking the notifies sent by RemoteClient.Notify as soon as they
+// are received, the remotes are called afterwards and their answers and errors are only logged.
+// The other rpcs are served as usual.
+func AckNotifies(server cluster.RPCServer, logger Logger) cluster.RPCServer {
+	return &ackRPCServer{RPCServer: server, logger: logger}
+}
+
+type ackRPCServer struct {
+	cluster.RPCServer
+	logger Logger
+}
+
+func (s *ackRPCServer) SetPitayaServer(server pitayaprotos.PitayaServer) {
+	s.RPCServer.SetPitayaServer(&ackPitayaServer{PitayaServer: server, logger: s.logger})
+}
+
+type ackPitayaServer struct {
+	pitayaprotos.PitayaServer
+	logger Logger
+}
+
+func (s *ackPitayaServer) Call(ctx context.Context, req *pitayaprotos.Request) (*pitayaprotos.Response, error) {
+	if req.Msg == nil || len(req.Metadata) == 0 {
+		return s.PitayaServer.Call(ctx, req)
+	}
+	decoded, err := pcontext.Decode(req.Metadata)
+	if err != nil || decoded == nil {
+		return s.PitayaServer.Call(ctx, req)
+	}
+	if acked, _ := pcontext.GetFromPropagateCtx(decoded, AckedNotifyKey).(bool); !acked {
+		return s.PitayaServer.Call(ctx, req)
+	}
+
+	// the context of the transport ends with the ack, the remote rebuilds its own from the metadata
+	go func() {
+		res, err := s.PitayaServer.Call(context.Background(), req)
+		switch {
+		case err != nil:
+			LoggerFromCtx(decoded, s.logger).Error("error handling notify", "route", req.Msg.Route, "error", err.Error())
+		case res != nil && res.Error != nil:
+			LoggerFromCtx(decoded, s.logger).Warn("notify answered an error", "route", req.Msg.Route, "code", res.Error.Code, "error", res.Error.Msg)
+		}
+	}()
+	return &pitayaprotos.Response{}, nil
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	pcontext "github.com/topfreegames/pitaya/context"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+)
+
+// blockingPitayaServer sends the notifies it receives to received once release is closed
+type blockingPitayaServer struct {
+	pitayaprotos.PitayaServer
+	release  chan struct{}
+	received chan []byte
+}
+
+func (s *blockingPitayaServer) Call(ctx context.Context, req *pitayaprotos.Request) (*pitayaprotos.Response, error) {
+	<-s.release
+	s.received <- req.Msg.Data
+	return &pitayaprotos.Response{Data: []byte("discarded")}, nil
+}
+
+// ackingRPC sends the rpcs to server wrapped by AckNotifies, building the requests like the nats client
+func ackingRPC(server pitayaprotos.PitayaServer) RPCFunc {
+	rpcServer := &fakeRPCServer{}
+	AckNotifies(rpcServer, NewNopLogger()).SetPitayaServer(server)
+	return func(ctx context.Context, serverID, routeStr string, reply, arg proto.Message) error {
+		data, err := proto.Marshal(arg)
+		if err != nil {
+			return err
+		}
+		metadata, err := pcontext.Encode(ctx)
+		if err != nil {
+			return err
+		}
+		res, err := rpcServer.pitayaServer.Call(ctx, &pitayaprotos.Request{
+			Type:     pitayaprotos.RPCType_User,
+			Msg:      &pitayaprotos.Msg{Route: routeStr, Data: data},
+			Metadata: metadata,
+		})
+		if err != nil {
+			return err
+		}
+		return proto.Unmarshal(res.Data, reply)
+	}
+}
+
+func TestNotifyAcked(t *testing.T) {
+	remote := &blockingPitayaServer{release: make(chan struct{}), received: make(chan []byte, 1)}
+	var letters int
+	client := NewRemoteClient(ackingRPC(remote), WithNotifyPolicy(NotifyPolicy{
+		Timeout:    time.Second,
+		Retry:      RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+		DeadLetter: func(string, []byte, error) { letters++ },
+	}))
+
+	// the remote is still blocked when the ack comes back
+	if err := client.Notify(context.Background(), "room-1", "room.roomremote.event", &protos.RPCMsg{Msg: "joined"}); err != nil {
+		t.Fatal(err)
+	}
+	if letters != 0 {
+		t.Fatalf("expected no dead letter, got %d", letters)
+	}
+
+	close(remote.release)
+	select {
+	case data := <-remote.received:
+		msg := &protos.RPCMsg{}
+		if err := proto.Unmarshal(data, msg); err != nil || msg.Msg != "joined" {
+			t.Fatalf("unexpected notify received: %v %v", msg, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the notify never reached the remote")
+	}
+}
+
+func TestNotifyDeadLetter(t *testing.T) {
+	attempts := 0
+	unacked := func(ctx context.Context, serverID, routeStr string, reply, arg proto.Message) error {
+		attempts++
+		if acked, _ := pcontext.GetFromPropagateCtx(ctx, AckedNotifyKey).(bool); !acked {
+			t.Errorf("the notify is not marked as acked")
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	type letter struct {
+		route string
+		arg   []byte
+		err   error
+	}
+	var letters []letter
+	client := NewRemoteClient(unacked, WithNotifyPolicy(NotifyPolicy{
+		Timeout: 10 * time.Millisecond,
+		Retry:   RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+		DeadLetter: func(route string, arg []byte, err error) {
+			letters = append(letters, letter{route, arg, err})
+		},
+	}))
+
+	err := client.Notify(context.Background(), "room-1", "room.roomremote.event", &protos.RPCMsg{Msg: "joined"})
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || !errors.Is(err, ErrRPCTimeout) || rpcErr.Attempts != 3 {
+		t.Fatalf("expected a timeout after 3 attempts, got %v", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+	if len(letters) != 1 || letters[0].route != "room.roomremote.event" || letters[0].err != err {
+		t.Fatalf("expected the notify to be dead-lettered once, got %v", letters)
+	}
+	msg := &protos.RPCMsg{}
+	if err := proto.Unmarshal(letters[0].arg, msg); err != nil || msg.Msg != "joined" {
+		t.Fatalf("unexpected dead letter argument: %v %v", msg, err)
+	}
+}
+
+func TestAckNotifiesServesOtherRPCs(t *testing.T) {
+	echo := &echoPitayaServer{}
+	client := NewRemoteClient(ackingRPC(echo))
+
+	res := &protos.RPCMsg{}
+	if err := client.call(context.Background(), "room-1", "room.roomremote.echo", res, &protos.RPCMsg{Msg: "ping"}); err != nil {
+		t.Fatal(err)
+	}
+	if res.Msg != "ping" {
+		t.Fatalf("expected the answer of the remote, got %v", res)
+	}
+}
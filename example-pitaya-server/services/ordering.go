@@ -0,0 +1,149 @@
+package services
+
+import (
+	"sync"
+
+	"github.com/topfreegames/pitaya/session"
+)
+
+// WithOrderedPushes makes the pushes of the connector to a session reach the client in the order
+// Push was called, even when called from several goroutines. Each session gets a queue the pushes
+// are numbered and delivered from one at a time, which costs a lock and a goroutine per session
+// being pushed to; pushes are delivered in whatever order the goroutines reach the agent otherwise.
+func WithOrderedPushes() ConnectorOption {
+	return func(c *Connector) {
+		c.ordered = true
+	}
+}
+
+// queuedPush is a push waiting in the queue of its session
+type queuedPush struct {
+	seq     uint64
+	route   string
+	payload []byte
+	done    chan error
+}
+
+// pushQueue delivers the pushes of a session in the order of their sequence numbers
+type pushQueue struct {
+	mutex   sync.Mutex
+	session *session.Session
+	// next is the sequence number of the next push queued
+	next    uint64
+	pending []*queuedPush
+	running bool
+	// size bounds the pushes pending when positive, see WithSendBuffer
+	size     int
+	overflow OverflowPolicy
+	// room is signaled when a push leaves the queue or the queue is closed
+	room   *sync.Cond
+	closed bool
+	// undelivered receives the buffered pushes that failed, nobody waits for them
+	undelivered func(p *queuedPush, err error)
+}
+
+func newPushQueue(s *session.Session) *pushQueue {
+	q := &pushQueue{session: s}
+	q.room = sync.NewCond(&q.mutex)
+	return q
+}
+
+// enqueue numbers the push and queues it, the error of its delivery is sent to done
+func (q *pushQueue) enqueue(route string, payload []byte) *queuedPush {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.queue(route, payload)
+}
+
+// queue numbers the push and queues it, it must be called with the mutex held
+func (q *pushQueue) queue(route string, payload []byte) *queuedPush {
+	p := &queuedPush{route: route, payload: payload, done: make(chan error, 1)}
+	p.seq = q.next
+	q.next++
+	q.pending = append(q.pending, p)
+	if !q.running {
+		q.running = true
+		go q.deliver()
+	}
+	return p
+}
+
+// deliver pushes the queued pushes until the queue is empty
+func (q *pushQueue) deliver() {
+	for {
+		q.mutex.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			q.mutex.Unlock()
+			return
+		}
+		p := q.pending[0]
+		q.pending[0] = nil
+		q.pending = q.pending[1:]
+		q.room.Broadcast()
+		q.mutex.Unlock()
+
+		err := q.session.Push(p.route, p.payload)
+		if err != nil && q.undelivered != nil {
+			q.undelivered(p, err)
+		}
+		p.done <- err
+	}
+}
+
+// close wakes the pushes waiting for room, they fail as gone
+func (q *pushQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.closed = true
+	q.room.Broadcast()
+}
+
+// pushQueue returns the queue of s, creating it on its first push
+func (c *Connector) pushQueue(s *session.Session) *pushQueue {
+	c.queuesMutex.Lock()
+	defer c.queuesMutex.Unlock()
+	q, ok := c.queues[s.ID()]
+	if !ok {
+		q = newPushQueue(s)
+		if c.sendBuffer > 0 {
+			q.size = c.sendBuffer
+			q.overflow = c.overflow
+			q.undelivered = func(p *queuedPush, err error) {
+				c.deadLetter(s.UID(), p.route, p.payload)
+			}
+		}
+		c.queues[s.ID()] = q
+	}
+	return q
+}
+
+// dropPushQueue forgets the queue of a closed session, the pushes still queued fail as gone
+func (c *Connector) dropPushQueue(s *session.Session) {
+	c.queuesMutex.Lock()
+	q, ok := c.queues[s.ID()]
+	delete(c.queues, s.ID())
+	c.queuesMutex.Unlock()
+	if ok {
+		q.close()
+	}
+}
+
+// push sends payload to s, through its queue when the pushes are ordered or buffered. Every push
+// of the connector to a session goes through it: Push, the broadcasts of its groups, the pushes
+// of the other servers, see WrapRPCServer, and the shutdown message.
+func (c *Connector) push(s *session.Session, route string, payload []byte) error {
+	if c.sendBuffer > 0 {
+		return c.bufferPush(s, route, payload)
+	}
+	return c.pushDelivered(s, route, payload)
+}
+
+// pushDelivered sends payload to s after the pushes queued before it and waits until it is
+// delivered, the send buffer doesn't bound it
+func (c *Connector) pushDelivered(s *session.Session, route string, payload []byte) error {
+	if c.sendBuffer > 0 || c.ordered {
+		return <-c.pushQueue(s).enqueue(route, payload).done
+	}
+	return s.Push(route, payload)
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/session"
+
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+)
+
+// payloadEntity records the payloads pushed to the client
+type payloadEntity struct {
+	fakeEntity
+	payloads []string
+}
+
+func (p *payloadEntity) Push(route string, v interface{}) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.payloads = append(p.payloads, string(v.([]byte)))
+	return nil
+}
+
+func TestOrderedPushes(t *testing.T) {
+	const pushes = 1000
+	c := NewConnector(nil, WithOrderedPushes())
+	entity := &payloadEntity{}
+	s := session.New(entity, true, "uid1")
+	c.sessions = func(uid string) *session.Session { return s }
+
+	// the sequence numbers are the submission order, submitted[seq] is the push numbered seq
+	submitted := make([]string, pushes)
+	var wg sync.WaitGroup
+	for i := 0; i < pushes; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			payload := fmt.Sprintf("push-%d", i)
+			p := c.pushQueue(s).enqueue("onMessage", []byte(payload))
+			submitted[p.seq] = payload
+			if err := <-p.done; err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(entity.payloads) != pushes {
+		t.Fatalf("expected %d pushes, got %d", pushes, len(entity.payloads))
+	}
+	for seq, payload := range entity.payloads {
+		if payload != submitted[seq] {
+			t.Fatalf("push %d: expected %s, got %s", seq, submitted[seq], payload)
+		}
+	}
+
+	// pushes go through the queue of the session from Push too
+	for i := 0; i < pushes; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Push("uid1", "onMessage", []byte("hello")); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if q := c.pushQueue(s); q.next != 2*pushes || len(entity.payloads) != 2*pushes {
+		t.Fatalf("expected every push to be queued and delivered, got %d and %d", q.next, len(entity.payloads))
+	}
+
+	c.onSessionClose(s)
+	if len(c.queues) != 0 {
+		t.Fatal("the queue of a closed session should be dropped")
+	}
+}
+
+func TestOrderedPushesOfEveryPath(t *testing.T) {
+	const pushes = 100
+	c := NewConnector(nil, WithOrderedPushes(), WithShutdownKick("onServerGoingAway", []byte("bye")))
+	entity := &payloadEntity{}
+	s := session.New(entity, true, "uid1")
+	c.sessions = func(uid string) *session.Session { return s }
+	if err := c.trackSession(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+	g, err := c.Group(context.Background(), "room")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Add("uid1"); err != nil {
+		t.Fatal(err)
+	}
+	rpcServer := &fakeRPCServer{}
+	c.WrapRPCServer(rpcServer).SetPitayaServer(kickingPitayaServer{})
+
+	// the connector pushes, the broadcasts of its groups and the pushes of the other servers race
+	var wg sync.WaitGroup
+	for i := 0; i < pushes; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			if err := c.Push("uid1", "onMessage", []byte("push")); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := g.Broadcast(context.Background(), "onMessage", &protos.UserMessage{Name: "broadcast"}); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			push := &pitayaprotos.Push{Route: "onMessage", Uid: "uid1", Data: []byte("forwarded")}
+			if _, err := rpcServer.pitayaServer.PushToUser(context.Background(), push); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	q := c.pushQueue(s)
+	if q.next != 3*pushes || len(entity.payloads) != 3*pushes {
+		t.Fatalf("expected every push to be queued and delivered, got %d and %d", q.next, len(entity.payloads))
+	}
+
+	// the shutdown message is delivered after them
+	if err := c.GracefulShutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if q.next != 3*pushes+1 || entity.payloads[len(entity.payloads)-1] != "bye" {
+		t.Fatalf("expected the shutdown message to be queued last, got %d pushes", q.next)
+	}
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/topfreegames/pitaya/constants"
+	e "github.com/topfreegames/pitaya/errors"
+)
+
+// ErrSessionGone is returned when pushing to an uid whose session is not connected anymore
+var ErrSessionGone = errors.New("session is gone")
+
+// UndeliverableFunc receives the pushes that could not be delivered because the session of uid is gone
+// or because its send buffer overflowed, so they can be requeued or persisted
+type UndeliverableFunc func(uid, route string, payload []byte)
+
+// OnUndeliverable calls f for the pushes and the broadcasts of the connector to sessions that are gone
+func OnUndeliverable(f UndeliverableFunc) ConnectorOption {
+	return func(c *Connector) {
+		c.undeliverable = f
+	}
+}
+
+// Push sends payload, already serialized, to the session of uid connected to this frontend, see
+// WithOrderedPushes to deliver the pushes to a session in the order of the calls and WithSendBuffer
+// to bound the pushes waiting for a slow client
+func (c *Connector) Push(uid, route string, payload []byte) error {
+	s := c.sessions(uid)
+	if s == nil {
+		c.deadLetter(uid, route, payload)
+		return ErrSessionGone
+	}
+	err := c.push(s, route, payload)
+	if isSessionGone(err) {
+		c.deadLetter(uid, route, payload)
+		return ErrSessionGone
+	}
+	return err
+}
+
+func (c *Connector) deadLetter(uid, route string, payload []byte) {
+	if c.undeliverable != nil {
+		c.undeliverable(uid, route, payload)
+	}
+}
+
+// isSessionGone returns whether a push failed with err because the agent of the session is closed
+func isSessionGone(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == constants.ErrBrokenPipe || err == ErrSessionGone {
+		return true
+	}
+	// the agent wraps its errors keeping only the message
+	pitayaErr, ok := err.(*e.Error)
+	return ok && pitayaErr.Message == constants.ErrBrokenPipe.Error()
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/constants"
+	e "github.com/topfreegames/pitaya/errors"
+	"github.com/topfreegames/pitaya/session"
+)
+
+// closedEntity fails pushes like the agent of a closed session
+type closedEntity struct {
+	fakeEntity
+}
+
+func (c *closedEntity) Push(route string, v interface{}) error {
+	return e.NewError(constants.ErrBrokenPipe, e.ErrClientClosedRequest)
+}
+
+type deadLetter struct {
+	uid, route string
+	payload    []byte
+}
+
+func recordDeadLetters(letters *[]deadLetter) ConnectorOption {
+	return OnUndeliverable(func(uid, route string, payload []byte) {
+		*letters = append(*letters, deadLetter{uid, route, payload})
+	})
+}
+
+func TestPushToClosedSession(t *testing.T) {
+	var letters []deadLetter
+	c := NewConnector(nil, recordDeadLetters(&letters))
+	closed := session.New(&closedEntity{}, true)
+	c.sessions = func(uid string) *session.Session {
+		if uid == "uid1" {
+			return closed
+		}
+		return nil
+	}
+
+	if err := c.Push("uid1", "onMessage", []byte("hello")); err != ErrSessionGone {
+		t.Fatalf("expected ErrSessionGone, got %v", err)
+	}
+	expected := []deadLetter{{"uid1", "onMessage", []byte("hello")}}
+	if !reflect.DeepEqual(letters, expected) {
+		t.Fatalf("expected %v, got %v", expected, letters)
+	}
+
+	if err := c.Push("uid2", "onMessage", []byte("bye")); err != ErrSessionGone {
+		t.Fatalf("expected ErrSessionGone, got %v", err)
+	}
+	if len(letters) != 2 || letters[1].uid != "uid2" {
+		t.Fatalf("disconnected uids should be dead lettered, got %v", letters)
+	}
+}
+
+func TestPushDelivered(t *testing.T) {
+	var letters []deadLetter
+	c := NewConnector(nil, recordDeadLetters(&letters))
+	entity := &fakeEntity{}
+	c.sessions = func(uid string) *session.Session {
+		return session.New(entity, true)
+	}
+
+	if err := c.Push("uid1", "onMessage", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 0 || !reflect.DeepEqual(entity.pushes, []string{"onMessage"}) {
+		t.Fatalf("expected the push to be delivered, got %v and %v", entity.pushes, letters)
+	}
+}
+
+func TestBroadcastDeadLetters(t *testing.T) {
+	var letters []deadLetter
+	c := NewConnector(nil, recordDeadLetters(&letters))
+	alice := &fakeEntity{}
+	sessions := map[string]*session.Session{
+		"alice": session.New(alice, true),
+		"bob":   session.New(&closedEntity{}, true),
+	}
+	c.sessions = func(uid string) *session.Session {
+		return sessions[uid]
+	}
+
+	g, err := c.Group(context.Background(), "chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, uid := range []string{"alice", "bob", "carol"} {
+		if err := g.Add(uid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := g.Broadcast(context.Background(), "onMessage", &protos.Response{Msg: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(letters) != 2 || letters[0].uid != "bob" || letters[1].uid != "carol" {
+		t.Fatalf("expected bob and carol to be dead lettered, got %v", letters)
+	}
+	if len(alice.pushes) != 1 {
+		t.Fatalf("alice should receive the broadcast, got %v", alice.pushes)
+	}
+}
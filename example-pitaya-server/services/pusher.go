@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/topfreegames/pitaya"
+	"github.com/topfreegames/pitaya/constants"
+)
+
+// ErrSessionNotFound is returned when pushing to an uid not connected to this frontend
+var ErrSessionNotFound = errors.New("session not found")
+
+// ErrRouteTemplate is returned when a route template is malformed or misses an argument
+var ErrRouteTemplate = errors.New("invalid route template")
+
+// Pusher pushes proto messages to the sessions of a connector, encoded with the serializer each
+// session negotiated in its handshake
+type Pusher struct {
+	connector    *Connector
+	frontendType string
+	forward      func(uid, route string, data []byte, frontendType string) error
+}
+
+// PusherOption configures a Pusher
+type PusherOption func(p *Pusher)
+
+// ForwardPushes sends the pushes to the uids not connected locally to their frontend of
+// frontendType, instead of failing with ErrSessionNotFound. The frontend is found through the
+// binding storage, their messages are encoded with the default serializer of the route.
+func ForwardPushes(frontendType string) PusherOption {
+	return func(p *Pusher) {
+		p.frontendType = frontendType
+	}
+}
+
+// NewPusher returns a pusher to the sessions of connector
+func NewPusher(connector *Connector, opts ...PusherOption) *Pusher {
+	p := &Pusher{connector: connector, forward: forwardPush}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+func forwardPush(uid, route string, data []byte, frontendType string) error {
+	notPushed, err := pitaya.SendPushToUsers(route, data, []string{uid}, frontendType)
+	if err != nil {
+		return err
+	}
+	if len(notPushed) > 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// Push sends msg on route to the session of uid, see Connector.Push for the delivery guarantees
+func (p *Pusher) Push(ctx context.Context, uid, route string, msg proto.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s := p.connector.sessions(uid)
+	if s == nil {
+		if p.frontendType == "" {
+			return ErrSessionNotFound
+		}
+		data, err := p.marshal(context.Background(), route, msg)
+		if err != nil {
+			return err
+		}
+		return p.forward(uid, route, data, p.frontendType)
+	}
+	// the content type of the session is the one of the receiver, not the one of the caller
+	data, err := p.marshal(context.WithValue(context.Background(), constants.SessionCtxKey, s), route, msg)
+	if err != nil {
+		return err
+	}
+	return p.connector.Push(uid, route, data)
+}
+
+// PushTemplate sends msg to the session of uid on the route of template filled with args, see ExpandRoute
+func (p *Pusher) PushTemplate(ctx context.Context, uid, template string, args map[string]string, msg proto.Message) error {
+	route, err := ExpandRoute(template, args)
+	if err != nil {
+		return err
+	}
+	return p.Push(ctx, uid, route, msg)
+}
+
+func (p *Pusher) marshal(ctx context.Context, route string, msg proto.Message) ([]byte, error) {
+	serializer, err := p.connector.Serializer(ctx, route)
+	if err != nil {
+		return nil, err
+	}
+	return serializer.Marshal(msg)
+}
+
+// ExpandRoute replaces the {name} placeholders of template with args[name], so "room.{id}.update"
+// with an id of 42 is "room.42.update". The arguments cannot be empty nor contain dots or braces
+// so they never change the segments of the route.
+func ExpandRoute(template string, args map[string]string) (string, error) {
+	var b strings.Builder
+	for rest := template; rest != ""; {
+		open := strings.IndexAny(rest, "{}")
+		if open < 0 {
+			b.WriteString(rest)
+			break
+		}
+		if rest[open] == '}' {
+			return "", fmt.Errorf("%w: unexpected } in %s", ErrRouteTemplate, template)
+		}
+		b.WriteString(rest[:open])
+		rest = rest[open+1:]
+		end := strings.IndexAny(rest, "{}")
+		if end < 0 || rest[end] != '}' {
+			return "", fmt.Errorf("%w: unclosed { in %s", ErrRouteTemplate, template)
+		}
+		name := rest[:end]
+		value, ok := args[name]
+		if !ok {
+			return "", fmt.Errorf("%w: missing argument %q of %s", ErrRouteTemplate, name, template)
+		}
+		if value == "" || strings.ContainsAny(value, ".{}") {
+			return "", fmt.Errorf("%w: invalid argument %q of %s: %q", ErrRouteTemplate, name, template, value)
+		}
+		b.WriteString(value)
+		rest = rest[end+1:]
+	}
+	return b.String(), nil
+}
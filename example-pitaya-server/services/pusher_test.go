@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/session"
+)
+
+func TestPusherPushLocal(t *testing.T) {
+	c := NewConnector(nil)
+	jsonEntity, protoEntity := &payloadEntity{}, &payloadEntity{}
+	jsonSession := session.New(jsonEntity, true, "alice")
+	protoSession := session.New(protoEntity, true, "bob")
+	protoSession.SetHandshakeData(&session.HandshakeData{User: map[string]interface{}{ContentTypeKey: ContentTypeProtobuf}})
+	c.sessions = func(uid string) *session.Session {
+		return map[string]*session.Session{"alice": jsonSession, "bob": protoSession}[uid]
+	}
+	p := NewPusher(c)
+
+	msg := &protos.UserMessage{Name: "carol", Content: "hello"}
+	if err := p.Push(context.Background(), "alice", "onMessage", msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Push(context.Background(), "bob", "onMessage", msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(jsonEntity.payloads) != 1 || jsonEntity.payloads[0] != `{"Name":"carol","Content":"hello"}` {
+		t.Fatalf("expected a json push, got %v", jsonEntity.payloads)
+	}
+	var decoded protos.UserMessage
+	if len(protoEntity.payloads) != 1 || proto.Unmarshal([]byte(protoEntity.payloads[0]), &decoded) != nil || !proto.Equal(&decoded, msg) {
+		t.Fatalf("expected a protobuf push, got %v", protoEntity.payloads)
+	}
+}
+
+func TestPusherSessionNotFound(t *testing.T) {
+	c := NewConnector(nil)
+	c.sessions = func(uid string) *session.Session { return nil }
+	msg := &protos.UserMessage{Content: "hello"}
+
+	if err := NewPusher(c).Push(context.Background(), "alice", "onMessage", msg); err != ErrSessionNotFound {
+		t.Fatalf("expected ErrSessionNotFound, got %v", err)
+	}
+
+	var forwarded []deadLetter
+	p := NewPusher(c, ForwardPushes("connector"))
+	p.forward = func(uid, route string, data []byte, frontendType string) error {
+		if frontendType != "connector" {
+			t.Fatalf("expected the push to be forwarded to the connectors, got %s", frontendType)
+		}
+		forwarded = append(forwarded, deadLetter{uid, route, data})
+		return nil
+	}
+	if err := p.Push(context.Background(), "alice", "onMessage", msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(forwarded) != 1 || forwarded[0].uid != "alice" || string(forwarded[0].payload) != `{"Content":"hello"}` {
+		t.Fatalf("expected the push to be forwarded, got %v", forwarded)
+	}
+}
+
+func TestExpandRoute(t *testing.T) {
+	tables := []struct {
+		template string
+		args     map[string]string
+		route    string
+	}{
+		{"room.{id}.update", map[string]string{"id": "42"}, "room.42.update"},
+		{"{kind}.{id}", map[string]string{"kind": "room", "id": "42"}, "room.42"},
+		{"onMessage", nil, "onMessage"},
+	}
+	for _, table := range tables {
+		route, err := ExpandRoute(table.template, table.args)
+		if err != nil || route != table.route {
+			t.Errorf("expected %s to expand to %s, got %s %v", table.template, table.route, route, err)
+		}
+	}
+
+	invalid := []struct {
+		template string
+		args     map[string]string
+	}{
+		{"room.{id}.update", nil},
+		{"room.{id}.update", map[string]string{"id": "4.2"}},
+		{"room.{id}.update", map[string]string{"id": ""}},
+		{"room.{id.update", map[string]string{"id": "42"}},
+		{"room.id}.update", nil},
+	}
+	for _, table := range invalid {
+		if _, err := ExpandRoute(table.template, table.args); !errors.Is(err, ErrRouteTemplate) {
+			t.Errorf("expected %s with %v to be rejected, got %v", table.template, table.args, err)
+		}
+	}
+}
+
+func TestPusherPushTemplate(t *testing.T) {
+	c := NewConnector(nil)
+	entity := &fakeEntity{}
+	c.sessions = func(uid string) *session.Session { return session.New(entity, true, uid) }
+	p := NewPusher(c)
+
+	if err := p.PushTemplate(context.Background(), "alice", "room.{id}.update", map[string]string{"id": "42"}, &protos.UserMessage{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(entity.pushes) != 1 || entity.pushes[0] != "room.42.update" {
+		t.Fatalf("expected a push on room.42.update, got %v", entity.pushes)
+	}
+	if err := p.PushTemplate(context.Background(), "alice", "room.{id}.update", nil, &protos.UserMessage{}); !errors.Is(err, ErrRouteTemplate) {
+		t.Fatalf("expected ErrRouteTemplate, got %v", err)
+	}
+}
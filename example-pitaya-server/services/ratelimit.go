@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+	e "github.com/topfreegames/pitaya/errors"
+	"github.com/topfreegames/pitaya/session"
+)
+
+// ErrRateLimitedCode is the pitaya error code returned to callers that exceeded a rate limit
+const ErrRateLimitedCode = "PIT-429"
+
+// RateLimitRule is a token bucket refilled at Rate tokens per second holding up to Burst tokens
+type RateLimitRule struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimitOptions configures a RateLimiter
+type RateLimitOptions struct {
+	// Default is the rule applied to routes without an override, a zero rule disables limiting
+	Default RateLimitRule
+	// Routes overrides the default rule per route
+	Routes map[string]RateLimitRule
+	// Key returns the bucket key of a call, DefaultRateLimitKey is used when nil
+	Key func(ctx context.Context) string
+}
+
+// RateLimitError is returned when a call exceeded its rate limit
+type RateLimitError struct {
+	Route      string
+	Key        string
+	RetryAfter time.Duration
+}
+
+func (r *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded for route %s, retry after %s", r.Route, r.RetryAfter)
+}
+
+// PitayaError converts the error so its fields reach the caller on the wire
+func (r *RateLimitError) PitayaError() *e.Error {
+	return e.NewError(r, ErrRateLimitedCode, map[string]string{
+		"route":      r.Route,
+		"retryAfter": strconv.FormatInt(int64(r.RetryAfter/time.Millisecond), 10),
+	})
+}
+
+// BucketState is a snapshot of a token bucket, meant to be exported as metrics
+type BucketState struct {
+	Route    string
+	Key      string
+	Tokens   float64
+	Capacity int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	rule   RateLimitRule
+}
+
+// refill adds the tokens earned since the last refill, capped at the burst
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(float64(b.rule.Burst), b.tokens+elapsed*b.rule.Rate)
+	b.last = now
+}
+
+type bucketKey struct {
+	route string
+	key   string
+}
+
+// RateLimiter limits calls per route and per caller using token buckets
+type RateLimiter struct {
+	mutex     sync.Mutex
+	opts      RateLimitOptions
+	buckets   map[bucketKey]*bucket
+	lastSweep time.Time
+	clock     Clock
+}
+
+// RateLimit returns a new rate limiter, it can be used as a handler pipeline
+// with pitaya.BeforeHandler and given to remotes with WithRateLimiter
+func RateLimit(opts RateLimitOptions) *RateLimiter {
+	if opts.Key == nil {
+		opts.Key = DefaultRateLimitKey
+	}
+	return &RateLimiter{
+		opts:    opts,
+		buckets: make(map[bucketKey]*bucket),
+		clock:   RealClock,
+	}
+}
+
+// DefaultRateLimitKey keys buckets by session uid, falling back to the client ip. The rpcs are keyed
+// by the uid that originated them, so the users behind one server don't share a bucket, and then
+// by the server that made them.
+func DefaultRateLimitKey(ctx context.Context) string {
+	if s, ok := ctx.Value(constants.SessionCtxKey).(*session.Session); ok && s != nil {
+		if uid := s.UID(); uid != "" {
+			return "uid:" + uid
+		}
+		if addr := s.RemoteAddr(); addr != nil {
+			if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+				return "ip:" + host
+			}
+			return "ip:" + addr.String()
+		}
+	}
+	if uid := requestUID(ctx); uid != "" {
+		return "uid:" + uid
+	}
+	if peer, ok := pcontext.GetFromPropagateCtx(ctx, constants.PeerIDKey).(string); ok {
+		return "server:" + peer
+	}
+	return ""
+}
+
+func (r *RateLimiter) rule(route string) RateLimitRule {
+	if rule, ok := r.opts.Routes[route]; ok {
+		return rule
+	}
+	return r.opts.Default
+}
+
+// Allow takes a token from the bucket of the call, it returns a *RateLimitError when it is empty
+func (r *RateLimiter) Allow(ctx context.Context, route string) error {
+	rule := r.rule(route)
+	if rule.Rate <= 0 || rule.Burst <= 0 {
+		return nil
+	}
+	key := bucketKey{route: route, key: r.opts.Key(ctx)}
+	now := r.clock.Now()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.sweep(now)
+	b, ok := r.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Burst), last: now, rule: rule}
+		r.buckets[key] = b
+	}
+	b.refill(now)
+
+	if b.tokens < 1 {
+		missing := 1 - b.tokens
+		return &RateLimitError{
+			Route:      route,
+			Key:        key.key,
+			RetryAfter: time.Duration(math.Ceil(missing / rule.Rate * float64(time.Second))),
+		}
+	}
+	b.tokens--
+	return nil
+}
+
+// sweep drops the buckets that are full again, they behave exactly like new ones
+func (r *RateLimiter) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < time.Minute {
+		return
+	}
+	r.lastSweep = now
+	for key, b := range r.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.rule.Burst) {
+			delete(r.buckets, key)
+		}
+	}
+}
+
+// limit is like Allow but returns an error ready to be sent to the caller
+func (r *RateLimiter) limit(ctx context.Context, route string) error {
+	if err := r.Allow(ctx, route); err != nil {
+		return err.(*RateLimitError).PitayaError()
+	}
+	return nil
+}
+
+// BeforeHandler is a pitaya handler pipeline limiting the route being handled
+func (r *RateLimiter) BeforeHandler(ctx context.Context, in interface{}) (interface{}, error) {
+	route, _ := pcontext.GetFromPropagateCtx(ctx, constants.RouteKey).(string)
+	if err := r.limit(ctx, route); err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+// Buckets returns the state of the active buckets
+func (r *RateLimiter) Buckets() []BucketState {
+	now := r.clock.Now()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	states := make([]BucketState, 0, len(r.buckets))
+	for key, b := range r.buckets {
+		b.refill(now)
+		states = append(states, BucketState{
+			Route:    key.route,
+			Key:      key.key,
+			Tokens:   b.tokens,
+			Capacity: b.rule.Burst,
+		})
+	}
+	return states
+}
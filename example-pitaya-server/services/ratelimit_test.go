@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+	e "github.com/topfreegames/pitaya/errors"
+)
+
+func newTestLimiter(clock *fakeClock) *RateLimiter {
+	limiter := RateLimit(RateLimitOptions{
+		Default: RateLimitRule{Rate: 100, Burst: 100},
+		Routes: map[string]RateLimitRule{
+			RemoteFuncRoute: {Rate: 10, Burst: 5},
+		},
+		Key: func(ctx context.Context) string { return "client" },
+	})
+	limiter.clock = clock
+	return limiter
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	clock := newFakeClock()
+	limiter := newTestLimiter(clock)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if err := limiter.Allow(ctx, RemoteFuncRoute); err != nil {
+			t.Fatalf("call %d should be allowed: %s", i, err)
+		}
+	}
+
+	err := limiter.Allow(ctx, RemoteFuncRoute)
+	var rlErr *RateLimitError
+	if !errors.As(err, &rlErr) {
+		t.Fatalf("expected a RateLimitError, got %v", err)
+	}
+	if rlErr.RetryAfter != 100*time.Millisecond {
+		t.Fatalf("expected to retry after 100ms, got %s", rlErr.RetryAfter)
+	}
+
+	// other routes have their own buckets
+	if err := limiter.Allow(ctx, "room.room.join"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	clock := newFakeClock()
+	limiter := newTestLimiter(clock)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		limiter.Allow(ctx, RemoteFuncRoute)
+	}
+
+	clock.Advance(99 * time.Millisecond)
+	if err := limiter.Allow(ctx, RemoteFuncRoute); err == nil {
+		t.Fatal("a token should not be available before 100ms")
+	}
+
+	clock.Advance(time.Millisecond)
+	if err := limiter.Allow(ctx, RemoteFuncRoute); err != nil {
+		t.Fatalf("a token should be available after 100ms: %s", err)
+	}
+
+	clock.Advance(time.Hour)
+	buckets := limiter.Buckets()
+	if len(buckets) != 1 || buckets[0].Tokens != 5 || buckets[0].Capacity != 5 {
+		t.Fatalf("bucket should refill up to its capacity, got %+v", buckets)
+	}
+}
+
+func TestRateLimiterHandlerPipeline(t *testing.T) {
+	clock := newFakeClock()
+	limiter := RateLimit(RateLimitOptions{Default: RateLimitRule{Rate: 1, Burst: 1}})
+	limiter.clock = clock
+
+	ctx := pcontext.AddToPropagateCtx(context.Background(), constants.RouteKey, "room.room.join")
+	ctx = pcontext.AddToPropagateCtx(ctx, constants.PeerIDKey, "connector-1")
+	if _, err := limiter.BeforeHandler(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := limiter.BeforeHandler(ctx, nil)
+	pitayaErr, ok := err.(*e.Error)
+	if !ok || pitayaErr.Code != ErrRateLimitedCode || pitayaErr.Metadata["retryAfter"] != "1000" {
+		t.Fatalf("expected a rate limited pitaya error, got %#v", err)
+	}
+}
+
+func TestRateLimitKeyOfRPCs(t *testing.T) {
+	clock := newFakeClock()
+	limiter := RateLimit(RateLimitOptions{Default: RateLimitRule{Rate: 1, Burst: 1}})
+	limiter.clock = clock
+
+	// the rpcs of two users come from the same connector, the propagated values are shared by the
+	// contexts derived from one another
+	rpc := func(uid string) context.Context {
+		ctx := pcontext.AddToPropagateCtx(context.Background(), constants.PeerIDKey, "connector-1")
+		if uid != "" {
+			ctx = pcontext.AddToPropagateCtx(ctx, UIDKey, uid)
+		}
+		return ctx
+	}
+	first, second, server := rpc("player-1"), rpc("player-2"), rpc("")
+	if key := DefaultRateLimitKey(first); key != "uid:player-1" {
+		t.Fatalf("expected the rpc to be keyed by its uid, got %s", key)
+	}
+	if err := limiter.Allow(first, RemoteFuncRoute); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.Allow(first, RemoteFuncRoute); err == nil {
+		t.Fatal("the second call of the user should be limited")
+	}
+	if err := limiter.Allow(second, RemoteFuncRoute); err != nil {
+		t.Fatalf("the other user should have its own bucket: %s", err)
+	}
+	if key := DefaultRateLimitKey(server); key != "server:connector-1" {
+		t.Fatalf("expected the rpc without uid to be keyed by its server, got %s", key)
+	}
+}
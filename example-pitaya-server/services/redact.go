@@ -0,0 +1,156 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Redacted replaces the sensitive values of the session data when they are logged or shown
+const Redacted = "***"
+
+// DefaultSensitiveKeys are the session data keys redacted when no other keys are configured
+var DefaultSensitiveKeys = []string{"token"}
+
+// defaultRedactor redacts the session data formatted without a configured Redactor
+var defaultRedactor = NewRedactor(DefaultSensitiveKeys...)
+
+// Sensitive wraps a session data value that must never be logged whatever its key, it is
+// serialized as the value it wraps
+type Sensitive struct {
+	Value interface{}
+}
+
+func (s Sensitive) String() string {
+	return Redacted
+}
+
+// GoString redacts the value from the %#v format
+func (s Sensitive) GoString() string {
+	return Redacted
+}
+
+// MarshalJSON encodes the wrapped value, so the sessions keep it when persisted
+func (s Sensitive) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Value)
+}
+
+// Redactor redacts the values of the sensitive keys of the session data and the Sensitive values
+type Redactor struct {
+	keys map[string]bool
+}
+
+// NewRedactor returns a redactor of the session data under keys
+func NewRedactor(keys ...string) *Redactor {
+	r := &Redactor{keys: make(map[string]bool, len(keys))}
+	for _, key := range keys {
+		if key != "" {
+			r.keys[key] = true
+		}
+	}
+	return r
+}
+
+// WithRedactor redacts the session data the connector logs and the admin remotes answer with r,
+// the DefaultSensitiveKeys are redacted otherwise
+func WithRedactor(r *Redactor) ConnectorOption {
+	return func(c *Connector) {
+		c.redactor = r
+	}
+}
+
+// Sensitive returns whether the value of key or value itself must be redacted
+func (r *Redactor) Sensitive(key string, value interface{}) bool {
+	if _, ok := value.(Sensitive); ok {
+		return true
+	}
+	return r.keys[key]
+}
+
+// Redact returns a copy of data whose sensitive values are Redacted
+func (r *Redactor) Redact(data map[string]interface{}) map[string]interface{} {
+	if data == nil {
+		return nil
+	}
+	redacted := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		if r.Sensitive(k, v) {
+			redacted[k] = Redacted
+			continue
+		}
+		redacted[k] = v
+	}
+	return redacted
+}
+
+// redactKeyvals returns a copy of keyvals where the values of the sensitive keys, the Sensitive
+// values and the sensitive values of the session data are redacted
+func (r *Redactor) redactKeyvals(keyvals []interface{}) []interface{} {
+	redacted := make([]interface{}, len(keyvals))
+	for i, v := range keyvals {
+		if i%2 == 1 {
+			if key, ok := keyvals[i-1].(string); ok && r.Sensitive(key, v) {
+				redacted[i] = Redacted
+				continue
+			}
+		}
+		switch v := v.(type) {
+		case Sensitive:
+			redacted[i] = Redacted
+		case SessionData:
+			redacted[i] = r.Redact(v.Data)
+		case *SessionData:
+			if v != nil {
+				redacted[i] = r.Redact(v.Data)
+			}
+		case map[string]interface{}:
+			redacted[i] = r.Redact(v)
+		default:
+			redacted[i] = v
+		}
+	}
+	return redacted
+}
+
+// Logger returns l redacting the keyvals it is given, the keys are the session data keys
+func (r *Redactor) Logger(l Logger) Logger {
+	if rl, ok := l.(*redactingLogger); ok && rl.redactor == r {
+		return l
+	}
+	return &redactingLogger{logger: l, redactor: r}
+}
+
+type redactingLogger struct {
+	logger   Logger
+	redactor *Redactor
+}
+
+func (l *redactingLogger) Debug(msg string, keyvals ...interface{}) {
+	l.logger.Debug(msg, l.redactor.redactKeyvals(keyvals)...)
+}
+
+func (l *redactingLogger) Info(msg string, keyvals ...interface{}) {
+	l.logger.Info(msg, l.redactor.redactKeyvals(keyvals)...)
+}
+
+func (l *redactingLogger) Warn(msg string, keyvals ...interface{}) {
+	l.logger.Warn(msg, l.redactor.redactKeyvals(keyvals)...)
+}
+
+func (l *redactingLogger) Error(msg string, keyvals ...interface{}) {
+	l.logger.Error(msg, l.redactor.redactKeyvals(keyvals)...)
+}
+
+func (l *redactingLogger) With(keyvals ...interface{}) Logger {
+	return &redactingLogger{logger: l.logger.With(l.redactor.redactKeyvals(keyvals)...), redactor: l.redactor}
+}
+
+// String formats the data with the DefaultSensitiveKeys and the Sensitive values redacted, so the
+// errors and the logs echoing it don't leak them
+func (d SessionData) String() string {
+	return fmt.Sprint(defaultRedactor.Redact(d.Data))
+}
+
+// GoString redacts the data of the %#v format like String
+func (d SessionData) GoString() string {
+	return fmt.Sprintf("services.SessionData{Data:%#v}", defaultRedactor.Redact(d.Data))
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRedactLogger(t *testing.T) {
+	recorder := newRecordingLogger()
+	logger := NewRedactor("token").Logger(recorder)
+
+	data := SessionData{Data: map[string]interface{}{
+		"token": "eyJhbGciOi",
+		"email": Sensitive{"player@example.com"},
+		"level": 3,
+		"guild": "red",
+	}}
+	logger.With("session", data).Info("session restored", "token", "eyJhbGciOi", "uid", "player-1")
+
+	entry := recorder.last()
+	logged, ok := entry.keyvals["session"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected the logged session data, got %v", entry.keyvals["session"])
+	}
+	if logged["token"] != Redacted || logged["email"] != Redacted {
+		t.Fatalf("expected the token and the sensitive email to be redacted, got %v", logged)
+	}
+	if logged["level"] != 3 || logged["guild"] != "red" {
+		t.Fatalf("expected the other keys to be kept, got %v", logged)
+	}
+	if entry.keyvals["token"] != Redacted || entry.keyvals["uid"] != "player-1" {
+		t.Fatalf("expected only the token keyval to be redacted, got %v", entry.keyvals)
+	}
+	if data.Data["token"] != "eyJhbGciOi" {
+		t.Fatalf("expected the session data to be left untouched, got %v", data.Data)
+	}
+}
+
+func TestSessionDataFormatRedacted(t *testing.T) {
+	data := SessionData{Data: map[string]interface{}{
+		"token":    "eyJhbGciOi",
+		"password": Sensitive{"hunter2"},
+		"level":    3,
+	}}
+	err := fmt.Errorf("failed to persist %v", data)
+	for _, formatted := range []string{err.Error(), fmt.Sprintf("%+v", data), fmt.Sprintf("%#v", data)} {
+		if strings.Contains(formatted, "eyJhbGciOi") || strings.Contains(formatted, "hunter2") {
+			t.Fatalf("expected the sensitive values to be redacted, got %s", formatted)
+		}
+		if !strings.Contains(formatted, "level") {
+			t.Fatalf("expected the other keys to be kept, got %s", formatted)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	nats "github.com/nats-io/nats.go"
+	"github.com/topfreegames/pitaya/constants"
+	e "github.com/topfreegames/pitaya/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RemoteFuncRoute is the route of ConnectorRemote.RemoteFunc
+const RemoteFuncRoute = "connector.connectorremote.remotefunc"
+
+var (
+	// ErrRPCTimeout is returned when the remote server did not answer in time
+	ErrRPCTimeout = errors.New("rpc timed out")
+	// ErrRemoteNotFound is returned when there is no server or remote able to handle the route
+	ErrRemoteNotFound = errors.New("remote not found")
+)
+
+// RPCFunc sends a rpc to serverID, or to any server of the route type when serverID is empty.
+// pitaya.RPCTo satisfies it.
+type RPCFunc func(ctx context.Context, serverID, routeStr string, reply proto.Message, arg proto.Message) error
+
+// RPCError is returned by RemoteClient when a call fails.
+// Err is either ErrRPCTimeout, ErrRemoteNotFound, a *RouteNotFoundError, a *MessageTooLargeError,
+// an error matching ErrCircuitOpen or the *PitayaError answered by the remote.
+type RPCError struct {
+	Route string
+	Err   error
+	// Attempts is the number of calls made, more than one when retried
+	Attempts int
+}
+
+func (r *RPCError) Error() string {
+	return fmt.Sprintf("rpc to %s failed: %s", r.Route, r.Err.Error())
+}
+
+// Unwrap returns the underlying error
+func (r *RPCError) Unwrap() error {
+	return r.Err
+}
+
+// RemoteClient calls the connector remotes from other servers
+type RemoteClient struct {
+	rpc    RPCFunc
+	retry  RetryPolicy
+	router Router
+	notify NotifyPolicy
+	clock  Clock
+}
+
+// NewRemoteClient returns a new remote client that sends rpcs with rpc, usually pitaya.RPCTo.
+// Calls are not retried unless WithRetryPolicy is given.
+func NewRemoteClient(rpc RPCFunc, opts ...RemoteClientOption) *RemoteClient {
+	r := &RemoteClient{
+		rpc:    rpc,
+		notify: DefaultNotifyPolicy,
+		clock:  RealClock,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// CallRemoteFunc calls ConnectorRemote.RemoteFunc in any connector
+func (r *RemoteClient) CallRemoteFunc(ctx context.Context, req *protos.RPCMsg) (*protos.Response, error) {
+	res := &protos.Response{}
+	if err := r.call(ctx, "", RemoteFuncRoute, res, req); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (r *RemoteClient) call(ctx context.Context, serverID, route string, reply, arg proto.Message) error {
+	ctx = r.context(ctx)
+	serverID, err := r.route(ctx, serverID, route)
+	if err != nil {
+		return err
+	}
+	return r.send(ctx, serverID, route, reply, arg)
+}
+
+// context returns the ctx propagated to the remotes
+func (r *RemoteClient) context(ctx context.Context) context.Context {
+	return WithContentType(propagateRequest(ctx), ContentTypeProtobuf)
+}
+
+// route returns the server handling the call to route, serverID when given
+func (r *RemoteClient) route(ctx context.Context, serverID, route string) (string, error) {
+	if serverID != "" || r.router == nil {
+		return serverID, nil
+	}
+	routed, err := r.router.Route(ctx, route)
+	if err != nil {
+		return "", &RPCError{Route: route, Err: err}
+	}
+	return routed, nil
+}
+
+// send sends the rpc to serverID, retrying it according to the retry policy
+func (r *RemoteClient) send(ctx context.Context, serverID, route string, reply, arg proto.Message) error {
+	for attempt := 1; ; attempt++ {
+		err := r.rpc(ctx, serverID, route, reply, arg)
+		if err == nil {
+			return nil
+		}
+		err = classifyRPCError(err)
+		if !r.retry.wait(ctx, r.clock, attempt, err) {
+			return &RPCError{
+				Route:    route,
+				Err:      err,
+				Attempts: attempt,
+			}
+		}
+	}
+}
+
+// classifyRPCError maps the errors pitaya returns for timeouts and missing remotes to typed errors,
+// the timeouts are the ones of both the nats and the grpc rpc clients
+func classifyRPCError(err error) error {
+	switch {
+	case err == nats.ErrTimeout, errors.Is(err, context.DeadlineExceeded), status.Code(err) == codes.DeadlineExceeded:
+		return ErrRPCTimeout
+	case err == constants.ErrServerNotFound, err == constants.ErrNoServersAvailableOfType:
+		return ErrRemoteNotFound
+	}
+
+	if pitayaErr, ok := err.(*e.Error); ok {
+		if pitayaErr.Code == ErrDeadlineExceededCode {
+			return ErrRPCTimeout
+		}
+		if pitayaErr.Code == ErrMessageTooLargeCode {
+			return messageTooLarge(pitayaErr.Metadata)
+		}
+		if route, ok := pitayaErr.Metadata["route"]; ok && pitayaErr.Code == e.ErrNotFoundCode {
+			return &RouteNotFoundError{Route: route}
+		}
+		// the router wraps its errors keeping only the message
+		if pitayaErr.Code == e.ErrNotFoundCode || pitayaErr.Message == constants.ErrNoServersAvailableOfType.Error() {
+			return ErrRemoteNotFound
+		}
+		return fromPitayaError(pitayaErr)
+	}
+	return err
+}
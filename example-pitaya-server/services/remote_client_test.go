@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	nats "github.com/nats-io/nats.go"
+	"github.com/topfreegames/pitaya/cluster"
+	"github.com/topfreegames/pitaya/component"
+	"github.com/topfreegames/pitaya/conn/message"
+	"github.com/topfreegames/pitaya/constants"
+	e "github.com/topfreegames/pitaya/errors"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/route"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// loopbackRPC delivers the rpc to an in-process ConnectorRemote the same way pitaya would
+func loopbackRPC(remote *ConnectorRemote) RPCFunc {
+	return func(ctx context.Context, serverID, routeStr string, reply, arg proto.Message) error {
+		if routeStr != RemoteFuncRoute {
+			return e.NewError(errors.New("route not found"), e.ErrNotFoundCode)
+		}
+		data, err := proto.Marshal(arg)
+		if err != nil {
+			return err
+		}
+		res, err := remote.RemoteFunc(ctx, data)
+		if err != nil {
+			return err
+		}
+		data, err = proto.Marshal(res)
+		if err != nil {
+			return err
+		}
+		return proto.Unmarshal(data, reply)
+	}
+}
+
+func TestRemoteClientCallRemoteFunc(t *testing.T) {
+	client := NewRemoteClient(loopbackRPC(&ConnectorRemote{}))
+
+	res, err := client.CallRemoteFunc(context.Background(), &protos.RPCMsg{Msg: "ping"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Code != 200 || res.Msg != "ping" {
+		t.Fatalf("unexpected response: %v", res)
+	}
+}
+
+func TestRemoteClientTypedErrors(t *testing.T) {
+	tables := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{"nats timeout", nats.ErrTimeout, ErrRPCTimeout},
+		{"ctx deadline", context.DeadlineExceeded, ErrRPCTimeout},
+		{"grpc deadline", status.Error(codes.DeadlineExceeded, "context deadline exceeded"), ErrRPCTimeout},
+		{"server not found", constants.ErrServerNotFound, ErrRemoteNotFound},
+		{"route not found", e.NewError(errors.New("route not found"), e.ErrNotFoundCode), ErrRemoteNotFound},
+		{"no servers of type", e.NewError(constants.ErrNoServersAvailableOfType, e.ErrInternalCode), ErrRemoteNotFound},
+		{"message too large", (&MessageTooLargeError{Size: 2, Max: 1}).PitayaError(), ErrMessageTooLarge},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			client := NewRemoteClient(func(context.Context, string, string, proto.Message, proto.Message) error {
+				return table.err
+			})
+			_, err := client.CallRemoteFunc(context.Background(), &protos.RPCMsg{})
+			if !errors.Is(err, table.expected) {
+				t.Fatalf("expected %v, got %v", table.expected, err)
+			}
+			var rpcErr *RPCError
+			if !errors.As(err, &rpcErr) || rpcErr.Route != RemoteFuncRoute {
+				t.Fatalf("expected a RPCError for %s, got %v", RemoteFuncRoute, err)
+			}
+		})
+	}
+
+	businessErr := e.NewError(errors.New("invalid room"), "ROOM-001")
+	client := NewRemoteClient(func(context.Context, string, string, proto.Message, proto.Message) error {
+		return businessErr
+	})
+	_, err := client.CallRemoteFunc(context.Background(), &protos.RPCMsg{})
+	if !errors.Is(err, businessErr) {
+		t.Fatalf("remote errors should be kept, got %v", err)
+	}
+}
+
+// slowRemote answers once released
+type slowRemote struct {
+	component.Base
+	released chan struct{}
+}
+
+func (s *slowRemote) Slow(ctx context.Context, message []byte) (*protos.Response, error) {
+	<-s.released
+	return &protos.Response{Code: 200}, nil
+}
+
+// clusterRPC sends the rpcs with client to the servers like pitaya.RPCTo
+func clusterRPC(client cluster.RPCClient, servers map[string]*cluster.Server) RPCFunc {
+	return func(ctx context.Context, serverID, routeStr string, reply, arg proto.Message) error {
+		server, ok := servers[serverID]
+		if !ok {
+			return constants.ErrServerNotFound
+		}
+		rt, err := route.Decode(routeStr)
+		if err != nil {
+			return err
+		}
+		data, err := proto.Marshal(arg)
+		if err != nil {
+			return err
+		}
+		res, err := client.Call(ctx, pitayaprotos.RPCType_User, rt, nil, &message.Message{Type: message.Request, Data: data}, server)
+		if err != nil {
+			return err
+		}
+		return proto.Unmarshal(res.Data, reply)
+	}
+}
+
+func TestRemoteClientAcrossServers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remoteclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newTestCA(t, "cluster ca")
+
+	// the connector serves RemoteFunc and a remote that doesn't answer in time over grpc
+	slow := &slowRemote{released: make(chan struct{})}
+	routes := newTestRoutes()
+	if err := routes.HandleRemote("connectorremote.remotefunc", &ConnectorRemote{}, "RemoteFunc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := routes.HandleRemote("connectorremote.slow", slow, "Slow"); err != nil {
+		t.Fatal(err)
+	}
+	server := NewTLSGRPCServer("127.0.0.1:0", newClusterTLS(t, ca.writeCert(t, dir, "connector")))
+	routes.WrapRPCServer(server).SetPitayaServer(&countingPitayaServer{})
+	if err := server.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Shutdown()
+	// released before the graceful shutdown waits for it
+	defer close(slow.released)
+
+	// the room calls it with the client of its own server
+	host, port, _ := net.SplitHostPort(server.Addr())
+	connector := &cluster.Server{ID: "connector-1", Type: "connector", Frontend: true, Metadata: map[string]string{
+		constants.GRPCHostKey: host,
+		constants.GRPCPortKey: port,
+	}}
+	rpcClient := NewTLSGRPCClient(&cluster.Server{ID: "room-1", Type: "room"}, newClusterTLS(t, ca.writeCert(t, dir, "room")), 200*time.Millisecond, nil)
+	defer rpcClient.Shutdown()
+	rpcClient.AddServer(connector)
+	client := NewRemoteClient(clusterRPC(rpcClient, map[string]*cluster.Server{connector.ID: connector}))
+
+	t.Run("call", func(t *testing.T) {
+		res := &protos.Response{}
+		if err := client.call(context.Background(), connector.ID, RemoteFuncRoute, res, &protos.RPCMsg{Msg: "ping"}); err != nil {
+			t.Fatal(err)
+		}
+		if res.Code != 200 || res.Msg != "ping" {
+			t.Fatalf("unexpected response: %v", res)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		err := client.call(context.Background(), connector.ID, "connector.connectorremote.slow", &protos.Response{}, &protos.RPCMsg{})
+		if !errors.Is(err, ErrRPCTimeout) {
+			t.Fatalf("expected the grpc deadline to be a timeout, got %v", err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		err := client.call(context.Background(), "connector-2", RemoteFuncRoute, &protos.Response{}, &protos.RPCMsg{})
+		if !errors.Is(err, ErrRemoteNotFound) {
+			t.Fatalf("expected the unknown server to be not found, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	pcontext "github.com/topfreegames/pitaya/context"
+)
+
+// RequestCacheKey is the propagated context key identifying the cache of the remote running
+const RequestCacheKey = "requestCache"
+
+type requestCacheKey struct{}
+
+// requestCaches are the caches of the remotes running in RequestScope by id. The remotes get the
+// context rebuilt from the propagated one, which only carries the id.
+var requestCaches = struct {
+	mutex  sync.Mutex
+	caches map[string]*Cache
+}{caches: make(map[string]*Cache)}
+
+// Cache memoizes the values computed during one request, see RequestCache
+type Cache struct {
+	mutex   sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+// cacheEntry is a value computed once, done is closed when it is
+type cacheEntry struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+func newCache() *Cache {
+	return &Cache{entries: make(map[string]*cacheEntry)}
+}
+
+// WithRequestCache returns a ctx carrying a new request cache, for the handlers that don't run in
+// RequestScope. The cache is not propagated to the servers called with ctx.
+func WithRequestCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestCacheKey{}, newCache())
+}
+
+// RequestCache returns the cache of the request in ctx. Without one, as outside of RequestScope,
+// the cache returned memoizes nothing.
+func RequestCache(ctx context.Context) *Cache {
+	if c, ok := ctx.Value(requestCacheKey{}).(*Cache); ok {
+		return c
+	}
+	id, _ := pcontext.GetFromPropagateCtx(ctx, RequestCacheKey).(string)
+	if id == "" {
+		return nil
+	}
+	requestCaches.mutex.Lock()
+	defer requestCaches.mutex.Unlock()
+	return requestCaches.caches[id]
+}
+
+// GetOrCompute returns the value of key, calling compute when it was not computed yet during the
+// request. Concurrent calls for a key wait for the first one. Errors are not memoized: the calls
+// waiting for a compute failing get its error and the next call computes key again.
+func (c *Cache) GetOrCompute(key string, compute func() (interface{}, error)) (interface{}, error) {
+	if c == nil {
+		return compute()
+	}
+	c.mutex.Lock()
+	if entry, ok := c.entries[key]; ok {
+		c.mutex.Unlock()
+		<-entry.done
+		return entry.value, entry.err
+	}
+	entry := &cacheEntry{done: make(chan struct{})}
+	c.entries[key] = entry
+	c.mutex.Unlock()
+
+	defer close(entry.done)
+	entry.value, entry.err = compute()
+	if entry.err != nil {
+		c.mutex.Lock()
+		if c.entries[key] == entry {
+			delete(c.entries, key)
+		}
+		c.mutex.Unlock()
+	}
+	return entry.value, entry.err
+}
+
+// clear forgets every value, the computes still running are not memoized
+func (c *Cache) clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = make(map[string]*cacheEntry)
+}
+
+// RequestScope returns a middleware giving every remote its own request cache, discarded when the
+// remote returns. The servers called by the remote don't share it.
+func RequestScope() MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, in []byte) ([]byte, error) {
+			id := uuid.New().String()
+			c := newCache()
+			requestCaches.mutex.Lock()
+			requestCaches.caches[id] = c
+			requestCaches.mutex.Unlock()
+			defer func() {
+				requestCaches.mutex.Lock()
+				delete(requestCaches.caches, id)
+				requestCaches.mutex.Unlock()
+				c.clear()
+			}()
+			return next(pcontext.AddToPropagateCtx(ctx, RequestCacheKey, id), in)
+		}
+	}
+}
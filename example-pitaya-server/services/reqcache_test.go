@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	pcontext "github.com/topfreegames/pitaya/context"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+)
+
+// cachingPitayaServer is a remote that rebuilds its context from the metadata like pitaya and
+// calls f with it
+type cachingPitayaServer struct {
+	pitayaprotos.PitayaServer
+	f func(ctx context.Context)
+}
+
+func (s *cachingPitayaServer) Call(ctx context.Context, req *pitayaprotos.Request) (*pitayaprotos.Response, error) {
+	ctx, err := pcontext.Decode(req.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	s.f(ctx)
+	return &pitayaprotos.Response{}, nil
+}
+
+func callInRequestScope(t *testing.T, f func(ctx context.Context)) {
+	t.Helper()
+	rpcServer := &fakeRPCServer{}
+	NewPipeline(RequestScope()).WrapRPCServer(rpcServer).SetPitayaServer(&cachingPitayaServer{f: f})
+	res, err := rpcServer.pitayaServer.Call(context.Background(), &pitayaprotos.Request{
+		Type: pitayaprotos.RPCType_User,
+		Msg:  &pitayaprotos.Msg{Route: "room.roomremote.join"},
+	})
+	if err != nil || res.Error != nil {
+		t.Fatalf("unexpected answer: %v %v", res, err)
+	}
+}
+
+func TestRequestCacheComputesOnce(t *testing.T) {
+	var computes int32
+	compute := func() (interface{}, error) {
+		atomic.AddInt32(&computes, 1)
+		return "room-1", nil
+	}
+
+	var first, second interface{}
+	callInRequestScope(t, func(ctx context.Context) {
+		first, _ = RequestCache(ctx).GetOrCompute("room:player-1", compute)
+		second, _ = RequestCache(ctx).GetOrCompute("room:player-1", compute)
+	})
+	if computes != 1 || first != "room-1" || second != "room-1" {
+		t.Fatalf("expected one compute of room-1, got %d computes of %v and %v", computes, first, second)
+	}
+
+	// the cache is discarded with the request
+	callInRequestScope(t, func(ctx context.Context) {
+		if _, err := RequestCache(ctx).GetOrCompute("room:player-1", compute); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if computes != 2 {
+		t.Fatalf("expected the next request to compute again, got %d computes", computes)
+	}
+	if len(requestCaches.caches) != 0 {
+		t.Fatalf("expected the caches of the requests to be dropped, got %d", len(requestCaches.caches))
+	}
+}
+
+func TestRequestCacheFanOut(t *testing.T) {
+	var computes int32
+	release := make(chan struct{})
+	callInRequestScope(t, func(ctx context.Context) {
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				value, err := RequestCache(ctx).GetOrCompute("profile", func() (interface{}, error) {
+					atomic.AddInt32(&computes, 1)
+					<-release
+					return 42, nil
+				})
+				if err != nil || value != 42 {
+					t.Errorf("unexpected value %v %v", value, err)
+				}
+			}()
+		}
+		close(release)
+		wg.Wait()
+	})
+	if computes != 1 {
+		t.Fatalf("expected the goroutines to share one compute, got %d", computes)
+	}
+}
+
+func TestRequestCacheErrorsNotMemoized(t *testing.T) {
+	ctx := WithRequestCache(context.Background())
+	failing := errors.New("room unavailable")
+	if _, err := RequestCache(ctx).GetOrCompute("room", func() (interface{}, error) { return nil, failing }); err != failing {
+		t.Fatalf("expected the error of the compute, got %v", err)
+	}
+	value, err := RequestCache(ctx).GetOrCompute("room", func() (interface{}, error) { return "room-1", nil })
+	if err != nil || value != "room-1" {
+		t.Fatalf("expected the key to be computed again, got %v %v", value, err)
+	}
+
+	// without a request cache every call computes
+	var computes int
+	for i := 0; i < 2; i++ {
+		RequestCache(context.Background()).GetOrCompute("room", func() (interface{}, error) {
+			computes++
+			return nil, nil
+		})
+	}
+	if computes != 2 {
+		t.Fatalf("expected 2 computes outside of a request, got %d", computes)
+	}
+}
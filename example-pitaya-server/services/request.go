@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/topfreegames/pitaya"
+)
+
+// ContentTypeKey is the propagated context key used by callers to tell how a message is encoded
+const ContentTypeKey = "content-type"
+
+// Content types accepted in remote messages, they match the pitaya serializer names
+const (
+	ContentTypeJSON     = "json"
+	ContentTypeProtobuf = "protobuf"
+)
+
+// ErrUnsupportedContentType is returned when a message is encoded in an unknown format
+var ErrUnsupportedContentType = errors.New("unsupported content type")
+
+// RequestInfo holds the metadata the caller propagated along with a remote call
+type RequestInfo struct {
+	// ContentType is the encoding of the message, json when the caller did not set it
+	ContentType string
+}
+
+// GetRequestInfo returns the request metadata propagated in ctx
+func GetRequestInfo(ctx context.Context) RequestInfo {
+	info := RequestInfo{
+		ContentType: ContentTypeJSON,
+	}
+	if ct, ok := pitaya.GetFromPropagateCtx(ctx, ContentTypeKey).(string); ok && ct != "" {
+		info.ContentType = ct
+	}
+	return info
+}
+
+// WithContentType returns a ctx that tells the remote how the outgoing message is encoded
+func WithContentType(ctx context.Context, contentType string) context.Context {
+	return pitaya.AddToPropagateCtx(ctx, ContentTypeKey, contentType)
+}
+
+// DecodeMessage decodes message into v according to the content type propagated in ctx
+func DecodeMessage(ctx context.Context, message []byte, v proto.Message) error {
+	s, err := defaultSerializers.Get(GetRequestInfo(ctx).ContentType)
+	if err != nil {
+		return err
+	}
+	return s.Unmarshal(message, v)
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+)
+
+func TestRemoteFuncProtobuf(t *testing.T) {
+	remote := &ConnectorRemote{}
+	ctx := WithContentType(context.Background(), ContentTypeProtobuf)
+
+	tables := []struct {
+		name string
+		msg  *protos.RPCMsg
+	}{
+		{"filled", &protos.RPCMsg{Route: "room.room.join", Msg: "hello"}},
+		{"empty", &protos.RPCMsg{}},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			message, err := proto.Marshal(table.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := remote.RemoteFunc(ctx, message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Code != 200 || res.Msg != table.msg.Msg {
+				t.Fatalf("unexpected response: %v", res)
+			}
+		})
+	}
+}
+
+func TestRemoteFuncJSON(t *testing.T) {
+	remote := &ConnectorRemote{}
+	contexts := map[string]context.Context{
+		"explicit": WithContentType(context.Background(), ContentTypeJSON),
+		"default":  context.Background(),
+	}
+
+	for name, ctx := range contexts {
+		t.Run(name, func(t *testing.T) {
+			for _, message := range []string{`{"msg":"hello"}`, ""} {
+				res, err := remote.RemoteFunc(ctx, []byte(message))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if res.Msg != message {
+					t.Fatalf("expected %q, got %q", message, res.Msg)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeMessage(t *testing.T) {
+	msg := &protos.RPCMsg{}
+	ctx := WithContentType(context.Background(), ContentTypeJSON)
+	if err := DecodeMessage(ctx, []byte(`{"Route":"a.b.c","Msg":"hi"}`), msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Route != "a.b.c" || msg.Msg != "hi" {
+		t.Fatalf("unexpected message: %v", msg)
+	}
+
+	if err := DecodeMessage(ctx, nil, msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Route != "" || msg.Msg != "" {
+		t.Fatalf("empty message should reset v, got %v", msg)
+	}
+
+	ctx = WithContentType(context.Background(), "xml")
+	if err := DecodeMessage(ctx, nil, msg); !errors.Is(err, ErrUnsupportedContentType) {
+		t.Fatalf("expected ErrUnsupportedContentType, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	e "github.com/topfreegames/pitaya/errors"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/route"
+)
+
+// ErrRouteNotRegistered is returned when caching the response of a route no remote serves
+var ErrRouteNotRegistered = errors.New("route not registered")
+
+// cachedResponse is the answer of a route, encoded once per content type
+type cachedResponse struct {
+	msg     proto.Message
+	mutex   sync.Mutex
+	encoded map[string][]byte
+}
+
+// encode returns msg encoded by s, the encoding is shared by the calls and must not be modified
+func (c *cachedResponse) encode(s Serializer) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if data, ok := c.encoded[s.ContentType()]; ok {
+		return data, nil
+	}
+	data, err := s.Marshal(c.msg)
+	if err != nil {
+		return nil, err
+	}
+	c.encoded[s.ContentType()] = data
+	return data, nil
+}
+
+// SetCachedResponse answers msg to the calls to rt, "service.method", without calling its remote.
+// msg is copied and encoded once per content type, with the serializer picked for each call, see
+// SerializerRegistry.ForRoute. It must be the message answered by the remote of rt.
+func (r *Routes) SetCachedResponse(rt string, msg proto.Message) error {
+	parsed, err := route.Decode(rt)
+	if err != nil {
+		return err
+	}
+	if parsed.SvType != "" {
+		return fmt.Errorf("route %s must not have a server type", rt)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	info, ok := r.routes[parsed.Short()]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrRouteNotRegistered, rt)
+	}
+	if reflect.TypeOf(msg) != reflect.PtrTo(info.Reply) {
+		return fmt.Errorf("%s answers %s, got %T", rt, info.Reply, msg)
+	}
+	r.cached[parsed.Short()] = &cachedResponse{msg: proto.Clone(msg), encoded: make(map[string][]byte)}
+	return nil
+}
+
+// InvalidateCachedResponse discards the cached response of rt, its remote answers the calls again
+// until a response is cached with SetCachedResponse
+func (r *Routes) InvalidateCachedResponse(rt string) {
+	parsed, err := route.Decode(rt)
+	if err != nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.cached, parsed.Short())
+}
+
+// cachedResponse answers req from the cached response of rt, if any
+func (s *routesPitayaServer) cachedResponse(ctx context.Context, req *pitayaprotos.Request, rt *route.Route) (*pitayaprotos.Response, bool) {
+	s.routes.mutex.RLock()
+	cached, ok := s.routes.cached[rt.Short()]
+	s.routes.mutex.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	serializer, err := s.routes.serializers.ForRoute(requestContext(ctx, req), req.Msg.Route)
+	if err != nil {
+		return pitayaErrorResponse(Wrap(err, e.ErrBadRequestCode, err.Error())), true
+	}
+	data, err := cached.encode(serializer)
+	if err != nil {
+		return pitayaErrorResponse(err), true
+	}
+	return &pitayaprotos.Response{Data: data}, true
+}
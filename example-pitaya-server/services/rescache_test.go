@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/component"
+	pcontext "github.com/topfreegames/pitaya/context"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+)
+
+// countingSerializer counts the messages it encodes
+type countingSerializer struct {
+	Serializer
+	marshals *int32
+}
+
+func (c countingSerializer) Marshal(v interface{}) ([]byte, error) {
+	atomic.AddInt32(c.marshals, 1)
+	return c.Serializer.Marshal(v)
+}
+
+// motdRemote answers its message of the day, counting the calls
+type motdRemote struct {
+	component.Base
+	motd  string
+	calls int32
+}
+
+func (m *motdRemote) Motd(ctx context.Context, message []byte) (*protos.Response, error) {
+	atomic.AddInt32(&m.calls, 1)
+	return &protos.Response{Code: 200, Msg: m.motd}, nil
+}
+
+// newMotdRoutes serves remote under connector.motd, the responses cached are counted in marshals
+func newMotdRoutes(t testing.TB, remote *motdRemote, marshals *int32) (*Routes, *fakeRPCServer) {
+	routes := newTestRoutes()
+	if err := routes.HandleRemote("connector.motd", remote, "Motd"); err != nil {
+		t.Fatal(err)
+	}
+	routes.serializers = NewSerializerRegistry()
+	routes.serializers.Register(countingSerializer{NewJSONSerializer(), marshals})
+	routes.serializers.Register(countingSerializer{NewProtobufSerializer(), marshals})
+	rpcServer := &fakeRPCServer{}
+	routes.WrapRPCServer(rpcServer).SetPitayaServer(&echoPitayaServer{})
+	if err := routes.SetCachedResponse("connector.motd", &protos.Response{Code: 200, Msg: "welcome"}); err != nil {
+		t.Fatal(err)
+	}
+	return routes, rpcServer
+}
+
+func callMotd(t testing.TB, rpcServer *fakeRPCServer, contentType string) []byte {
+	ctx := context.Background()
+	if contentType != "" {
+		ctx = pcontext.AddToPropagateCtx(ctx, ContentTypeKey, contentType)
+	}
+	metadata, err := pcontext.Encode(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := rpcServer.pitayaServer.Call(context.Background(), &pitayaprotos.Request{
+		Type:     pitayaprotos.RPCType_User,
+		Msg:      &pitayaprotos.Msg{Route: "connector.connector.motd"},
+		Metadata: metadata,
+	})
+	if err != nil || res.Error != nil {
+		t.Fatalf("unexpected answer %v %v", res, err)
+	}
+	return res.Data
+}
+
+func TestCachedResponse(t *testing.T) {
+	var marshals int32
+	remote := &motdRemote{motd: "fresh"}
+	routes, rpcServer := newMotdRoutes(t, remote, &marshals)
+
+	for i := 0; i < 2; i++ {
+		if data := callMotd(t, rpcServer, ""); string(data) != `{"Code":200,"Msg":"welcome"}` {
+			t.Fatalf("expected the json of the cached response, got %s", data)
+		}
+	}
+	answer := &protos.Response{}
+	if err := proto.Unmarshal(callMotd(t, rpcServer, ContentTypeProtobuf), answer); err != nil || answer.Msg != "welcome" {
+		t.Fatalf("expected the protobuf of the cached response, got %v %v", answer, err)
+	}
+	if marshals != 2 || remote.calls != 0 {
+		t.Fatalf("expected one encoding per content type and no call, got %d encodings and %d calls", marshals, remote.calls)
+	}
+
+	// invalidated, the remote answers until a response is cached again, which is encoded again
+	routes.InvalidateCachedResponse("connector.motd")
+	if err := proto.Unmarshal(callMotd(t, rpcServer, ""), answer); err != nil || answer.Msg != "fresh" || remote.calls != 1 {
+		t.Fatalf("expected the remote to answer, got %v %v", answer, err)
+	}
+	if err := routes.SetCachedResponse("connector.motd", &protos.Response{Code: 200, Msg: "updated"}); err != nil {
+		t.Fatal(err)
+	}
+	if data := callMotd(t, rpcServer, ""); string(data) != `{"Code":200,"Msg":"updated"}` || marshals != 3 {
+		t.Fatalf("expected the new response to be encoded, got %s and %d encodings", data, marshals)
+	}
+}
+
+func TestSetCachedResponseInvalid(t *testing.T) {
+	routes := newTestRoutes()
+	if err := routes.HandleRemote("connector.motd", &motdRemote{}, "Motd"); err != nil {
+		t.Fatal(err)
+	}
+	if err := routes.SetCachedResponse("connector.unknown", &protos.Response{}); !errors.Is(err, ErrRouteNotRegistered) {
+		t.Fatalf("expected ErrRouteNotRegistered, got %v", err)
+	}
+	if err := routes.SetCachedResponse("connector.motd", &protos.UserMessage{}); err == nil {
+		t.Fatal("expected a message of another type to be rejected")
+	}
+	if err := routes.SetCachedResponse("connector.connector.motd", &protos.Response{}); err == nil {
+		t.Fatal("expected a route with a server type to be rejected")
+	}
+}
+
+// BenchmarkCachedResponse4KB compares answering a 4KB message from its remote and from its cached
+// encoding, marshals/op counts the messages encoded
+func BenchmarkCachedResponse4KB(b *testing.B) {
+	motd := strings.Repeat("x", 4096)
+	b.Run("remote", func(b *testing.B) {
+		var marshals int32
+		remote := &motdRemote{motd: motd}
+		routes, rpcServer := newMotdRoutes(b, remote, &marshals)
+		routes.InvalidateCachedResponse("connector.motd")
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			callMotd(b, rpcServer, ContentTypeProtobuf)
+		}
+		b.ReportMetric(float64(remote.calls+marshals)/float64(b.N), "marshals/op")
+	})
+	b.Run("cached", func(b *testing.B) {
+		var marshals int32
+		remote := &motdRemote{}
+		routes, rpcServer := newMotdRoutes(b, remote, &marshals)
+		if err := routes.SetCachedResponse("connector.motd", &protos.Response{Code: 200, Msg: motd}); err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			callMotd(b, rpcServer, ContentTypeProtobuf)
+		}
+		b.ReportMetric(float64(remote.calls+marshals)/float64(b.N), "marshals/op")
+	})
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"syscall"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// RetryPolicy retries the rpc's failing with a transient error, waiting
+// BaseDelay * Multiplier^(attempt-1) between attempts, capped by MaxDelay.
+type RetryPolicy struct {
+	// MaxAttempts is the number of calls made at most, including the first one
+	MaxAttempts int
+	BaseDelay   time.Duration
+	// MaxDelay caps the delay between attempts, it is not capped when zero
+	MaxDelay time.Duration
+	// Multiplier grows the delay after each attempt, 2 when zero
+	Multiplier float64
+	// Jitter is the fraction of the delay that is randomized, between 0 and 1
+	Jitter float64
+	// Retryable tells whether a call failing with err can be retried, IsTransient when nil
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy retries three times within about a second
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    time.Second,
+	Jitter:      0.2,
+}
+
+// IsTransient returns whether err is a failure to reach the remote that can succeed when retried:
+// the connection to nats failed or no server of the route was found, as servers can be rediscovered.
+// Errors answered by the remote are never transient.
+func IsTransient(err error) bool {
+	switch {
+	case errors.Is(err, ErrRemoteNotFound),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, nats.ErrConnectionClosed),
+		errors.Is(err, nats.ErrConnectionReconnecting),
+		errors.Is(err, nats.ErrNoServers):
+		return true
+	}
+	return false
+}
+
+// RemoteClientOption configures a RemoteClient
+type RemoteClientOption func(r *RemoteClient)
+
+// WithRetryPolicy retries the calls of the client according to policy
+func WithRetryPolicy(policy RetryPolicy) RemoteClientOption {
+	return func(r *RemoteClient) {
+		r.retry = policy
+	}
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsTransient(err)
+}
+
+// delay returns how long to wait after attempt failed
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	delay := float64(p.BaseDelay) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
+
+// wait sleeps before the attempt after attempt, it returns false when the call must not be retried
+// because the policy or the deadline of ctx are exhausted
+func (p RetryPolicy) wait(ctx context.Context, clock Clock, attempt int, err error) bool {
+	if attempt >= p.MaxAttempts || !p.retryable(err) {
+		return false
+	}
+	delay := p.delay(attempt)
+	if deadline, ok := ctx.Deadline(); ok && deadline.Sub(clock.Now()) < delay {
+		return false
+	}
+
+	timer := clock.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	nats "github.com/nats-io/nats.go"
+	"github.com/topfreegames/pitaya/constants"
+	e "github.com/topfreegames/pitaya/errors"
+)
+
+// failingRPC fails the first len(errs) calls with errs before delivering the rpc to next
+func failingRPC(calls *int, next RPCFunc, errs ...error) RPCFunc {
+	return func(ctx context.Context, serverID, routeStr string, reply, arg proto.Message) error {
+		*calls++
+		if *calls <= len(errs) {
+			return errs[*calls-1]
+		}
+		return next(ctx, serverID, routeStr, reply, arg)
+	}
+}
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Millisecond,
+}
+
+func TestRetrySucceedsOnThirdAttempt(t *testing.T) {
+	calls := 0
+	rpc := failingRPC(&calls, loopbackRPC(&ConnectorRemote{}), nats.ErrConnectionClosed, constants.ErrNoServersAvailableOfType)
+	client := NewRemoteClient(rpc, WithRetryPolicy(testRetryPolicy))
+
+	res, err := client.CallRemoteFunc(context.Background(), &protos.RPCMsg{Msg: "ping"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 || res.Msg != "ping" {
+		t.Fatalf("expected the third call to succeed, got %d calls and %v", calls, res)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	businessErr := e.NewError(errors.New("room is full"), "PIT-409")
+	tables := []struct {
+		name     string
+		errs     []error
+		expected int
+	}{
+		{"business error", []error{businessErr}, 1},
+		{"attempts exhausted", []error{nats.ErrNoServers, nats.ErrNoServers, nats.ErrNoServers}, 3},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			calls := 0
+			rpc := failingRPC(&calls, loopbackRPC(&ConnectorRemote{}), table.errs...)
+			client := NewRemoteClient(rpc, WithRetryPolicy(testRetryPolicy))
+
+			_, err := client.CallRemoteFunc(context.Background(), &protos.RPCMsg{})
+			var rpcErr *RPCError
+			if !errors.As(err, &rpcErr) || rpcErr.Attempts != table.expected || calls != table.expected {
+				t.Fatalf("expected to fail after %d calls, got %d calls and %v", table.expected, calls, err)
+			}
+		})
+	}
+}
+
+func TestRetryRespectsDeadline(t *testing.T) {
+	calls := 0
+	rpc := failingRPC(&calls, loopbackRPC(&ConnectorRemote{}), nats.ErrNoServers, nats.ErrNoServers)
+	client := NewRemoteClient(rpc, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.CallRemoteFunc(ctx, &protos.RPCMsg{})
+	if !errors.Is(err, nats.ErrNoServers) || calls != 1 {
+		t.Fatalf("expected a single call, got %d calls and %v", calls, err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("the client should not wait past the deadline, took %s", elapsed)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 30 * time.Millisecond}
+	for attempt, expected := range []time.Duration{10, 20, 30, 30} {
+		if delay := p.delay(attempt + 1); delay != expected*time.Millisecond {
+			t.Fatalf("attempt %d: expected %s, got %s", attempt+1, expected*time.Millisecond, delay)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if delay := p.delay(1); delay < 5*time.Millisecond || delay > 15*time.Millisecond {
+			t.Fatalf("expected the jitter to stay within half the delay, got %s", delay)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,8 +20,11 @@ type (
 	// like Join/Message
 	Room struct {
 		component.Base
-		timer *timer.Timer
-		Stats *Stats
+		timer   *timer.Timer
+		Stats   *Stats
+		remotes *RemoteClient
+		streams *StreamReceiver
+		logger  Logger
 	}
 
 	// Stats exports the room status
@@ -42,11 +46,33 @@ func (Stats *Stats) Inbound(ctx context.Context, in []byte) ([]byte, error) {
 	return in, nil
 }
 
+// RoomOption configures a Room
+type RoomOption func(r *Room)
+
+// WithRoomLogger sets the logger of the room
+func WithRoomLogger(l Logger) RoomOption {
+	return func(r *Room) {
+		r.logger = l
+	}
+}
+
 // NewRoom returns a new room
-func NewRoom() *Room {
-	return &Room{
-		Stats: &Stats{},
+func NewRoom(opts ...RoomOption) *Room {
+	r := &Room{
+		Stats:   &Stats{},
+		remotes: NewRemoteClient(pitaya.RPCTo, WithRetryPolicy(DefaultRetryPolicy)),
+		streams: NewStreamReceiver("room"),
+		logger:  NewNopLogger(),
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// StreamReceiver returns the remote receiving the streams opened by the room
+func (r *Room) StreamReceiver() *StreamReceiver {
+	return r.streams
 }
 
 // Init runs on service initialization
@@ -110,10 +136,39 @@ func (r *Room) Message(ctx context.Context, msg *protos.UserMessage) {
 
 // SendRPC sends rpc
 func (r *Room) SendRPC(ctx context.Context, msg []byte) (*protos.Response, error) {
-	ret := protos.Response{}
-	err := pitaya.RPC(ctx, "connector.connectorremote.remotefunc", &ret, &protos.RPCMsg{})
+	ret, err := r.remotes.CallRemoteFunc(ctx, &protos.RPCMsg{})
 	if err != nil {
 		return nil, pitaya.Error(err, "RPC-000")
 	}
 	return reply(200, ret.Msg), nil
 }
+
+// StreamRPC opens a stream to the connectors and pushes every frame to the client
+func (r *Room) StreamRPC(ctx context.Context, msg *protos.RPCMsg) (*protos.Response, error) {
+	stream, err := r.remotes.StreamRemoteFunc(ctx, r.streams, msg)
+	if err != nil {
+		return nil, pitaya.Error(err, "RPC-000")
+	}
+	s := pitaya.GetSessionFromCtx(ctx)
+	logger := LoggerFromCtx(ctx, r.logger)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		defer stream.Close()
+		for {
+			res, err := stream.Recv(ctx)
+			if err != nil {
+				if err != io.EOF {
+					logger.Error("error receiving stream", "route", OpenStreamRoute, "error", err.Error())
+				}
+				return
+			}
+			// the frame goes to the frontend of the session, its connector pushes it like Connector.Push
+			if err := s.Push("onStreamFrame", res); err != nil {
+				logger.Error("error pushing stream frame", "route", "onStreamFrame", "error", err.Error())
+				return
+			}
+		}
+	}()
+	return reply(200, "ok"), nil
+}
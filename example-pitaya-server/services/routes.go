@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/topfreegames/pitaya"
+	"github.com/topfreegames/pitaya/cluster"
+	"github.com/topfreegames/pitaya/component"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/route"
+)
+
+// ErrRouteConflict is returned when a route is registered twice
+var ErrRouteConflict = errors.New("route already registered")
+
+var (
+	typeOfContext  = reflect.TypeOf((*context.Context)(nil)).Elem()
+	typeOfBytes    = reflect.TypeOf(([]byte)(nil))
+	typeOfError    = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfProtoMsg = reflect.TypeOf((*proto.Message)(nil)).Elem()
+)
+
+// Routes registers the remotes of the server, failing on conflicting routes instead of silently
+// replacing the first remote. Remote methods can be given explicit routes, which stay the same
+// when the go methods are renamed. The remotes are called by the server returned by WrapRPCServer
+// with the deadline sent by the caller. Routes answering static replies can be served from bytes,
+// see SetCachedResponse.
+type Routes struct {
+	mutex       sync.RWMutex
+	routes      map[string]RemoteInfo
+	explicit    map[string]*namedRemote
+	cached      map[string]*cachedResponse
+	serializers *SerializerRegistry
+	notFound    NotFoundHandler
+	register    func(c component.Component, options ...component.Option)
+}
+
+// RemoteInfo describes the signature of a registered remote
+type RemoteInfo struct {
+	// Route is the route of the remote without the server type, "service.method"
+	Route string
+	// Method is the go method serving the route, "Type.Method"
+	Method string
+	// Arg is the proto message received by the remote, nil when it receives the raw message or nothing
+	Arg reflect.Type
+	// Raw tells whether the remote receives the raw message
+	Raw bool
+	// Reply is the proto message answered by the remote
+	Reply reflect.Type
+}
+
+type namedRemote struct {
+	method reflect.Value
+	// arg is nil for methods receiving the raw message or nothing
+	arg reflect.Type
+	// bare tells whether the method only receives the context
+	bare bool
+}
+
+// NewRoutes returns new routes registering the remotes in pitaya
+func NewRoutes() *Routes {
+	return &Routes{
+		routes:      make(map[string]RemoteInfo),
+		explicit:    make(map[string]*namedRemote),
+		cached:      make(map[string]*cachedResponse),
+		serializers: defaultSerializers,
+		register:    pitaya.RegisterRemote,
+	}
+}
+
+// RegisterRemote registers c in pitaya under the routes derived from its name and methods
+func (r *Routes) RegisterRemote(c component.Component, options ...component.Option) error {
+	s := component.NewService(c, options)
+	if err := s.ExtractRemote(); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	explicit := make(map[string]*namedRemote, len(s.Remotes))
+	for name, remote := range s.Remotes {
+		info := RemoteInfo{
+			Route:  s.Name + "." + name,
+			Method: methodName(s.Type, remote.Method.Name),
+			Reply:  remote.Method.Type.Out(0).Elem(),
+		}
+		named := &namedRemote{method: reflect.ValueOf(c).MethodByName(remote.Method.Name), bare: !remote.HasArgs}
+		if remote.HasArgs {
+			info.Arg = remote.Type.Elem()
+			named.arg = info.Arg
+		}
+		if err := r.reserve(info); err != nil {
+			return err
+		}
+		explicit[info.Route] = named
+	}
+	for rt, named := range explicit {
+		r.explicit[rt] = named
+	}
+	r.register(c, options...)
+	return nil
+}
+
+// HandleRemote serves method of c under rt, "service.method". The method must receive a context
+// and either the raw message or a proto message, and return a proto message and an error.
+// Calls to explicit routes are served by the server returned by WrapRPCServer.
+func (r *Routes) HandleRemote(rt string, c component.Component, method string) error {
+	parsed, err := route.Decode(rt)
+	if err != nil {
+		return err
+	}
+	if parsed.SvType != "" {
+		return fmt.Errorf("route %s must not have a server type", rt)
+	}
+	remote, err := newNamedRemote(c, method)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	info := RemoteInfo{
+		Route:  parsed.Short(),
+		Method: methodName(reflect.TypeOf(c), method),
+		Arg:    remote.arg,
+		Raw:    remote.arg == nil,
+		Reply:  remote.method.Type().Out(0).Elem(),
+	}
+	if err := r.reserve(info); err != nil {
+		return err
+	}
+	r.explicit[parsed.Short()] = remote
+	return nil
+}
+
+// Remotes returns the remotes registered so far sorted by route
+func (r *Routes) Remotes() []RemoteInfo {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	remotes := make([]RemoteInfo, 0, len(r.routes))
+	for _, info := range r.routes {
+		remotes = append(remotes, info)
+	}
+	sort.Slice(remotes, func(i, j int) bool { return remotes[i].Route < remotes[j].Route })
+	return remotes
+}
+
+// reserve records the route of info, it must be called with the mutex held
+func (r *Routes) reserve(info RemoteInfo) error {
+	if previous, ok := r.routes[info.Route]; ok {
+		return fmt.Errorf("%w: %s by %s and %s", ErrRouteConflict, info.Route, previous.Method, info.Method)
+	}
+	r.routes[info.Route] = info
+	return nil
+}
+
+func methodName(t reflect.Type, method string) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name() + "." + method
+}
+
+func newNamedRemote(c component.Component, method string) (*namedRemote, error) {
+	m := reflect.ValueOf(c).MethodByName(method)
+	if !m.IsValid() {
+		return nil, fmt.Errorf("%T has no method %s", c, method)
+	}
+	mt := m.Type()
+	if mt.NumIn() != 2 || mt.In(0) != typeOfContext ||
+		mt.NumOut() != 2 || !mt.Out(0).Implements(typeOfProtoMsg) || mt.Out(1) != typeOfError {
+		return nil, fmt.Errorf("%T.%s is not a remote method", c, method)
+	}
+
+	remote := &namedRemote{method: m}
+	switch arg := mt.In(1); {
+	case arg == typeOfBytes:
+	case arg.Kind() == reflect.Ptr && arg.Implements(typeOfProtoMsg):
+		remote.arg = arg.Elem()
+	default:
+		return nil, fmt.Errorf("%T.%s is not a remote method", c, method)
+	}
+	return remote, nil
+}
+
+// call calls the remote with the encoded message data and returns its encoded answer
+func (n *namedRemote) call(ctx context.Context, data []byte) ([]byte, error) {
+	reply, err := n.invoke(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(reply)
+}
+
+// invoke calls the remote with the encoded message data and returns its answer
+func (n *namedRemote) invoke(ctx context.Context, data []byte) (proto.Message, error) {
+	args := []reflect.Value{reflect.ValueOf(ctx)}
+	switch {
+	case n.arg != nil:
+		msg := reflect.New(n.arg)
+		if err := proto.Unmarshal(data, msg.Interface().(proto.Message)); err != nil {
+			return nil, err
+		}
+		args = append(args, msg)
+	case !n.bare:
+		args = append(args, reflect.ValueOf(data))
+	}
+
+	out := n.method.Call(args)
+	if err, _ := out[1].Interface().(error); err != nil {
+		return nil, err
+	}
+	return out[0].Interface().(proto.Message), nil
+}
+
+// WrapRPCServer serves the registered routes and the unknown routes of the remote calls received by server,
+// it must be the outermost wrapper so the calls go through the other ones
+func (r *Routes) WrapRPCServer(server cluster.RPCServer) cluster.RPCServer {
+	return &routesRPCServer{RPCServer: server, routes: r}
+}
+
+type routesRPCServer struct {
+	cluster.RPCServer
+	routes *Routes
+}
+
+func (s *routesRPCServer) SetPitayaServer(server pitayaprotos.PitayaServer) {
+	s.RPCServer.SetPitayaServer(&routesPitayaServer{PitayaServer: server, routes: s.routes})
+}
+
+type routesPitayaServer struct {
+	pitayaprotos.PitayaServer
+	routes *Routes
+}
+
+func (s *routesPitayaServer) Call(ctx context.Context, req *pitayaprotos.Request) (*pitayaprotos.Response, error) {
+	if req.Type != pitayaprotos.RPCType_User || req.Msg == nil {
+		return s.PitayaServer.Call(ctx, req)
+	}
+	rt, err := route.Decode(req.Msg.Route)
+	if err != nil {
+		return s.PitayaServer.Call(ctx, req)
+	}
+	if res, ok := s.cachedResponse(ctx, req, rt); ok {
+		return res, nil
+	}
+	s.routes.mutex.RLock()
+	remote, ok := s.routes.explicit[rt.Short()]
+	s.routes.mutex.RUnlock()
+	if !ok {
+		res, err := s.PitayaServer.Call(ctx, req)
+		if err == nil && isRemoteNotFound(res) {
+			return s.notFound(ctx, req), nil
+		}
+		return res, err
+	}
+
+	remoteCtx, cancel := remoteContext(ctx, req)
+	defer cancel()
+	reply, err := remote.invoke(remoteCtx, req.Msg.Data)
+	if err != nil {
+		return pitayaErrorResponse(err), nil
+	}
+	// the pipeline copies the answer out of the pooled buffer before the transport gets it
+	data, err := marshalAnswer(ctx, reply)
+	if err != nil {
+		return pitayaErrorResponse(err), nil
+	}
+	return &pitayaprotos.Response{Data: data}, nil
+}
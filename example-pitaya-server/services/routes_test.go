@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/component"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+)
+
+// newTestRoutes returns routes that do not register the remotes in pitaya
+func newTestRoutes() *Routes {
+	r := NewRoutes()
+	r.register = func(c component.Component, options ...component.Option) {}
+	return r
+}
+
+func TestHandleRemoteCustomRoute(t *testing.T) {
+	routes := newTestRoutes()
+	if err := routes.HandleRemote("connector.echo", &ConnectorRemote{}, "RemoteFunc"); err != nil {
+		t.Fatal(err)
+	}
+	rpcServer := &fakeRPCServer{}
+	fallback := &echoPitayaServer{}
+	routes.WrapRPCServer(rpcServer).SetPitayaServer(fallback)
+
+	res, err := rpcServer.pitayaServer.Call(context.Background(), &pitayaprotos.Request{
+		Type: pitayaprotos.RPCType_User,
+		Msg:  &pitayaprotos.Msg{Route: "connector.connector.echo", Data: []byte(`{"msg":"hi"}`)},
+	})
+	if err != nil || res.Error != nil {
+		t.Fatalf("unexpected error %v %v", err, res.Error)
+	}
+	answer := &protos.Response{}
+	if err := proto.Unmarshal(res.Data, answer); err != nil {
+		t.Fatal(err)
+	}
+	if answer.Msg != `{"msg":"hi"}` {
+		t.Fatalf("expected the message to be echoed, got %v", answer)
+	}
+	if fallback.received != nil {
+		t.Fatal("explicit routes should not reach pitaya")
+	}
+
+	// other routes are served by pitaya
+	if _, err := rpcServer.pitayaServer.Call(context.Background(), &pitayaprotos.Request{
+		Type: pitayaprotos.RPCType_User,
+		Msg:  &pitayaprotos.Msg{Route: "connector.connectorremote.openstream", Data: []byte("open")},
+	}); err != nil || string(fallback.received) != "open" {
+		t.Fatalf("expected the call to reach pitaya, got %v", err)
+	}
+}
+
+func TestRoutesConflict(t *testing.T) {
+	routes := newTestRoutes()
+	err := routes.RegisterRemote(&ConnectorRemote{},
+		component.WithName("connectorremote"),
+		component.WithNameFunc(strings.ToLower),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tables := []struct {
+		name string
+		err  error
+	}{
+		{"explicit over derived", routes.HandleRemote("connectorremote.openstream", &ConnectorRemote{}, "RemoteFunc")},
+		{"derived over derived", routes.RegisterRemote(&ConnectorRemote{},
+			component.WithName("connectorremote"),
+			component.WithNameFunc(strings.ToLower),
+		)},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			if !errors.Is(table.err, ErrRouteConflict) {
+				t.Fatalf("expected ErrRouteConflict, got %v", table.err)
+			}
+		})
+	}
+
+	if err := routes.HandleRemote("connector.echo", &ConnectorRemote{}, "RemoteFunc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := routes.HandleRemote("connector.echo", &ConnectorRemote{}, "RemoteFunc"); !errors.Is(err, ErrRouteConflict) {
+		t.Fatalf("expected ErrRouteConflict, got %v", err)
+	}
+}
+
+func TestHandleRemoteInvalid(t *testing.T) {
+	routes := newTestRoutes()
+	tables := []struct {
+		name   string
+		route  string
+		method string
+	}{
+		{"missing method", "connector.echo", "Echo"},
+		{"not a remote", "connector.echo", "Init"},
+		{"server type", "connector.connector.echo", "RemoteFunc"},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			if err := routes.HandleRemote(table.route, &ConnectorRemote{}, table.method); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+	"github.com/topfreegames/pitaya/session"
+)
+
+// RoutingKeysKey is the propagated context key with the routing keys of the request, e.g. its tenant
+const RoutingKeysKey = "routing-keys"
+
+// ErrNoShard is returned when the routing key of a call has no shard configured
+var ErrNoShard = errors.New("no shard for routing key")
+
+// WithRoutingKey returns a ctx that propagates the routing key name to the servers it calls
+func WithRoutingKey(ctx context.Context, name, value string) context.Context {
+	keys := map[string]string{name: value}
+	for k, v := range propagatedRoutingKeys(ctx) {
+		if k != name {
+			keys[k] = v
+		}
+	}
+	return pcontext.AddToPropagateCtx(ctx, RoutingKeysKey, keys)
+}
+
+// RoutingKey returns the routing key name propagated by the caller. Handlers of client requests
+// also find it in the data of the session, which is not propagated unless set with WithRoutingKey.
+func RoutingKey(ctx context.Context, name string) (string, bool) {
+	if value, ok := propagatedRoutingKeys(ctx)[name]; ok {
+		return value, true
+	}
+	if s, ok := ctx.Value(constants.SessionCtxKey).(*session.Session); ok && s != nil {
+		if value, ok := s.Get(name).(string); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// propagatedRoutingKeys returns the routing keys in ctx, they are decoded as a map[string]interface{}
+// when propagated from another server
+func propagatedRoutingKeys(ctx context.Context) map[string]string {
+	switch keys := pcontext.GetFromPropagateCtx(ctx, RoutingKeysKey).(type) {
+	case map[string]string:
+		return keys
+	case map[string]interface{}:
+		decoded := make(map[string]string, len(keys))
+		for k, v := range keys {
+			if s, ok := v.(string); ok {
+				decoded[k] = s
+			}
+		}
+		return decoded
+	}
+	return nil
+}
+
+// Router picks the server handling a call from the routing keys of its context
+type Router interface {
+	// Route returns the id of the server handling the call to route, empty to let pitaya pick any
+	// server of the route type
+	Route(ctx context.Context, route string) (serverID string, err error)
+}
+
+// RouterFunc adapts a function into a Router
+type RouterFunc func(ctx context.Context, route string) (string, error)
+
+// Route calls f
+func (f RouterFunc) Route(ctx context.Context, route string) (string, error) {
+	return f(ctx, route)
+}
+
+// ShardRouter sends the calls to the server configured for the value of a routing key, so the
+// calls of a tenant always land on its shard
+type ShardRouter struct {
+	key    string
+	shards map[string]string
+}
+
+// NewShardRouter returns a router sending the calls whose routing key is a key of shards to
+// the server id it maps to
+func NewShardRouter(key string, shards map[string]string) *ShardRouter {
+	return &ShardRouter{key: key, shards: shards}
+}
+
+// Route returns the shard of the routing key of ctx. Calls without the routing key go to any
+// server, calls whose value has no shard fail with ErrNoShard instead of landing on another shard.
+func (r *ShardRouter) Route(ctx context.Context, route string) (string, error) {
+	value, ok := RoutingKey(ctx, r.key)
+	if !ok {
+		return "", nil
+	}
+	serverID, ok := r.shards[value]
+	if !ok {
+		return "", fmt.Errorf("%w: %s=%s", ErrNoShard, r.key, value)
+	}
+	return serverID, nil
+}
+
+// WithRouter sends the calls of the client to the servers picked by router
+func WithRouter(router Router) RemoteClientOption {
+	return func(r *RemoteClient) {
+		r.router = router
+	}
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/constants"
+	"github.com/topfreegames/pitaya/session"
+)
+
+func TestRoutingKeyPropagated(t *testing.T) {
+	ctx := WithRoutingKey(WithRoutingKey(context.Background(), "tenant", "A"), "region", "eu")
+	ctx = propagated(t, ctx)
+	if tenant, ok := RoutingKey(ctx, "tenant"); !ok || tenant != "A" {
+		t.Fatalf("expected tenant A, got %q", tenant)
+	}
+	if region, ok := RoutingKey(ctx, "region"); !ok || region != "eu" {
+		t.Fatalf("expected region eu, got %q", region)
+	}
+	if _, ok := RoutingKey(ctx, "shard"); ok {
+		t.Fatal("unset routing keys should not be found")
+	}
+}
+
+func TestRoutingKeyFromSession(t *testing.T) {
+	s := session.New(&fakeEntity{}, true)
+	if err := s.Set("tenant", "B"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), constants.SessionCtxKey, s)
+	if tenant, ok := RoutingKey(ctx, "tenant"); !ok || tenant != "B" {
+		t.Fatalf("expected tenant B, got %q", tenant)
+	}
+	// the propagated key wins
+	if tenant, _ := RoutingKey(WithRoutingKey(ctx, "tenant", "A"), "tenant"); tenant != "A" {
+		t.Fatalf("expected tenant A, got %q", tenant)
+	}
+}
+
+func TestShardRouterSticky(t *testing.T) {
+	var servers []string
+	client := NewRemoteClient(func(ctx context.Context, serverID, route string, reply, arg proto.Message) error {
+		servers = append(servers, serverID)
+		return nil
+	}, WithRouter(NewShardRouter("tenant", map[string]string{
+		"A": "connector-a",
+		"B": "connector-b",
+	})))
+
+	tables := []struct {
+		tenant   string
+		expected string
+	}{
+		{"A", "connector-a"},
+		{"B", "connector-b"},
+		{"A", "connector-a"},
+		{"B", "connector-b"},
+	}
+	for _, table := range tables {
+		servers = nil
+		ctx := propagated(t, WithRoutingKey(context.Background(), "tenant", table.tenant))
+		if _, err := client.CallRemoteFunc(ctx, &protos.RPCMsg{}); err != nil {
+			t.Fatal(err)
+		}
+		if len(servers) != 1 || servers[0] != table.expected {
+			t.Fatalf("expected tenant %s to land on %s, got %v", table.tenant, table.expected, servers)
+		}
+	}
+
+	servers = nil
+	if _, err := client.CallRemoteFunc(context.Background(), &protos.RPCMsg{}); err != nil {
+		t.Fatal(err)
+	}
+	if servers[0] != "" {
+		t.Fatalf("calls without tenant should go to any server, got %s", servers[0])
+	}
+
+	servers = nil
+	_, err := client.CallRemoteFunc(WithRoutingKey(context.Background(), "tenant", "C"), &protos.RPCMsg{})
+	if !errors.Is(err, ErrNoShard) || len(servers) != 0 {
+		t.Fatalf("expected ErrNoShard without calls, got %v and %v", err, servers)
+	}
+}
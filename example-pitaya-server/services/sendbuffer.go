@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/topfreegames/pitaya/session"
+)
+
+// ErrSendBufferFull is returned when a push overflows the send buffer of its session
+var ErrSendBufferFull = errors.New("send buffer is full")
+
+// errSlowConsumer is returned by a send buffer that overflowed and must be disconnected
+var errSlowConsumer = errors.New("slow consumer")
+
+// OverflowPolicy tells what a push to a full send buffer does
+type OverflowPolicy int
+
+// Policies of the send buffers
+const (
+	// OverflowBlock makes Push wait until the buffer has room
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest push buffered to make room for the new one
+	OverflowDropOldest
+	// OverflowDropNewest drops the new push, Push returns ErrSendBufferFull
+	OverflowDropNewest
+	// OverflowDisconnect closes the session with DisconnectSlowConsumer, Push returns ErrSendBufferFull
+	OverflowDisconnect
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowDisconnect:
+		return "disconnect"
+	}
+	return "unknown"
+}
+
+// ParseOverflowPolicy returns the policy named s, as returned by String
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	for _, p := range []OverflowPolicy{OverflowBlock, OverflowDropOldest, OverflowDropNewest, OverflowDisconnect} {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown overflow policy %q", s)
+}
+
+// WithSendBuffer buffers up to size pushes per session while its client is slow to read them, a
+// push to a full buffer is handled by overflow. Push returns once the push is buffered, the buffered
+// pushes are delivered in order and the ones dropped or failing are given to the OnUndeliverable
+// callback. The pushes are not buffered when size is 0.
+//
+// The broadcasts of the groups of the connector and the pushes of the other servers, e.g. the stream
+// frames of the rooms, are buffered too. The shutdown message is never dropped, it is delivered after
+// the buffered pushes.
+func WithSendBuffer(size int, overflow OverflowPolicy) ConnectorOption {
+	return func(c *Connector) {
+		c.sendBuffer = size
+		c.overflow = overflow
+	}
+}
+
+// offer queues the push unless the buffer is full and its policy refuses it, it returns the push
+// dropped to make room if any
+func (q *pushQueue) offer(route string, payload []byte) (dropped *queuedPush, err error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for !q.closed && len(q.pending) >= q.size {
+		switch q.overflow {
+		case OverflowDropOldest:
+			dropped = q.pending[0]
+			q.pending[0] = nil
+			q.pending = q.pending[1:]
+		case OverflowDropNewest:
+			return nil, ErrSendBufferFull
+		case OverflowDisconnect:
+			// the session is being closed, the pushes fail until it is
+			q.closed = true
+			return nil, errSlowConsumer
+		default:
+			q.room.Wait()
+		}
+	}
+	if q.closed {
+		return dropped, ErrSessionGone
+	}
+	q.queue(route, payload)
+	return dropped, nil
+}
+
+// depth returns the number of pushes buffered
+func (q *pushQueue) depth() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.pending)
+}
+
+// bufferPush buffers the push to s, applying the overflow policy when the buffer is full
+func (c *Connector) bufferPush(s *session.Session, route string, payload []byte) error {
+	dropped, err := c.pushQueue(s).offer(route, payload)
+	if dropped != nil {
+		c.deadLetter(s.UID(), dropped.route, dropped.payload)
+	}
+	switch err {
+	case errSlowConsumer:
+		c.logger.Warn("disconnecting slow consumer", "uid", s.UID(), "buffered", c.sendBuffer)
+		go func() {
+			if err := c.kick(context.Background(), s, DisconnectSlowConsumer); err != nil {
+				c.logger.Warn("failed to kick slow consumer", "uid", s.UID(), "error", err)
+			}
+		}()
+		err = ErrSendBufferFull
+		fallthrough
+	case ErrSendBufferFull:
+		c.deadLetter(s.UID(), route, payload)
+	}
+	return err
+}
+
+// SendBufferDepth returns the number of pushes buffered for the session of uid, see WithSendBuffer
+func (c *Connector) SendBufferDepth(uid string) int {
+	s := c.sessions(uid)
+	if s == nil {
+		return 0
+	}
+	c.queuesMutex.Lock()
+	q, ok := c.queues[s.ID()]
+	c.queuesMutex.Unlock()
+	if !ok {
+		return 0
+	}
+	return q.depth()
+}
+
+// SendBufferDepths returns the number of pushes buffered by uid for the sessions that were pushed to
+func (c *Connector) SendBufferDepths() map[string]int {
+	c.queuesMutex.Lock()
+	queues := make([]*pushQueue, 0, len(c.queues))
+	for _, q := range c.queues {
+		queues = append(queues, q)
+	}
+	c.queuesMutex.Unlock()
+
+	depths := make(map[string]int, len(queues))
+	for _, q := range queues {
+		depths[q.session.UID()] = q.depth()
+	}
+	return depths
+}
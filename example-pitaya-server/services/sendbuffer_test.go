@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/session"
+
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+)
+
+// slowEntity is a client reading a push each time release receives, started receives when a push
+// starts being written
+type slowEntity struct {
+	payloadEntity
+	started chan string
+	release chan struct{}
+}
+
+func (s *slowEntity) Push(route string, v interface{}) error {
+	s.started <- string(v.([]byte))
+	<-s.release
+	return s.payloadEntity.Push(route, v)
+}
+
+// saturate pushes p0, which the client is slow to read, and fills the buffer of 2 with p1 and p2
+func saturate(t *testing.T, overflow OverflowPolicy) (*Connector, *slowEntity, *[]deadLetter, chan disconnection) {
+	var letters []deadLetter
+	disconnects := make(chan disconnection, 1)
+	c := lifecycleConnector(disconnects, WithSendBuffer(2, overflow), recordDeadLetters(&letters))
+	entity := &slowEntity{started: make(chan string, 8), release: make(chan struct{})}
+	s := session.New(entity, true, "uid1")
+	c.sessions = func(uid string) *session.Session { return s }
+
+	for _, payload := range []string{"p0", "p1", "p2"} {
+		if err := c.Push("uid1", "onMessage", []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+		if payload == "p0" {
+			<-entity.started
+		}
+	}
+	if depth := c.SendBufferDepth("uid1"); depth != 2 {
+		t.Fatalf("expected 2 pushes buffered, got %d", depth)
+	}
+	return c, entity, &letters, disconnects
+}
+
+// drain lets the client read n pushes and returns what it received
+func (s *slowEntity) drain(t *testing.T, n int) []string {
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			select {
+			case <-s.started:
+			case <-time.After(time.Second):
+				t.Fatalf("push %d was never written", i)
+			}
+		}
+		s.release <- struct{}{}
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.mutex.Lock()
+		payloads := append([]string{}, s.payloads...)
+		s.mutex.Unlock()
+		if len(payloads) == n || time.Now().After(deadline) {
+			return payloads
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func expectPayloads(t *testing.T, got []string, expected ...string) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+	}
+}
+
+func TestSendBufferBlock(t *testing.T) {
+	c, entity, letters, _ := saturate(t, OverflowBlock)
+
+	pushed := make(chan error, 1)
+	go func() { pushed <- c.Push("uid1", "onMessage", []byte("p3")) }()
+	select {
+	case err := <-pushed:
+		t.Fatalf("the push should wait for room in the buffer, returned %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	payloads := entity.drain(t, 4)
+	if err := <-pushed; err != nil {
+		t.Fatal(err)
+	}
+	expectPayloads(t, payloads, "p0", "p1", "p2", "p3")
+	if len(*letters) != 0 {
+		t.Fatalf("expected no dead letter, got %v", *letters)
+	}
+}
+
+func TestSendBufferDropOldest(t *testing.T) {
+	c, entity, letters, _ := saturate(t, OverflowDropOldest)
+
+	if err := c.Push("uid1", "onMessage", []byte("p3")); err != nil {
+		t.Fatal(err)
+	}
+	if depth := c.SendBufferDepth("uid1"); depth != 2 {
+		t.Fatalf("expected the buffer to stay full, got %d", depth)
+	}
+	expectPayloads(t, entity.drain(t, 3), "p0", "p2", "p3")
+	if len(*letters) != 1 || string((*letters)[0].payload) != "p1" {
+		t.Fatalf("expected p1 to be dead-lettered, got %v", *letters)
+	}
+}
+
+func TestSendBufferDropNewest(t *testing.T) {
+	c, entity, letters, _ := saturate(t, OverflowDropNewest)
+
+	if err := c.Push("uid1", "onMessage", []byte("p3")); err != ErrSendBufferFull {
+		t.Fatalf("expected ErrSendBufferFull, got %v", err)
+	}
+	expectPayloads(t, entity.drain(t, 3), "p0", "p1", "p2")
+	if len(*letters) != 1 || string((*letters)[0].payload) != "p3" {
+		t.Fatalf("expected p3 to be dead-lettered, got %v", *letters)
+	}
+}
+
+func TestSendBufferDisconnect(t *testing.T) {
+	c, entity, letters, disconnects := saturate(t, OverflowDisconnect)
+	s := c.sessions("uid1")
+
+	if err := c.Push("uid1", "onMessage", []byte("p3")); err != ErrSendBufferFull {
+		t.Fatalf("expected ErrSendBufferFull, got %v", err)
+	}
+	if err := c.Push("uid1", "onMessage", []byte("p4")); err != ErrSessionGone {
+		t.Fatalf("expected the session to be gone while it is closed, got %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		entity.mutex.Lock()
+		kicked := entity.kicked
+		entity.mutex.Unlock()
+		if kicked {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the slow consumer was not kicked")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	c.onSessionClose(s)
+	if d := receive(t, disconnects); d.reason != DisconnectSlowConsumer || d.reason.String() != "slow consumer" {
+		t.Fatalf("expected a slow consumer, got %s", d.reason)
+	}
+	if len(*letters) != 2 || string((*letters)[0].payload) != "p3" || string((*letters)[1].payload) != "p4" {
+		t.Fatalf("expected p3 and p4 to be dead-lettered, got %v", *letters)
+	}
+	close(entity.release)
+}
+
+func TestSendBufferBlockedPushFailsWhenClosed(t *testing.T) {
+	c, entity, letters, _ := saturate(t, OverflowBlock)
+
+	pushed := make(chan error, 1)
+	go func() { pushed <- c.Push("uid1", "onMessage", []byte("p3")) }()
+	time.Sleep(10 * time.Millisecond)
+	c.dropPushQueue(c.sessions("uid1"))
+	select {
+	case err := <-pushed:
+		if err != ErrSessionGone {
+			t.Fatalf("expected ErrSessionGone, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the blocked push was not woken up")
+	}
+	if len(*letters) != 1 || string((*letters)[0].payload) != "p3" {
+		t.Fatalf("expected p3 to be dead-lettered, got %v", *letters)
+	}
+	close(entity.release)
+}
+
+func TestSendBufferBoundsEveryPath(t *testing.T) {
+	c, entity, letters, _ := saturate(t, OverflowDropNewest)
+	g, err := c.Group(context.Background(), "room")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Add("uid1"); err != nil {
+		t.Fatal(err)
+	}
+	rpcServer := &fakeRPCServer{}
+	c.WrapRPCServer(rpcServer).SetPitayaServer(kickingPitayaServer{})
+
+	err = g.Broadcast(context.Background(), "onMessage", &protos.UserMessage{Name: "broadcast"})
+	var broadcastErr *BroadcastError
+	if !errors.As(err, &broadcastErr) || broadcastErr.Errors["uid1"] != ErrSendBufferFull {
+		t.Fatalf("expected the broadcast to be dropped, got %v", err)
+	}
+	push := &pitayaprotos.Push{Route: "onMessage", Uid: "uid1", Data: []byte("forwarded")}
+	if _, err := rpcServer.pitayaServer.PushToUser(context.Background(), push); err != ErrSendBufferFull {
+		t.Fatalf("expected the forwarded push to be dropped, got %v", err)
+	}
+	if len(*letters) != 2 || string((*letters)[1].payload) != "forwarded" {
+		t.Fatalf("expected the broadcast and the forwarded push to be dead-lettered, got %v", *letters)
+	}
+
+	// the shutdown message is not dropped, it waits for the pushes buffered before it
+	c.kickRoute, c.kickMsg = "onServerGoingAway", []byte("bye")
+	pushed := make(chan error, 1)
+	go func() { pushed <- c.pushShutdown(c.sessions("uid1")) }()
+	expectPayloads(t, entity.drain(t, 4), "p0", "p1", "p2", "bye")
+	if err := <-pushed; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+	"github.com/topfreegames/pitaya/session"
+)
+
+// ErrContentTypeMismatch is returned when a message is not encoded in the content type its route accepts
+var ErrContentTypeMismatch = errors.New("content type mismatch")
+
+// Serializer encodes and decodes messages of a content type
+type Serializer interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	ContentType() string
+}
+
+type jsonSerializer struct{}
+
+// NewJSONSerializer returns a serializer encoding proto messages with jsonpb and other values with encoding/json
+func NewJSONSerializer() Serializer {
+	return jsonSerializer{}
+}
+
+func (jsonSerializer) Marshal(v interface{}) ([]byte, error) {
+	if msg, ok := v.(proto.Message); ok {
+		var buf bytes.Buffer
+		if err := (&jsonpb.Marshaler{}).Marshal(&buf, msg); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes data into v, an empty message resets proto messages
+func (jsonSerializer) Unmarshal(data []byte, v interface{}) error {
+	if msg, ok := v.(proto.Message); ok {
+		if len(data) == 0 {
+			msg.Reset()
+			return nil
+		}
+		return jsonpb.Unmarshal(bytes.NewReader(data), msg)
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (jsonSerializer) ContentType() string {
+	return ContentTypeJSON
+}
+
+type protobufSerializer struct{}
+
+// NewProtobufSerializer returns a serializer of proto messages
+func NewProtobufSerializer() Serializer {
+	return protobufSerializer{}
+}
+
+func (protobufSerializer) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf serializer: %T is not a proto message", v)
+	}
+	return proto.Marshal(msg)
+}
+
+func (protobufSerializer) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf serializer: %T is not a proto message", v)
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+func (protobufSerializer) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+// SerializerRegistry picks the serializer of a call, from the first of:
+// the serializer of its route, the content type the caller propagated,
+// the content type the client sent in the handshake and the default.
+type SerializerRegistry struct {
+	mutex       sync.RWMutex
+	serializers map[string]Serializer
+	routes      map[string]string
+	defaultType string
+}
+
+// NewSerializerRegistry returns a new registry with the json and protobuf serializers, json being the default
+func NewSerializerRegistry() *SerializerRegistry {
+	r := &SerializerRegistry{
+		serializers: make(map[string]Serializer),
+		routes:      make(map[string]string),
+		defaultType: ContentTypeJSON,
+	}
+	r.Register(NewJSONSerializer())
+	r.Register(NewProtobufSerializer())
+	return r
+}
+
+// Register adds s to the registry, replacing the serializer of the same content type
+func (r *SerializerRegistry) Register(s Serializer) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.serializers[s.ContentType()] = s
+}
+
+// SetDefault sets the content type used when neither the route nor the caller chose one
+func (r *SerializerRegistry) SetDefault(contentType string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.serializers[contentType]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupportedContentType, contentType)
+	}
+	r.defaultType = contentType
+	return nil
+}
+
+// SetRoute makes route only accept messages of contentType
+func (r *SerializerRegistry) SetRoute(route, contentType string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.serializers[contentType]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupportedContentType, contentType)
+	}
+	r.routes[route] = contentType
+	return nil
+}
+
+// Get returns the serializer of contentType
+func (r *SerializerRegistry) Get(contentType string) (Serializer, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	s, ok := r.serializers[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedContentType, contentType)
+	}
+	return s, nil
+}
+
+// ForRoute returns the serializer of a call to route made with ctx.
+// Routes with a serializer reject callers declaring another content type with ErrContentTypeMismatch.
+func (r *SerializerRegistry) ForRoute(ctx context.Context, route string) (Serializer, error) {
+	declared := negotiatedContentType(ctx)
+
+	r.mutex.RLock()
+	contentType, ok := r.routes[route]
+	if !ok {
+		contentType = declared
+	}
+	if contentType == "" {
+		contentType = r.defaultType
+	}
+	r.mutex.RUnlock()
+
+	if declared != "" && declared != contentType {
+		return nil, fmt.Errorf("%w: %s accepts %s messages, got %s", ErrContentTypeMismatch, route, contentType, declared)
+	}
+	return r.Get(contentType)
+}
+
+// negotiatedContentType returns the content type propagated by the caller or sent in the handshake of the session
+func negotiatedContentType(ctx context.Context) string {
+	if ct, ok := pcontext.GetFromPropagateCtx(ctx, ContentTypeKey).(string); ok && ct != "" {
+		return ct
+	}
+	s, ok := ctx.Value(constants.SessionCtxKey).(*session.Session)
+	if !ok || s == nil {
+		return ""
+	}
+	if handshake := s.GetHandshakeData(); handshake != nil {
+		ct, _ := handshake.User[ContentTypeKey].(string)
+		return ct
+	}
+	return ""
+}
+
+var defaultSerializers = NewSerializerRegistry()
+
+// WithSerializers sets the registry picking the serializers of the connector and of its remotes
+func WithSerializers(r *SerializerRegistry) ConnectorOption {
+	return func(c *Connector) {
+		c.serializers = r
+	}
+}
+
+// Serializer returns the serializer of a call to route, the content type of clients is the one of their handshake
+func (c *Connector) Serializer(ctx context.Context, route string) (Serializer, error) {
+	return c.serializers.ForRoute(ctx, route)
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/constants"
+	e "github.com/topfreegames/pitaya/errors"
+	"github.com/topfreegames/pitaya/session"
+)
+
+func TestSerializersRoundTrip(t *testing.T) {
+	for _, s := range []Serializer{NewJSONSerializer(), NewProtobufSerializer()} {
+		t.Run(s.ContentType(), func(t *testing.T) {
+			data, err := s.Marshal(&protos.RPCMsg{Route: "room.room.join", Msg: "hi"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := &protos.RPCMsg{}
+			if err := s.Unmarshal(data, msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Route != "room.room.join" || msg.Msg != "hi" {
+				t.Fatalf("unexpected message: %v", msg)
+			}
+		})
+	}
+}
+
+func TestSerializerRegistryForRoute(t *testing.T) {
+	r := NewSerializerRegistry()
+	if err := r.SetRoute("room.room.join", ContentTypeProtobuf); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetRoute("room.room.join", "xml"); !errors.Is(err, ErrUnsupportedContentType) {
+		t.Fatalf("expected ErrUnsupportedContentType, got %v", err)
+	}
+
+	s := session.New(&fakeEntity{}, true)
+	s.SetHandshakeData(&session.HandshakeData{User: map[string]interface{}{ContentTypeKey: ContentTypeProtobuf}})
+	handshakeCtx := context.WithValue(context.Background(), constants.SessionCtxKey, s)
+
+	tables := []struct {
+		name     string
+		ctx      context.Context
+		route    string
+		expected string
+	}{
+		{"default", context.Background(), "room.room.message", ContentTypeJSON},
+		{"route", context.Background(), "room.room.join", ContentTypeProtobuf},
+		{"propagated", WithContentType(context.Background(), ContentTypeProtobuf), "room.room.message", ContentTypeProtobuf},
+		{"handshake", handshakeCtx, "room.room.message", ContentTypeProtobuf},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			ser, err := r.ForRoute(table.ctx, table.route)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ser.ContentType() != table.expected {
+				t.Fatalf("expected %s, got %s", table.expected, ser.ContentType())
+			}
+		})
+	}
+}
+
+func TestProtobufRouteRejectsJSON(t *testing.T) {
+	serializers := NewSerializerRegistry()
+	if err := serializers.SetRoute(RemoteFuncRoute, ContentTypeProtobuf); err != nil {
+		t.Fatal(err)
+	}
+	remote := NewConnectorRemote(NewConnector(nil, WithSerializers(serializers)))
+
+	ctx := WithContentType(context.Background(), ContentTypeJSON)
+	if _, err := serializers.ForRoute(ctx, RemoteFuncRoute); !errors.Is(err, ErrContentTypeMismatch) {
+		t.Fatalf("expected ErrContentTypeMismatch, got %v", err)
+	}
+
+	_, err := remote.RemoteFunc(ctx, []byte(`{"msg":"hi"}`))
+	pitayaErr, ok := err.(*e.Error)
+	if !ok || pitayaErr.Code != e.ErrBadRequestCode {
+		t.Fatalf("expected a bad request pitaya error, got %#v", err)
+	}
+	expected := "content type mismatch: " + RemoteFuncRoute + " accepts protobuf messages, got json"
+	if pitayaErr.Message != expected {
+		t.Fatalf("expected %q, got %q", expected, pitayaErr.Message)
+	}
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/topfreegames/pitaya/serialize"
+	"github.com/topfreegames/pitaya/serialize/json"
+)
+
+// ErrSessionDataNotFound is returned by a SessionStore when there is no data stored for an uid
+var ErrSessionDataNotFound = errors.New("session data not found")
+
+// SessionStore persists the SessionData of users so it survives connector restarts
+//
+// Stores are expected to expire abandoned sessions by themselves: every Set refreshes
+// the TTL of the uid, so the data of a user that never reconnects is dropped once the
+// TTL elapses after the last write. A TTL of zero keeps the data until Delete is called.
+type SessionStore interface {
+	Get(ctx context.Context, uid string) (SessionData, error)
+	Set(ctx context.Context, uid string, data SessionData) error
+	Delete(ctx context.Context, uid string) error
+}
+
+type memoryEntry struct {
+	encoded  []byte
+	expireAt time.Time
+}
+
+// MemorySessionStore is a SessionStore that keeps the data in memory, it is meant for tests
+type MemorySessionStore struct {
+	mutex      sync.Mutex
+	entries    map[string]memoryEntry
+	serializer serialize.Serializer
+	ttl        time.Duration
+	clock      Clock
+}
+
+// NewMemorySessionStore returns a new in memory session store, a ttl of zero never expires data
+func NewMemorySessionStore(ttl time.Duration) *MemorySessionStore {
+	return &MemorySessionStore{
+		entries:    make(map[string]memoryEntry),
+		serializer: json.NewSerializer(),
+		ttl:        ttl,
+		clock:      RealClock,
+	}
+}
+
+// SetSerializer changes the serializer used to encode the session data
+func (m *MemorySessionStore) SetSerializer(ser serialize.Serializer) {
+	m.serializer = ser
+}
+
+// Get returns the data stored for the uid
+func (m *MemorySessionStore) Get(ctx context.Context, uid string) (SessionData, error) {
+	m.mutex.Lock()
+	entry, ok := m.entries[uid]
+	if ok && !entry.expireAt.IsZero() && !m.clock.Now().Before(entry.expireAt) {
+		delete(m.entries, uid)
+		ok = false
+	}
+	m.mutex.Unlock()
+
+	if !ok {
+		return SessionData{}, ErrSessionDataNotFound
+	}
+	return decodeSessionData(m.serializer, entry.encoded)
+}
+
+// Set stores the data for the uid and refreshes its ttl
+func (m *MemorySessionStore) Set(ctx context.Context, uid string, data SessionData) error {
+	encoded, err := m.serializer.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	entry := memoryEntry{encoded: encoded}
+	if m.ttl > 0 {
+		entry.expireAt = m.clock.Now().Add(m.ttl)
+	}
+
+	m.mutex.Lock()
+	m.entries[uid] = entry
+	m.mutex.Unlock()
+	return nil
+}
+
+// Delete removes the data stored for the uid
+func (m *MemorySessionStore) Delete(ctx context.Context, uid string) error {
+	m.mutex.Lock()
+	delete(m.entries, uid)
+	m.mutex.Unlock()
+	return nil
+}
+
+// RedisSessionStore is a SessionStore backed by redis, expiration is handled by redis itself
+type RedisSessionStore struct {
+	pool       *redis.Pool
+	prefix     string
+	serializer serialize.Serializer
+	ttl        time.Duration
+}
+
+// NewRedisSessionStore returns a new redis session store connected to address, a ttl of zero never expires data
+func NewRedisSessionStore(address string, ttl time.Duration) *RedisSessionStore {
+	pool := &redis.Pool{
+		MaxIdle:     10,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", address)
+		},
+	}
+	return NewRedisSessionStoreWithPool(pool, ttl)
+}
+
+// NewRedisSessionStoreWithPool returns a new redis session store using an existing pool
+func NewRedisSessionStoreWithPool(pool *redis.Pool, ttl time.Duration) *RedisSessionStore {
+	return &RedisSessionStore{
+		pool:       pool,
+		prefix:     "pitaya:session:",
+		serializer: json.NewSerializer(),
+		ttl:        ttl,
+	}
+}
+
+// SetSerializer changes the serializer used to encode the session data
+func (r *RedisSessionStore) SetSerializer(ser serialize.Serializer) {
+	r.serializer = ser
+}
+
+func (r *RedisSessionStore) key(uid string) string {
+	return fmt.Sprintf("%s%s", r.prefix, uid)
+}
+
+// Get returns the data stored for the uid
+func (r *RedisSessionStore) Get(ctx context.Context, uid string) (SessionData, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	encoded, err := redis.Bytes(conn.Do("GET", r.key(uid)))
+	if err == redis.ErrNil {
+		return SessionData{}, ErrSessionDataNotFound
+	}
+	if err != nil {
+		return SessionData{}, err
+	}
+	return decodeSessionData(r.serializer, encoded)
+}
+
+// Set stores the data for the uid and refreshes its ttl
+func (r *RedisSessionStore) Set(ctx context.Context, uid string, data SessionData) error {
+	encoded, err := r.serializer.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	if r.ttl > 0 {
+		_, err = conn.Do("SET", r.key(uid), encoded, "PX", int64(r.ttl/time.Millisecond))
+	} else {
+		_, err = conn.Do("SET", r.key(uid), encoded)
+	}
+	return err
+}
+
+// Delete removes the data stored for the uid
+func (r *RedisSessionStore) Delete(ctx context.Context, uid string) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("DEL", r.key(uid))
+	return err
+}
+
+func decodeSessionData(ser serialize.Serializer, encoded []byte) (SessionData, error) {
+	data := SessionData{}
+	if err := ser.Unmarshal(encoded, &data); err != nil {
+		return SessionData{}, err
+	}
+	if data.Data == nil {
+		data.Data = map[string]interface{}{}
+	}
+	return data, nil
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemorySessionStoreRoundTrip(t *testing.T) {
+	store := NewMemorySessionStore(0)
+	ctx := context.Background()
+
+	data := SessionData{Data: map[string]interface{}{
+		"level": 3,
+		"inventory": map[string]interface{}{
+			"swords": []interface{}{"short", "long"},
+		},
+	}}
+	if err := store.Set(ctx, "uid1", data); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Get(ctx, "uid1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inventory, ok := got.Data["inventory"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("nested value was lost: %#v", got.Data)
+	}
+	if swords := inventory["swords"].([]interface{}); len(swords) != 2 || swords[1] != "long" {
+		t.Fatalf("unexpected nested value: %#v", swords)
+	}
+
+	if err := store.Delete(ctx, "uid1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "uid1"); err != ErrSessionDataNotFound {
+		t.Fatalf("expected ErrSessionDataNotFound, got %v", err)
+	}
+}
+
+func TestMemorySessionStoreTTL(t *testing.T) {
+	clock := newFakeClock()
+	store := NewMemorySessionStore(time.Minute)
+	store.clock = clock
+	ctx := context.Background()
+
+	if err := store.Set(ctx, "uid1", SessionData{Data: map[string]interface{}{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(59 * time.Second)
+	if _, err := store.Get(ctx, "uid1"); err != nil {
+		t.Fatalf("data expired too early: %v", err)
+	}
+
+	clock.Advance(time.Second)
+	if _, err := store.Get(ctx, "uid1"); err != ErrSessionDataNotFound {
+		t.Fatalf("expected data to expire, got %v", err)
+	}
+}
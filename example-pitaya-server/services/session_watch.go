@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/topfreegames/pitaya/serialize"
+	"github.com/topfreegames/pitaya/serialize/json"
+)
+
+// DefaultWatchDebounce is how long the changes of the session data of an uid are coalesced before
+// being sent to its watchers
+const DefaultWatchDebounce = 100 * time.Millisecond
+
+// PubSub delivers the messages published on a subject to its subscribers, on every node
+type PubSub interface {
+	Publish(subject string, data []byte) error
+	// Subscribe calls f with the messages published on subject until unsubscribe is called
+	Subscribe(subject string, f func(data []byte)) (unsubscribe func(), err error)
+}
+
+// NATSPubSub is a PubSub sending the messages through nats
+type NATSPubSub struct {
+	conn *nats.Conn
+}
+
+// NewNATSPubSub returns a PubSub publishing on conn
+func NewNATSPubSub(conn *nats.Conn) *NATSPubSub {
+	return &NATSPubSub{conn: conn}
+}
+
+// Publish publishes data on subject
+func (n *NATSPubSub) Publish(subject string, data []byte) error {
+	return n.conn.Publish(subject, data)
+}
+
+// Subscribe calls f with the messages published on subject, one at a time
+func (n *NATSPubSub) Subscribe(subject string, f func(data []byte)) (func(), error) {
+	sub, err := n.conn.Subscribe(subject, func(msg *nats.Msg) {
+		f(msg.Data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func() { sub.Unsubscribe() }, nil
+}
+
+// MemoryPubSub is a PubSub delivering the messages in process, it is meant for tests
+type MemoryPubSub struct {
+	mutex       sync.Mutex
+	lastID      int
+	subscribers map[string]map[int]func(data []byte)
+}
+
+// NewMemoryPubSub returns a new in memory PubSub
+func NewMemoryPubSub() *MemoryPubSub {
+	return &MemoryPubSub{subscribers: make(map[string]map[int]func(data []byte))}
+}
+
+// Publish calls the subscribers of subject with data before returning
+func (m *MemoryPubSub) Publish(subject string, data []byte) error {
+	m.mutex.Lock()
+	subscribers := make([]func(data []byte), 0, len(m.subscribers[subject]))
+	for _, f := range m.subscribers[subject] {
+		subscribers = append(subscribers, f)
+	}
+	m.mutex.Unlock()
+
+	for _, f := range subscribers {
+		f(data)
+	}
+	return nil
+}
+
+// Subscribe calls f with the messages published on subject
+func (m *MemoryPubSub) Subscribe(subject string, f func(data []byte)) (func(), error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.lastID++
+	id := m.lastID
+	if m.subscribers[subject] == nil {
+		m.subscribers[subject] = make(map[int]func(data []byte))
+	}
+	m.subscribers[subject][id] = f
+	return func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		delete(m.subscribers[subject], id)
+	}, nil
+}
+
+// WatchedSessionStore is a SessionStore publishing the data it sets, so the nodes sharing the
+// store can watch the session data of an uid changing
+type WatchedSessionStore struct {
+	SessionStore
+	pubsub     PubSub
+	prefix     string
+	serializer serialize.Serializer
+	debounce   time.Duration
+	clock      Clock
+}
+
+// NewWatchedSessionStore returns store publishing the data set on pubsub, the changes of an uid
+// are coalesced for debounce, they are sent as they are published when debounce is 0
+func NewWatchedSessionStore(store SessionStore, pubsub PubSub, debounce time.Duration) *WatchedSessionStore {
+	return &WatchedSessionStore{
+		SessionStore: store,
+		pubsub:       pubsub,
+		prefix:       "pitaya.session.",
+		serializer:   json.NewSerializer(),
+		debounce:     debounce,
+		clock:        RealClock,
+	}
+}
+
+// subject is the subject of the changes of uid, uids must be valid nats tokens
+func (w *WatchedSessionStore) subject(uid string) string {
+	return w.prefix + uid
+}
+
+// Set stores the data for the uid and publishes it to its watchers
+func (w *WatchedSessionStore) Set(ctx context.Context, uid string, data SessionData) error {
+	if err := w.SessionStore.Set(ctx, uid, data); err != nil {
+		return err
+	}
+	encoded, err := w.serializer.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return w.pubsub.Publish(w.subject(uid), encoded)
+}
+
+// Watch returns a channel receiving the data set for uid by any node, until cancel is called.
+// Changes coalesced by the debounce, or not received yet when a newer one is sent, are skipped:
+// only the latest data is delivered.
+func (w *WatchedSessionStore) Watch(uid string) (<-chan SessionData, func(), error) {
+	watcher := &sessionWatcher{
+		ch:   make(chan SessionData, 1),
+		done: make(chan struct{}),
+	}
+	unsubscribe, err := w.pubsub.Subscribe(w.subject(uid), func(encoded []byte) {
+		data, err := decodeSessionData(w.serializer, encoded)
+		if err != nil {
+			return
+		}
+		watcher.changed(data, w.debounce, w.clock)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			unsubscribe()
+			watcher.close()
+		})
+	}
+	return watcher.ch, cancel, nil
+}
+
+// sessionWatcher sends the latest data of an uid to ch once the debounce elapsed
+type sessionWatcher struct {
+	ch   chan SessionData
+	done chan struct{}
+
+	mutex   sync.Mutex
+	latest  SessionData
+	pending bool
+	closed  bool
+}
+
+func (s *sessionWatcher) changed(data SessionData, debounce time.Duration, clock Clock) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.latest = data
+	if debounce <= 0 {
+		s.send()
+		return
+	}
+	if s.pending {
+		return
+	}
+	s.pending = true
+	go func() {
+		select {
+		case <-clock.After(debounce):
+		case <-s.done:
+			return
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.pending = false
+		s.send()
+	}()
+}
+
+// send replaces the data not received yet by the latest one, it must be called with the mutex held
+func (s *sessionWatcher) send() {
+	if s.closed {
+		return
+	}
+	select {
+	case <-s.ch:
+	default:
+	}
+	s.ch <- s.latest
+}
+
+func (s *sessionWatcher) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	close(s.done)
+	close(s.ch)
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func receiveSessionData(t *testing.T, ch <-chan SessionData) SessionData {
+	t.Helper()
+	select {
+	case data := <-ch:
+		return data
+	case <-time.After(time.Second):
+		t.Fatal("the change was not delivered")
+	}
+	return SessionData{}
+}
+
+func TestWatchAcrossStores(t *testing.T) {
+	backend := NewMemorySessionStore(0)
+	pubsub := NewMemoryPubSub()
+	node1 := NewWatchedSessionStore(backend, pubsub, 0)
+	node2 := NewWatchedSessionStore(backend, pubsub, 0)
+
+	changes, cancel, err := node2.Watch("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	ctx := context.Background()
+	if err := node1.Set(ctx, "bob", SessionData{Data: map[string]interface{}{"online": true}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := node1.Set(ctx, "alice", SessionData{Data: map[string]interface{}{"online": true}}); err != nil {
+		t.Fatal(err)
+	}
+	if data := receiveSessionData(t, changes); data.Data["online"] != true || len(changes) != 0 {
+		t.Fatalf("expected only the data of alice, got %v", data)
+	}
+	if stored, err := node2.Get(ctx, "alice"); err != nil || stored.Data["online"] != true {
+		t.Fatalf("the data should be stored in the shared backend, got %v and %v", stored, err)
+	}
+
+	cancel()
+	if _, ok := <-changes; ok {
+		t.Fatal("the channel should be closed once canceled")
+	}
+	if err := node1.Set(ctx, "alice", SessionData{Data: map[string]interface{}{}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchDebounce(t *testing.T) {
+	clock := newFakeClock()
+	backend := NewMemorySessionStore(0)
+	pubsub := NewMemoryPubSub()
+	node1 := NewWatchedSessionStore(backend, pubsub, time.Second)
+	node2 := NewWatchedSessionStore(backend, pubsub, time.Second)
+	node2.clock = clock
+
+	changes, cancel, err := node2.Watch("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	ctx := context.Background()
+	for level := 1; level <= 3; level++ {
+		if err := node1.Set(ctx, "alice", SessionData{Data: map[string]interface{}{"level": level}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clock.wait(t)
+	if len(changes) != 0 {
+		t.Fatal("the changes should wait for the debounce")
+	}
+	clock.Advance(time.Second)
+	if data := receiveSessionData(t, changes); data.Data["level"] != float64(3) {
+		t.Fatalf("expected the latest change, got %v", data)
+	}
+
+	// the next change waits for a new debounce
+	if err := node1.Set(ctx, "alice", SessionData{Data: map[string]interface{}{"level": 4}}); err != nil {
+		t.Fatal(err)
+	}
+	clock.wait(t)
+	clock.Advance(time.Second)
+	if data := receiveSessionData(t, changes); data.Data["level"] != float64(4) {
+		t.Fatalf("expected the latest change, got %v", data)
+	}
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/acceptor"
+	"github.com/topfreegames/pitaya/cluster"
+	"github.com/topfreegames/pitaya/conn/message"
+	"github.com/topfreegames/pitaya/constants"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/route"
+	"github.com/topfreegames/pitaya/session"
+)
+
+var (
+	// ErrSessionsForceClosed is returned by GracefulShutdown when the drain timeout elapsed with calls still in flight
+	ErrSessionsForceClosed = errors.New("sessions were force-closed")
+	// ErrConnectorShuttingDown is returned when a session tries to bind while the connector is shutting down
+	ErrConnectorShuttingDown = errors.New("connector is shutting down")
+)
+
+// DefaultDrainTimeout is how long GracefulShutdown waits for in flight calls when no timeout is configured
+const DefaultDrainTimeout = 10 * time.Second
+
+// ConnectorOption configures a Connector
+type ConnectorOption func(c *Connector)
+
+// WithAcceptors sets the acceptors the connector stops when shutting down
+func WithAcceptors(acceptors ...acceptor.Acceptor) ConnectorOption {
+	return func(c *Connector) {
+		c.acceptors = append(c.acceptors, acceptors...)
+	}
+}
+
+// WithDrainTimeout sets how long GracefulShutdown waits for in flight calls before closing the sessions
+func WithDrainTimeout(timeout time.Duration) ConnectorOption {
+	return func(c *Connector) {
+		c.drainTimeout = timeout
+	}
+}
+
+// WithShutdownKick sets the message pushed to clients right before they are kicked on shutdown
+func WithShutdownKick(route string, msg interface{}) ConnectorOption {
+	return func(c *Connector) {
+		c.kickRoute = route
+		c.kickMsg = msg
+	}
+}
+
+// drainState keeps track of the bound sessions and of the calls in flight for each of them
+type drainState struct {
+	mutex        sync.Mutex
+	sessions     map[int64]*session.Session
+	boundAt      map[int64]time.Time
+	clock        Clock
+	pending      map[int64]int
+	total        int
+	idle         chan struct{}
+	shuttingDown bool
+	// draining closes the new connections, see SetDraining
+	draining bool
+}
+
+func newDrainState() *drainState {
+	return &drainState{
+		sessions: make(map[int64]*session.Session),
+		boundAt:  make(map[int64]time.Time),
+		pending:  make(map[int64]int),
+		idle:     make(chan struct{}, 1),
+		clock:    RealClock,
+	}
+}
+
+// track marks a call as in flight until the returned func is called, s can be nil
+func (d *drainState) track(s *session.Session) func() {
+	d.mutex.Lock()
+	d.total++
+	if s != nil {
+		d.pending[s.ID()]++
+	}
+	d.mutex.Unlock()
+
+	return func() {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		d.total--
+		if s != nil {
+			if d.pending[s.ID()]--; d.pending[s.ID()] <= 0 {
+				delete(d.pending, s.ID())
+			}
+		}
+		if d.total == 0 {
+			select {
+			case d.idle <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (d *drainState) add(s *session.Session) {
+	d.mutex.Lock()
+	d.sessions[s.ID()] = s
+	d.boundAt[s.ID()] = d.clock.Now()
+	d.mutex.Unlock()
+}
+
+func (d *drainState) remove(s *session.Session) {
+	d.mutex.Lock()
+	delete(d.sessions, s.ID())
+	delete(d.boundAt, s.ID())
+	d.mutex.Unlock()
+}
+
+func (d *drainState) snapshot() []*session.Session {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	sessions := make([]*session.Session, 0, len(d.sessions))
+	for _, s := range d.sessions {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+func (d *drainState) wait(ctx context.Context) error {
+	for {
+		d.mutex.Lock()
+		total := d.total
+		d.mutex.Unlock()
+		if total == 0 {
+			return nil
+		}
+
+		select {
+		case <-d.idle:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (d *drainState) isShuttingDown() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.shuttingDown
+}
+
+func (d *drainState) hasPending(s *session.Session) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.pending[s.ID()] > 0
+}
+
+// OnBeforeShutdown adds a hook that receives the connected sessions before they are kicked,
+// it can be used to persist their state
+func (c *Connector) OnBeforeShutdown(f func(sessions []*session.Session)) {
+	c.beforeShutdown = append(c.beforeShutdown, f)
+}
+
+// GracefulShutdown stops accepting connections, waits for the calls in flight up to the ctx deadline
+// or the drain timeout and kicks every connected client with the configured message.
+// It returns ErrSessionsForceClosed when some sessions still had calls in flight.
+//
+// It must run before pitaya.Shutdown, pitaya closes every session right away once it is stopping.
+func (c *Connector) GracefulShutdown(ctx context.Context) error {
+	c.drain.mutex.Lock()
+	c.drain.shuttingDown = true
+	c.drain.mutex.Unlock()
+
+	for _, ac := range c.acceptors {
+		ac.Stop()
+	}
+
+	sessions := c.drain.snapshot()
+	for _, f := range c.beforeShutdown {
+		f(sessions)
+	}
+
+	drainCtx, cancel := context.WithTimeout(ctx, c.drainTimeout)
+	defer cancel()
+	if err := c.drain.wait(drainCtx); err != nil {
+		c.logger.Warn("connector drain interrupted", "error", err)
+	}
+
+	forceClosed := 0
+	for _, s := range c.drain.snapshot() {
+		if c.drain.hasPending(s) {
+			forceClosed++
+		}
+		if c.kickRoute != "" {
+			if err := c.pushShutdown(s); err != nil {
+				c.logger.Warn("failed to push shutdown message", "uid", s.UID(), "error", err)
+			}
+		}
+		if err := c.kick(ctx, s, DisconnectKick); err != nil {
+			c.logger.Warn("failed to kick session", "uid", s.UID(), "error", err)
+		}
+	}
+
+	if forceClosed > 0 {
+		return fmt.Errorf("%w: %d sessions had calls in flight", ErrSessionsForceClosed, forceClosed)
+	}
+	return nil
+}
+
+// trackSession is called when a session is bound so it is kicked on shutdown, uids reserved for
+// the groups are rejected
+func (c *Connector) trackSession(ctx context.Context, s *session.Session) error {
+	if !s.IsFrontend {
+		return nil
+	}
+
+	if c.drain.isShuttingDown() {
+		return ErrConnectorShuttingDown
+	}
+	if err := checkUID(s.UID()); err != nil {
+		return err
+	}
+	if err := c.claimSession(ctx, s); err != nil {
+		return err
+	}
+
+	c.drain.add(s)
+	return nil
+}
+
+func (c *Connector) untrackSession(s *session.Session) {
+	c.drain.remove(s)
+}
+
+// WrapRPCClient returns a rpc client that reports its calls as in flight to the connector,
+// it should wrap the client set with pitaya.SetRPCClient so forwarded requests are drained
+func (c *Connector) WrapRPCClient(client cluster.RPCClient) cluster.RPCClient {
+	return &drainRPCClient{
+		RPCClient: client,
+		drain:     c.drain,
+	}
+}
+
+type drainRPCClient struct {
+	cluster.RPCClient
+	drain *drainState
+}
+
+func (d *drainRPCClient) Call(
+	ctx context.Context,
+	rpcType pitayaprotos.RPCType,
+	route *route.Route,
+	session *session.Session,
+	msg *message.Message,
+	server *cluster.Server,
+) (*pitayaprotos.Response, error) {
+	defer d.drain.track(session)()
+	return d.RPCClient.Call(ctx, rpcType, route, session, msg, server)
+}
+
+// pushShutdown pushes the shutdown message to s after the pushes queued before it, it is encoded
+// with the serializer of the session and delivered before s is kicked
+func (c *Connector) pushShutdown(s *session.Session) error {
+	serializer, err := c.Serializer(context.WithValue(context.Background(), constants.SessionCtxKey, s), c.kickRoute)
+	if err != nil {
+		return err
+	}
+	payload, ok := c.kickMsg.([]byte)
+	if !ok {
+		if payload, err = serializer.Marshal(c.kickMsg); err != nil {
+			return err
+		}
+	}
+	return c.pushDelivered(s, c.kickRoute, payload)
+}
+
+func defaultShutdownKick() *protos.Response {
+	return &protos.Response{
+		Code: 503,
+		Msg:  "server going away",
+	}
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/session"
+)
+
+// fakeEntity is a session.NetworkEntity that records what was sent to the client
+type fakeEntity struct {
+	mutex  sync.Mutex
+	pushes []string
+	kicked bool
+	closed bool
+}
+
+func (f *fakeEntity) Push(route string, v interface{}) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.pushes = append(f.pushes, route)
+	return nil
+}
+
+func (f *fakeEntity) ResponseMID(ctx context.Context, mid uint, v interface{}, isError ...bool) error {
+	return nil
+}
+
+func (f *fakeEntity) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.closed = true
+	return nil
+}
+
+func (f *fakeEntity) Kick(ctx context.Context) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.kicked = true
+	return nil
+}
+
+func (f *fakeEntity) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 3250}
+}
+
+func (f *fakeEntity) SendRequest(ctx context.Context, serverID, route string, v interface{}) (*pitayaprotos.Response, error) {
+	return nil, nil
+}
+
+func newBoundSession(t *testing.T, c *Connector, uid string) (*session.Session, *fakeEntity) {
+	entity := &fakeEntity{}
+	s := session.New(entity, true, uid)
+	if err := c.trackSession(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+	return s, entity
+}
+
+func TestGracefulShutdownKicksSessions(t *testing.T) {
+	c := NewConnector(nil)
+	s, entity := newBoundSession(t, c, "uid1")
+
+	var hooked []*session.Session
+	c.OnBeforeShutdown(func(sessions []*session.Session) {
+		hooked = sessions
+	})
+
+	done := c.drain.track(s)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		done()
+	}()
+
+	if err := c.GracefulShutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(hooked) != 1 || hooked[0] != s {
+		t.Fatalf("hook should receive the connected sessions, got %v", hooked)
+	}
+	if !entity.kicked || len(entity.pushes) != 1 || entity.pushes[0] != "onServerGoingAway" {
+		t.Fatalf("session should be warned and kicked, got %+v", entity)
+	}
+
+	other := session.New(&fakeEntity{}, true, "uid2")
+	if err := c.trackSession(context.Background(), other); err != ErrConnectorShuttingDown {
+		t.Fatalf("expected ErrConnectorShuttingDown, got %v", err)
+	}
+}
+
+func TestGracefulShutdownForceCloses(t *testing.T) {
+	c := NewConnector(nil, WithDrainTimeout(10*time.Millisecond))
+	busy, busyEntity := newBoundSession(t, c, "busy")
+	newBoundSession(t, c, "idle")
+
+	c.drain.track(busy)
+
+	err := c.GracefulShutdown(context.Background())
+	if !errors.Is(err, ErrSessionsForceClosed) {
+		t.Fatalf("expected ErrSessionsForceClosed, got %v", err)
+	}
+	if err.Error() != "sessions were force-closed: 1 sessions had calls in flight" {
+		t.Fatalf("unexpected error message: %s", err)
+	}
+	if !busyEntity.kicked {
+		t.Fatal("busy session should be kicked anyway")
+	}
+}
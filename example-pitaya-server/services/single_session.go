@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/cluster"
+	"github.com/topfreegames/pitaya/session"
+)
+
+// ErrSessionConflictCode is the pitaya error code of the binds rejected because the uid already has a session
+const ErrSessionConflictCode = "PIT-409"
+
+// ClaimSessionRoute is the route of ConnectorRemote.ClaimSession
+const ClaimSessionRoute = "connector.connectorremote.claimsession"
+
+// ErrDuplicateSession is returned when binding an uid that already has a session with SessionReject
+var ErrDuplicateSession = errors.New("uid already has a session")
+
+// SessionPolicy tells what binding an uid that already has a session does
+type SessionPolicy int
+
+// Policies of the binds of an uid that already has a session
+const (
+	// SessionAllow keeps both sessions
+	SessionAllow SessionPolicy = iota
+	// SessionReject fails the bind of the new session with ErrDuplicateSession
+	SessionReject
+	// SessionReplace kicks the old session, its disconnect hooks are given DisconnectReplaced
+	SessionReplace
+)
+
+func (p SessionPolicy) String() string {
+	switch p {
+	case SessionAllow:
+		return "allow"
+	case SessionReject:
+		return "reject"
+	case SessionReplace:
+		return "replace"
+	}
+	return "unknown"
+}
+
+// ParseSessionPolicy returns the policy named s, see SessionPolicy.String
+func ParseSessionPolicy(s string) (SessionPolicy, error) {
+	for _, p := range []SessionPolicy{SessionAllow, SessionReject, SessionReplace} {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return SessionAllow, fmt.Errorf("unknown session policy %q", s)
+}
+
+// ServerLister lists the servers of a type, cluster.ServiceDiscovery satisfies it
+type ServerLister interface {
+	GetServersByType(serverType string) (map[string]*cluster.Server, error)
+}
+
+// singleSession enforces one session per uid, among the sessions of the peers too when set
+type singleSession struct {
+	policy  SessionPolicy
+	servers ServerLister
+	self    *cluster.Server
+	rpc     RPCFunc
+}
+
+// WithSingleSession applies policy when a session binds an uid that already has a session on
+// this connector, see WithSessionPeers to enforce it across the connectors of the cluster
+func WithSingleSession(policy SessionPolicy) ConnectorOption {
+	return func(c *Connector) {
+		c.single.policy = policy
+	}
+}
+
+// WithSessionPeers makes WithSingleSession apply to the sessions of the other frontends of the
+// type of self listed by servers, which are asked about the uid being bound with rpc, usually
+// pitaya.RPCTo, before the bind completes. The frontends that don't answer are skipped.
+func WithSessionPeers(servers ServerLister, self *cluster.Server, rpc RPCFunc) ConnectorOption {
+	return func(c *Connector) {
+		c.single.servers = servers
+		c.single.self = self
+		c.single.rpc = rpc
+	}
+}
+
+// claimSession applies the session policy to the bind of s, it runs before s is stored as the
+// session of its uid
+func (c *Connector) claimSession(ctx context.Context, s *session.Session) error {
+	if c.single.policy == SessionAllow {
+		return nil
+	}
+	if old := c.sessions(s.UID()); old != nil && old != s {
+		if err := c.resolveDuplicate(ctx, old, c.single.policy == SessionReplace); err != nil {
+			return err
+		}
+	}
+	if c.single.servers == nil {
+		return nil
+	}
+
+	servers, err := c.single.servers.GetServersByType(c.single.self.Type)
+	if err != nil {
+		LoggerFromCtx(ctx, c.logger).Warn("failed to list the frontends", "uid", s.UID(), "error", err.Error())
+		return nil
+	}
+	claim := &protos.SessionClaim{UID: s.UID(), Replace: c.single.policy == SessionReplace}
+	for id := range servers {
+		if id == c.single.self.ID {
+			continue
+		}
+		res := &protos.Response{}
+		if err := c.single.rpc(ctx, id, ClaimSessionRoute, res, claim); err != nil {
+			LoggerFromCtx(ctx, c.logger).Warn("failed to claim the session", "uid", s.UID(), "server", id, "error", err.Error())
+			continue
+		}
+		if res.Code == 409 {
+			return ErrDuplicateSession
+		}
+	}
+	return nil
+}
+
+// resolveDuplicate closes old when replaced, failing with ErrDuplicateSession otherwise
+func (c *Connector) resolveDuplicate(ctx context.Context, old *session.Session, replace bool) error {
+	if !replace {
+		return ErrDuplicateSession
+	}
+	LoggerFromCtx(ctx, c.logger).Info("replacing session", "uid", old.UID())
+	if err := c.kick(ctx, old, DisconnectReplaced); err != nil {
+		LoggerFromCtx(ctx, c.logger).Warn("failed to kick the replaced session", "uid", old.UID(), "error", err.Error())
+	}
+	// closed right away so the old session doesn't unbind the uid once the new one is bound
+	old.Close()
+	return nil
+}
+
+// ClaimSession answers 409 when the connector has a session of req.UID, which is kicked with
+// DisconnectReplaced instead when req.Replace is set. It is called by the connectors binding
+// the uid, see WithSessionPeers.
+func (c *ConnectorRemote) ClaimSession(ctx context.Context, req *protos.SessionClaim) (*protos.Response, error) {
+	if c.connector == nil {
+		return &protos.Response{Code: 200, Msg: "free"}, nil
+	}
+	old := c.connector.sessions(req.UID)
+	if old == nil {
+		return &protos.Response{Code: 200, Msg: "free"}, nil
+	}
+	if err := c.connector.resolveDuplicate(ctx, old, req.Replace); err != nil {
+		return &protos.Response{Code: 409, Msg: err.Error()}, nil
+	}
+	return &protos.Response{Code: 200, Msg: "replaced"}, nil
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/cluster"
+	"github.com/topfreegames/pitaya/session"
+)
+
+// fakeServers is a discovery listing the connectors of a test
+type fakeServers map[string]*cluster.Server
+
+func (f fakeServers) GetServersByType(serverType string) (map[string]*cluster.Server, error) {
+	servers := make(map[string]*cluster.Server)
+	for id, sv := range f {
+		if sv.Type == serverType {
+			servers[id] = sv
+		}
+	}
+	return servers, nil
+}
+
+// peersRPC calls the ClaimSession remote of the connector of the server called, encoding the
+// messages like pitaya. The servers without remote are unreachable.
+func peersRPC(remotes map[string]*ConnectorRemote) RPCFunc {
+	return func(ctx context.Context, serverID, routeStr string, reply proto.Message, arg proto.Message) error {
+		remote, ok := remotes[serverID]
+		if !ok || routeStr != ClaimSessionRoute {
+			return ErrRemoteNotFound
+		}
+		encoded, err := proto.Marshal(arg)
+		if err != nil {
+			return err
+		}
+		claim := &protos.SessionClaim{}
+		if err := proto.Unmarshal(encoded, claim); err != nil {
+			return err
+		}
+		res, err := remote.ClaimSession(ctx, claim)
+		if err != nil {
+			return err
+		}
+		proto.Merge(reply, res)
+		return nil
+	}
+}
+
+func TestSingleSessionLocal(t *testing.T) {
+	t.Run("reject", func(t *testing.T) {
+		c := NewConnector(nil, WithSingleSession(SessionReject))
+		oldEntity := &fakeEntity{}
+		old := session.New(oldEntity, true, "uid1")
+		c.sessions = func(uid string) *session.Session { return old }
+
+		if err := c.trackSession(context.Background(), session.New(&fakeEntity{}, true, "uid1")); err != ErrDuplicateSession {
+			t.Fatalf("expected ErrDuplicateSession, got %v", err)
+		}
+		if oldEntity.kicked || oldEntity.closed {
+			t.Fatal("expected the old session to be kept")
+		}
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		disconnects := make(chan disconnection, 1)
+		c := lifecycleConnector(disconnects, WithSingleSession(SessionReplace))
+		oldEntity := &fakeEntity{}
+		old := session.New(oldEntity, true, "uid1")
+		c.sessions = func(uid string) *session.Session { return old }
+
+		if err := c.trackSession(context.Background(), session.New(&fakeEntity{}, true, "uid1")); err != nil {
+			t.Fatal(err)
+		}
+		if !oldEntity.kicked || !oldEntity.closed {
+			t.Fatal("expected the old session to be kicked and closed")
+		}
+		c.sessionClosed(old)
+		if d := receive(t, disconnects); d.session != old || d.reason != DisconnectReplaced || d.reason.String() != "replaced by new login" {
+			t.Fatalf("expected the old session to be replaced, got %s", d.reason)
+		}
+	})
+
+	t.Run("allow", func(t *testing.T) {
+		c := NewConnector(nil)
+		old := session.New(&fakeEntity{}, true, "uid1")
+		c.sessions = func(uid string) *session.Session { return old }
+		if err := c.trackSession(context.Background(), session.New(&fakeEntity{}, true, "uid1")); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestSingleSessionAcrossConnectors(t *testing.T) {
+	servers := fakeServers{
+		"connector-a": {ID: "connector-a", Type: "connector", Frontend: true},
+		"connector-b": {ID: "connector-b", Type: "connector", Frontend: true},
+		"connector-c": {ID: "connector-c", Type: "connector", Frontend: true},
+		"room-1":      {ID: "room-1", Type: "room"},
+	}
+
+	for _, policy := range []SessionPolicy{SessionReject, SessionReplace} {
+		t.Run(policy.String(), func(t *testing.T) {
+			// uid1 is connected to b, c is unreachable
+			disconnects := make(chan disconnection, 1)
+			b := lifecycleConnector(disconnects)
+			oldEntity := &fakeEntity{}
+			old := session.New(oldEntity, true, "uid1")
+			b.sessions = func(uid string) *session.Session {
+				if uid == "uid1" {
+					return old
+				}
+				return nil
+			}
+			remotes := map[string]*ConnectorRemote{"connector-b": NewConnectorRemote(b)}
+			a := NewConnector(nil, WithSingleSession(policy), WithSessionPeers(servers, servers["connector-a"], peersRPC(remotes)))
+			a.sessions = func(uid string) *session.Session { return nil }
+			remotes["connector-a"] = NewConnectorRemote(a)
+
+			err := a.trackSession(context.Background(), session.New(&fakeEntity{}, true, "uid1"))
+			if policy == SessionReject {
+				if !errors.Is(err, ErrDuplicateSession) {
+					t.Fatalf("expected ErrDuplicateSession, got %v", err)
+				}
+				if oldEntity.kicked || oldEntity.closed {
+					t.Fatal("expected the session of the other connector to be kept")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !oldEntity.kicked || !oldEntity.closed {
+				t.Fatal("expected the session of the other connector to be kicked and closed")
+			}
+			b.sessionClosed(old)
+			if d := receive(t, disconnects); d.reason != DisconnectReplaced {
+				t.Fatalf("expected the old session to be replaced, got %s", d.reason)
+			}
+
+			// uids connected nowhere are bound
+			if err := a.trackSession(context.Background(), session.New(&fakeEntity{}, true, "uid2")); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestParseSessionPolicy(t *testing.T) {
+	for _, policy := range []SessionPolicy{SessionAllow, SessionReject, SessionReplace} {
+		if parsed, err := ParseSessionPolicy(policy.String()); err != nil || parsed != policy {
+			t.Errorf("expected %s, got %s %v", policy, parsed, err)
+		}
+	}
+	if _, err := ParseSessionPolicy("kick"); err == nil {
+		t.Fatal("expected an unknown policy to be rejected")
+	}
+}
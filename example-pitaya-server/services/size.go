@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/topfreegames/pitaya/acceptor"
+	"github.com/topfreegames/pitaya/cluster"
+	e "github.com/topfreegames/pitaya/errors"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+)
+
+const (
+	// ErrMessageTooLargeCode is the pitaya error code returned for messages larger than the limit
+	ErrMessageTooLargeCode = "PIT-413"
+	// DefaultMaxMessageSize is the size of the largest message accepted or answered, 1MB.
+	// Messages of clients are packets of at most 16MB, the largest size pitaya can decode.
+	DefaultMaxMessageSize = 1 << 20
+)
+
+// ErrMessageTooLarge is matched by the MessageTooLargeError returned for messages larger than the limit
+var ErrMessageTooLarge = errors.New("message too large")
+
+// MessageTooLargeError is returned when a message is larger than the limit
+type MessageTooLargeError struct {
+	Size int
+	Max  int
+}
+
+func (m *MessageTooLargeError) Error() string {
+	return fmt.Sprintf("%s: %d bytes, at most %d", ErrMessageTooLarge, m.Size, m.Max)
+}
+
+// Is makes errors.Is match ErrMessageTooLarge
+func (m *MessageTooLargeError) Is(target error) bool {
+	return target == ErrMessageTooLarge
+}
+
+// PitayaError converts the error so its sizes reach the caller on the wire
+func (m *MessageTooLargeError) PitayaError() *e.Error {
+	return e.NewError(m, ErrMessageTooLargeCode, map[string]string{
+		"size": strconv.Itoa(m.Size),
+		"max":  strconv.Itoa(m.Max),
+	})
+}
+
+// messageTooLarge rebuilds the error answered by another server from the metadata of its pitaya error
+func messageTooLarge(metadata map[string]string) *MessageTooLargeError {
+	size, _ := strconv.Atoi(metadata["size"])
+	max, _ := strconv.Atoi(metadata["max"])
+	return &MessageTooLargeError{Size: size, Max: max}
+}
+
+// MessageLimit rejects the messages larger than a size where they are decoded: the packets of the
+// clients, the rpcs received from other servers and the answers of the handlers and remotes
+type MessageLimit struct {
+	max int
+}
+
+// NewMessageLimit returns a limit of max bytes, messages of any size are accepted when max is 0
+func NewMessageLimit(max int) *MessageLimit {
+	return &MessageLimit{max: max}
+}
+
+func (l *MessageLimit) check(size int) error {
+	if l.max > 0 && size > l.max {
+		return &MessageTooLargeError{Size: size, Max: l.max}
+	}
+	return nil
+}
+
+// AfterHandler fails the answers of the handlers that are larger than the limit
+func (l *MessageLimit) AfterHandler(ctx context.Context, out interface{}, err error) (interface{}, error) {
+	if err != nil {
+		return out, err
+	}
+	var size int
+	switch out := out.(type) {
+	case []byte:
+		size = len(out)
+	case proto.Message:
+		size = proto.Size(out)
+	default:
+		return out, nil
+	}
+	if err := l.check(size); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// WrapAcceptor returns an acceptor whose connections read the header of the packets first, closing
+// the connection with a MessageTooLargeError before reading the body of a packet larger than the limit
+func (l *MessageLimit) WrapAcceptor(a acceptor.Acceptor) acceptor.Acceptor {
+	return &limitAcceptor{
+		Acceptor: a,
+		limit:    l,
+		conns:    make(chan acceptor.PlayerConn),
+	}
+}
+
+type limitAcceptor struct {
+	acceptor.Acceptor
+	limit *MessageLimit
+	once  sync.Once
+	conns chan acceptor.PlayerConn
+}
+
+func (a *limitAcceptor) GetConnChan() chan acceptor.PlayerConn {
+	a.once.Do(func() {
+		go func() {
+			for conn := range a.Acceptor.GetConnChan() {
+				a.conns <- &limitConn{PlayerConn: conn, limit: a.limit}
+			}
+			close(a.conns)
+		}()
+	})
+	return a.conns
+}
+
+// limitConn reads the packets itself instead of the acceptor. Websocket connections read the
+// bytes of the messages in order, so a message longer than its header is read as the next packet.
+type limitConn struct {
+	acceptor.PlayerConn
+	limit *MessageLimit
+}
+
+func (c *limitConn) GetNextMessage() ([]byte, error) {
+	return readPacket(c.PlayerConn, c.limit.check)
+}
+
+// WrapRPCServer fails the rpcs received by server whose message or answer is larger than the limit.
+// It must wrap the server returned by Compression.WrapRPCServer so decompressed sizes are checked.
+// The rpc is already read by then, nats bounds its size with its max payload.
+func (l *MessageLimit) WrapRPCServer(server cluster.RPCServer) cluster.RPCServer {
+	return &limitRPCServer{RPCServer: server, limit: l}
+}
+
+type limitRPCServer struct {
+	cluster.RPCServer
+	limit *MessageLimit
+}
+
+func (s *limitRPCServer) SetPitayaServer(server pitayaprotos.PitayaServer) {
+	s.RPCServer.SetPitayaServer(&limitPitayaServer{PitayaServer: server, limit: s.limit})
+}
+
+type limitPitayaServer struct {
+	pitayaprotos.PitayaServer
+	limit *MessageLimit
+}
+
+func (s *limitPitayaServer) Call(ctx context.Context, req *pitayaprotos.Request) (*pitayaprotos.Response, error) {
+	if req.Msg != nil {
+		if err := s.limit.check(len(req.Msg.Data)); err != nil {
+			return pitayaErrorResponse(err), nil
+		}
+	}
+	res, err := s.PitayaServer.Call(ctx, req)
+	if err != nil || res == nil || res.Error != nil {
+		return res, err
+	}
+	if err := s.limit.check(len(res.Data)); err != nil {
+		return pitayaErrorResponse(err), nil
+	}
+	return res, nil
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/conn/codec"
+	"github.com/topfreegames/pitaya/conn/packet"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+)
+
+const testMaxMessageSize = 1024
+
+// readerConn is a client connection sending the bytes of r
+type readerConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *readerConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *readerConn) GetNextMessage() ([]byte, error) {
+	panic("the packets should be read by the limit")
+}
+
+func encodePacket(t *testing.T, size int) []byte {
+	p, err := codec.NewPomeloPacketEncoder().Encode(packet.Data, bytes.Repeat([]byte("x"), size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLimitPacketSize(t *testing.T) {
+	limit := NewMessageLimit(testMaxMessageSize)
+	under := encodePacket(t, testMaxMessageSize)
+	over := encodePacket(t, testMaxMessageSize+1)
+	conn := &limitConn{
+		PlayerConn: &readerConn{r: bytes.NewReader(append(append([]byte{}, under...), over...))},
+		limit:      limit,
+	}
+
+	msg, err := conn.GetNextMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(msg, under) {
+		t.Fatal("a packet under the limit should be read whole")
+	}
+
+	_, err = conn.GetNextMessage()
+	var tooLarge *MessageTooLargeError
+	if !errors.As(err, &tooLarge) || !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("expected a MessageTooLargeError, got %v", err)
+	}
+	if tooLarge.Size != testMaxMessageSize+1 || tooLarge.Max != testMaxMessageSize {
+		t.Fatalf("unexpected sizes %d and %d", tooLarge.Size, tooLarge.Max)
+	}
+}
+
+func TestLimitTruncatedPacket(t *testing.T) {
+	p := encodePacket(t, 10)
+	conn := &limitConn{
+		PlayerConn: &readerConn{r: bytes.NewReader(p[:len(p)-1])},
+		limit:      NewMessageLimit(testMaxMessageSize),
+	}
+	if _, err := conn.GetNextMessage(); err == nil {
+		t.Fatal("expected an error for a truncated packet")
+	}
+}
+
+// sizedPitayaServer answers size bytes
+type sizedPitayaServer struct {
+	pitayaprotos.PitayaServer
+	size int
+}
+
+func (s *sizedPitayaServer) Call(ctx context.Context, req *pitayaprotos.Request) (*pitayaprotos.Response, error) {
+	return &pitayaprotos.Response{Data: make([]byte, s.size)}, nil
+}
+
+func TestLimitRPCSize(t *testing.T) {
+	tables := []struct {
+		name         string
+		requestSize  int
+		responseSize int
+		tooLarge     bool
+	}{
+		{"under", testMaxMessageSize, testMaxMessageSize, false},
+		{"request over", testMaxMessageSize + 1, 1, true},
+		{"response over", 1, testMaxMessageSize + 1, true},
+	}
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			rpcServer := &fakeRPCServer{}
+			NewMessageLimit(testMaxMessageSize).WrapRPCServer(rpcServer).SetPitayaServer(&sizedPitayaServer{size: table.responseSize})
+
+			res, err := rpcServer.pitayaServer.Call(context.Background(), &pitayaprotos.Request{
+				Type: pitayaprotos.RPCType_User,
+				Msg:  &pitayaprotos.Msg{Route: "room.room.join", Data: make([]byte, table.requestSize)},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !table.tooLarge {
+				if res.Error != nil || len(res.Data) != table.responseSize {
+					t.Fatalf("unexpected response %v", res)
+				}
+				return
+			}
+			if res.Error == nil || res.Error.Code != ErrMessageTooLargeCode || res.Error.Metadata["max"] != "1024" {
+				t.Fatalf("expected a message too large error, got %v", res)
+			}
+		})
+	}
+}
+
+func TestLimitHandlerAnswer(t *testing.T) {
+	limit := NewMessageLimit(testMaxMessageSize)
+	// the code takes 3 bytes and Msg 3 more than its length
+	under := &protos.BytesResponse{Code: 200, Msg: make([]byte, testMaxMessageSize-6)}
+	if _, err := limit.AfterHandler(context.Background(), under, nil); err != nil {
+		t.Fatal(err)
+	}
+	over := &protos.BytesResponse{Code: 200, Msg: make([]byte, testMaxMessageSize-5)}
+	if _, err := limit.AfterHandler(context.Background(), over, nil); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("expected ErrMessageTooLarge, got %v", err)
+	}
+}
+
+func TestNoMessageLimit(t *testing.T) {
+	if err := NewMessageLimit(0).check(1 << 30); err != nil {
+		t.Fatal(err)
+	}
+}
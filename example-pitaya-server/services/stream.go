@@ -0,0 +1,321 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/uuid"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya"
+	"github.com/topfreegames/pitaya/component"
+	e "github.com/topfreegames/pitaya/errors"
+)
+
+// OpenStreamRoute is the route of ConnectorRemote.OpenStream
+const OpenStreamRoute = "connector.connectorremote.openstream"
+
+// streamGoneCode is answered to frames of a stream the caller is not reading anymore
+const streamGoneCode = 410
+
+// streamBuffer is how many frames a stream holds before blocking its sender
+const streamBuffer = 16
+
+// StreamIdleTimeout is how long a stream waits for the next frame of its remote before it is cancelled
+const StreamIdleTimeout = time.Minute
+
+// ErrStreamClosed is returned when sending to a stream the caller stopped reading
+var ErrStreamClosed = errors.New("stream closed by the caller")
+
+// ResponseStream sends the frames of a streaming remote to its caller
+type ResponseStream interface {
+	// Send blocks until the caller has room for res, frames are received in the order they were sent
+	Send(res *protos.Response) error
+}
+
+// rpcStream is a ResponseStream sending each frame as a rpc to the StreamReceiver of the caller.
+// A frame is only sent after the previous one was acked, keeping them in order and making a slow
+// reader slow down the sender. It is cancelled when no frame was sent for idleTimeout.
+type rpcStream struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
+	idle        *time.Timer
+	idleTimeout time.Duration
+	rpc         RPCFunc
+	id          string
+	serverID    string
+	route       string
+	seq         int64
+}
+
+func (s *rpcStream) Send(res *protos.Response) error {
+	return s.send(&protos.StreamFrame{Response: res})
+}
+
+func (s *rpcStream) send(frame *protos.StreamFrame) error {
+	if s.ctx.Err() != nil {
+		return ErrStreamClosed
+	}
+	s.seq++
+	frame.StreamID = s.id
+	frame.Seq = s.seq
+
+	ack := &protos.Response{}
+	if err := s.rpc(s.ctx, s.serverID, s.route, ack, frame); err != nil {
+		s.cancel()
+		return classifyRPCError(err)
+	}
+	if ack.Code == streamGoneCode {
+		s.cancel()
+		return ErrStreamClosed
+	}
+	s.idle.Reset(s.idleTimeout)
+	return nil
+}
+
+// end sends the last frame of the stream carrying the error returned by the remote
+func (s *rpcStream) end(err error) {
+	frame := &protos.StreamFrame{End: true}
+	if err != nil {
+		frame.Error = err.Error()
+	}
+	s.send(frame)
+	s.stop()
+}
+
+// stop cancels the stream and its idle timer
+func (s *rpcStream) stop() {
+	s.idle.Stop()
+	s.cancel()
+}
+
+// OpenStream starts RemoteFuncStream, or the item stream req.Route, sending its frames to the receiver of the caller.
+// It returns as soon as the stream started, the frames follow through rpcs to req.ReplyRoute.
+func (c *ConnectorRemote) OpenStream(ctx context.Context, req *protos.StreamOpen) (*protos.Response, error) {
+	if req.StreamID == "" || req.ReplyServerID == "" || req.ReplyRoute == "" {
+		return nil, pitaya.Error(errors.New("stream id and reply address are required"), e.ErrBadRequestCode)
+	}
+	if c.connector != nil && c.connector.drain.isShuttingDown() {
+		return nil, pitaya.Error(ErrConnectorShuttingDown, e.ErrInternalCode)
+	}
+
+	// the stream outlives the rpc that opened it, which is cancelled once it returns, and its
+	// frames are not bound by the deadline of the open nor change its propagated values
+	streamCtx, cancel := context.WithCancel(withoutPropagatedDeadline(context.WithoutCancel(ctx)))
+	stream := &rpcStream{
+		ctx:         streamCtx,
+		cancel:      cancel,
+		idle:        time.AfterFunc(c.streamIdle, cancel),
+		idleTimeout: c.streamIdle,
+		rpc:         c.rpc,
+		id:          req.StreamID,
+		serverID:    req.ReplyServerID,
+		route:       req.ReplyRoute,
+	}
+	run := func() error { return c.RemoteFuncStream(streamCtx, req.Message, stream) }
+	if req.Route != "" {
+		items, ok := c.items[req.Route]
+		if !ok {
+			stream.stop()
+			return nil, pitaya.Error(fmt.Errorf("no item stream %s", req.Route), e.ErrNotFoundCode)
+		}
+		run = func() error { return streamItems(streamCtx, stream, items, req.Message) }
+	}
+	var done func()
+	if c.connector != nil {
+		done = c.connector.drain.track(nil)
+	}
+	go func() {
+		if done != nil {
+			defer done()
+		}
+		// the stream runs outside of the middlewares, its panics end it with an internal error
+		defer func() {
+			if rec := recover(); rec != nil {
+				perr := &PanicError{Value: rec, Stack: debug.Stack()}
+				LoggerFromCtx(ctx, c.logger()).Error("recovered from panic",
+					"streamId", req.StreamID,
+					"panic", perr.Error(),
+					"stack", string(perr.Stack),
+				)
+				stream.end(perr)
+			}
+		}()
+		err := run()
+		if err == ErrStreamClosed {
+			LoggerFromCtx(ctx, c.logger()).Info("stream closed by the caller or idle", "streamId", req.StreamID)
+			stream.stop()
+			return
+		}
+		stream.end(err)
+	}()
+	return &protos.Response{Code: 200}, nil
+}
+
+// RemoteFuncStream sends back a frame for every word of the message, until ctx is cancelled.
+//
+// When the caller stops reading, either because its stream was closed or because its server went
+// away, ctx is cancelled and Send returns ErrStreamClosed or the error of the failed rpc.
+// Neither is sent to the caller, the stream just ends.
+func (c *ConnectorRemote) RemoteFuncStream(ctx context.Context, message []byte, stream ResponseStream) error {
+	req := &protos.RPCMsg{}
+	if err := DecodeMessage(ctx, message, req); err != nil {
+		return err
+	}
+	for _, word := range strings.Fields(req.Msg) {
+		if err := ctx.Err(); err != nil {
+			return ErrStreamClosed
+		}
+		if err := stream.Send(&protos.Response{Code: 200, Msg: word}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stream is the caller side of a streaming remote
+type Stream struct {
+	id       string
+	receiver *StreamReceiver
+	frames   chan *protos.StreamFrame
+	done     chan struct{}
+	once     sync.Once
+	next     int64
+}
+
+// Recv returns the next frame, io.EOF is returned after the last one
+func (s *Stream) Recv(ctx context.Context) (*protos.Response, error) {
+	frame, err := s.recv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return frame.Response, nil
+}
+
+func (s *Stream) recv(ctx context.Context) (*protos.StreamFrame, error) {
+	select {
+	case <-s.done:
+		return nil, ErrStreamClosed
+	default:
+	}
+
+	select {
+	case frame := <-s.frames:
+		s.next++
+		if frame.Seq != s.next {
+			s.Close()
+			return nil, fmt.Errorf("stream %s received frame %d, expected %d", s.id, frame.Seq, s.next)
+		}
+		if frame.End {
+			s.Close()
+			if frame.Error != "" {
+				return nil, errors.New(frame.Error)
+			}
+			return nil, io.EOF
+		}
+		return frame, nil
+	case <-s.done:
+		return nil, ErrStreamClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops reading the stream, the remote is cancelled on its next frame
+func (s *Stream) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.receiver.remove(s.id)
+	})
+}
+
+// StreamReceiver is a remote receiving the frames of the streams opened by its server.
+// It must be registered with the name "streamreceiver".
+type StreamReceiver struct {
+	component.Base
+	route    string
+	serverID func() string
+	mutex    sync.Mutex
+	streams  map[string]*Stream
+}
+
+// NewStreamReceiver returns a new stream receiver for a server of serverType
+func NewStreamReceiver(serverType string) *StreamReceiver {
+	return &StreamReceiver{
+		route:    serverType + ".streamreceiver.frame",
+		serverID: pitaya.GetServerID,
+		streams:  make(map[string]*Stream),
+	}
+}
+
+func (r *StreamReceiver) add() *Stream {
+	s := &Stream{
+		id:       uuid.New().String(),
+		receiver: r,
+		frames:   make(chan *protos.StreamFrame, streamBuffer),
+		done:     make(chan struct{}),
+	}
+	r.mutex.Lock()
+	r.streams[s.id] = s
+	r.mutex.Unlock()
+	return s
+}
+
+func (r *StreamReceiver) remove(id string) {
+	r.mutex.Lock()
+	delete(r.streams, id)
+	r.mutex.Unlock()
+}
+
+// Frame receives a frame of a stream, it blocks while the stream buffer is full.
+// A reader slower than the rpc timeout breaks the stream, the sender gets ErrRPCTimeout.
+func (r *StreamReceiver) Frame(ctx context.Context, frame *protos.StreamFrame) (*protos.Response, error) {
+	r.mutex.Lock()
+	s, ok := r.streams[frame.StreamID]
+	r.mutex.Unlock()
+	if !ok {
+		return &protos.Response{Code: streamGoneCode}, nil
+	}
+
+	select {
+	case s.frames <- frame:
+		return &protos.Response{Code: 200}, nil
+	case <-s.done:
+		return &protos.Response{Code: streamGoneCode}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// StreamRemoteFunc calls ConnectorRemote.RemoteFuncStream in any connector, the frames are
+// received by receiver. The stream must be closed when not read until io.EOF.
+func (r *RemoteClient) StreamRemoteFunc(ctx context.Context, receiver *StreamReceiver, req *protos.RPCMsg) (*Stream, error) {
+	return r.openStream(ctx, receiver, "", req)
+}
+
+// openStream opens the stream route of any connector, RemoteFuncStream when route is empty
+func (r *RemoteClient) openStream(ctx context.Context, receiver *StreamReceiver, route string, req proto.Message) (*Stream, error) {
+	message, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	s := receiver.add()
+	open := &protos.StreamOpen{
+		StreamID:      s.id,
+		ReplyServerID: receiver.serverID(),
+		ReplyRoute:    receiver.route,
+		Message:       message,
+		Route:         route,
+	}
+	if err := r.call(ctx, "", OpenStreamRoute, &protos.Response{}, open); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
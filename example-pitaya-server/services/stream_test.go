@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	pcontext "github.com/topfreegames/pitaya/context"
+	e "github.com/topfreegames/pitaya/errors"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+)
+
+// streamRPC delivers the stream rpcs between an in-process connector remote and stream receiver
+func streamRPC(remote *ConnectorRemote, receiver *StreamReceiver) RPCFunc {
+	return func(ctx context.Context, serverID, routeStr string, reply, arg proto.Message) error {
+		var res proto.Message
+		var err error
+		switch routeStr {
+		case OpenStreamRoute:
+			res, err = remote.OpenStream(ctx, arg.(*protos.StreamOpen))
+		case receiver.route:
+			if serverID != receiver.serverID() {
+				return e.NewError(errors.New("server not found"), e.ErrNotFoundCode)
+			}
+			res, err = receiver.Frame(ctx, arg.(*protos.StreamFrame))
+		default:
+			return e.NewError(errors.New("route not found"), e.ErrNotFoundCode)
+		}
+		if err != nil {
+			return err
+		}
+		data, err := proto.Marshal(res)
+		if err != nil {
+			return err
+		}
+		return proto.Unmarshal(data, reply)
+	}
+}
+
+func newTestStream(t *testing.T, msg string) (*Stream, *Connector) {
+	connector := NewConnector(nil)
+	remote := NewConnectorRemote(connector)
+	receiver := NewStreamReceiver("room")
+	receiver.serverID = func() string { return "room-1" }
+	remote.rpc = streamRPC(remote, receiver)
+
+	client := NewRemoteClient(remote.rpc)
+	stream, err := client.StreamRemoteFunc(context.Background(), receiver, &protos.RPCMsg{Msg: msg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stream, connector
+}
+
+func TestStreamRemoteFuncOrdering(t *testing.T) {
+	const frames = 100
+	words := make([]string, frames)
+	for i := range words {
+		words[i] = fmt.Sprintf("frame-%d", i)
+	}
+	stream, _ := newTestStream(t, strings.Join(words, " "))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i := 0; ; i++ {
+		res, err := stream.Recv(ctx)
+		if err == io.EOF {
+			if i != frames {
+				t.Fatalf("expected %d frames, got %d", frames, i)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Msg != words[i] {
+			t.Fatalf("expected frame %d to be %s, got %s", i, words[i], res.Msg)
+		}
+	}
+}
+
+func TestStreamRemoteFuncCallerCloses(t *testing.T) {
+	stream, connector := newTestStream(t, strings.Repeat("frame ", 1000))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := stream.Recv(ctx); err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+
+	// the remote is tracked as in flight until it notices the caller went away
+	if err := connector.drain.wait(ctx); err != nil {
+		t.Fatalf("the remote should stop sending once the stream is closed: %s", err)
+	}
+	if _, err := stream.Recv(ctx); err != ErrStreamClosed {
+		t.Fatalf("expected ErrStreamClosed, got %v", err)
+	}
+}
+
+func TestStreamRemotePanics(t *testing.T) {
+	connector := NewConnector(nil)
+	remote := NewConnectorRemote(connector, WithItems(countRoute, func(ctx context.Context, message []byte) (ItemIterator, error) {
+		return ItemIteratorFunc(func(ctx context.Context) (proto.Message, error) {
+			panic("iterator panicked")
+		}), nil
+	}))
+	receiver := NewStreamReceiver("room")
+	receiver.serverID = func() string { return "room-1" }
+	remote.rpc = streamRPC(remote, receiver)
+
+	stream, err := NewRemoteClient(remote.rpc).StreamItems(context.Background(), receiver, countRoute, &protos.RPCMsg{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := stream.Next(ctx, &protos.Response{}); err == nil || err.Error() != "panic: iterator panicked" {
+		t.Fatalf("expected the stream to end with the panic, got %v", err)
+	}
+	if err := connector.drain.wait(ctx); err != nil {
+		t.Fatalf("the stream should not be in flight anymore: %s", err)
+	}
+}
+
+func TestStreamOutlivesTheOpen(t *testing.T) {
+	connector := NewConnector(nil)
+	remote := NewConnectorRemote(connector)
+	receiver := NewStreamReceiver("room")
+	receiver.serverID = func() string { return "room-1" }
+	frames := streamRPC(remote, receiver)
+	deadlines := make(chan bool, 4*streamBuffer)
+	remote.rpc = func(ctx context.Context, serverID, routeStr string, reply, arg proto.Message) error {
+		_, ok := propagatedDeadline(ctx)
+		deadlines <- ok
+		return frames(ctx, serverID, routeStr, reply, arg)
+	}
+
+	// the open goes through the routes and the middlewares like main, its context is cancelled
+	// once it returns and its deadline passes before the frames are read
+	routes := newTestRoutes()
+	if err := routes.HandleRemote("connectorremote.openstream", remote, "OpenStream"); err != nil {
+		t.Fatal(err)
+	}
+	rpcServer := &fakeRPCServer{}
+	routes.WrapRPCServer(NewPipeline(Deadline(20 * time.Millisecond)).WrapRPCServer(rpcServer)).SetPitayaServer(&countingPitayaServer{})
+
+	total := 3 * streamBuffer
+	message, err := proto.Marshal(&protos.RPCMsg{Msg: strings.Repeat("frame ", total)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := receiver.add()
+	open, err := proto.Marshal(&protos.StreamOpen{
+		StreamID:      stream.id,
+		ReplyServerID: receiver.serverID(),
+		ReplyRoute:    receiver.route,
+		Message:       message,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := pcontext.Encode(WithContentType(context.Background(), ContentTypeProtobuf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := rpcServer.pitayaServer.Call(context.Background(), &pitayaprotos.Request{
+		Type:     pitayaprotos.RPCType_User,
+		Msg:      &pitayaprotos.Msg{Route: OpenStreamRoute, Data: open},
+		Metadata: metadata,
+	})
+	if err != nil || res.Error != nil {
+		t.Fatalf("expected the stream to open, got %v %v", res, err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i := 0; ; i++ {
+		_, err := stream.Recv(ctx)
+		if err == io.EOF {
+			if i != total {
+				t.Fatalf("expected %d frames, got %d", total, i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(deadlines)
+	for propagated := range deadlines {
+		if propagated {
+			t.Fatal("the frames should not carry the deadline of the open")
+		}
+	}
+}
+
+func TestStreamIdle(t *testing.T) {
+	connector := NewConnector(nil)
+	cancelled := make(chan error, 1)
+	remote := NewConnectorRemote(connector, WithItems(countRoute, func(ctx context.Context, message []byte) (ItemIterator, error) {
+		return ItemIteratorFunc(func(ctx context.Context) (proto.Message, error) {
+			<-ctx.Done()
+			cancelled <- ctx.Err()
+			return nil, ctx.Err()
+		}), nil
+	}))
+	remote.streamIdle = 20 * time.Millisecond
+	receiver := NewStreamReceiver("room")
+	receiver.serverID = func() string { return "room-1" }
+	remote.rpc = streamRPC(remote, receiver)
+
+	stream, err := NewRemoteClient(remote.rpc).StreamItems(context.Background(), receiver, countRoute, &protos.RPCMsg{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	// a remote that sends nothing is cancelled at the idle timeout
+	select {
+	case err := <-cancelled:
+		if err != context.Canceled {
+			t.Fatalf("expected the idle stream to be cancelled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the idle stream should have been cancelled")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := connector.drain.wait(ctx); err != nil {
+		t.Fatalf("the idle stream should not be in flight anymore: %s", err)
+	}
+}
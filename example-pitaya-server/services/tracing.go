@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+
+	"github.com/topfreegames/pitaya/cluster"
+	"github.com/topfreegames/pitaya/conn/message"
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+	e "github.com/topfreegames/pitaya/errors"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/route"
+	"github.com/topfreegames/pitaya/session"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attributes of the spans started by this package
+const (
+	// RouteTag is the route called
+	RouteTag = "pitaya.route"
+	// StatusTag is "ok" or the pitaya error code of the answer
+	StatusTag = "pitaya.status"
+	// MessageSizeTag is the size of the message sent to the route
+	MessageSizeTag = "message.size"
+	// ResponseSizeTag is the size of the answer of the route
+	ResponseSizeTag = "response.size"
+)
+
+// tracerName is the name of the tracer of the spans started by this package
+const tracerName = "github.com/leohahn/pitaya-rs/example-pitaya-server/services"
+
+// propagator carries the trace context in the context propagated to the servers called, as
+// the w3c traceparent and tracestate keys
+var propagator = propagation.TraceContext{}
+
+// tracer returns the tracer of the global tracer provider, set by otel.SetTracerProvider.
+// The spans are no-ops while it is not set.
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// propagatedCarrier reads and writes the trace context in the values propagated by ctx
+type propagatedCarrier struct {
+	ctx context.Context
+}
+
+func (c *propagatedCarrier) Get(key string) string {
+	value, _ := pcontext.GetFromPropagateCtx(c.ctx, key).(string)
+	return value
+}
+
+func (c *propagatedCarrier) Set(key, value string) {
+	c.ctx = pcontext.AddToPropagateCtx(c.ctx, key, value)
+}
+
+func (c *propagatedCarrier) Keys() []string {
+	return propagator.Fields()
+}
+
+// extractSpan returns ctx with the span of the caller propagated in it, unless it has a span
+func extractSpan(ctx context.Context) context.Context {
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	return propagator.Extract(ctx, &propagatedCarrier{ctx: ctx})
+}
+
+// injectSpan propagates the span of ctx to the servers called with it, the remotes rebuild
+// their context from the propagated values
+func injectSpan(ctx context.Context) context.Context {
+	carrier := &propagatedCarrier{ctx: ctx}
+	propagator.Inject(ctx, carrier)
+	return carrier.ctx
+}
+
+// endSpan records the outcome of a call answering size bytes in span and ends it
+func endSpan(span trace.Span, size int, err error) {
+	if err != nil {
+		span.SetAttributes(attribute.String(StatusTag, toPitayaError(err).Code))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(attribute.String(StatusTag, "ok"), attribute.Int(ResponseSizeTag, size))
+	}
+	span.End()
+}
+
+// Tracing returns a middleware running the remotes and the handlers in a server span, child of
+// the span of the caller propagated in the context. The span is propagated to the calls made by
+// the remotes.
+func Tracing() MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, in []byte) ([]byte, error) {
+			route, _ := pcontext.GetFromPropagateCtx(ctx, constants.RouteKey).(string)
+			ctx, span := tracer().Start(extractSpan(ctx), route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(attribute.String(RouteTag, route), attribute.Int(MessageSizeTag, len(in))),
+			)
+			out, err := next(injectSpan(ctx), in)
+			endSpan(span, len(out), err)
+			return out, err
+		}
+	}
+}
+
+// TraceRPCClient returns a rpc client making its calls in a client span, child of the span of the
+// context and parent of the span of the server called
+func TraceRPCClient(client cluster.RPCClient) cluster.RPCClient {
+	return &tracingRPCClient{RPCClient: client}
+}
+
+type tracingRPCClient struct {
+	cluster.RPCClient
+}
+
+func (t *tracingRPCClient) Call(
+	ctx context.Context,
+	rpcType pitayaprotos.RPCType,
+	route *route.Route,
+	session *session.Session,
+	msg *message.Message,
+	server *cluster.Server,
+) (*pitayaprotos.Response, error) {
+	ctx, span := tracer().Start(extractSpan(ctx), "rpc "+route.String(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String(RouteTag, route.String()),
+			attribute.Int(MessageSizeTag, len(msg.Data)),
+			attribute.String("peer.id", server.ID),
+			attribute.String("peer.serverType", server.Type),
+		),
+	)
+
+	res, err := t.RPCClient.Call(injectSpan(ctx), rpcType, route, session, msg, server)
+	switch {
+	case err != nil:
+		endSpan(span, 0, err)
+	case res == nil:
+		endSpan(span, 0, nil)
+	case res.Error != nil:
+		endSpan(span, 0, &e.Error{Code: res.Error.Code, Message: res.Error.Msg, Metadata: res.Error.Metadata})
+	default:
+		endSpan(span, len(res.Data), nil)
+	}
+	return res, err
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/topfreegames/pitaya/cluster"
+	"github.com/topfreegames/pitaya/conn/message"
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+	pitayaprotos "github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/route"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// callingPitayaServer answers every call with the answer of client calling route of target
+type callingPitayaServer struct {
+	pitayaprotos.PitayaServer
+	client cluster.RPCClient
+	target *cluster.Server
+	route  *route.Route
+}
+
+func (s *callingPitayaServer) Call(ctx context.Context, req *pitayaprotos.Request) (*pitayaprotos.Response, error) {
+	// the remote service of pitaya rebuilds the context from the metadata
+	ctx, err := pcontext.Decode(req.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	return s.client.Call(ctx, pitayaprotos.RPCType_User, s.route, nil, &message.Message{Data: req.Msg.Data}, s.target)
+}
+
+// useInMemoryExporter sets a global tracer provider exporting the spans to the returned exporter
+func useInMemoryExporter(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		_ = provider.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+// spanAttribute returns the value of the attribute key of span
+func spanAttribute(span tracetest.SpanStub, key string) attribute.Value {
+	for _, kv := range span.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func tracingServer(server pitayaprotos.PitayaServer) *fakeRPCServer {
+	rpcServer := &fakeRPCServer{}
+	NewPipeline(Tracing()).WrapRPCServer(rpcServer).SetPitayaServer(server)
+	return rpcServer
+}
+
+func TestTracingAcrossServers(t *testing.T) {
+	exporter := useInMemoryExporter(t)
+
+	// the connector calls the room, each in its own server
+	room := tracingServer(&echoPitayaServer{})
+	connector := tracingServer(&callingPitayaServer{
+		client: TraceRPCClient(&wireRPCClient{server: room}),
+		target: &cluster.Server{ID: "room-1", Type: "room"},
+		route:  route.NewRoute("room", "room", "join"),
+	})
+
+	ctx := pcontext.AddToPropagateCtx(context.Background(), constants.RouteKey, "connector.connectorremote.remotefunc")
+	metadata, err := pcontext.Encode(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := connector.pitayaServer.Call(context.Background(), &pitayaprotos.Request{
+		Msg:      &pitayaprotos.Msg{Route: "connector.connectorremote.remotefunc", Data: []byte("hello")},
+		Metadata: metadata,
+	})
+	if err != nil || res.Error != nil || string(res.Data) != "hello" {
+		t.Fatalf("expected the echo of the room, got %v and %v", res, err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %v", spans)
+	}
+	// spans end from the innermost
+	roomSpan, clientSpan, connectorSpan := spans[0], spans[1], spans[2]
+	if connectorSpan.Parent.IsValid() || connectorSpan.Name != "connector.connectorremote.remotefunc" {
+		t.Fatalf("expected the root span of the connector, got %v", connectorSpan)
+	}
+	if clientSpan.Parent.SpanID() != connectorSpan.SpanContext.SpanID() || spanAttribute(clientSpan, RouteTag).AsString() != "room.room.join" {
+		t.Fatalf("expected the rpc span to be a child of the connector span, got %v", clientSpan)
+	}
+	if roomSpan.Parent.SpanID() != clientSpan.SpanContext.SpanID() || roomSpan.SpanContext.TraceID() != connectorSpan.SpanContext.TraceID() {
+		t.Fatalf("expected the room span to be a child of the rpc span, got %v", roomSpan)
+	}
+	if !roomSpan.Parent.IsRemote() {
+		t.Fatal("expected the parent of the room span to be propagated in the metadata")
+	}
+	if spanAttribute(roomSpan, RouteTag).AsString() != "room.room.join" || spanAttribute(roomSpan, StatusTag).AsString() != "ok" ||
+		spanAttribute(roomSpan, MessageSizeTag).AsInt64() != 5 || spanAttribute(roomSpan, ResponseSizeTag).AsInt64() != 5 {
+		t.Fatalf("unexpected attributes %v", roomSpan.Attributes)
+	}
+}
+
+func TestTracingErrors(t *testing.T) {
+	exporter := useInMemoryExporter(t)
+	server := tracingServer(notFoundPitayaServer{})
+	ctx := pcontext.AddToPropagateCtx(context.Background(), constants.RouteKey, "room.room.missing")
+	if _, err := server.pitayaServer.Call(ctx, &pitayaprotos.Request{Msg: &pitayaprotos.Msg{Route: "room.room.missing"}}); err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spanAttribute(spans[0], StatusTag).AsString() != "PIT-404" || spans[0].Status.Code != codes.Error {
+		t.Fatalf("expected an error span, got %v", spans)
+	}
+}
+
+// spanPitayaServer records whether a span was propagated to the remote
+type spanPitayaServer struct {
+	pitayaprotos.PitayaServer
+	propagated bool
+}
+
+func (s *spanPitayaServer) Call(ctx context.Context, req *pitayaprotos.Request) (*pitayaprotos.Response, error) {
+	ctx, err := pcontext.Decode(req.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	s.propagated = pcontext.GetFromPropagateCtx(ctx, "traceparent") != nil
+	return &pitayaprotos.Response{}, nil
+}
+
+func TestTracingDisabled(t *testing.T) {
+	remote := &spanPitayaServer{}
+	server := tracingServer(remote)
+	ctx := pcontext.AddToPropagateCtx(context.Background(), constants.RouteKey, "room.room.join")
+	if _, err := server.pitayaServer.Call(ctx, &pitayaprotos.Request{Msg: &pitayaprotos.Msg{Route: "room.room.join"}}); err != nil {
+		t.Fatal(err)
+	}
+	if remote.propagated {
+		t.Fatal("no span should be propagated without tracer provider")
+	}
+
+	useInMemoryExporter(t)
+	if _, err := server.pitayaServer.Call(ctx, &pitayaprotos.Request{Msg: &pitayaprotos.Msg{Route: "room.room.join"}}); err != nil {
+		t.Fatal(err)
+	}
+	if !remote.propagated {
+		t.Fatal("the span should be propagated to the remote service")
+	}
+}
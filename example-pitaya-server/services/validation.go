@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+	e "github.com/topfreegames/pitaya/errors"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// FieldError is a field that failed validation
+type FieldError struct {
+	Field string `json:"field"`
+	Tag   string `json:"tag"`
+	Param string `json:"param,omitempty"`
+}
+
+// ValidationError is returned when a decoded message has invalid fields, it lists all of them
+type ValidationError struct {
+	Route  string
+	Fields []FieldError
+}
+
+func (v *ValidationError) Error() string {
+	fields := make([]string, len(v.Fields))
+	for i, f := range v.Fields {
+		fields[i] = fmt.Sprintf("%s failed %s", f.Field, f.Tag)
+	}
+	return fmt.Sprintf("invalid message for route %s: %s", v.Route, strings.Join(fields, ", "))
+}
+
+// Response converts the error into a response for the client, Msg holds the failing fields as json
+func (v *ValidationError) Response() *protos.Response {
+	fields, _ := json.Marshal(v.Fields)
+	return &protos.Response{
+		Code: 400,
+		Msg:  string(fields),
+	}
+}
+
+// PitayaError converts the error so the failing fields reach the caller on the wire
+func (v *ValidationError) PitayaError() *e.Error {
+	return e.NewError(v, e.ErrBadRequestCode, map[string]string{
+		"route":  v.Route,
+		"fields": v.Response().Msg,
+	})
+}
+
+// Validator validates decoded messages with their `validate` struct tags, only for the routes it was enabled on
+type Validator struct {
+	validate *validator.Validate
+	routes   map[string]bool
+	tagged   sync.Map
+}
+
+// NewValidator returns a new validator enabled on routes
+func NewValidator(routes ...string) *Validator {
+	v := &Validator{
+		validate: validator.New(),
+		routes:   make(map[string]bool, len(routes)),
+	}
+	for _, route := range routes {
+		v.routes[route] = true
+	}
+	return v
+}
+
+// Validate returns a *ValidationError when msg has invalid fields.
+// Messages of routes without validation or of types without tags are not inspected.
+func (v *Validator) Validate(route string, msg interface{}) error {
+	if !v.routes[route] || msg == nil || !v.hasTags(reflect.TypeOf(msg)) {
+		return nil
+	}
+
+	err := v.validate.Struct(msg)
+	errs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return err
+	}
+	verr := &ValidationError{Route: route, Fields: make([]FieldError, len(errs))}
+	for i, fe := range errs {
+		verr.Fields[i] = FieldError{
+			Field: fe.Namespace(),
+			Tag:   fe.Tag(),
+			Param: fe.Param(),
+		}
+	}
+	return verr
+}
+
+// validateMessage is like Validate but returns an error ready to be sent to the caller
+func (v *Validator) validateMessage(route string, msg interface{}) error {
+	if err := v.Validate(route, msg); err != nil {
+		if verr, ok := err.(*ValidationError); ok {
+			return verr.PitayaError()
+		}
+		return e.NewError(err, e.ErrBadRequestCode)
+	}
+	return nil
+}
+
+// BeforeHandler is a pitaya handler pipeline validating the decoded handler argument
+func (v *Validator) BeforeHandler(ctx context.Context, in interface{}) (interface{}, error) {
+	route, _ := pcontext.GetFromPropagateCtx(ctx, constants.RouteKey).(string)
+	if err := v.validateMessage(route, in); err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+// hasTags reports whether t is a struct, or a pointer to one, with validate tags
+func (v *Validator) hasTags(t reflect.Type) bool {
+	if tagged, ok := v.tagged.Load(t); ok {
+		return tagged.(bool)
+	}
+	tagged := structHasTags(t, map[reflect.Type]bool{})
+	v.tagged.Store(t, tagged)
+	return tagged
+}
+
+func structHasTags(t reflect.Type, seen map[reflect.Type]bool) bool {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return false
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if _, ok := field.Tag.Lookup("validate"); ok {
+			return true
+		}
+		if structHasTags(field.Type, seen) {
+			return true
+		}
+	}
+	return false
+}
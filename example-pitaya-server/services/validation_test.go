@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+	e "github.com/topfreegames/pitaya/errors"
+)
+
+type testProfile struct {
+	Country string `validate:"len=2"`
+}
+
+type testJoin struct {
+	Name    string       `validate:"required"`
+	Age     int          `validate:"gte=13,lte=130"`
+	Email   string       `validate:"omitempty,email"`
+	Profile *testProfile `validate:"required"`
+}
+
+func TestValidatorReportsAllFields(t *testing.T) {
+	validator := NewValidator("room.room.join")
+
+	err := validator.Validate("room.room.join", &testJoin{
+		Age:     7,
+		Email:   "not an email",
+		Profile: &testProfile{Country: "BRA"},
+	})
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+
+	expected := []FieldError{
+		{Field: "testJoin.Name", Tag: "required"},
+		{Field: "testJoin.Age", Tag: "gte", Param: "13"},
+		{Field: "testJoin.Email", Tag: "email"},
+		{Field: "testJoin.Profile.Country", Tag: "len", Param: "2"},
+	}
+	if len(verr.Fields) != len(expected) {
+		t.Fatalf("expected %d fields, got %+v", len(expected), verr.Fields)
+	}
+	for i, field := range expected {
+		if verr.Fields[i] != field {
+			t.Fatalf("expected field %d to be %+v, got %+v", i, field, verr.Fields[i])
+		}
+	}
+
+	res := verr.Response()
+	var fields []FieldError
+	if err := json.Unmarshal([]byte(res.Msg), &fields); err != nil {
+		t.Fatal(err)
+	}
+	if res.Code != 400 || len(fields) != len(expected) {
+		t.Fatalf("unexpected response: %v", res)
+	}
+}
+
+func TestValidatorSkipsRoutesAndUntaggedTypes(t *testing.T) {
+	validator := NewValidator("room.room.join")
+
+	if err := validator.Validate("room.room.message", &testJoin{}); err != nil {
+		t.Fatalf("routes without validation should not be validated: %s", err)
+	}
+	if err := validator.Validate("room.room.join", &protos.Response{}); err != nil {
+		t.Fatalf("types without tags should not be validated: %s", err)
+	}
+}
+
+func TestValidatorHandlerPipeline(t *testing.T) {
+	validator := NewValidator("room.room.join")
+	ctx := pcontext.AddToPropagateCtx(context.Background(), constants.RouteKey, "room.room.join")
+
+	_, err := validator.BeforeHandler(ctx, &testJoin{Age: 20})
+	pitayaErr, ok := err.(*e.Error)
+	if !ok || pitayaErr.Code != e.ErrBadRequestCode || pitayaErr.Metadata["fields"] == "" {
+		t.Fatalf("expected a bad request pitaya error, got %#v", err)
+	}
+
+	in := &testJoin{Name: "bob", Age: 20, Profile: &testProfile{Country: "BR"}}
+	if out, err := validator.BeforeHandler(ctx, in); err != nil || out != in {
+		t.Fatalf("valid messages should pass through, got %v %v", out, err)
+	}
+}
@@ -0,0 +1,334 @@
+// Package testkit runs components in memory so their handlers and remotes can be called by route
+// in tests, without nats, etcd or a running pitaya.
+package testkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/topfreegames/pitaya/component"
+	"github.com/topfreegames/pitaya/constants"
+	pcontext "github.com/topfreegames/pitaya/context"
+	e "github.com/topfreegames/pitaya/errors"
+	"github.com/topfreegames/pitaya/route"
+	"github.com/topfreegames/pitaya/serialize"
+	"github.com/topfreegames/pitaya/serialize/protobuf"
+)
+
+var (
+	typeOfContext  = reflect.TypeOf((*context.Context)(nil)).Elem()
+	typeOfBytes    = reflect.TypeOf(([]byte)(nil))
+	typeOfError    = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfProtoMsg = reflect.TypeOf((*proto.Message)(nil)).Elem()
+)
+
+// rpcSerializer encodes the messages and answers of the remotes
+var rpcSerializer = protobuf.NewSerializer()
+
+// ErrRouteNotFound is returned when calling a route no component registered
+var ErrRouteNotFound = errors.New("route not found")
+
+// App holds the components of a server. Handlers and remotes are called like pitaya does, their
+// messages and answers are encoded, and the propagated context goes through the wire encoding.
+type App struct {
+	serializer serialize.Serializer
+	mutex      sync.Mutex
+	components []component.Component
+	handlers   map[string]*method
+	remotes    map[string]*method
+	started    bool
+}
+
+// method is a handler or a remote of a component
+type method struct {
+	receiver reflect.Value
+	fn       reflect.Value
+	// arg is the type of the message, nil for methods without message
+	arg reflect.Type
+}
+
+// Option configures an App
+type Option func(a *App)
+
+// WithSerializer sets the serializer of the messages of the handlers, protobuf by default
+func WithSerializer(serializer serialize.Serializer) Option {
+	return func(a *App) {
+		a.serializer = serializer
+	}
+}
+
+// New returns an empty app
+func New(opts ...Option) *App {
+	a := &App{
+		serializer: protobuf.NewSerializer(),
+		handlers:   make(map[string]*method),
+		remotes:    make(map[string]*method),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Register registers the handlers of c under the routes derived from its name and methods
+func (a *App) Register(c component.Component, options ...component.Option) error {
+	s := component.NewService(c, options)
+	if err := s.ExtractHandler(); err != nil {
+		return err
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for name, h := range s.Handlers {
+		m := &method{receiver: h.Receiver, fn: h.Method.Func}
+		if h.Type != nil {
+			m.arg = h.Type
+		}
+		a.handlers[s.Name+"."+name] = m
+	}
+	a.add(c)
+	return nil
+}
+
+// RegisterRemote registers the remotes of c under the routes derived from its name and methods
+func (a *App) RegisterRemote(c component.Component, options ...component.Option) error {
+	s := component.NewService(c, options)
+	if err := s.ExtractRemote(); err != nil {
+		return err
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for name, r := range s.Remotes {
+		m := &method{receiver: r.Receiver, fn: r.Method.Func}
+		if r.HasArgs {
+			m.arg = r.Type
+		}
+		a.remotes[s.Name+"."+name] = m
+	}
+	a.add(c)
+	return nil
+}
+
+// HandleRemote serves method of c under rt, "service.method", like services.Routes.HandleRemote
+func (a *App) HandleRemote(rt string, c component.Component, name string) error {
+	fn, ok := reflect.TypeOf(c).MethodByName(name)
+	if !ok {
+		return fmt.Errorf("%T has no method %s", c, name)
+	}
+	mt := fn.Type
+	if mt.NumIn() != 3 || mt.In(1) != typeOfContext || mt.NumOut() != 2 || mt.Out(1) != typeOfError ||
+		mt.In(2) != typeOfBytes && !mt.In(2).Implements(typeOfProtoMsg) {
+		return fmt.Errorf("%T.%s is not a remote method", c, name)
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.remotes[rt] = &method{receiver: reflect.ValueOf(c), fn: fn.Func, arg: mt.In(2)}
+	a.add(c)
+	return nil
+}
+
+// add keeps c to run its lifecycle, it must be called with the mutex held
+func (a *App) add(c component.Component) {
+	for _, other := range a.components {
+		if other == c {
+			return
+		}
+	}
+	a.components = append(a.components, c)
+	if a.started {
+		c.Init()
+		c.AfterInit()
+	}
+}
+
+// Start runs Init and AfterInit of the components, like pitaya does when starting.
+// Components registered later are started when registered.
+func (a *App) Start() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.started {
+		return
+	}
+	a.started = true
+	for _, c := range a.components {
+		c.Init()
+	}
+	for _, c := range a.components {
+		c.AfterInit()
+	}
+}
+
+// Stop runs BeforeShutdown and Shutdown of the components, like pitaya does when stopping
+func (a *App) Stop() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if !a.started {
+		return
+	}
+	a.started = false
+	for _, c := range a.components {
+		c.BeforeShutdown()
+	}
+	for _, c := range a.components {
+		c.Shutdown()
+	}
+}
+
+// Call calls the remote at rt, "service.method" with an optional server type, with arg, either a
+// proto message or an encoded one, decoding its answer into reply. ctx is propagated like rpcs do.
+// Errors are the ones the caller receives from the wire, *errors.Error of pitaya.
+func (a *App) Call(ctx context.Context, rt string, reply proto.Message, arg interface{}) error {
+	m, err := a.lookup(a.remotes, rt)
+	if err != nil {
+		return err
+	}
+	data, err := encode(arg, rpcSerializer.Marshal)
+	if err != nil {
+		return err
+	}
+	ctx, err = propagate(ctx)
+	if err != nil {
+		return err
+	}
+	ctx = pcontext.AddToPropagateCtx(ctx, constants.RouteKey, rt)
+	out, err := m.call(ctx, data, rpcSerializer.Unmarshal)
+	if err != nil {
+		return err
+	}
+	return decodeAnswer(out, reply, rpcSerializer.Marshal, rpcSerializer.Unmarshal)
+}
+
+// Request calls the handler at rt for s with arg, either a message or an encoded one, decoding its
+// answer into reply. Errors are the ones the client receives, *errors.Error of pitaya.
+func (a *App) Request(ctx context.Context, s *Session, rt string, reply interface{}, arg interface{}) error {
+	out, err := a.handle(ctx, s, rt, arg)
+	if err != nil {
+		return err
+	}
+	return decodeAnswer(out, reply, a.serializer.Marshal, a.serializer.Unmarshal)
+}
+
+// Notify calls the handler at rt for s with arg without waiting for an answer, like a client notify
+func (a *App) Notify(ctx context.Context, s *Session, rt string, arg interface{}) error {
+	_, err := a.handle(ctx, s, rt, arg)
+	return err
+}
+
+func (a *App) handle(ctx context.Context, s *Session, rt string, arg interface{}) (interface{}, error) {
+	m, err := a.lookup(a.handlers, rt)
+	if err != nil {
+		return nil, err
+	}
+	data, err := encode(arg, a.serializer.Marshal)
+	if err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, constants.SessionCtxKey, s.Session)
+	ctx = pcontext.AddToPropagateCtx(ctx, constants.RouteKey, rt)
+	return m.call(ctx, data, a.serializer.Unmarshal)
+}
+
+func (a *App) lookup(methods map[string]*method, rt string) (*method, error) {
+	parsed, err := route.Decode(rt)
+	if err != nil {
+		return nil, err
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	m, ok := methods[parsed.Short()]
+	if !ok {
+		return nil, wireError(fmt.Errorf("%w: %s", ErrRouteNotFound, rt))
+	}
+	return m, nil
+}
+
+// call decodes data into the message of the method and calls it
+func (m *method) call(ctx context.Context, data []byte, unmarshal func(data []byte, v interface{}) error) (interface{}, error) {
+	in := []reflect.Value{m.receiver, reflect.ValueOf(ctx)}
+	switch {
+	case m.arg == nil:
+	case m.arg == typeOfBytes:
+		in = append(in, reflect.ValueOf(data))
+	default:
+		arg := reflect.New(m.arg.Elem())
+		if err := unmarshal(data, arg.Interface()); err != nil {
+			return nil, wireError(err)
+		}
+		in = append(in, arg)
+	}
+
+	out := m.fn.Call(in)
+	if len(out) == 0 {
+		return nil, nil
+	}
+	if err, _ := out[1].Interface().(error); err != nil {
+		return nil, wireError(err)
+	}
+	return out[0].Interface(), nil
+}
+
+// encode returns arg encoded with marshal, arg is returned as is when already encoded
+func encode(arg interface{}, marshal func(v interface{}) ([]byte, error)) ([]byte, error) {
+	switch arg := arg.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return arg, nil
+	}
+	return marshal(arg)
+}
+
+// decodeAnswer encodes out and decodes it into reply, so reply is what goes through the wire
+func decodeAnswer(
+	out, reply interface{},
+	marshal func(v interface{}) ([]byte, error),
+	unmarshal func(data []byte, v interface{}) error,
+) error {
+	if reply == nil || out == nil {
+		return nil
+	}
+	data, err := encode(out, func(v interface{}) ([]byte, error) {
+		if msg, ok := v.(proto.Message); ok {
+			return proto.Marshal(msg)
+		}
+		return marshal(v)
+	})
+	if err != nil {
+		return err
+	}
+	if raw, ok := reply.(*[]byte); ok {
+		*raw = data
+		return nil
+	}
+	return unmarshal(data, reply)
+}
+
+// propagate returns the context the callee of a rpc gets from ctx
+func propagate(ctx context.Context) (context.Context, error) {
+	encoded, err := pcontext.Encode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := pcontext.Decode(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if decoded == nil {
+		return context.Background(), nil
+	}
+	return decoded, nil
+}
+
+// wireError converts err into the error the caller receives, like the pipeline of services does
+func wireError(err error) error {
+	switch err := err.(type) {
+	case *e.Error:
+		return err
+	case interface{ PitayaError() *e.Error }:
+		return err.PitayaError()
+	}
+	return e.NewError(err, e.ErrUnknownCode)
+}
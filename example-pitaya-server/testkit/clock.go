@@ -0,0 +1,107 @@
+package testkit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/services"
+)
+
+// FakeClock is a services.Clock that only moves when advanced, the timers due fire during Advance
+type FakeClock struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	timers  []*fakeTimer
+	started int
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	at    time.Time
+	ch    chan time.Time
+}
+
+// NewFakeClock returns a fake clock at now
+func NewFakeClock(now time.Time) *FakeClock {
+	f := &FakeClock{now: now}
+	f.cond = sync.NewCond(&f.mutex)
+	return f
+}
+
+// Now returns the time of the clock
+func (f *FakeClock) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+// After returns a channel receiving the time once the clock is advanced by d
+func (f *FakeClock) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// NewTimer returns a timer firing once the clock is advanced by d
+func (f *FakeClock) NewTimer(d time.Duration) services.Timer {
+	timer := &fakeTimer{clock: f, ch: make(chan time.Time, 1)}
+	timer.Reset(d)
+	return timer
+}
+
+// Advance moves the clock by d, firing the timers that are due
+func (f *FakeClock) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.now = f.now.Add(d)
+	pending := f.timers[:0]
+	for _, timer := range f.timers {
+		if timer.at.After(f.now) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.ch <- f.now
+	}
+	f.timers = pending
+}
+
+// BlockUntil waits for n timers to have been started on the clock since it was created, so a
+// test can advance it once the goroutine it drives is waiting
+func (f *FakeClock) BlockUntil(n int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for f.started < n {
+		f.cond.Wait()
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	return t.stop()
+}
+
+// stop removes the timer from the clock, it must be called with the mutex of the clock held
+func (t *fakeTimer) stop() bool {
+	for i, timer := range t.clock.timers {
+		if timer == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	active := t.stop()
+	t.at = t.clock.now.Add(d)
+	t.clock.timers = append(t.clock.timers, t)
+	t.clock.started++
+	t.clock.cond.Broadcast()
+	return active
+}
@@ -0,0 +1,59 @@
+package testkit_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/services"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/testkit"
+	"github.com/topfreegames/pitaya/acceptor"
+	"github.com/topfreegames/pitaya/conn/packet"
+)
+
+// pipeConn is the server side of a net.Pipe, reading a message per read
+type pipeConn struct {
+	net.Conn
+}
+
+func (p pipeConn) GetNextMessage() ([]byte, error) {
+	b := make([]byte, 1024)
+	n, err := p.Read(b)
+	return b[:n], err
+}
+
+// pipeAcceptor accepts the connections sent on conns
+type pipeAcceptor struct {
+	conns chan acceptor.PlayerConn
+}
+
+func (a pipeAcceptor) ListenAndServe()                       {}
+func (a pipeAcceptor) Stop()                                 {}
+func (a pipeAcceptor) GetAddr() string                       { return "pipe" }
+func (a pipeAcceptor) GetConnChan() chan acceptor.PlayerConn { return a.conns }
+
+func TestFakeClockIdleTimeout(t *testing.T) {
+	clock := testkit.NewFakeClock(time.Unix(0, 0))
+	connector := services.NewConnector(nil, services.WithIdleTimeout(30*time.Second, 10*time.Second), services.WithClock(clock))
+	server, client := net.Pipe()
+	defer client.Close()
+	accepted := pipeAcceptor{conns: make(chan acceptor.PlayerConn, 1)}
+	accepted.conns <- pipeConn{server}
+	conn := <-connector.WrapAcceptor(accepted).GetConnChan()
+
+	// the connection is pinged once idle for the timeout
+	clock.BlockUntil(1)
+	clock.Advance(30 * time.Second)
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	ping := make([]byte, 16)
+	if n, err := client.Read(ping); err != nil || n == 0 || packet.Type(ping[0]) != packet.Heartbeat {
+		t.Fatalf("expected a ping, got %v %v", ping[:n], err)
+	}
+
+	// and closed when the client didn't answer within the grace
+	clock.BlockUntil(2)
+	clock.Advance(10 * time.Second)
+	if _, err := conn.GetNextMessage(); err != services.ErrIdleTimeout {
+		t.Fatalf("expected the idle timeout, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package testkit_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/protos"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/services"
+	"github.com/leohahn/pitaya-rs/example-pitaya-server/testkit"
+	"github.com/topfreegames/pitaya/component"
+	e "github.com/topfreegames/pitaya/errors"
+)
+
+// tokenAuthenticator authenticates the token "token-<uid>"
+type tokenAuthenticator struct{}
+
+func (tokenAuthenticator) Authenticate(ctx context.Context, token string) (string, map[string]interface{}, error) {
+	if len(token) <= len("token-") || token[:len("token-")] != "token-" {
+		return "", nil, services.ErrUnauthenticated
+	}
+	uid := token[len("token-"):]
+	return uid, map[string]interface{}{"sub": uid}, nil
+}
+
+// newConnectorApp returns a started app with a connector and its remote, like the connector of main
+func newConnectorApp(t *testing.T, store services.SessionStore, opts ...services.RemoteOption) (*testkit.App, *services.Connector) {
+	connector := services.NewConnector(store, services.WithAuthenticator(tokenAuthenticator{}))
+	app := testkit.New()
+	if err := app.Register(connector, component.WithName("connector"), component.WithNameFunc(strings.ToLower)); err != nil {
+		t.Fatal(err)
+	}
+	remote := services.NewConnectorRemote(connector, opts...)
+	if err := app.RegisterRemote(remote, component.WithName("connectorremote"), component.WithNameFunc(strings.ToLower)); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.HandleRemote("connectorremote.remotefunc", remote, "RemoteFuncBytes"); err != nil {
+		t.Fatal(err)
+	}
+	app.Start()
+	t.Cleanup(app.Stop)
+	return app, connector
+}
+
+func TestRemoteFunc(t *testing.T) {
+	app, _ := newConnectorApp(t, nil)
+
+	res := &protos.Response{}
+	ctx := services.WithContentType(context.Background(), services.ContentTypeJSON)
+	if err := app.Call(ctx, services.RemoteFuncRoute, res, []byte(`{"msg":"hello"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if res.Msg != `{"msg":"hello"}` {
+		t.Fatalf("json messages should be echoed back, got %q", res.Msg)
+	}
+
+	res = &protos.Response{}
+	ctx = services.WithContentType(context.Background(), services.ContentTypeProtobuf)
+	if err := app.Call(ctx, services.RemoteFuncRoute, res, &protos.RPCMsg{Msg: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if res.Code != 200 || res.Msg != "hello" {
+		t.Fatalf("unexpected response %v", res)
+	}
+
+	data, err := proto.Marshal(&protos.RPCMsg{Msg: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.Call(services.WithContentType(context.Background(), "xml"), services.RemoteFuncRoute, res, data)
+	var pitayaErr *e.Error
+	if !errors.As(err, &pitayaErr) || pitayaErr.Code != e.ErrBadRequestCode {
+		t.Fatalf("expected a bad request, got %v", err)
+	}
+}
+
+func TestRemoteFuncValidation(t *testing.T) {
+	app, _ := newConnectorApp(t, nil, services.WithValidator(services.NewValidator(services.RemoteFuncRoute)))
+	ctx := services.WithContentType(context.Background(), services.ContentTypeProtobuf)
+
+	res := &protos.Response{}
+	err := app.Call(ctx, services.RemoteFuncRoute, res, &protos.RPCMsg{Msg: strings.Repeat("a", 1025)})
+	var pitayaErr *e.Error
+	if !errors.As(err, &pitayaErr) || pitayaErr.Code != e.ErrBadRequestCode {
+		t.Fatalf("expected a bad request, got %v", err)
+	}
+	if fields := pitayaErr.Metadata["fields"]; !strings.Contains(fields, "RPCMsg.Msg") || !strings.Contains(fields, "max") {
+		t.Fatalf("expected the failing field to reach the caller, got %q", fields)
+	}
+
+	if err := app.Call(ctx, services.RemoteFuncRoute, res, &protos.RPCMsg{Msg: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	app, _ := newConnectorApp(t, nil)
+
+	s := app.NewSession()
+	res := &protos.Response{}
+	err := app.Request(context.Background(), s, "connector.auth", res, &protos.AuthRequest{Token: "invalid"})
+	var pitayaErr *e.Error
+	if !errors.As(err, &pitayaErr) || pitayaErr.Code != services.ErrUnauthenticatedCode || s.UID() != "" {
+		t.Fatalf("expected the session to stay unauthenticated, got %v", err)
+	}
+
+	if err := app.Request(context.Background(), s, "connector.auth", res, &protos.AuthRequest{Token: "token-alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if res.Msg != "alice" || s.UID() != "alice" {
+		t.Fatalf("expected the session to be bound to alice, got %q", s.UID())
+	}
+	claims, _ := s.Get(services.ClaimsKey).(map[string]interface{})
+	if claims["sub"] != "alice" {
+		t.Fatalf("expected the claims in the session data, got %v", s.GetData())
+	}
+	s.Disconnect()
+}
+
+func TestSessionDataRestored(t *testing.T) {
+	store := services.NewMemorySessionStore(time.Minute)
+	app, _ := newConnectorApp(t, store)
+
+	s, err := app.Connect("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("level", "7"); err != nil {
+		t.Fatal(err)
+	}
+	s.Disconnect()
+	if !s.Closed() {
+		t.Fatal("the session should be closed")
+	}
+	stored, err := store.Get(context.Background(), "alice")
+	if err != nil || stored.Data["level"] != "7" {
+		t.Fatalf("expected the session data to be persisted, got %v and %v", stored, err)
+	}
+
+	s, err = app.Connect("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Disconnect()
+	if s.Get("level") != "7" {
+		t.Fatalf("expected the session data to be restored, got %v", s.GetData())
+	}
+}
+
+func TestPushes(t *testing.T) {
+	app, connector := newConnectorApp(t, services.NewMemorySessionStore(time.Minute))
+
+	alice, err := app.Connect("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alice.Disconnect()
+	bob, err := app.Connect("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bob.Disconnect()
+
+	data, err := proto.Marshal(&protos.Response{Code: 200, Msg: "hi alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := connector.Push("alice", "onMessage", data); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := connector.Group(context.Background(), "room")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Add("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Add("bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Broadcast(context.Background(), "onNews", &protos.Response{Code: 200, Msg: "news"}); err != nil {
+		t.Fatal(err)
+	}
+
+	pushes := alice.Pushes()
+	if len(pushes) != 2 || pushes[0].Route != "onMessage" || pushes[1].Route != "onNews" {
+		t.Fatalf("unexpected pushes to alice %v", pushes)
+	}
+	msg := &protos.Response{}
+	if err := pushes[0].Decode(msg); err != nil || msg.Msg != "hi alice" {
+		t.Fatalf("unexpected push %v, %v", msg, err)
+	}
+	if pushes := bob.Pushes(); len(pushes) != 1 || pushes[0].Route != "onNews" {
+		t.Fatalf("unexpected pushes to bob %v", pushes)
+	}
+
+	bob.Disconnect()
+	if err := connector.Push("bob", "onMessage", data); !errors.Is(err, services.ErrSessionGone) {
+		t.Fatalf("expected ErrSessionGone, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package testkit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/topfreegames/pitaya/constants"
+	"github.com/topfreegames/pitaya/protos"
+	"github.com/topfreegames/pitaya/session"
+)
+
+// ErrNoRemote is returned by the sessions asked to send requests, they are not connected to servers
+var ErrNoRemote = errors.New("testkit sessions don't send requests")
+
+var lastPort int32
+
+// Push is a message pushed to a session
+type Push struct {
+	Route string
+	// Message is the pushed message, as the session received it
+	Message interface{}
+}
+
+// Decode decodes the message of the push, sent already serialized or as a proto message, into v
+func (p Push) Decode(v proto.Message) error {
+	switch msg := p.Message.(type) {
+	case []byte:
+		return proto.Unmarshal(msg, v)
+	case proto.Message:
+		data, err := proto.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		return proto.Unmarshal(data, v)
+	}
+	return errors.New("the pushed message is not a proto message")
+}
+
+// Session is a frontend session connected to a fake client that records what it receives
+type Session struct {
+	*session.Session
+	entity *entity
+}
+
+// NewSession returns a session not bound to an uid yet
+func (a *App) NewSession() *Session {
+	en := &entity{
+		addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: int(atomic.AddInt32(&lastPort, 1))},
+	}
+	return &Session{Session: session.New(en, true), entity: en}
+}
+
+// Connect returns a session bound to uid, running the bind callbacks of the connectors like a
+// client authenticating does
+func (a *App) Connect(uid string) (*Session, error) {
+	s := a.NewSession()
+	if err := s.Bind(context.Background(), uid); err != nil {
+		s.Session.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Pushes returns the messages pushed to the session, oldest first
+func (s *Session) Pushes() []Push {
+	s.entity.mutex.Lock()
+	defer s.entity.mutex.Unlock()
+	return append([]Push(nil), s.entity.pushes...)
+}
+
+// Kicked returns whether the session was kicked
+func (s *Session) Kicked() bool {
+	s.entity.mutex.Lock()
+	defer s.entity.mutex.Unlock()
+	return s.entity.kicked
+}
+
+// Closed returns whether the connection of the session was closed
+func (s *Session) Closed() bool {
+	s.entity.mutex.Lock()
+	defer s.entity.mutex.Unlock()
+	return s.entity.closed
+}
+
+// Disconnect closes the session like the client disconnecting does, running its close callbacks
+// and the ones of the connectors. Disconnecting a closed session does nothing.
+func (s *Session) Disconnect() {
+	if s.Closed() {
+		return
+	}
+	for _, f := range s.OnCloseCallbacks {
+		f()
+	}
+	for _, f := range session.SessionCloseCallbacks {
+		f(s.Session)
+	}
+	s.Close()
+}
+
+// entity is the connection of a session
+type entity struct {
+	addr   net.Addr
+	mutex  sync.Mutex
+	pushes []Push
+	kicked bool
+	closed bool
+}
+
+func (en *entity) Push(route string, v interface{}) error {
+	en.mutex.Lock()
+	defer en.mutex.Unlock()
+	if en.closed {
+		return constants.ErrBrokenPipe
+	}
+	en.pushes = append(en.pushes, Push{Route: route, Message: v})
+	return nil
+}
+
+func (en *entity) ResponseMID(ctx context.Context, mid uint, v interface{}, isError ...bool) error {
+	return nil
+}
+
+func (en *entity) Close() error {
+	en.mutex.Lock()
+	defer en.mutex.Unlock()
+	en.closed = true
+	return nil
+}
+
+func (en *entity) Kick(ctx context.Context) error {
+	en.mutex.Lock()
+	defer en.mutex.Unlock()
+	en.kicked = true
+	return nil
+}
+
+func (en *entity) RemoteAddr() net.Addr {
+	return en.addr
+}
+
+func (en *entity) SendRequest(ctx context.Context, serverID, route string, v interface{}) (*protos.Response, error) {
+	return nil, ErrNoRemote
+}
@@ -9,6 +9,7 @@ extern crate serde;
 extern crate serde_json;
 
 mod discovery;
+mod remotes;
 mod rpc;
 mod utils;
 
@@ -16,6 +17,11 @@ mod protos {
     include!(concat!(env!("OUT_DIR"), "/protos.rs"));
 }
 
+// The protos of the example server are in a package also named protos.
+mod example_protos {
+    include!(concat!(env!("OUT_DIR"), "/example/protos.rs"));
+}
+
 use serde::{Serialize, Deserialize};
 use std::collections::HashMap;
 
@@ -28,6 +34,7 @@ enum Error {
     Nats(std::io::Error),
     Etcd(etcd_client::Error),
     Json(serde_json::Error),
+    Remote { code: String, msg: String },
 }
 
 impl std::fmt::Display for Error {
@@ -39,6 +46,7 @@ impl std::fmt::Display for Error {
             Error::Nats(ref e) => write!(f, "nats: {}", e),
             Error::Etcd(ref e) => write!(f, "etcd: {}", e),
             Error::Json(ref e) => write!(f, "json: {}", e),
+            Error::Remote { ref code, ref msg } => write!(f, "remote: {}: {}", code, msg),
         }
     }
 }
@@ -52,6 +60,7 @@ impl std::error::Error for Error {
             Error::Nats(ref e) => Some(e),
             Error::Etcd(ref e) => Some(e),
             Error::Json(ref e) => Some(e),
+            Error::Remote { .. } => None,
         }
     }
 }
@@ -0,0 +1,45 @@
+// Code generated by example-pitaya-server -rustbindings. DO NOT EDIT.
+
+use super::rpc::{call_remote, Client};
+use super::{Error, Server};
+use prost::Message;
+
+/// Calls ConnectorRemote.RemoteFuncBytes at connector.connectorremote.remotefunc.
+pub(crate) async fn connector_connectorremote_remotefunc(
+    client: &impl Client,
+    target: &Server,
+    message: &[u8],
+) -> Result<crate::example_protos::BytesResponse, Error> {
+    let data = call_remote(client, target, "connector.connectorremote.remotefunc", message.to_vec())?;
+    Ok(crate::example_protos::BytesResponse::decode(data.as_ref())?)
+}
+
+/// Calls Room.Entry at room.room.entry.
+pub(crate) async fn room_room_entry(
+    client: &impl Client,
+    target: &Server,
+) -> Result<crate::example_protos::Response, Error> {
+    let data = call_remote(client, target, "room.room.entry", Vec::new())?;
+    Ok(crate::example_protos::Response::decode(data.as_ref())?)
+}
+
+/// Calls Room.Join at room.room.join.
+pub(crate) async fn room_room_join(
+    client: &impl Client,
+    target: &Server,
+) -> Result<crate::example_protos::Response, Error> {
+    let data = call_remote(client, target, "room.room.join", Vec::new())?;
+    Ok(crate::example_protos::Response::decode(data.as_ref())?)
+}
+
+/// Calls Room.StreamRPC at room.room.streamrpc.
+pub(crate) async fn room_room_streamrpc(
+    client: &impl Client,
+    target: &Server,
+    message: &crate::example_protos::RpcMsg,
+) -> Result<crate::example_protos::Response, Error> {
+    let mut data = Vec::with_capacity(message.encoded_len());
+    message.encode(&mut data)?;
+    let data = call_remote(client, target, "room.room.streamrpc", data)?;
+    Ok(crate::example_protos::Response::decode(data.as_ref())?)
+}
@@ -2,10 +2,40 @@ use super::{protos, utils, Error, Server, ServerId, ServerKind};
 use prost::Message;
 use std::time::Duration;
 
-trait Client {
+pub(crate) trait Client {
     fn call(&self, target: &Server, req: protos::Request) -> Result<protos::Response, Error>;
 }
 
+// Calls the remote at route of target with data, the error answered by the remote is returned as Error::Remote.
+pub(crate) fn call_remote(
+    client: &impl Client,
+    target: &Server,
+    route: &str,
+    data: Vec<u8>,
+) -> Result<Vec<u8>, Error> {
+    let response = client.call(
+        target,
+        protos::Request {
+            r#type: protos::RpcType::User as i32,
+            msg: Some(protos::Msg {
+                r#type: protos::MsgType::MsgRequest as i32,
+                data: data,
+                route: route.to_owned(),
+                ..protos::Msg::default()
+            }),
+            ..protos::Request::default()
+        },
+    )?;
+
+    if let Some(err) = response.error {
+        return Err(Error::Remote {
+            code: err.code,
+            msg: err.msg,
+        });
+    }
+    Ok(response.data)
+}
+
 struct NatsClientBuilder {
     pub address: String,
     pub connection_timeout: Duration,